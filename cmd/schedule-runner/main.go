@@ -0,0 +1,56 @@
+// Скрипт для создания запланированных транзакций.
+// Запускается по крону, например:
+//
+//	10 0 * * * /path/to/schedule-runner
+//
+// Использует переменные окружения (те же, что и основной сервер):
+//
+//	DATABASE_DSN — строка подключения к MariaDB (с parseTime=true)
+//
+// Для каждого включённого расписания создаёт транзакции (режим auto) или
+// напоминания (режим remind) за все наступившие даты, которые ещё не
+// обработаны. Повторный запуск в тот же день ничего не дублирует, а
+// пропущенные запуски (сервер был выключен) догоняются при следующем.
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/config"
+	"github.com/evbogdanov/finforme/internal/schedule"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	cfg := config.Load()
+
+	db, err := sql.Open("mysql", cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	log.Println("Running scheduled transactions...")
+	report, err := schedule.Run(db, 0, time.Now())
+	if err != nil {
+		log.Printf("ERROR running schedules: %v", err)
+		os.Exit(1)
+	}
+
+	for _, e := range report.Errors {
+		log.Printf("ERROR %v", e)
+	}
+	log.Printf("Created %d transactions, %d reminders", report.Created, report.Reminders)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+	log.Println("Done successfully")
+}
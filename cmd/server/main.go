@@ -79,11 +79,21 @@ func main() {
 	r.HandleFunc("/finance/", h.RequireAuth(h.FinanceIndex)).Methods("GET")
 	r.HandleFunc("/finance/account/new", h.RequireAuth(h.FinanceAccountEdit)).Methods("GET")
 	r.HandleFunc("/finance/account/{id}/edit", h.RequireAuth(h.FinanceAccountEdit)).Methods("GET")
+	r.HandleFunc("/finance/account/{id}/reconcile", h.RequireAuth(h.FinanceAccountReconcile)).Methods("GET")
 	r.HandleFunc("/finance/account/{id}", h.RequireAuth(h.FinanceAccountView)).Methods("GET")
 	r.HandleFunc("/finance/transaction/{account_id}/", h.RequireAuth(h.FinanceTransaction)).Methods("GET")
 	r.HandleFunc("/finance/transaction/{account_id}/{tx_id}", h.RequireAuth(h.FinanceTransaction)).Methods("GET")
+	r.HandleFunc("/finance/tags", h.RequireAuth(h.FinanceTags)).Methods("GET")
 	r.HandleFunc("/finance/tag/{tag}", h.RequireAuth(h.FinanceTransactionsByTag)).Methods("GET")
+	r.HandleFunc("/finance/search", h.RequireAuth(h.FinanceTransactionSearch)).Methods("GET")
 	r.HandleFunc("/finance/settings", h.RequireAuth(h.FinanceSettings)).Methods("GET")
+	r.HandleFunc("/finance/import/csv", h.RequireAuth(h.FinanceImportCSV)).Methods("GET")
+	r.HandleFunc("/finance/import/ofx", h.RequireAuth(h.FinanceImportOFX)).Methods("GET")
+	r.HandleFunc("/finance/scheduled", h.RequireAuth(h.FinanceScheduled)).Methods("GET")
+	r.HandleFunc("/finance/budget", h.RequireAuth(h.FinanceBudget)).Methods("GET")
+	r.HandleFunc("/finance/reports/income-statement", h.RequireAuth(h.FinanceIncomeStatement)).Methods("GET")
+	r.HandleFunc("/finance/reports/balance-sheet", h.RequireAuth(h.FinanceBalanceSheet)).Methods("GET")
+	r.HandleFunc("/finance/reports/tags", h.RequireAuth(h.FinanceTagReport)).Methods("GET")
 
 	// Админка
 	r.HandleFunc("/admin/", h.RequireAdmin(h.AdminIndex)).Methods("GET")
@@ -102,18 +112,46 @@ func main() {
 	api.HandleFunc("/finance/account/save", h.APIAccountSave).Methods("POST")
 	api.HandleFunc("/finance/account/form", h.APIAccountFormGet).Methods("GET")
 	api.HandleFunc("/finance/account/delete", h.APIAccountDelete).Methods("DELETE")
+	api.HandleFunc("/finance/account/delete/form", h.APIAccountDeleteFormGet).Methods("GET")
+	api.HandleFunc("/finance/account/move", h.APIAccountMove).Methods("POST")
+	api.HandleFunc("/finance/account/merge", h.APIAccountMerge).Methods("POST")
+	api.HandleFunc("/finance/account/reconcile", h.APIAccountReconcile).Methods("POST")
+	api.HandleFunc("/finance/account/{id}/history", h.APIAccountHistory).Methods("GET")
 	api.HandleFunc("/finance/transactions/get", h.APITransactionsGet).Methods("GET")
+	api.HandleFunc("/finance/transactions/table", h.APITransactionSearchTableGet).Methods("GET")
 	api.HandleFunc("/finance/transaction/save", h.APITransactionSave).Methods("POST")
 	api.HandleFunc("/finance/transaction/form", h.APITransactionFormGet).Methods("GET")
 	api.HandleFunc("/finance/transaction/table", h.APITransactionTableGet).Methods("GET")
 	api.HandleFunc("/finance/transaction/delete", h.APITransactionDelete).Methods("DELETE")
+	api.HandleFunc("/finance/tags/get", h.APITagsGet).Methods("GET")
+	api.HandleFunc("/finance/tag/save", h.APITagSave).Methods("POST")
+	api.HandleFunc("/finance/tag/merge", h.APITagMerge).Methods("POST")
+	api.HandleFunc("/finance/tag/delete", h.APITagDelete).Methods("DELETE")
+	api.HandleFunc("/finance/scheduled/save", h.APIScheduledSave).Methods("POST")
+	api.HandleFunc("/finance/scheduled/delete", h.APIScheduledDelete).Methods("DELETE")
+	api.HandleFunc("/finance/scheduled/run", h.APIScheduledRun).Methods("POST")
+	api.HandleFunc("/finance/scheduled/occurrence", h.APIScheduledOccurrence).Methods("POST")
+	api.HandleFunc("/finance/scheduled/reviewed", h.APIScheduledReviewed).Methods("POST")
+	api.HandleFunc("/finance/budget/save", h.APIBudgetSave).Methods("POST")
+	api.HandleFunc("/finance/budget/copy", h.APIBudgetCopy).Methods("POST")
+	api.HandleFunc("/finance/reports/income-statement", h.APIIncomeStatement).Methods("GET")
+	api.HandleFunc("/finance/reports/balance-sheet", h.APIBalanceSheet).Methods("GET")
+	api.HandleFunc("/finance/reports/tags", h.APITagReport).Methods("GET")
 	api.HandleFunc("/finance/export/json", h.APIExportJSON).Methods("GET")
+	api.HandleFunc("/finance/settings/reporting-currency", h.APISettingsReportingCurrency).Methods("POST")
 	api.HandleFunc("/finance/delete", h.APIDataDelete).Methods("DELETE")
 	api.HandleFunc("/finance/welcome/createempty", h.APIWelcomeCreateEmpty).Methods("POST")
 	api.HandleFunc("/finance/welcome/createbase", h.APIWelcomeCreateBase).Methods("POST")
 	api.HandleFunc("/finance/welcome/importjson", h.APIImportJSON).Methods("POST")
 	api.HandleFunc("/finance/welcome/import", h.APIImportGnuCash).Methods("POST")
 	api.HandleFunc("/finance/welcome/importxml", h.APIImportGnuCashXML).Methods("POST")
+	api.HandleFunc("/finance/import/csv/preview", h.APICSVImportPreview).Methods("POST")
+	api.HandleFunc("/finance/import/csv", h.APICSVImport).Methods("POST")
+	api.HandleFunc("/finance/import/profiles/get", h.APICSVProfilesGet).Methods("GET")
+	api.HandleFunc("/finance/import/profile/save", h.APICSVProfileSave).Methods("POST")
+	api.HandleFunc("/finance/import/profile/delete", h.APICSVProfileDelete).Methods("DELETE")
+	api.HandleFunc("/finance/import/ofx/preview", h.APIOFXImportPreview).Methods("POST")
+	api.HandleFunc("/finance/import/ofx", h.APIOFXImport).Methods("POST")
 
 	// Запуск сервера
 	addr := fmt.Sprintf(":%s", cfg.Port)
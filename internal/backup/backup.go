@@ -0,0 +1,360 @@
+// Package backup описывает формат JSON-выгрузки книги пользователя
+// и потоковую запись этого формата.
+//
+// Документ имеет вид:
+//
+//	{
+//	  "format": "finforme-book",
+//	  "version": 1,
+//	  "exported_at": "...",
+//	  "commodities": [...],
+//	  "accounts": [...],
+//	  "transactions": [...],
+//	  "tags": [...],
+//	  "tag_colors": {...},
+//	  "scheduled": [...],
+//	  "budgets": [...],
+//	  "import_profiles": [...]
+//	}
+//
+// Идентификаторы внутри документа — это ID из базы на момент выгрузки.
+// Они нужны только для связей (родитель счёта, счёт сплита, валюта,
+// транзакция повторения) и при импорте переназначаются. Разделов после
+// tags нет в выгрузках, сделанных до их появления, — такие документы
+// читаются как книга без расписаний, бюджетов и профилей.
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/csvimport"
+)
+
+const (
+	// Format — значение поля "format" в документе
+	Format = "finforme-book"
+	// Version — текущая версия формата
+	Version = 1
+)
+
+// Document — книга пользователя целиком
+type Document struct {
+	Format       string        `json:"format"`
+	Version      int           `json:"version"`
+	ExportedAt   time.Time     `json:"exported_at"`
+	Commodities  []Commodity   `json:"commodities"`
+	Accounts     []Account     `json:"accounts"`
+	Transactions []Transaction `json:"transactions"`
+	Tags         []string      `json:"tags"`
+
+	TagColors      map[string]string `json:"tag_colors,omitempty"` // имя тега → #rrggbb
+	Scheduled      []Scheduled       `json:"scheduled,omitempty"`
+	Budgets        []Budget          `json:"budgets,omitempty"`
+	ImportProfiles []ImportProfile   `json:"import_profiles,omitempty"`
+}
+
+// Commodity — валюта или товар, используемый в книге
+type Commodity struct {
+	ID          int64  `json:"id"`
+	Namespace   string `json:"namespace"`
+	Mnemonic    string `json:"mnemonic"`
+	Fullname    string `json:"fullname,omitempty"`
+	Cusip       string `json:"cusip,omitempty"`
+	Fraction    int    `json:"fraction"`
+	QuoteSource string `json:"quote_source,omitempty"`
+	QuoteTZ     string `json:"quote_tz,omitempty"`
+	Sign        string `json:"sign,omitempty"`
+}
+
+// Account — счёт; ParentID ссылается на ID другого счёта в том же документе
+type Account struct {
+	ID           int64  `json:"id"`
+	ParentID     *int64 `json:"parent_id"`
+	Name         string `json:"name"`
+	AccountType  string `json:"account_type"`
+	CommodityID  int64  `json:"commodity_id"`
+	CommoditySCU int    `json:"commodity_scu"`
+	NonStdSCU    int    `json:"non_std_scu"`
+	Code         string `json:"code,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Hidden       bool   `json:"hidden"`
+	Placeholder  bool   `json:"placeholder"`
+}
+
+// Transaction — транзакция со всеми сплитами
+type Transaction struct {
+	ID          int64     `json:"id"`
+	CurrencyID  int64     `json:"currency_id"`
+	Num         string    `json:"num,omitempty"`
+	PostDate    time.Time `json:"post_date"`
+	EnterDate   time.Time `json:"enter_date"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags,omitempty"`
+	Splits      []Split   `json:"splits"`
+	FITIDs      []FITID   `json:"fitids,omitempty"`
+}
+
+// FITID — идентификатор операции банковской выписки, по которой создана
+// транзакция; по нему повторный импорт выписки на счёт AccountID
+// пропускает уже проведённые операции
+type FITID struct {
+	AccountID int64  `json:"account_id"`
+	FITID     string `json:"fitid"`
+}
+
+// Split — часть транзакции: сумма value_num/value_denom в валюте транзакции
+// и quantity_num/quantity_denom в валюте счёта AccountID.
+// В старых выгрузках quantity нет — тогда она равна value,
+// а пустое ReconcileState равносильно "n".
+type Split struct {
+	AccountID      int64      `json:"account_id"`
+	ValueNum       int64      `json:"value_num"`
+	ValueDenom     int64      `json:"value_denom"`
+	QuantityNum    int64      `json:"quantity_num,omitempty"`
+	QuantityDenom  int64      `json:"quantity_denom,omitempty"`
+	Memo           string     `json:"memo,omitempty"`
+	Action         string     `json:"action,omitempty"`
+	ReconcileState string     `json:"reconcile_state,omitempty"`
+	ReconcileDate  *time.Time `json:"reconcile_date,omitempty"`
+}
+
+// Scheduled — запланированная транзакция: шаблон сплитов, правило повторения
+// и уже обработанные даты
+type Scheduled struct {
+	ID             int64            `json:"id"`
+	Description    string           `json:"description"`
+	Tags           []string         `json:"tags,omitempty"`
+	CurrencyID     int64            `json:"currency_id"`
+	Rule           string           `json:"rule"`
+	RuleInterval   int              `json:"rule_interval"`
+	RuleDay        int              `json:"rule_day"`
+	StartDate      time.Time        `json:"start_date"`
+	EndDate        *time.Time       `json:"end_date,omitempty"`
+	MaxOccurrences int              `json:"max_occurrences,omitempty"`
+	Mode           string           `json:"mode"`
+	Enabled        bool             `json:"enabled"`
+	Splits         []ScheduledSplit `json:"splits"`
+	Occurrences    []Occurrence     `json:"occurrences,omitempty"`
+}
+
+// ScheduledSplit — строка шаблона запланированной транзакции
+type ScheduledSplit struct {
+	AccountID     int64  `json:"account_id"`
+	ValueNum      int64  `json:"value_num"`
+	ValueDenom    int64  `json:"value_denom"`
+	QuantityNum   int64  `json:"quantity_num"`
+	QuantityDenom int64  `json:"quantity_denom"`
+	Memo          string `json:"memo,omitempty"`
+	Action        string `json:"action,omitempty"`
+}
+
+// Occurrence — обработанная дата расписания; TxID ссылается на ID
+// транзакции в том же документе, nil — транзакции нет (пропуск, напоминание
+// или удалённая транзакция)
+type Occurrence struct {
+	Date     time.Time `json:"date"`
+	Status   string    `json:"status"`
+	TxID     *int64    `json:"tx_id,omitempty"`
+	Reviewed bool      `json:"reviewed"`
+}
+
+// Budget — бюджет счёта AccountID на месяц Month в валюте счёта
+type Budget struct {
+	AccountID   int64     `json:"account_id"`
+	Month       time.Time `json:"month"`
+	AmountNum   int64     `json:"amount_num"`
+	AmountDenom int64     `json:"amount_denom"`
+}
+
+// ImportProfile — профиль импорта CSV-выписок; AccountID и CounterpartID
+// ссылаются на счета документа, nil — счёт не выбран
+type ImportProfile struct {
+	Name string `json:"name"`
+	csvimport.Profile
+	AccountID     *int64 `json:"account_id,omitempty"`
+	CounterpartID *int64 `json:"counterpart_id,omitempty"`
+}
+
+// Extra — разделы документа после транзакций, которые Writer пишет в End
+type Extra struct {
+	TagColors      map[string]string
+	Scheduled      []Scheduled
+	Budgets        []Budget
+	ImportProfiles []ImportProfile
+}
+
+// Writer пишет документ потоково: сначала шапку со справочниками,
+// затем транзакции по одной, в конце — список тегов и остальные разделы.
+// Так выгрузка не держит в памяти все транзакции книги.
+type Writer struct {
+	w     *bufio.Writer
+	tags  map[string]bool
+	count int
+	state int
+}
+
+const (
+	stateNew = iota
+	stateTransactions
+	stateDone
+)
+
+// NewWriter создаёт Writer поверх w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:    bufio.NewWriter(w),
+		tags: make(map[string]bool),
+	}
+}
+
+// Begin пишет шапку документа, валюты и счета и открывает массив транзакций
+func (bw *Writer) Begin(exportedAt time.Time, commodities []Commodity, accounts []Account) error {
+	if bw.state != stateNew {
+		return errors.New("backup: Begin called twice")
+	}
+	if commodities == nil {
+		commodities = []Commodity{}
+	}
+	if accounts == nil {
+		accounts = []Account{}
+	}
+
+	fmt.Fprintf(bw.w, `{"format":%q,"version":%d,"exported_at":`, Format, Version)
+	if err := bw.writeValue(exportedAt.UTC()); err != nil {
+		return err
+	}
+	bw.w.WriteString(`,"commodities":`)
+	if err := bw.writeValue(commodities); err != nil {
+		return err
+	}
+	bw.w.WriteString(`,"accounts":`)
+	if err := bw.writeValue(accounts); err != nil {
+		return err
+	}
+	bw.w.WriteString(`,"transactions":[`)
+	bw.state = stateTransactions
+	return nil
+}
+
+// WriteTransaction дописывает одну транзакцию и запоминает её теги
+func (bw *Writer) WriteTransaction(tx *Transaction) error {
+	if bw.state != stateTransactions {
+		return errors.New("backup: WriteTransaction called outside of Begin/End")
+	}
+	if tx.Splits == nil {
+		tx.Splits = []Split{}
+	}
+	if bw.count > 0 {
+		bw.w.WriteByte(',')
+	}
+	bw.w.WriteByte('\n')
+	if err := bw.writeValue(tx); err != nil {
+		return err
+	}
+	for _, tag := range tx.Tags {
+		bw.tags[tag] = true
+	}
+	bw.count++
+	return nil
+}
+
+// End закрывает массив транзакций, пишет отсортированный список тегов
+// и разделы extra (nil — пустые) и сбрасывает буфер
+func (bw *Writer) End(extra *Extra) error {
+	if bw.state != stateTransactions {
+		return errors.New("backup: End called before Begin")
+	}
+	tags := make([]string, 0, len(bw.tags))
+	for tag := range bw.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	if extra == nil {
+		extra = &Extra{}
+	}
+	if extra.TagColors == nil {
+		extra.TagColors = map[string]string{}
+	}
+	if extra.Scheduled == nil {
+		extra.Scheduled = []Scheduled{}
+	}
+	if extra.Budgets == nil {
+		extra.Budgets = []Budget{}
+	}
+	if extra.ImportProfiles == nil {
+		extra.ImportProfiles = []ImportProfile{}
+	}
+
+	bw.w.WriteString("\n],\"tags\":")
+	if err := bw.writeValue(tags); err != nil {
+		return err
+	}
+	for _, section := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"tag_colors", extra.TagColors},
+		{"scheduled", extra.Scheduled},
+		{"budgets", extra.Budgets},
+		{"import_profiles", extra.ImportProfiles},
+	} {
+		fmt.Fprintf(bw.w, ",%q:", section.name)
+		if err := bw.writeValue(section.value); err != nil {
+			return err
+		}
+	}
+	bw.w.WriteString("}\n")
+	bw.state = stateDone
+	return bw.w.Flush()
+}
+
+// Count возвращает количество записанных транзакций
+func (bw *Writer) Count() int {
+	return bw.count
+}
+
+// writeValue кодирует значение без завершающего перевода строки
+func (bw *Writer) writeValue(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("backup: failed to encode: %w", err)
+	}
+	_, err = bw.w.Write(data)
+	return err
+}
+
+// Summary — сколько объектов каждого вида записано при импорте
+type Summary struct {
+	Commodities  int `json:"commodities"`
+	Accounts     int `json:"accounts"`
+	Transactions int `json:"transactions"`
+	Splits       int `json:"splits"`
+	Tags         int `json:"tags"`
+
+	Scheduled      int `json:"scheduled"`
+	Budgets        int `json:"budgets"`
+	ImportProfiles int `json:"import_profiles"`
+}
+
+// Read читает документ целиком и проверяет формат и версию.
+// Содержимое документа проверяет Validate.
+func Read(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	if doc.Format != Format {
+		return nil, fmt.Errorf("unknown document format %q", doc.Format)
+	}
+	if doc.Version < 1 || doc.Version > Version {
+		return nil, fmt.Errorf("unsupported document version %d", doc.Version)
+	}
+	return &doc, nil
+}
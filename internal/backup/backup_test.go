@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	parentID := int64(1)
+
+	bw := NewWriter(&buf)
+	err := bw.Begin(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		[]Commodity{{ID: 1, Namespace: "CURRENCY", Mnemonic: "RUB", Fraction: 100}},
+		[]Account{
+			{ID: 1, Name: "Активы", AccountType: "ASSET", CommodityID: 1, Placeholder: true},
+			{ID: 2, ParentID: &parentID, Name: "Наличные", AccountType: "CASH", CommodityID: 1},
+		})
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	txs := []Transaction{
+		{ID: 10, CurrencyID: 1, Description: "Кофе", Tags: []string{"food", "cafe"},
+			Splits: []Split{{AccountID: 2, ValueNum: -25000, ValueDenom: 100}, {AccountID: 3, ValueNum: 25000, ValueDenom: 100}}},
+		{ID: 11, CurrencyID: 1, Description: "Без сплитов"},
+		{ID: 12, CurrencyID: 1, Description: "Ещё кофе", Tags: []string{"cafe"}},
+	}
+	for i := range txs {
+		if err := bw.WriteTransaction(&txs[i]); err != nil {
+			t.Fatalf("WriteTransaction: %v", err)
+		}
+	}
+	cash := int64(2)
+	err = bw.End(&Extra{
+		TagColors: map[string]string{"cafe": "#ff8800"},
+		Scheduled: []Scheduled{{ID: 5, CurrencyID: 1, Rule: "monthly", RuleInterval: 1, RuleDay: 10, Mode: "auto",
+			Splits:      []ScheduledSplit{{AccountID: 2, ValueNum: -100, ValueDenom: 100, QuantityNum: -100, QuantityDenom: 100}},
+			Occurrences: []Occurrence{{Status: "created", TxID: &txs[0].ID}}}},
+		Budgets:        []Budget{{AccountID: 2, AmountNum: 500, AmountDenom: 1}},
+		ImportProfiles: []ImportProfile{{Name: "Банк", AccountID: &cash}},
+	})
+	if err != nil {
+		t.Fatalf("End: %v", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if doc.Format != Format || doc.Version != Version {
+		t.Errorf("format/version = %q/%d, expected %q/%d", doc.Format, doc.Version, Format, Version)
+	}
+	if len(doc.Commodities) != 1 || len(doc.Accounts) != 2 {
+		t.Errorf("got %d commodities, %d accounts", len(doc.Commodities), len(doc.Accounts))
+	}
+	if doc.Accounts[1].ParentID == nil || *doc.Accounts[1].ParentID != 1 {
+		t.Errorf("parent reference lost: %+v", doc.Accounts[1])
+	}
+	if len(doc.Transactions) != 3 || bw.Count() != 3 {
+		t.Fatalf("got %d transactions (count %d), expected 3", len(doc.Transactions), bw.Count())
+	}
+	if s := doc.Transactions[0].Splits; len(s) != 2 || s[0].ValueNum != -25000 || s[0].ValueDenom != 100 {
+		t.Errorf("splits = %+v", s)
+	}
+	if doc.Transactions[1].Splits == nil {
+		t.Errorf("transaction without splits should have empty splits array")
+	}
+	if len(doc.Tags) != 2 || doc.Tags[0] != "cafe" || doc.Tags[1] != "food" {
+		t.Errorf("tags = %v, expected [cafe food]", doc.Tags)
+	}
+	if doc.TagColors["cafe"] != "#ff8800" {
+		t.Errorf("tag_colors = %v", doc.TagColors)
+	}
+	if len(doc.Scheduled) != 1 || len(doc.Scheduled[0].Splits) != 1 || len(doc.Scheduled[0].Occurrences) != 1 ||
+		*doc.Scheduled[0].Occurrences[0].TxID != 10 {
+		t.Errorf("scheduled = %+v", doc.Scheduled)
+	}
+	if len(doc.Budgets) != 1 || doc.Budgets[0].AmountNum != 500 {
+		t.Errorf("budgets = %+v", doc.Budgets)
+	}
+	if len(doc.ImportProfiles) != 1 || doc.ImportProfiles[0].Name != "Банк" || *doc.ImportProfiles[0].AccountID != 2 {
+		t.Errorf("import_profiles = %+v", doc.ImportProfiles)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewWriter(&buf)
+	if err := bw.Begin(time.Now(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.End(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if doc.Commodities == nil || doc.Accounts == nil || doc.Transactions == nil || doc.Tags == nil ||
+		!strings.Contains(buf.String(), `"scheduled":[],"budgets":[],"import_profiles":[]`) {
+		t.Errorf("empty document should contain empty arrays, got %s", buf.String())
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	bw := NewWriter(&bytes.Buffer{})
+	if err := bw.WriteTransaction(&Transaction{}); err == nil {
+		t.Error("WriteTransaction before Begin should fail")
+	}
+	if err := bw.End(nil); err == nil {
+		t.Error("End before Begin should fail")
+	}
+}
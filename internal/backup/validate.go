@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/schedule"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// colorPattern — цвет тега в виде #rrggbb
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// maxProblems ограничивает число проблем в ValidationError,
+// чтобы ответ на битый файл оставался читаемым
+const maxProblems = 20
+
+// ValidationError содержит все найденные в документе проблемы
+type ValidationError struct {
+	Problems []string
+	Omitted  int // сколько проблем не попало в Problems
+}
+
+func (e *ValidationError) Error() string {
+	msg := "invalid document: " + strings.Join(e.Problems, "; ")
+	if e.Omitted > 0 {
+		msg += fmt.Sprintf(" (and %d more)", e.Omitted)
+	}
+	return msg
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	if len(e.Problems) >= maxProblems {
+		e.Omitted++
+		return
+	}
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate проверяет ссылочную целостность документа: уникальность ID,
+// известные типы счетов, разрешимые и нецикличные родители, ссылки на
+// валюты и счета, положительные знаменатели и сбалансированность сплитов,
+// уникальность FITID на счёте, а также правила расписаний, бюджеты, цвета тегов и профили импорта.
+// Возвращает *ValidationError или nil.
+func Validate(doc *Document) error {
+	verr := &ValidationError{}
+
+	commodities := make(map[int64]bool, len(doc.Commodities))
+	for _, c := range doc.Commodities {
+		if commodities[c.ID] {
+			verr.add("commodity %d: duplicate id", c.ID)
+		}
+		commodities[c.ID] = true
+		if c.Mnemonic == "" {
+			verr.add("commodity %d: empty mnemonic", c.ID)
+		}
+	}
+
+	accounts := make(map[int64]*Account, len(doc.Accounts))
+	for i := range doc.Accounts {
+		acc := &doc.Accounts[i]
+		if accounts[acc.ID] != nil {
+			verr.add("account %d: duplicate id", acc.ID)
+		}
+		accounts[acc.ID] = acc
+
+		if acc.Name == "" {
+			verr.add("account %d: empty name", acc.ID)
+		}
+		if !models.IsKnownAccountType(acc.AccountType) {
+			verr.add("account %d: unknown account type %q", acc.ID, acc.AccountType)
+		}
+		if !commodities[acc.CommodityID] {
+			verr.add("account %d: unknown commodity %d", acc.ID, acc.CommodityID)
+		}
+	}
+
+	// Родитель должен существовать, а цепочка родителей — заканчиваться
+	for _, acc := range doc.Accounts {
+		if acc.ParentID == nil {
+			continue
+		}
+		if accounts[*acc.ParentID] == nil {
+			verr.add("account %d: unknown parent %d", acc.ID, *acc.ParentID)
+			continue
+		}
+		seen := map[int64]bool{acc.ID: true}
+		for p := accounts[*acc.ParentID]; p != nil && p.ParentID != nil; p = accounts[*p.ParentID] {
+			if seen[p.ID] {
+				verr.add("account %d: parent cycle", acc.ID)
+				break
+			}
+			seen[p.ID] = true
+		}
+	}
+
+	txIDs := make(map[int64]bool, len(doc.Transactions))
+	fitids := make(map[FITID]bool)
+	for _, tx := range doc.Transactions {
+		if txIDs[tx.ID] {
+			verr.add("transaction %d: duplicate id", tx.ID)
+		}
+		txIDs[tx.ID] = true
+
+		if !commodities[tx.CurrencyID] {
+			verr.add("transaction %d: unknown currency %d", tx.ID, tx.CurrencyID)
+		}
+		if tx.PostDate.IsZero() {
+			verr.add("transaction %d: empty post_date", tx.ID)
+		}
+
+		sum := new(big.Rat)
+		denomOK := true
+		for _, s := range tx.Splits {
+			if accounts[s.AccountID] == nil {
+				verr.add("transaction %d: split references unknown account %d", tx.ID, s.AccountID)
+			}
+			if s.ReconcileState != "" && !models.IsKnownReconcileState(s.ReconcileState) {
+				verr.add("transaction %d: split has unknown reconcile_state %q", tx.ID, s.ReconcileState)
+			}
+			if s.QuantityDenom < 0 || (s.QuantityDenom == 0 && s.QuantityNum != 0) {
+				verr.add("transaction %d: split has non-positive quantity_denom %d", tx.ID, s.QuantityDenom)
+			}
+			if s.ValueDenom <= 0 {
+				verr.add("transaction %d: split has non-positive value_denom %d", tx.ID, s.ValueDenom)
+				denomOK = false
+				continue
+			}
+			sum.Add(sum, big.NewRat(s.ValueNum, s.ValueDenom))
+		}
+		if denomOK && sum.Sign() != 0 {
+			verr.add("transaction %d: splits are not balanced (sum %s)", tx.ID, sum.FloatString(2))
+		}
+
+		for _, f := range tx.FITIDs {
+			if accounts[f.AccountID] == nil {
+				verr.add("transaction %d: fitid references unknown account %d", tx.ID, f.AccountID)
+			}
+			if f.FITID == "" {
+				verr.add("transaction %d: empty fitid", tx.ID)
+			}
+			if fitids[f] {
+				verr.add("transaction %d: duplicate fitid %q for account %d", tx.ID, f.FITID, f.AccountID)
+			}
+			fitids[f] = true
+		}
+	}
+
+	for name, color := range doc.TagColors {
+		if err := tags.CheckName(name); err != nil {
+			verr.add("tag %q: %v", name, err)
+		}
+		if !colorPattern.MatchString(color) {
+			verr.add("tag %q: invalid color %q", name, color)
+		}
+	}
+
+	scheduledIDs := make(map[int64]bool, len(doc.Scheduled))
+	for _, s := range doc.Scheduled {
+		if scheduledIDs[s.ID] {
+			verr.add("scheduled %d: duplicate id", s.ID)
+		}
+		scheduledIDs[s.ID] = true
+
+		if !commodities[s.CurrencyID] {
+			verr.add("scheduled %d: unknown currency %d", s.ID, s.CurrencyID)
+		}
+		if err := (schedule.Rule{Kind: s.Rule, Interval: s.RuleInterval, Day: s.RuleDay}).Validate(); err != nil {
+			verr.add("scheduled %d: %v", s.ID, err)
+		}
+		if s.StartDate.IsZero() {
+			verr.add("scheduled %d: empty start_date", s.ID)
+		}
+		if s.Mode != schedule.ModeAuto && s.Mode != schedule.ModeRemind {
+			verr.add("scheduled %d: unknown mode %q", s.ID, s.Mode)
+		}
+		for _, sp := range s.Splits {
+			if accounts[sp.AccountID] == nil {
+				verr.add("scheduled %d: split references unknown account %d", s.ID, sp.AccountID)
+			}
+			if sp.ValueDenom <= 0 || sp.QuantityDenom <= 0 {
+				verr.add("scheduled %d: split has non-positive denominator", s.ID)
+			}
+		}
+		dates := make(map[string]bool, len(s.Occurrences))
+		for _, o := range s.Occurrences {
+			date := o.Date.Format("2006-01-02")
+			if dates[date] {
+				verr.add("scheduled %d: duplicate occurrence %s", s.ID, date)
+			}
+			dates[date] = true
+			switch o.Status {
+			case schedule.StatusCreated, schedule.StatusPending, schedule.StatusSkipped:
+			default:
+				verr.add("scheduled %d: occurrence %s has unknown status %q", s.ID, date, o.Status)
+			}
+			if o.TxID != nil && !txIDs[*o.TxID] {
+				verr.add("scheduled %d: occurrence %s references unknown transaction %d", s.ID, date, *o.TxID)
+			}
+		}
+	}
+
+	budgetMonths := make(map[string]bool, len(doc.Budgets))
+	for _, b := range doc.Budgets {
+		month := b.Month.Format("2006-01")
+		if accounts[b.AccountID] == nil {
+			verr.add("budget %s: unknown account %d", month, b.AccountID)
+		}
+		key := fmt.Sprintf("%d/%s", b.AccountID, month)
+		if budgetMonths[key] {
+			verr.add("budget %s: duplicate month for account %d", month, b.AccountID)
+		}
+		budgetMonths[key] = true
+		if b.AmountDenom <= 0 {
+			verr.add("budget %s: non-positive amount_denom %d", month, b.AmountDenom)
+		}
+	}
+
+	profileNames := make(map[string]bool, len(doc.ImportProfiles))
+	for _, p := range doc.ImportProfiles {
+		if p.Name == "" {
+			verr.add("import profile: empty name")
+		}
+		key := strings.ToLower(p.Name)
+		if profileNames[key] {
+			verr.add("import profile %q: duplicate name", p.Name)
+		}
+		profileNames[key] = true
+		if err := p.Profile.Validate(); err != nil {
+			verr.add("import profile %q: %v", p.Name, err)
+		}
+		for _, id := range []*int64{p.AccountID, p.CounterpartID} {
+			if id != nil && accounts[*id] == nil {
+				verr.add("import profile %q: unknown account %d", p.Name, *id)
+			}
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/csvimport"
+)
+
+func validDocument() *Document {
+	assets := int64(1)
+	cash := int64(2)
+	txID := int64(1)
+	return &Document{
+		Format:      Format,
+		Version:     Version,
+		Commodities: []Commodity{{ID: 1, Namespace: "CURRENCY", Mnemonic: "RUB", Fraction: 100}},
+		Accounts: []Account{
+			{ID: 1, Name: "Активы", AccountType: "ASSET", CommodityID: 1, Placeholder: true},
+			{ID: 2, ParentID: &assets, Name: "Наличные", AccountType: "CASH", CommodityID: 1},
+			{ID: 3, Name: "Продукты", AccountType: "EXPENSE", CommodityID: 1},
+		},
+		Transactions: []Transaction{
+			{ID: 1, CurrencyID: 1, PostDate: time.Now(), Description: "Магазин",
+				Splits: []Split{{AccountID: 2, ValueNum: -1999, ValueDenom: 100}, {AccountID: 3, ValueNum: 1999, ValueDenom: 100}},
+				FITIDs: []FITID{{AccountID: 2, FITID: "F1"}}},
+			// Разные знаменатели в одной транзакции — тоже баланс
+			{ID: 2, CurrencyID: 1, PostDate: time.Now(), Description: "Кофе",
+				Splits: []Split{{AccountID: 2, ValueNum: -25, ValueDenom: 1}, {AccountID: 3, ValueNum: 2500, ValueDenom: 100}}},
+		},
+		TagColors: map[string]string{"еда": "#00AA00"},
+		Scheduled: []Scheduled{
+			{ID: 1, CurrencyID: 1, Rule: "monthly", RuleInterval: 1, RuleDay: 5, StartDate: time.Now(), Mode: "auto",
+				Splits: []ScheduledSplit{
+					{AccountID: 2, ValueNum: -100, ValueDenom: 100, QuantityNum: -100, QuantityDenom: 100},
+					{AccountID: 3, ValueNum: 100, ValueDenom: 100, QuantityNum: 100, QuantityDenom: 100},
+				},
+				Occurrences: []Occurrence{{Date: time.Now(), Status: "created", TxID: &txID}}},
+		},
+		Budgets: []Budget{{AccountID: 3, Month: time.Now(), AmountNum: 500, AmountDenom: 1}},
+		ImportProfiles: []ImportProfile{{Name: "Банк", AccountID: &cash,
+			Profile: csvimport.Profile{Delimiter: ";", Encoding: "utf-8", DateFormat: "02.01.2006", DateColumn: 1, AmountColumn: 2}}},
+	}
+}
+
+func TestValidate_OK(t *testing.T) {
+	if err := Validate(validDocument()); err != nil {
+		t.Fatalf("Validate() = %v, expected nil", err)
+	}
+}
+
+func TestValidate_Problems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(doc *Document)
+		want   string
+	}{
+		{"unbalanced", func(d *Document) { d.Transactions[0].Splits[1].ValueNum = 1998 }, "not balanced"},
+		{"unknown type", func(d *Document) { d.Accounts[2].AccountType = "SPENDING" }, "unknown account type"},
+		{"unknown parent", func(d *Document) { p := int64(42); d.Accounts[1].ParentID = &p }, "unknown parent 42"},
+		{"self parent", func(d *Document) { p := int64(1); d.Accounts[0].ParentID = &p }, "parent cycle"},
+		{"parent cycle", func(d *Document) { p := int64(2); d.Accounts[0].ParentID = &p }, "parent cycle"},
+		{"unknown commodity", func(d *Document) { d.Accounts[2].CommodityID = 7 }, "unknown commodity 7"},
+		{"unknown currency", func(d *Document) { d.Transactions[1].CurrencyID = 7 }, "unknown currency 7"},
+		{"unknown split account", func(d *Document) { d.Transactions[1].Splits[0].AccountID = 99 }, "unknown account 99"},
+		{"zero denom", func(d *Document) { d.Transactions[1].Splits[0].ValueDenom = 0 }, "non-positive value_denom"},
+		{"zero quantity denom", func(d *Document) { d.Transactions[1].Splits[0].QuantityNum = 5 }, "non-positive quantity_denom"},
+		{"unknown reconcile state", func(d *Document) { d.Transactions[1].Splits[0].ReconcileState = "x" }, "unknown reconcile_state"},
+		{"duplicate account", func(d *Document) { d.Accounts[2].ID = 2 }, "duplicate id"},
+		{"fitid unknown account", func(d *Document) { d.Transactions[0].FITIDs[0].AccountID = 99 }, "unknown account 99"},
+		{"empty fitid", func(d *Document) { d.Transactions[0].FITIDs[0].FITID = "" }, "empty fitid"},
+		{"duplicate fitid", func(d *Document) { d.Transactions[1].FITIDs = d.Transactions[0].FITIDs }, "duplicate fitid"},
+		{"bad tag color", func(d *Document) { d.TagColors["еда"] = "green" }, "invalid color"},
+		{"bad rule", func(d *Document) { d.Scheduled[0].RuleDay = 40 }, "scheduled 1:"},
+		{"unknown mode", func(d *Document) { d.Scheduled[0].Mode = "manual" }, "unknown mode"},
+		{"scheduled unknown account", func(d *Document) { d.Scheduled[0].Splits[1].AccountID = 99 }, "unknown account 99"},
+		{"occurrence unknown tx", func(d *Document) { id := int64(42); d.Scheduled[0].Occurrences[0].TxID = &id }, "unknown transaction 42"},
+		{"occurrence status", func(d *Document) { d.Scheduled[0].Occurrences[0].Status = "done" }, "unknown status"},
+		{"budget unknown account", func(d *Document) { d.Budgets[0].AccountID = 99 }, "unknown account 99"},
+		{"duplicate budget", func(d *Document) { d.Budgets = append(d.Budgets, d.Budgets[0]) }, "duplicate month"},
+		{"bad profile", func(d *Document) { d.ImportProfiles[0].DateColumn = 0 }, "import profile"},
+		{"profile unknown account", func(d *Document) { id := int64(99); d.ImportProfiles[0].CounterpartID = &id }, "unknown account 99"},
+	}
+
+	for _, test := range tests {
+		doc := validDocument()
+		test.modify(doc)
+		err := Validate(doc)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: Validate() = %v, expected *ValidationError", test.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestValidate_ProblemsLimit(t *testing.T) {
+	doc := validDocument()
+	for i := 0; i < maxProblems+5; i++ {
+		doc.Accounts = append(doc.Accounts, Account{ID: int64(100 + i), Name: "x", AccountType: "BAD", CommodityID: 1})
+	}
+	var verr *ValidationError
+	if !errors.As(Validate(doc), &verr) {
+		t.Fatal("expected ValidationError")
+	}
+	if len(verr.Problems) != maxProblems || verr.Omitted != 5 {
+		t.Errorf("got %d problems, %d omitted", len(verr.Problems), verr.Omitted)
+	}
+}
+
+func TestRead(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"format":"finforme-book","version":1}`)); err != nil {
+		t.Errorf("Read(valid) = %v", err)
+	}
+	if _, err := Read(strings.NewReader(`{"format":"other","version":1}`)); err == nil {
+		t.Error("Read should reject unknown format")
+	}
+	if _, err := Read(strings.NewReader(`{"format":"finforme-book","version":99}`)); err == nil {
+		t.Error("Read should reject future version")
+	}
+	if _, err := Read(strings.NewReader(`{`)); err == nil {
+		t.Error("Read should reject broken JSON")
+	}
+}
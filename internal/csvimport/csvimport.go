@@ -0,0 +1,254 @@
+// Package csvimport разбирает банковские выписки в CSV. Форматы у банков
+// разные, поэтому разбор задаётся профилем: разделитель, кодировка, число
+// строк заголовка, номера колонок и формат даты.
+package csvimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/evbogdanov/finforme/internal/money"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Кодировки файла выписки
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1251 = "windows-1251"
+)
+
+// DateFormat — формат даты в выписке: подпись для пользователя и раскладка time.Parse
+type DateFormat struct {
+	Label  string `json:"label"`
+	Layout string `json:"layout"`
+}
+
+// DateFormats — поддерживаемые форматы дат
+var DateFormats = []DateFormat{
+	{"ДД.ММ.ГГГГ", "02.01.2006"},
+	{"ДД.ММ.ГГ", "02.01.06"},
+	{"ГГГГ-ММ-ДД", "2006-01-02"},
+	{"ДД/ММ/ГГГГ", "02/01/2006"},
+	{"ММ/ДД/ГГГГ", "01/02/2006"},
+}
+
+// Profile — как читать выписку. Колонки нумеруются с 1, 0 — колонки нет.
+// Сумма берётся либо из AmountColumn (со знаком: минус — списание), либо из
+// пары DebitColumn (списание) и CreditColumn (зачисление).
+type Profile struct {
+	Delimiter  string `json:"delimiter"`   // один символ, например ";" или "\t"
+	Encoding   string `json:"encoding"`    // EncodingUTF8 или EncodingWindows1251
+	SkipRows   int    `json:"skip_rows"`   // строк заголовка перед операциями
+	DateFormat string `json:"date_format"` // раскладка из DateFormats
+
+	DateColumn        int `json:"date_column"`
+	AmountColumn      int `json:"amount_column"`
+	DebitColumn       int `json:"debit_column"`
+	CreditColumn      int `json:"credit_column"`
+	DescriptionColumn int `json:"description_column"`
+	CategoryColumn    int `json:"category_column"`
+}
+
+// Row — операция выписки
+type Row struct {
+	Line        int       // строка файла, с 1
+	Date        time.Time // дата операции
+	Num, Denom  int64     // сумма движения по счёту: плюс — зачисление, минус — списание
+	Description string
+	Category    string
+}
+
+// Validate проверяет профиль до разбора файла
+func (p Profile) Validate() error {
+	if utf8.RuneCountInString(p.Delimiter) != 1 || p.Delimiter == "\"" || p.Delimiter == "\n" || p.Delimiter == "\r" {
+		return errors.New("Разделитель — один символ, кроме кавычки и перевода строки")
+	}
+	if p.Encoding != EncodingUTF8 && p.Encoding != EncodingWindows1251 {
+		return errors.New("Неизвестная кодировка")
+	}
+	if p.SkipRows < 0 {
+		return errors.New("Число строк заголовка не может быть отрицательным")
+	}
+	known := false
+	for _, f := range DateFormats {
+		known = known || f.Layout == p.DateFormat
+	}
+	if !known {
+		return errors.New("Неизвестный формат даты")
+	}
+	for _, c := range []int{p.DateColumn, p.AmountColumn, p.DebitColumn, p.CreditColumn, p.DescriptionColumn, p.CategoryColumn} {
+		if c < 0 {
+			return errors.New("Номер колонки не может быть отрицательным")
+		}
+	}
+	switch {
+	case p.DateColumn == 0:
+		return errors.New("Укажите колонку с датой")
+	case p.AmountColumn == 0 && p.DebitColumn == 0 && p.CreditColumn == 0:
+		return errors.New("Укажите колонку с суммой или колонки списания и зачисления")
+	case p.AmountColumn != 0 && (p.DebitColumn != 0 || p.CreditColumn != 0):
+		return errors.New("Укажите либо колонку с суммой, либо колонки списания и зачисления")
+	}
+	return nil
+}
+
+// Decode переводит содержимое файла в UTF-8 и убирает BOM
+func Decode(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingUTF8:
+		if !utf8.Valid(data) {
+			return nil, errors.New("Файл не в UTF-8 — выберите кодировку Windows-1251")
+		}
+		return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+	case EncodingWindows1251:
+		decoded, _, err := transform.Bytes(charmap.Windows1251.NewDecoder(), data)
+		return decoded, err
+	}
+	return nil, errors.New("Неизвестная кодировка")
+}
+
+// Records возвращает записи файла как есть, включая строки заголовка,
+// с номерами строк файла; пустые строки пропускаются
+func Records(data []byte, p Profile) ([][]string, []int, error) {
+	decoded, err := Decode(data, p.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(decoded))
+	reader.Comma, _ = utf8.DecodeRuneInString(p.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Некорректный CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	return records, lines, nil
+}
+
+// Parse разбирает операции выписки по профилю. Строки без даты (итоги,
+// остатки) и с нулевой суммой пропускаются; ошибка в дате или сумме
+// останавливает разбор с номером строки.
+func Parse(data []byte, p Profile) ([]Row, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	records, lines, err := Records(data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for i, record := range records {
+		if i < p.SkipRows {
+			continue
+		}
+		row, ok, err := parseRecord(record, p)
+		if err != nil {
+			return nil, fmt.Errorf("Строка %d: %v", lines[i], err)
+		}
+		if ok {
+			row.Line = lines[i]
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// parseRecord разбирает одну запись; ok = false — запись не операция
+func parseRecord(record []string, p Profile) (row Row, ok bool, err error) {
+	cell := func(column int) (string, error) {
+		if column == 0 {
+			return "", nil
+		}
+		if column > len(record) {
+			return "", fmt.Errorf("нет колонки %d", column)
+		}
+		return strings.TrimSpace(record[column-1]), nil
+	}
+
+	date, err := cell(p.DateColumn)
+	if err != nil || date == "" {
+		return row, false, nil
+	}
+	// Время после даты («02.01.2006 15:04») отбрасывается
+	if i := strings.IndexAny(date, " T"); i > 0 && !strings.ContainsAny(p.DateFormat, " T") {
+		date = date[:i]
+	}
+	if row.Date, err = time.Parse(p.DateFormat, date); err != nil {
+		return row, false, fmt.Errorf("некорректная дата %q", date)
+	}
+
+	if p.AmountColumn != 0 {
+		s, err := cell(p.AmountColumn)
+		if err != nil {
+			return row, false, err
+		}
+		if s == "" {
+			return row, false, nil
+		}
+		if row.Num, row.Denom, err = money.Parse(s); err != nil {
+			return row, false, fmt.Errorf("сумма %q: %v", s, err)
+		}
+	} else {
+		debit, err := unsignedCell(cell, p.DebitColumn)
+		if err != nil {
+			return row, false, err
+		}
+		credit, err := unsignedCell(cell, p.CreditColumn)
+		if err != nil {
+			return row, false, err
+		}
+		sum := new(big.Rat).Sub(credit, debit)
+		if !sum.Num().IsInt64() || !sum.Denom().IsInt64() {
+			return row, false, money.ErrRange
+		}
+		row.Num, row.Denom = sum.Num().Int64(), sum.Denom().Int64()
+	}
+	if row.Num == 0 {
+		return row, false, nil
+	}
+
+	if row.Description, err = cell(p.DescriptionColumn); err != nil {
+		return row, false, err
+	}
+	if row.Category, err = cell(p.CategoryColumn); err != nil {
+		return row, false, err
+	}
+	return row, true, nil
+}
+
+// unsignedCell разбирает сумму списания или зачисления; знак не важен —
+// банки пишут списания и с минусом, и без. Пустая ячейка — ноль.
+func unsignedCell(cell func(int) (string, error), column int) (*big.Rat, error) {
+	s, err := cell(column)
+	if err != nil || s == "" {
+		return new(big.Rat), err
+	}
+	num, denom, err := money.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("сумма %q: %v", s, err)
+	}
+	if num < 0 {
+		num = -num
+	}
+	return big.NewRat(num, denom), nil
+}
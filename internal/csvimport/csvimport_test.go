@@ -0,0 +1,101 @@
+package csvimport
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestParse(t *testing.T) {
+	statement := "Выписка по счёту 40817\n" +
+		"Дата;Сумма;Описание;Категория\n" +
+		"01.03.2026 10:15;-1 250,50;\"Магазин; у дома\";Продукты\n" +
+		"\n" +
+		"02.03.2026;50000;Зарплата;\n" +
+		"03.03.2026;0;Комиссия;\n" +
+		";;Итого;\n"
+	p := Profile{Delimiter: ";", Encoding: EncodingUTF8, SkipRows: 2, DateFormat: "02.01.2006",
+		DateColumn: 1, AmountColumn: 2, DescriptionColumn: 3, CategoryColumn: 4}
+
+	rows, err := Parse([]byte("\xef\xbb\xbf"+statement), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%d %s %d/%d %s|%s", r.Line, r.Date.Format("2006-01-02"), r.Num, r.Denom, r.Description, r.Category))
+	}
+	want := "3 2026-03-01 -125050/100 Магазин; у дома|Продукты, 5 2026-03-02 50000/1 Зарплата|"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("rows:\n%s\nexpected\n%s", strings.Join(got, ", "), want)
+	}
+
+	// Та же выписка в Windows-1251
+	encoded, err := charmap.Windows1251.NewEncoder().String(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse([]byte(encoded), p); err == nil {
+		t.Error("Windows-1251 file parsed as UTF-8")
+	}
+	p.Encoding = EncodingWindows1251
+	if rows, err := Parse([]byte(encoded), p); err != nil || len(rows) != 2 || rows[0].Category != "Продукты" {
+		t.Errorf("Windows-1251: %v %+v", err, rows)
+	}
+
+	// Заголовок, принятый за операцию, — ошибка с номером строки
+	p.SkipRows = 1
+	if _, err := Parse([]byte(encoded), p); err == nil || !strings.Contains(err.Error(), "Строка 2") {
+		t.Errorf("header as data: %v", err)
+	}
+}
+
+func TestParseDebitCredit(t *testing.T) {
+	statement := "date,debit,credit,memo\n" +
+		"2026-03-01,-19.99,,Coffee\n" +
+		"2026-03-02,,1000,Salary\n" +
+		"2026-03-03,5,2.5,Refund and fee\n"
+	p := Profile{Delimiter: ",", Encoding: EncodingUTF8, SkipRows: 1, DateFormat: "2006-01-02",
+		DateColumn: 1, DebitColumn: 2, CreditColumn: 3, DescriptionColumn: 4}
+	rows, err := Parse([]byte(statement), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%d/%d", r.Num, r.Denom))
+	}
+	if strings.Join(got, " ") != "-1999/100 1000/1 -5/2" {
+		t.Errorf("amounts: %v", got)
+	}
+
+	p.DescriptionColumn = 9
+	if _, err := Parse([]byte(statement), p); err == nil || !strings.Contains(err.Error(), "нет колонки 9") {
+		t.Errorf("missing column: %v", err)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	valid := Profile{Delimiter: "\t", Encoding: EncodingUTF8, DateFormat: "02.01.06", DateColumn: 1, AmountColumn: 2}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid profile: %v", err)
+	}
+	for name, change := range map[string]func(*Profile){
+		"delimiter":        func(p *Profile) { p.Delimiter = ";;" },
+		"quote delimiter":  func(p *Profile) { p.Delimiter = "\"" },
+		"encoding":         func(p *Profile) { p.Encoding = "koi8-r" },
+		"date format":      func(p *Profile) { p.DateFormat = "2006" },
+		"no date":          func(p *Profile) { p.DateColumn = 0 },
+		"no amount":        func(p *Profile) { p.AmountColumn = 0 },
+		"amount and debit": func(p *Profile) { p.DebitColumn = 3 },
+		"negative skip":    func(p *Profile) { p.SkipRows = -1 },
+	} {
+		p := valid
+		change(&p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
+
+	"github.com/evbogdanov/finforme/internal/tags"
 )
 
 // InitDB инициализирует базу данных и создает таблицы
@@ -18,6 +20,7 @@ func InitDB(db *sql.DB) error {
 			last_name VARCHAR(255),
 			is_active TINYINT DEFAULT 1,
 			is_admin TINYINT DEFAULT 0,
+			reporting_currency_id BIGINT NOT NULL DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
@@ -68,11 +71,29 @@ func InitDB(db *sql.DB) error {
 			post_date DATETIME NOT NULL,
 			enter_date DATETIME NOT NULL,
 			description TEXT,
-			tags TEXT,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 			FOREIGN KEY (currency_id) REFERENCES commodities(id)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
+		// Теги пользователя; имя уникально без учёта регистра
+		`CREATE TABLE IF NOT EXISTS tags (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			name VARCHAR(64) NOT NULL,
+			color VARCHAR(7) NOT NULL DEFAULT '' COMMENT 'Цвет метки, #rrggbb',
+			UNIQUE KEY uq_tag_user_name (user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		`CREATE TABLE IF NOT EXISTS transaction_tags (
+			tx_id BIGINT NOT NULL,
+			tag_id BIGINT NOT NULL,
+			PRIMARY KEY (tx_id, tag_id),
+			KEY idx_transaction_tags_tag (tag_id),
+			FOREIGN KEY (tx_id) REFERENCES transactions(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
 		`CREATE TABLE IF NOT EXISTS splits (
 			id BIGINT PRIMARY KEY AUTO_INCREMENT,
 			user_id BIGINT NOT NULL,
@@ -80,11 +101,138 @@ func InitDB(db *sql.DB) error {
 			account_id BIGINT NOT NULL,
 			value_num BIGINT NOT NULL,
 			value_denom INT DEFAULT 100,
+			quantity_num BIGINT,
+			quantity_denom INT,
+			memo VARCHAR(2048) NOT NULL DEFAULT '',
+			action VARCHAR(2048) NOT NULL DEFAULT '',
+			reconcile_state CHAR(1) NOT NULL DEFAULT 'n',
+			reconcile_date DATETIME,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 			FOREIGN KEY (tx_id) REFERENCES transactions(id) ON DELETE CASCADE,
 			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
+		// Запланированные транзакции: правило повторения и шаблон сплитов
+		`CREATE TABLE IF NOT EXISTS scheduled_transactions (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			description TEXT NOT NULL,
+			tags TEXT,
+			currency_id BIGINT DEFAULT 1,
+			rule VARCHAR(32) NOT NULL COMMENT 'monthly, weekly, days, last_business_day',
+			rule_interval INT NOT NULL DEFAULT 1,
+			rule_day INT NOT NULL DEFAULT 0 COMMENT 'День месяца или недели (0 — воскресенье)',
+			start_date DATE NOT NULL,
+			end_date DATE,
+			max_occurrences INT,
+			mode VARCHAR(16) NOT NULL DEFAULT 'auto' COMMENT 'auto — создавать, remind — напоминать',
+			enabled TINYINT DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (currency_id) REFERENCES commodities(id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		`CREATE TABLE IF NOT EXISTS scheduled_splits (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			scheduled_id BIGINT NOT NULL,
+			account_id BIGINT NOT NULL,
+			value_num BIGINT NOT NULL,
+			value_denom INT NOT NULL DEFAULT 100,
+			quantity_num BIGINT NOT NULL,
+			quantity_denom INT NOT NULL DEFAULT 100,
+			memo VARCHAR(2048) NOT NULL DEFAULT '',
+			action VARCHAR(2048) NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (scheduled_id) REFERENCES scheduled_transactions(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Обработанные даты расписаний; уникальный ключ делает запуск идемпотентным
+		`CREATE TABLE IF NOT EXISTS scheduled_occurrences (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			scheduled_id BIGINT NOT NULL,
+			occurrence_date DATE NOT NULL,
+			status VARCHAR(16) NOT NULL COMMENT 'created, pending, skipped',
+			tx_id BIGINT,
+			reviewed TINYINT NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uq_scheduled_occurrence (scheduled_id, occurrence_date),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (scheduled_id) REFERENCES scheduled_transactions(id) ON DELETE CASCADE,
+			FOREIGN KEY (tx_id) REFERENCES transactions(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Бюджет: сумма на счёт доходов или расходов за месяц, в валюте счёта
+		`CREATE TABLE IF NOT EXISTS budgets (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			account_id BIGINT NOT NULL,
+			month DATE NOT NULL COMMENT 'Первое число месяца',
+			amount_num BIGINT NOT NULL,
+			amount_denom INT NOT NULL DEFAULT 100,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uq_budget_account_month (account_id, month),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Профили импорта CSV-выписок: как читать файл конкретного банка и
+		// на какие счета проводить операции
+		`CREATE TABLE IF NOT EXISTS import_profiles (
+			id BIGINT PRIMARY KEY AUTO_INCREMENT,
+			user_id BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			delimiter VARCHAR(4) NOT NULL DEFAULT ';',
+			encoding VARCHAR(20) NOT NULL DEFAULT 'utf-8',
+			skip_rows INT NOT NULL DEFAULT 1,
+			date_format VARCHAR(32) NOT NULL DEFAULT '02.01.2006',
+			date_column INT NOT NULL DEFAULT 0,
+			amount_column INT NOT NULL DEFAULT 0,
+			debit_column INT NOT NULL DEFAULT 0,
+			credit_column INT NOT NULL DEFAULT 0,
+			description_column INT NOT NULL DEFAULT 0,
+			category_column INT NOT NULL DEFAULT 0,
+			account_id BIGINT COMMENT 'Счёт выписки',
+			counterpart_id BIGINT COMMENT 'Счёт для операций без подходящей категории',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uq_import_profile_name (user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE SET NULL,
+			FOREIGN KEY (counterpart_id) REFERENCES accounts(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Идентификаторы операций банка (FITID из OFX), уже проведённые на счёт.
+		// Хранятся отдельно от сплитов: при редактировании транзакции сплиты
+		// пересоздаются, а повторный импорт выписки не должен её дублировать
+		`CREATE TABLE IF NOT EXISTS statement_fitids (
+			account_id BIGINT NOT NULL,
+			fitid VARCHAR(255) NOT NULL,
+			user_id BIGINT NOT NULL,
+			tx_id BIGINT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (account_id, fitid),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+			FOREIGN KEY (tx_id) REFERENCES transactions(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+
+		// Снимки чистого капитала: остатки балансовых счетов на конец месяца
+		// по валютам. Удаляются с даты изменённой проводки и пересчитываются
+		// при следующем показе.
+		`CREATE TABLE IF NOT EXISTS net_worth_snapshots (
+			user_id BIGINT NOT NULL,
+			month DATE NOT NULL COMMENT 'Последний день месяца',
+			commodity_id BIGINT NOT NULL,
+			assets_num BIGINT NOT NULL,
+			assets_denom BIGINT NOT NULL,
+			liabilities_num BIGINT NOT NULL,
+			liabilities_denom BIGINT NOT NULL,
+			PRIMARY KEY (user_id, month, commodity_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
 		`CREATE TABLE IF NOT EXISTS currency_rates (
 			code VARCHAR(20) NOT NULL COMMENT 'Например: USD/RUB, EUR/RUB, USDT/RUB',
 			name VARCHAR(255) NOT NULL COMMENT 'Название валюты',
@@ -105,11 +253,24 @@ func InitDB(db *sql.DB) error {
 	// Миграции: добавляем новые колонки если их нет (для существующих БД)
 	migrations := []string{
 		`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin TINYINT DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS reporting_currency_id BIGINT NOT NULL DEFAULT 1`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS memo VARCHAR(2048) NOT NULL DEFAULT ''`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS action VARCHAR(2048) NOT NULL DEFAULT ''`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS reconcile_state CHAR(1) NOT NULL DEFAULT 'n'`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS reconcile_date DATETIME`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS quantity_num BIGINT`,
+		`ALTER TABLE splits ADD COLUMN IF NOT EXISTS quantity_denom INT`,
+		// До появления quantity все сплиты были в валюте транзакции
+		`UPDATE splits SET quantity_num = value_num, quantity_denom = value_denom WHERE quantity_num IS NULL`,
 	}
 	for _, m := range migrations {
 		db.Exec(m) // игнорируем ошибки (колонка уже может существовать)
 	}
 
+	if err := migrateTransactionTags(db); err != nil {
+		return fmt.Errorf("failed to migrate tags: %w", err)
+	}
+
 	// Создаём индексы для ускорения запросов
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_splits_account_user ON splits (account_id, user_id)`,
@@ -118,6 +279,9 @@ func InitDB(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions (user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_transactions_post_date ON transactions (user_id, post_date)`,
 		`CREATE INDEX IF NOT EXISTS idx_accounts_user_id ON accounts (user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_user_id ON scheduled_transactions (user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_occurrences_user ON scheduled_occurrences (user_id, reviewed)`,
+		`CREATE INDEX IF NOT EXISTS idx_budgets_user_month ON budgets (user_id, month)`,
 	}
 
 	for _, idx := range indexes {
@@ -133,6 +297,65 @@ func InitDB(db *sql.DB) error {
 	return nil
 }
 
+// migrateTransactionTags переносит теги из прежней колонки transactions.tags
+// (строка через запятую) в таблицы tags и transaction_tags и удаляет колонку.
+// Колонка удаляется только после переноса, поэтому прерванная миграция
+// повторится при следующем запуске.
+func migrateTransactionTags(db *sql.DB) error {
+	var columns int
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'transactions' AND column_name = 'tags'
+	`).Scan(&columns); err != nil || columns == 0 {
+		return err
+	}
+
+	type row struct {
+		userID, txID int64
+		tags         string
+	}
+	rows, err := db.Query("SELECT user_id, id, tags FROM transactions WHERE tags <> ''")
+	if err != nil {
+		return err
+	}
+	var legacy []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.userID, &r.txID, &r.tags); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, r := range legacy {
+		names := tags.Parse(r.tags)
+		// Прежняя колонка длину не ограничивала
+		for i, name := range names {
+			if runes := []rune(name); len(runes) > tags.MaxNameLength {
+				names[i] = string(runes[:tags.MaxNameLength])
+			}
+		}
+		if err := tags.Set(tx, r.userID, r.txID, names); err != nil {
+			return fmt.Errorf("transaction %d: %w", r.txID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE transactions DROP COLUMN tags")
+	return err
+}
+
 // seedCommodities добавляет базовые валюты
 func seedCommodities(db *sql.DB) error {
 	var count int
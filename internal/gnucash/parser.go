@@ -180,8 +180,14 @@ type ParsedSplit struct {
 	AccountGUID string
 	ValueNum    int64
 	ValueDenom  int64
-	Memo        string
-	Action      string
+	// Quantity — сумма в валюте счёта, Value — в валюте транзакции
+	QuantityNum   int64
+	QuantityDenom int64
+	Memo          string
+	Action        string
+	// ReconcileState — "n", "c", "y", "f" или "v"; ReconcileDate пуст, если сплит не сверен
+	ReconcileState string
+	ReconcileDate  time.Time
 }
 
 // ParseFile парсит .gnucash файл (сжатый gzip XML)
@@ -303,14 +309,23 @@ func parseXML(r io.Reader) (*ParsedData, error) {
 		// Парсим сплиты
 		for _, s := range t.Splits.Split {
 			valueNum, valueDenom := parseGnuCashValue(s.Value)
+			// Старые файлы могут не содержать quantity — тогда она равна value
+			quantityNum, quantityDenom := valueNum, valueDenom
+			if strings.TrimSpace(s.Quantity) != "" {
+				quantityNum, quantityDenom = parseGnuCashValue(s.Quantity)
+			}
 
 			parsedTx.Splits = append(parsedTx.Splits, ParsedSplit{
-				GUID:        s.ID.Value,
-				AccountGUID: s.Account.Value,
-				ValueNum:    valueNum,
-				ValueDenom:  valueDenom,
-				Memo:        s.Memo,
-				Action:      s.Action,
+				GUID:           s.ID.Value,
+				AccountGUID:    s.Account.Value,
+				ValueNum:       valueNum,
+				ValueDenom:     valueDenom,
+				QuantityNum:    quantityNum,
+				QuantityDenom:  quantityDenom,
+				Memo:           s.Memo,
+				Action:         s.Action,
+				ReconcileState: parseReconcileState(s.ReconciledState),
+				ReconcileDate:  parseGnuCashDate(s.ReconciledDate.Date),
 			})
 		}
 
@@ -344,6 +359,15 @@ func parseGnuCashDate(dateStr string) time.Time {
 	return time.Time{}
 }
 
+// parseReconcileState нормализует состояние сверки; пустое значение означает "n"
+func parseReconcileState(state string) string {
+	state = strings.TrimSpace(state)
+	if state == "" {
+		return "n"
+	}
+	return state
+}
+
 // parseGnuCashValue парсит значение в формате GnuCash (например, "10000/100")
 func parseGnuCashValue(valueStr string) (int64, int64) {
 	valueStr = strings.TrimSpace(valueStr)
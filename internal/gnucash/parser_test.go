@@ -172,6 +172,10 @@ func TestParseSimpleGnuCashXML(t *testing.T) {
       <splits>
         <split>
           <id type="guid">split-1</id>
+          <reconciled-state>y</reconciled-state>
+          <reconcile-date>
+            <date>2024-01-31 00:00:00 +0300</date>
+          </reconcile-date>
           <account type="guid">assets-guid-456</account>
           <value>10000/100</value>
           <quantity>10000/100</quantity>
@@ -211,6 +215,59 @@ func TestParseSimpleGnuCashXML(t *testing.T) {
 			if split.ValueNum != 10000 || split.ValueDenom != 100 {
 				t.Errorf("Expected value 10000/100, got %d/%d", split.ValueNum, split.ValueDenom)
 			}
+			if split.ReconcileState != "y" || split.ReconcileDate.Format("2006-01-02") != "2024-01-31" {
+				t.Errorf("Expected reconciled 2024-01-31, got %q %v", split.ReconcileState, split.ReconcileDate)
+			}
 		}
 	}
 }
+
+func TestParseSplitQuantity(t *testing.T) {
+	// Покупка долларов: сплит USD-счёта хранит сумму в долларах в quantity
+	xmlData := `<?xml version="1.0" encoding="utf-8" ?>
+<gnc-v2>
+  <book>
+    <transaction>
+      <id type="guid">tx-usd</id>
+      <currency>
+        <space>CURRENCY</space>
+        <id>RUB</id>
+      </currency>
+      <date-posted>
+        <date>2024-02-01 12:00:00 +0300</date>
+      </date-posted>
+      <description>Покупка валюты</description>
+      <splits>
+        <split>
+          <id type="guid">split-usd</id>
+          <account type="guid">usd-guid</account>
+          <value>900000/100</value>
+          <quantity>10000/100</quantity>
+        </split>
+        <split>
+          <id type="guid">split-rub</id>
+          <account type="guid">rub-guid</account>
+          <value>-900000/100</value>
+        </split>
+      </splits>
+    </transaction>
+  </book>
+</gnc-v2>`
+
+	result, err := ParseReaderWithFallback([]byte(xmlData))
+	if err != nil {
+		t.Fatalf("ParseReaderWithFallback failed: %v", err)
+	}
+	if len(result.Transactions) != 1 || len(result.Transactions[0].Splits) != 2 {
+		t.Fatalf("Unexpected transactions: %+v", result.Transactions)
+	}
+
+	usd, rub := result.Transactions[0].Splits[0], result.Transactions[0].Splits[1]
+	if usd.ValueNum != 900000 || usd.QuantityNum != 10000 || usd.QuantityDenom != 100 {
+		t.Errorf("Unexpected USD split: %+v", usd)
+	}
+	// Без quantity сумма в валюте счёта равна value
+	if rub.QuantityNum != -900000 || rub.QuantityDenom != 100 {
+		t.Errorf("Unexpected RUB split: %+v", rub)
+	}
+}
@@ -0,0 +1,268 @@
+package gnucash
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteHeader — первые байты любого файла базы SQLite 3
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// IsSQLite проверяет, что данные — база SQLite, а не XML
+func IsSQLite(data []byte) bool {
+	return bytes.HasPrefix(data, sqliteHeader)
+}
+
+// Parse разбирает файл GnuCash в любом из форматов хранения:
+// SQLite, сжатый gzip XML или обычный XML
+func Parse(data []byte) (*ParsedData, error) {
+	if !IsSQLite(data) {
+		return ParseReaderWithFallback(data)
+	}
+
+	// Драйвер SQLite работает только с файлами на диске
+	tmp, err := os.CreateTemp("", "gnucash-*.sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	return ParseSQLiteFile(tmp.Name())
+}
+
+// ParseSQLiteFile читает книгу GnuCash, сохранённую в формате SQLite.
+// Счета и транзакции шаблонов запланированных операций (дерево
+// root_template_guid) пропускаются — в XML они тоже хранятся отдельно.
+func ParseSQLiteFile(filename string) (*ParsedData, error) {
+	db, err := sql.Open("sqlite", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GnuCash database: %w", err)
+	}
+	defer db.Close()
+
+	result := &ParsedData{
+		Commodities:  make([]ParsedCommodity, 0),
+		Accounts:     make([]ParsedAccount, 0),
+		Transactions: make([]ParsedTransaction, 0),
+	}
+
+	// В SQLite счета ссылаются на валюту по guid, а ParsedData — по Space:ID,
+	// как в XML. Запоминаем соответствие.
+	commodityRefs, err := readSQLiteCommodities(db, result)
+	if err != nil {
+		return nil, err
+	}
+
+	templateAccounts, err := readSQLiteAccounts(db, result, commodityRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readSQLiteTransactions(db, result, commodityRefs, templateAccounts); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// readSQLiteCommodities читает валюты и возвращает отображение guid -> Space:ID
+func readSQLiteCommodities(db *sql.DB, result *ParsedData) (map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT guid, namespace, mnemonic, fullname, fraction, quote_source, quote_tz
+		FROM commodities
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commodities: %w", err)
+	}
+	defer rows.Close()
+
+	refs := make(map[string]string)
+	for rows.Next() {
+		var c ParsedCommodity
+		var fullname, quoteSource, quoteTZ sql.NullString
+		if err := rows.Scan(&c.GUID, &c.Space, &c.Mnemonic, &fullname, &c.Fraction,
+			&quoteSource, &quoteTZ); err != nil {
+			return nil, fmt.Errorf("failed to scan commodity: %w", err)
+		}
+		c.Fullname = fullname.String
+		c.QuoteSource = quoteSource.String
+		c.QuoteTZ = quoteTZ.String
+
+		refs[c.GUID] = c.Space + ":" + c.Mnemonic
+		result.Commodities = append(result.Commodities, c)
+	}
+
+	return refs, rows.Err()
+}
+
+// readSQLiteAccounts читает счета и возвращает множество guid счетов шаблонов
+func readSQLiteAccounts(db *sql.DB, result *ParsedData, commodityRefs map[string]string) (map[string]bool, error) {
+	var templateRoot sql.NullString
+	if err := db.QueryRow("SELECT root_template_guid FROM books LIMIT 1").Scan(&templateRoot); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query book: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT guid, name, account_type, commodity_guid, commodity_scu, non_std_scu,
+		       parent_guid, code, description, hidden, placeholder
+		FROM accounts
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []ParsedAccount
+	parents := make(map[string]string)
+	for rows.Next() {
+		var a ParsedAccount
+		var commodityGUID, parentGUID, code, description sql.NullString
+		var hidden, placeholder sql.NullInt64
+		if err := rows.Scan(&a.GUID, &a.Name, &a.AccountType, &commodityGUID, &a.CommoditySCU,
+			&a.NonStdSCU, &parentGUID, &code, &description, &hidden, &placeholder); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		a.CommodityRef = commodityRefs[commodityGUID.String]
+		a.ParentGUID = parentGUID.String
+		a.Code = code.String
+		a.Description = description.String
+		a.Hidden = hidden.Int64 == 1
+		a.Placeholder = placeholder.Int64 == 1
+
+		parents[a.GUID] = a.ParentGUID
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	templateAccounts := make(map[string]bool)
+	for _, a := range accounts {
+		if templateRoot.Valid && underRoot(a.GUID, templateRoot.String, parents) {
+			templateAccounts[a.GUID] = true
+			continue
+		}
+		result.Accounts = append(result.Accounts, a)
+	}
+
+	return templateAccounts, nil
+}
+
+// underRoot проверяет, что счёт guid — это root или его потомок
+func underRoot(guid, root string, parents map[string]string) bool {
+	// Ограничение глубины защищает от циклов в повреждённом файле
+	for depth := 0; guid != "" && depth <= len(parents); depth++ {
+		if guid == root {
+			return true
+		}
+		guid = parents[guid]
+	}
+	return false
+}
+
+// readSQLiteTransactions читает транзакции вместе со сплитами
+func readSQLiteTransactions(db *sql.DB, result *ParsedData, commodityRefs map[string]string, templateAccounts map[string]bool) error {
+	splitRows, err := db.Query(`
+		SELECT guid, tx_guid, account_guid, memo, action, reconcile_state, reconcile_date,
+		       value_num, value_denom, quantity_num, quantity_denom
+		FROM splits
+		ORDER BY tx_guid, rowid
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query splits: %w", err)
+	}
+	defer splitRows.Close()
+
+	splits := make(map[string][]ParsedSplit)
+	for splitRows.Next() {
+		var s ParsedSplit
+		var txGUID string
+		var memo, action, reconcileState, reconcileDate sql.NullString
+		if err := splitRows.Scan(&s.GUID, &txGUID, &s.AccountGUID, &memo, &action,
+			&reconcileState, &reconcileDate, &s.ValueNum, &s.ValueDenom,
+			&s.QuantityNum, &s.QuantityDenom); err != nil {
+			return fmt.Errorf("failed to scan split: %w", err)
+		}
+		if templateAccounts[s.AccountGUID] {
+			continue
+		}
+		if s.ValueDenom == 0 {
+			s.ValueDenom = 100
+		}
+		if s.QuantityDenom == 0 {
+			s.QuantityDenom = s.ValueDenom
+		}
+		s.Memo = memo.String
+		s.Action = action.String
+		s.ReconcileState = parseReconcileState(reconcileState.String)
+		// Несверенные сплиты GnuCash хранит с пустой датой или началом эпохи
+		if date := parseSQLiteDate(reconcileDate.String); date.Unix() > 0 {
+			s.ReconcileDate = date
+		}
+		splits[txGUID] = append(splits[txGUID], s)
+	}
+	if err := splitRows.Err(); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT guid, currency_guid, num, post_date, enter_date, description
+		FROM transactions
+		ORDER BY post_date, rowid
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t ParsedTransaction
+		var currencyGUID string
+		var num, postDate, enterDate, description sql.NullString
+		if err := rows.Scan(&t.GUID, &currencyGUID, &num, &postDate, &enterDate, &description); err != nil {
+			return fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		// Транзакции шаблонов остаются без сплитов — пропускаем их
+		t.Splits = splits[t.GUID]
+		if len(t.Splits) == 0 {
+			continue
+		}
+
+		t.CurrencyRef = commodityRefs[currencyGUID]
+		t.Num = num.String
+		t.PostDate = parseSQLiteDate(postDate.String)
+		t.EnterDate = parseSQLiteDate(enterDate.String)
+		t.Description = description.String
+
+		result.Transactions = append(result.Transactions, t)
+	}
+
+	return rows.Err()
+}
+
+// parseSQLiteDate парсит дату из SQLite-книги GnuCash (всегда UTC).
+// GnuCash 3+ пишет "2024-01-15 10:59:00", более старые версии — "20240115105900".
+func parseSQLiteDate(dateStr string) time.Time {
+	dateStr = strings.TrimSpace(dateStr)
+	for _, format := range []string{"2006-01-02 15:04:05", "20060102150405"} {
+		if t, err := time.Parse(format, dateStr); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,174 @@
+package gnucash
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseSQLiteDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2024-01-15 10:59:00", "2024-01-15 10:59"},
+		{"20131231210000", "2013-12-31 21:00"},
+		{"", "0001-01-01 00:00"},
+		{"garbage", "0001-01-01 00:00"},
+	}
+
+	for _, test := range tests {
+		result := parseSQLiteDate(test.input)
+		if result.Format("2006-01-02 15:04") != test.expected {
+			t.Errorf("parseSQLiteDate(%q) = %v, expected %v", test.input, result.Format("2006-01-02 15:04"), test.expected)
+		}
+	}
+}
+
+func TestParseSQLiteFile(t *testing.T) {
+	result, err := ParseSQLiteFile("testdata/book.gnucash")
+	if err != nil {
+		t.Fatalf("ParseSQLiteFile failed: %v", err)
+	}
+
+	if len(result.Commodities) != 2 {
+		t.Errorf("Expected 2 commodities, got %d", len(result.Commodities))
+	}
+
+	// 8 счетов книги, Template Root и его потомок пропускаются
+	if len(result.Accounts) != 8 {
+		t.Fatalf("Expected 8 accounts, got %d", len(result.Accounts))
+	}
+
+	accounts := make(map[string]ParsedAccount)
+	for _, a := range result.Accounts {
+		accounts[a.Name] = a
+	}
+	if _, ok := accounts["Template Root"]; ok {
+		t.Error("Template Root should be skipped")
+	}
+
+	cash := accounts["Наличные"]
+	if cash.AccountType != "CASH" || cash.Code != "101" || cash.Description != "Кошелёк" {
+		t.Errorf("Unexpected cash account: %+v", cash)
+	}
+	if cash.CommodityRef != "CURRENCY:RUB" {
+		t.Errorf("Expected commodity ref CURRENCY:RUB, got %q", cash.CommodityRef)
+	}
+	if cash.ParentGUID != accounts["Активы"].GUID {
+		t.Errorf("Expected parent Активы, got %q", cash.ParentGUID)
+	}
+	if !accounts["Активы"].Placeholder || !accounts["Доллары"].Hidden {
+		t.Error("Placeholder/hidden flags lost")
+	}
+	if accounts["Доллары"].CommodityRef != "CURRENCY:USD" {
+		t.Errorf("Expected commodity ref CURRENCY:USD, got %q", accounts["Доллары"].CommodityRef)
+	}
+
+	if len(result.Transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(result.Transactions))
+	}
+
+	salary := result.Transactions[0]
+	if salary.Description != "Зарплата" || salary.CurrencyRef != "CURRENCY:RUB" {
+		t.Errorf("Unexpected transaction: %+v", salary)
+	}
+	if !salary.PostDate.Equal(time.Date(2024, 1, 15, 10, 59, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected post date %v", salary.PostDate)
+	}
+	if len(salary.Splits) != 2 || salary.Splits[0].Memo != "аванс" || salary.Splits[1].Action != "Income" {
+		t.Errorf("Unexpected splits: %+v", salary.Splits)
+	}
+
+	shop := result.Transactions[1]
+	if shop.Num != "42" || len(shop.Splits) != 3 {
+		t.Fatalf("Unexpected transaction: %+v", shop)
+	}
+	if s := salary.Splits[0]; s.ReconcileState != "n" || !s.ReconcileDate.IsZero() {
+		t.Errorf("Expected unreconciled split, got %q %v", s.ReconcileState, s.ReconcileDate)
+	}
+	if s := shop.Splits[2]; s.ReconcileState != "c" {
+		t.Errorf("Expected cleared split, got %+v", s)
+	}
+	var sum int64
+	for _, s := range shop.Splits {
+		if s.ValueDenom != 100 {
+			t.Errorf("Expected denom 100, got %d", s.ValueDenom)
+		}
+		if s.QuantityNum != s.ValueNum || s.QuantityDenom != s.ValueDenom {
+			t.Errorf("Expected quantity equal to value, got %+v", s)
+		}
+		sum += s.ValueNum
+	}
+	if sum != 0 {
+		t.Errorf("Splits are not balanced: %d", sum)
+	}
+}
+
+func TestParseSQLiteFileLegacy(t *testing.T) {
+	result, err := ParseSQLiteFile("testdata/legacy.gnucash")
+	if err != nil {
+		t.Fatalf("ParseSQLiteFile failed: %v", err)
+	}
+
+	if len(result.Accounts) != 3 || len(result.Transactions) != 1 {
+		t.Fatalf("Expected 3 accounts and 1 transaction, got %d and %d",
+			len(result.Accounts), len(result.Transactions))
+	}
+
+	tx := result.Transactions[0]
+	if !tx.PostDate.Equal(time.Date(2013, 12, 31, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected post date %v", tx.PostDate)
+	}
+	if tx.CurrencyRef != "ISO4217:RUB" {
+		t.Errorf("Expected currency ref ISO4217:RUB, got %q", tx.CurrencyRef)
+	}
+	reconciled := false
+	for _, s := range tx.Splits {
+		if s.ReconcileState == "y" {
+			reconciled = s.ReconcileDate.Equal(time.Date(2014, 1, 10, 0, 0, 0, 0, time.UTC))
+		}
+	}
+	if !reconciled {
+		t.Errorf("Expected reconciled split dated 2014-01-10: %+v", tx.Splits)
+	}
+}
+
+func TestParseDetectsFormat(t *testing.T) {
+	data, err := os.ReadFile("testdata/book.gnucash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSQLite(data) {
+		t.Fatal("book.gnucash should be detected as SQLite")
+	}
+
+	result, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse (SQLite) failed: %v", err)
+	}
+	if len(result.Transactions) != 2 {
+		t.Errorf("Expected 2 transactions, got %d", len(result.Transactions))
+	}
+
+	xmlData := []byte(`<?xml version="1.0" encoding="utf-8" ?>
+<gnc-v2>
+  <book>
+    <commodity>
+      <space>CURRENCY</space>
+      <id>RUB</id>
+      <fraction>100</fraction>
+    </commodity>
+  </book>
+</gnc-v2>`)
+	if IsSQLite(xmlData) {
+		t.Fatal("XML should not be detected as SQLite")
+	}
+	result, err = Parse(xmlData)
+	if err != nil {
+		t.Fatalf("Parse (XML) failed: %v", err)
+	}
+	if len(result.Commodities) != 1 {
+		t.Errorf("Expected 1 commodity, got %d", len(result.Commodities))
+	}
+}
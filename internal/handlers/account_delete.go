@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/networth"
+)
+
+// accountDeletion — что затронет удаление счёта: показывается пользователю
+// до удаления, чтобы он выбрал, куда деть дочерние счета и операции
+type accountDeletion struct {
+	Account      *models.Account
+	Parent       *models.Account // nil — счёт верхнего уровня
+	Children     int
+	Transactions int
+	Splits       int
+	Scheduled    int      // запланированные транзакции со сплитами на счёте
+	Imported     int      // идентификаторы операций банка (FITID) из выписок OFX
+	Budgets      int      // месяцы бюджета: переносятся с операциями, иначе удаляются
+	Profiles     []string // профили импорта выписок, которые ссылаются на счёт
+}
+
+// HasOperations — у счёта есть операции, запланированные операции или
+// идентификаторы импорта: удаление требует выбора, перенести их или удалить
+func (d *accountDeletion) HasOperations() bool {
+	return d.Splits > 0 || d.Scheduled > 0 || d.Imported > 0
+}
+
+// previewAccountDeletion считает дочерние счета, транзакции, запланированные
+// транзакции, идентификаторы импорта и месяцы бюджета удаляемого счёта и
+// находит профили импорта, которые на него ссылаются
+func (h *Handler) previewAccountDeletion(userID int64, account *models.Account) (*accountDeletion, error) {
+	d := &accountDeletion{Account: account}
+	if account.ParentID != nil {
+		parent, err := h.getAccount(userID, *account.ParentID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		d.Parent = parent
+	}
+
+	err := h.db.QueryRow("SELECT COUNT(*) FROM accounts WHERE parent_id = ? AND user_id = ?",
+		account.ID, userID).Scan(&d.Children)
+	if err != nil {
+		return nil, err
+	}
+	err = h.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT tx_id) FROM splits WHERE account_id = ? AND user_id = ?
+	`, account.ID, userID).Scan(&d.Splits, &d.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	err = h.db.QueryRow(`
+		SELECT COUNT(DISTINCT scheduled_id) FROM scheduled_splits WHERE account_id = ? AND user_id = ?
+	`, account.ID, userID).Scan(&d.Scheduled)
+	if err != nil {
+		return nil, err
+	}
+	err = h.db.QueryRow("SELECT COUNT(*) FROM statement_fitids WHERE account_id = ? AND user_id = ?",
+		account.ID, userID).Scan(&d.Imported)
+	if err != nil {
+		return nil, err
+	}
+	err = h.db.QueryRow("SELECT COUNT(*) FROM budgets WHERE account_id = ? AND user_id = ?",
+		account.ID, userID).Scan(&d.Budgets)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.db.Query(`
+		SELECT name FROM import_profiles
+		WHERE user_id = ? AND (account_id = ? OR counterpart_id = ?)
+		ORDER BY name
+	`, userID, account.ID, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		d.Profiles = append(d.Profiles, name)
+	}
+	return d, rows.Err()
+}
+
+// accountTransactionIDs возвращает транзакции, в которых участвует счёт
+func accountTransactionIDs(tx *sql.Tx, userID, accountID int64) ([]interface{}, error) {
+	rows, err := tx.Query("SELECT DISTINCT tx_id FROM splits WHERE account_id = ? AND user_id = ?",
+		accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []interface{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// APIAccountDeleteFormGet - HTML-фрагмент для drawer-а удаления счёта:
+// сколько дочерних счетов и транзакций затронет удаление и что с ними сделать
+func (h *Handler) APIAccountDeleteFormGet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	accountID, err := strconv.ParseInt(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	preview, err := h.previewAccountDeletion(userID, account)
+	if err != nil {
+		fmt.Printf("ERROR previewing deletion of account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accounts, _ := h.getAccounts(userID)
+
+	h.renderTemplate(w, "finance_account_delete_form.html", map[string]interface{}{
+		"Preview":  preview,
+		"Accounts": accounts,
+	})
+}
+
+// APIAccountDelete - удаление счёта.
+// Счёт с дочерними счетами удаляется только с children=move: дочерние
+// переносятся к родителю удаляемого счёта. Счёт с операциями удаляется только
+// с явным выбором: splits=reassign&target_id=N переносит сплиты на другой счёт
+// в той же валюте, splits=delete удаляет транзакции целиком, со всеми сплитами,
+// чтобы в книге не осталось несбалансированных транзакций. Так же, вместе
+// с операциями, переносятся или удаляются запланированные транзакции счёта,
+// идентификаторы импортированных операций банка и бюджет; профили импорта
+// выписок при переносе переходят на новый счёт, иначе остаются без счёта.
+func (h *Handler) APIAccountDelete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	// Получаем ID счета из параметров запроса
+	query := r.URL.Query()
+	accountIDStr := query.Get("id")
+	if accountIDStr == "" {
+		http.Error(w, "Missing account ID", http.StatusBadRequest)
+		return
+	}
+
+	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	var targetID int64
+	if query.Get("splits") == "reassign" {
+		targetID, _ = strconv.ParseInt(query.Get("target_id"), 10, 64)
+	}
+
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID, targetID}}); err != nil {
+		if errors.Is(err, errNotOwned) {
+			http.Error(w, "Account not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	preview, err := h.previewAccountDeletion(userID, account)
+	if err != nil {
+		fmt.Printf("ERROR previewing deletion of account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fail := func(message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	if preview.Children > 0 && query.Get("children") != "move" {
+		fail("У счёта есть дочерние счета — перенесите их к родительскому счёту")
+		return
+	}
+
+	if preview.HasOperations() {
+		switch query.Get("splits") {
+		case "reassign":
+			if targetID == 0 || targetID == accountID {
+				fail("Выберите счёт, на который перенести операции")
+				return
+			}
+			target, err := h.getAccount(userID, targetID)
+			if err != nil {
+				http.Error(w, "Account not found", http.StatusNotFound)
+				return
+			}
+			if target.Placeholder == 1 {
+				fail("Нельзя перенести операции на контейнерный счёт")
+				return
+			}
+			// Суммы сплитов (quantity) записаны в валюте счёта
+			if target.CommodityID != account.CommodityID {
+				fail("Операции можно перенести только на счёт в той же валюте")
+				return
+			}
+		case "delete":
+		default:
+			fail(fmt.Sprintf("Счёт участвует в транзакциях (%d) и запланированных транзакциях (%d) — выберите счёт для переноса операций или удалите транзакции",
+				preview.Transactions, preview.Scheduled))
+			return
+		}
+	}
+
+	// Начинаем транзакцию
+	tx, err := h.db.Begin()
+	if err != nil {
+		fmt.Printf("ERROR starting transaction: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Дочерние счета поднимаем на уровень удаляемого
+	if preview.Children > 0 {
+		var parentID sql.NullInt64
+		if account.ParentID != nil {
+			parentID = sql.NullInt64{Int64: *account.ParentID, Valid: true}
+		}
+		_, err = tx.Exec("UPDATE accounts SET parent_id = ? WHERE parent_id = ? AND user_id = ?",
+			parentID, accountID, userID)
+		if err != nil {
+			fmt.Printf("ERROR moving child accounts: %v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if preview.HasOperations() {
+		if targetID != 0 {
+			_, err = moveAccountOperations(tx, userID, accountID, targetID)
+		} else {
+			err = deleteAccountTransactions(tx, userID, accountID)
+			if err == nil {
+				err = deleteAccountSchedules(tx, userID, accountID)
+			}
+			if err == nil {
+				_, err = tx.Exec("DELETE FROM statement_fitids WHERE account_id = ? AND user_id = ?", accountID, userID)
+			}
+		}
+		if err == nil && preview.Splits > 0 {
+			err = networth.Invalidate(tx, userID, time.Time{})
+		}
+		if err != nil {
+			fmt.Printf("ERROR handling splits of account %d: %v\n", accountID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Бюджет, не перенесённый вместе с операциями, удаляется со счётом,
+	// а профили импорта остаются без этого счёта — их нужно настроить заново
+	_, err = tx.Exec("DELETE FROM budgets WHERE account_id = ? AND user_id = ?", accountID, userID)
+	for _, column := range []string{"account_id", "counterpart_id"} {
+		if err == nil {
+			_, err = tx.Exec("UPDATE import_profiles SET "+column+" = NULL WHERE "+column+" = ? AND user_id = ?",
+				accountID, userID)
+		}
+	}
+	if err != nil {
+		fmt.Printf("ERROR detaching account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", accountID, userID)
+	if err != nil {
+		fmt.Printf("ERROR deleting account: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Проверяем, был ли удален счет
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	// Коммитим транзакцию
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("ERROR committing transaction: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Возвращаем пустой ответ для HTMX
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAccountTransactions удаляет транзакции счёта вместе со сплитами
+// на других счетах
+func deleteAccountTransactions(tx *sql.Tx, userID, accountID int64) error {
+	ids, err := accountTransactionIDs(tx, userID, accountID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := append([]interface{}{userID}, ids...)
+	if _, err := tx.Exec("DELETE FROM splits WHERE user_id = ? AND tx_id IN ("+placeholders+")", args...); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM transactions WHERE user_id = ? AND id IN ("+placeholders+")", args...)
+	return err
+}
+
+// deleteAccountSchedules удаляет запланированные транзакции счёта целиком,
+// со сплитами на других счетах и историей запусков, как schedule.Delete
+func deleteAccountSchedules(tx *sql.Tx, userID, accountID int64) error {
+	rows, err := tx.Query("SELECT DISTINCT scheduled_id FROM scheduled_splits WHERE account_id = ? AND user_id = ?",
+		accountID, userID)
+	if err != nil {
+		return err
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := append([]interface{}{userID}, ids...)
+	for _, table := range []string{"scheduled_splits", "scheduled_occurrences"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ? AND scheduled_id IN ("+placeholders+")", args...); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM scheduled_transactions WHERE user_id = ? AND id IN ("+placeholders+")", args...)
+	return err
+}
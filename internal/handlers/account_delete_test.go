@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deleteAccount удаляет счёт с параметрами выбора из формы удаления
+func deleteAccount(t *testing.T, h *Handler, userID, accountID int64, params url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("id", fmt.Sprint(accountID))
+	return doRequest(t, h, userID, h.APIAccountDelete, http.MethodDelete, "/?"+params.Encode(), nil, "", nil)
+}
+
+// accountBudgets возвращает бюджет счёта по месяцам: "2026-03=15000/100 ..."
+func accountBudgets(t *testing.T, h *Handler, accountID int64) string {
+	t.Helper()
+	rows, err := h.db.Query("SELECT month, amount_num, amount_denom FROM budgets WHERE account_id = ? ORDER BY month", accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var month time.Time
+		var num, denom int64
+		if err := rows.Scan(&month, &num, &denom); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, fmt.Sprintf("%s=%d/%d", month.Format("2006-01"), num, denom))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestAccountDeletePreview(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	transport := accountIDByName(t, h, userID, "Транспорт")
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Магазин", "", [3]int64{card, -1999, 100}, [3]int64{food, 1999, 100})
+	insertTx(t, h, userID, day, "Магазин и метро", "",
+		[3]int64{card, -2500, 100}, [3]int64{food, 2000, 100}, [3]int64{transport, 500, 100})
+	saveBudget(t, h, userID, food, "2026-03", "100")
+
+	account, err := h.getAccount(userID, food)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview, err := h.previewAccountDeletion(userID, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Transactions != 2 || preview.Splits != 2 || preview.Children != 0 || preview.Budgets != 1 {
+		t.Errorf("food preview = %d tx, %d splits, %d children, %d budgets",
+			preview.Transactions, preview.Splits, preview.Children, preview.Budgets)
+	}
+	if preview.Parent == nil || preview.Parent.Name != "Расходы" {
+		t.Errorf("food parent = %v", preview.Parent)
+	}
+}
+
+func TestAccountDeleteChildren(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	current := accountIDByName(t, h, userID, "Текущие активы")
+	assets := accountIDByName(t, h, userID, "Активы")
+	cash := accountIDByName(t, h, userID, "Наличные")
+
+	// Без явного переноса дочерних счетов удаление отклоняется
+	if rec := deleteAccount(t, h, userID, current, nil); rec.Code != 400 {
+		t.Fatalf("expected 400, got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := h.getAccount(userID, current); err != nil {
+		t.Fatalf("refused delete removed the account: %v", err)
+	}
+
+	if rec := deleteAccount(t, h, userID, current, url.Values{"children": {"move"}}); rec.Code != 204 {
+		t.Fatalf("expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	account, err := h.getAccount(userID, cash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ParentID == nil || *account.ParentID != assets {
+		t.Errorf("cash parent = %v, expected %d", account.ParentID, assets)
+	}
+}
+
+func TestAccountDeleteSplits(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	transport := accountIDByName(t, h, userID, "Транспорт")
+	expenses := accountIDByName(t, h, userID, "Расходы")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Магазин", "", [3]int64{card, -1999, 100}, [3]int64{food, 1999, 100})
+	insertTx(t, h, userID, day, "Зарплата", "", [3]int64{card, 100000, 100}, [3]int64{salary, -100000, 100})
+	saveBudget(t, h, userID, food, "2026-03", "100")
+	saveBudget(t, h, userID, food, "2026-04", "30")
+	saveBudget(t, h, userID, transport, "2026-03", "50")
+	saveBudget(t, h, userID, salary, "2026-03", "1000")
+
+	// Операции без явного выбора не удаляются
+	if rec := deleteAccount(t, h, userID, food, nil); rec.Code != 400 {
+		t.Fatalf("expected 400, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := deleteAccount(t, h, userID, food, url.Values{"splits": {"reassign"}, "target_id": {fmt.Sprint(expenses)}}); rec.Code != 400 {
+		t.Fatalf("placeholder target: expected 400, got %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, h, "splits", userID); n != 4 {
+		t.Fatalf("refused deletes changed splits: %d", n)
+	}
+
+	if rec := deleteAccount(t, h, userID, food, url.Values{"splits": {"reassign"}, "target_id": {fmt.Sprint(transport)}}); rec.Code != 204 {
+		t.Fatalf("reassign: expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	balances := bookBalances(t, h, userID)
+	if got := balances["Расходы:Транспорт"]; got != "1999/100" {
+		t.Errorf("transport balance = %s, expected 1999/100", got)
+	}
+	if _, ok := balances["Расходы:Продукты"]; ok {
+		t.Error("food account still exists")
+	}
+	// Бюджет переходит вместе с операциями и складывается с бюджетом цели
+	if got := accountBudgets(t, h, transport); got != "2026-03=15000/100 2026-04=3000/100" {
+		t.Errorf("transport budgets = %s", got)
+	}
+	if got := accountBudgets(t, h, food); got != "" {
+		t.Errorf("food budgets left behind: %s", got)
+	}
+
+	// Удаление транзакций целиком не оставляет несбалансированных сплитов
+	if rec := deleteAccount(t, h, userID, salary, url.Values{"splits": {"delete"}}); rec.Code != 204 {
+		t.Fatalf("delete: expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, h, "transactions", userID); n != 1 {
+		t.Errorf("%d transactions left, expected 1", n)
+	}
+	if got := accountBudgets(t, h, salary); got != "" {
+		t.Errorf("salary budgets left behind: %s", got)
+	}
+	if got := bookBalances(t, h, userID)["Активы:Текущие активы:Расчетный счет"]; got != "-1999/100" {
+		t.Errorf("card balance = %s, expected -1999/100", got)
+	}
+}
+
+func TestAccountDeleteSchedulesAndImports(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	cash := accountIDByName(t, h, userID, "Наличные")
+	food := accountIDByName(t, h, userID, "Продукты")
+	transport := accountIDByName(t, h, userID, "Транспорт")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	// Транспорт есть только в расписании, Наличные — только в отметке импорта:
+	// проведённая операция выписки потом перенесена на карту
+	code, resp := postJSON(t, h, userID, h.APIScheduledSave, scheduleForm("Проездной", "monthly", "2026-03-01", transport, card))
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("schedule save failed: %d %v", code, resp)
+	}
+	txID := insertTx(t, h, userID, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "Возврат", "",
+		[3]int64{cash, 50000, 100}, [3]int64{salary, -50000, 100})
+	if _, err := h.db.Exec("INSERT INTO statement_fitids (account_id, fitid, user_id, tx_id) VALUES (?, 'F1', ?, ?)",
+		cash, userID, txID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.db.Exec("UPDATE splits SET account_id = ? WHERE account_id = ?", card, cash); err != nil {
+		t.Fatal(err)
+	}
+	code, resp = postJSON(t, h, userID, h.APICSVProfileSave, url.Values{
+		"name": {"Мой банк"}, "delimiter": {";"}, "encoding": {"utf-8"}, "date_format": {"02.01.2006"},
+		"date_column": {"1"}, "amount_column": {"2"},
+		"account_id": {fmt.Sprint(cash)}, "counterpart_id": {fmt.Sprint(transport)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("profile save failed: %d %v", code, resp)
+	}
+	profile := func() string {
+		t.Helper()
+		var accountID, counterpartID sql.NullInt64
+		h.db.QueryRow("SELECT account_id, counterpart_id FROM import_profiles WHERE user_id = ?", userID).
+			Scan(&accountID, &counterpartID)
+		return fmt.Sprintf("%d/%d", accountID.Int64, counterpartID.Int64)
+	}
+
+	for _, tt := range []struct {
+		account             int64
+		scheduled, imported int
+	}{{transport, 1, 0}, {cash, 0, 1}} {
+		account, err := h.getAccount(userID, tt.account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		preview, err := h.previewAccountDeletion(userID, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.Splits != 0 || preview.Scheduled != tt.scheduled || preview.Imported != tt.imported ||
+			fmt.Sprint(preview.Profiles) != "[Мой банк]" {
+			t.Errorf("%s preview = %+v", account.Name, preview)
+		}
+		if rec := deleteAccount(t, h, userID, tt.account, nil); rec.Code != 400 {
+			t.Errorf("%s without a choice: expected 400, got %d", account.Name, rec.Code)
+		}
+	}
+
+	if rec := deleteAccount(t, h, userID, transport, url.Values{"splits": {"reassign"}, "target_id": {fmt.Sprint(food)}}); rec.Code != 204 {
+		t.Fatalf("reassign schedule: expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	var n int
+	h.db.QueryRow("SELECT COUNT(*) FROM scheduled_splits WHERE account_id = ?", food).Scan(&n)
+	if n != 1 || countRows(t, h, "scheduled_splits", userID) != 2 {
+		t.Errorf("schedule splits after reassign: %d on food", n)
+	}
+	if rec := deleteAccount(t, h, userID, cash, url.Values{"splits": {"reassign"}, "target_id": {fmt.Sprint(card)}}); rec.Code != 204 {
+		t.Fatalf("reassign import: expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	h.db.QueryRow("SELECT COUNT(*) FROM statement_fitids WHERE account_id = ? AND fitid = 'F1'", card).Scan(&n)
+	if n != 1 {
+		t.Error("imported FITID did not follow the reassigned operations")
+	}
+	// Профиль импорта следует за операциями, а при их удалении остаётся без счёта
+	if got, want := profile(), fmt.Sprintf("%d/%d", card, food); got != want {
+		t.Errorf("profile accounts after reassign = %s, expected %s", got, want)
+	}
+
+	// Удаление операций удаляет и расписание целиком, без половины сплитов
+	if rec := deleteAccount(t, h, userID, food, url.Values{"splits": {"delete"}}); rec.Code != 204 {
+		t.Fatalf("delete: expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, h, "scheduled_transactions", userID); n != 0 {
+		t.Errorf("%d schedules left, expected 0", n)
+	}
+	if n := countRows(t, h, "scheduled_splits", userID); n != 0 {
+		t.Errorf("%d schedule splits left, expected 0", n)
+	}
+	if got, want := profile(), fmt.Sprintf("%d/0", card); got != want {
+		t.Errorf("profile accounts after delete = %s, expected %s", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+// maxHistoryPoints ограничивает длину ряда баланса: чем длиннее период, тем крупнее шаг
+const maxHistoryPoints = 1000
+
+// historyPoint — баланс счёта на конец дня Date
+type historyPoint struct {
+	Date    time.Time
+	Balance models.Amount
+}
+
+// historyRange разбирает from, to и step. Без to — сегодня, без from — дата
+// первой проводки (first), без step — шаг по длине периода.
+func historyRange(query url.Values, first time.Time) (time.Time, time.Time, string, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := first
+
+	var err error
+	if s := query.Get("to"); s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, "", errors.New("Некорректная дата конца периода")
+		}
+	}
+	if s := query.Get("from"); s != "" {
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, "", errors.New("Некорректная дата начала периода")
+		}
+	}
+	// Без проводок до конца периода ряд состоит из одной точки
+	if from.IsZero() || from.After(to) && query.Get("from") == "" {
+		from = to
+	}
+	if to.Before(from) {
+		return from, to, "", errors.New("Конец периода раньше начала")
+	}
+
+	step := query.Get("step")
+	switch step {
+	case "day", "week", "month":
+	case "":
+		days := to.Sub(from).Hours() / 24
+		switch {
+		case days <= 92:
+			step = "day"
+		case days <= 731:
+			step = "week"
+		default:
+			step = "month"
+		}
+	default:
+		return from, to, "", errors.New("Шаг должен быть day, week или month")
+	}
+	return from, to, step, nil
+}
+
+// historyDates возвращает даты точек ряда: начало периода, затем конец
+// каждого шага (день, седьмой день недели от начала, последний день месяца);
+// последняя точка — конец периода
+func historyDates(from, to time.Time, step string) ([]time.Time, error) {
+	dates := []time.Time{from}
+	next := func(d time.Time) time.Time {
+		switch step {
+		case "week":
+			return d.AddDate(0, 0, 7)
+		case "month":
+			return time.Date(d.Year(), d.Month()+2, 0, 0, 0, 0, 0, time.UTC)
+		}
+		return d.AddDate(0, 0, 1)
+	}
+	d := from
+	if step == "month" {
+		d = time.Date(from.Year(), from.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+		if !d.After(from) {
+			d = next(d)
+		}
+	} else {
+		d = next(from)
+	}
+	for ; ; d = next(d) {
+		if len(dates) == maxHistoryPoints {
+			return nil, fmt.Errorf("Больше %d точек — выберите шаг крупнее", maxHistoryPoints)
+		}
+		if !d.Before(to) {
+			if to.After(from) {
+				dates = append(dates, to)
+			}
+			return dates, nil
+		}
+		dates = append(dates, d)
+	}
+}
+
+// historyAccounts возвращает счёт и, если он контейнерный, всех его потомков:
+// счёт → валюта. Суммы потомков в других валютах accountHistory пересчитывает.
+func (h *Handler) historyAccounts(userID int64, account *models.Account) (map[int64]int64, error) {
+	commodities := map[int64]int64{account.ID: account.CommodityID}
+	if account.Placeholder != 1 {
+		return commodities, nil
+	}
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	// getAccounts отдаёт дерево в порядке обхода: родитель раньше детей
+	for _, a := range accounts {
+		if a.ParentID != nil {
+			if _, ok := commodities[*a.ParentID]; ok {
+				commodities[a.ID] = a.CommodityID
+			}
+		}
+	}
+	return commodities, nil
+}
+
+// firstPostDate возвращает день первой проводки по счетам; нулевое время — проводок нет
+func (h *Handler) firstPostDate(userID int64, ids []int64) (time.Time, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	var first sql.NullTime
+	err := h.db.QueryRow(`
+		SELECT MIN(t.post_date)
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id IN (`+placeholders+`)
+	`, args...).Scan(&first)
+	if err != nil || !first.Valid {
+		return time.Time{}, err
+	}
+	d := first.Time
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// accountHistory возвращает баланс счетов (счёт → валюта, см. historyAccounts)
+// на конец каждой из дат (по возрастанию), со знаком как в дереве счетов.
+// Суммы в других валютах пересчитываются в валюту account по курсу на дату
+// точки; валюты без курса в баланс не входят и возвращаются вторым значением.
+func (h *Handler) accountHistory(userID int64, account *models.Account, commodities map[int64]int64, dates []time.Time) ([]historyPoint, []string, error) {
+	ids := make([]int64, 0, len(commodities))
+	for id := range commodities {
+		ids = append(ids, id)
+	}
+	// Курсы нужны, только если среди потомков есть счета в других валютах.
+	// Они загружаются один раз на весь ряд, до чтения сплитов.
+	var mnemonics map[int64]string
+	var rates *rateTimeline
+	mnemonic := func(commodityID int64) string {
+		if m := mnemonics[commodityID]; m != "" {
+			return m
+		}
+		return "RUB"
+	}
+	for _, commodityID := range commodities {
+		if commodityID != account.CommodityID && mnemonics == nil {
+			var err error
+			if mnemonics, err = h.commodityMnemonics(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if mnemonics != nil {
+		currencies := []string{mnemonic(account.CommodityID)}
+		for _, commodityID := range commodities {
+			currencies = append(currencies, mnemonic(commodityID))
+		}
+		var err error
+		if rates, err = h.loadRateTimeline(dates[0], dates[len(dates)-1], currencies); err != nil {
+			return nil, nil, err
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, dates[len(dates)-1].AddDate(0, 0, 1))
+	rows, err := h.db.Query(`
+		SELECT t.post_date, s.account_id, s.quantity_num, s.quantity_denom
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id IN (`+placeholders+`) AND t.post_date < ?
+		ORDER BY t.post_date
+	`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	missing := make(map[string]bool)
+	// balances — баланс по валютам счетов; чужие валюты пересчитываются
+	// в каждой точке заново, по своему курсу
+	balances := make(map[int64]models.Amount)
+	balanceAt := func(date time.Time) models.Amount {
+		balance := balances[account.CommodityID]
+		var converter *currencyConverter
+		for commodityID, sum := range balances {
+			if commodityID == account.CommodityID || sum.IsZero() {
+				continue
+			}
+			if converter == nil {
+				converter = newCurrencyConverter(rates.At(date), mnemonic(account.CommodityID))
+			}
+			if value, ok := converter.Convert(sum, mnemonic(commodityID)); ok {
+				balance = balance.Add(value)
+			}
+		}
+		if converter != nil {
+			for _, m := range converter.MissingCurrencies() {
+				missing[m] = true
+			}
+		}
+		return displayBalance(account, balance)
+	}
+
+	points := make([]historyPoint, 0, len(dates))
+	next := 0
+	for rows.Next() {
+		var postDate time.Time
+		var accountID, num, denom int64
+		if err := rows.Scan(&postDate, &accountID, &num, &denom); err != nil {
+			return nil, nil, err
+		}
+		// Закрываем точки, чей день закончился до этой проводки
+		for ; next < len(dates) && !postDate.Before(dates[next].AddDate(0, 0, 1)); next++ {
+			points = append(points, historyPoint{Date: dates[next], Balance: balanceAt(dates[next])})
+		}
+		commodityID := commodities[accountID]
+		balances[commodityID] = balances[commodityID].Add(models.NewAmount(num, denom))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	for ; next < len(dates); next++ {
+		points = append(points, historyPoint{Date: dates[next], Balance: balanceAt(dates[next])})
+	}
+
+	missingRates := make([]string, 0, len(missing))
+	for m := range missing {
+		missingRates = append(missingRates, m)
+	}
+	sort.Strings(missingRates)
+	return points, missingRates, nil
+}
+
+// APIAccountHistory - ряд баланса счёта для графика:
+// GET /api/v1/finance/account/{id}/history?from=&to=&step=day|week|month.
+// Для контейнерного счёта в баланс входят все дочерние счета; суммы в других
+// валютах пересчитываются по курсу на дату точки, валюты без курса
+// перечислены в missing_rates.
+func (h *Handler) APIAccountHistory(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+	serverError := func(err error) {
+		fmt.Printf("ERROR loading account history: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	accountID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		fail("Некорректный счёт")
+		return
+	}
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+
+	commodities, err := h.historyAccounts(userID, account)
+	if err != nil {
+		serverError(err)
+		return
+	}
+	ids := make([]int64, 0, len(commodities))
+	for id := range commodities {
+		ids = append(ids, id)
+	}
+	first, err := h.firstPostDate(userID, ids)
+	if err != nil {
+		serverError(err)
+		return
+	}
+	from, to, step, err := historyRange(r.URL.Query(), first)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	dates, err := historyDates(from, to, step)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	points, missing, err := h.accountHistory(userID, account, commodities, dates)
+	if err != nil {
+		serverError(err)
+		return
+	}
+
+	var mnemonic string
+	h.db.QueryRow("SELECT mnemonic FROM commodities WHERE id = ?", account.CommodityID).Scan(&mnemonic)
+
+	series := make([]map[string]interface{}, 0, len(points))
+	for _, p := range points {
+		series = append(series, map[string]interface{}{
+			"date":    p.Date.Format("2006-01-02"),
+			"balance": p.Balance.Float64(),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"account_id":    accountID,
+		"currency":      mnemonic,
+		"step":          step,
+		"points":        series,
+		"missing_rates": missing,
+	})
+}
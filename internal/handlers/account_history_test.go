@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHistoryDates(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		from, to, step string
+		want           []string
+	}{
+		{"2026-03-01", "2026-03-03", "day", []string{"2026-03-01", "2026-03-02", "2026-03-03"}},
+		{"2026-03-01", "2026-03-20", "week", []string{"2026-03-01", "2026-03-08", "2026-03-15", "2026-03-20"}},
+		{"2026-01-15", "2026-04-10", "month", []string{"2026-01-15", "2026-01-31", "2026-02-28", "2026-03-31", "2026-04-10"}},
+		// Начало в последний день месяца не повторяется
+		{"2026-01-31", "2026-03-31", "month", []string{"2026-01-31", "2026-02-28", "2026-03-31"}},
+		{"2026-03-01", "2026-03-01", "day", []string{"2026-03-01"}},
+	}
+	for _, tt := range tests {
+		dates, err := historyDates(day(tt.from), day(tt.to), tt.step)
+		if err != nil {
+			t.Fatalf("%s..%s %s: %v", tt.from, tt.to, tt.step, err)
+		}
+		var got []string
+		for _, d := range dates {
+			got = append(got, d.Format("2006-01-02"))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s..%s %s: %v, expected %v", tt.from, tt.to, tt.step, got, tt.want)
+		}
+	}
+	if _, err := historyDates(day("2020-01-01"), day("2026-01-01"), "day"); err == nil {
+		t.Error("expected too many points error")
+	}
+}
+
+func TestAccountHistory(t *testing.T) {
+	h := testHandler(t)
+	owner := createTestUser(t, h)
+	userID := createTestUser(t, h)
+	for _, id := range []int64{owner, userID} {
+		if err := h.createBaseAccounts(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	cash := accountIDByName(t, h, userID, "Наличные")
+	current := accountIDByName(t, h, userID, "Текущие активы")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	insertTx(t, h, userID, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), "Зарплата", "",
+		[3]int64{card, 500000, 100}, [3]int64{salary, -500000, 100})
+	insertTx(t, h, userID, time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC), "Снятие", "",
+		[3]int64{cash, 100000, 100}, [3]int64{card, -100000, 100})
+	insertTx(t, h, userID, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 20000, 100}, [3]int64{cash, -20000, 100})
+
+	history := func(accountID int64, query string) (int, map[string]interface{}) {
+		t.Helper()
+		rec := doRequest(t, h, userID, h.APIAccountHistory, "GET",
+			fmt.Sprintf("/api/v1/finance/account/%d/history?%s", accountID, query), nil, "",
+			map[string]string{"id": fmt.Sprint(accountID)})
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	balances := func(resp map[string]interface{}) string {
+		var out []string
+		for _, p := range resp["points"].([]interface{}) {
+			point := p.(map[string]interface{})
+			out = append(out, fmt.Sprintf("%s=%.2f", point["date"], point["balance"]))
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		name      string
+		accountID int64
+		query     string
+		want      string
+	}{
+		{"card by month", card, "from=2025-12-15&to=2026-03-31&step=month",
+			"[2025-12-15=0.00 2025-12-31=0.00 2026-01-31=5000.00 2026-02-28=4000.00 2026-03-31=4000.00]"},
+		// Контейнерный счёт включает дочерние: снятие наличных баланс не меняет
+		{"placeholder", current, "from=2026-02-04&to=2026-02-06&step=day",
+			"[2026-02-04=5000.00 2026-02-05=5000.00 2026-02-06=5000.00]"},
+		{"spending on the last day", cash, "from=2026-03-30&to=2026-03-31&step=day",
+			"[2026-03-30=1000.00 2026-03-31=800.00]"},
+		// Расходы показываются положительными, как в дереве счетов
+		{"expense", food, "from=2026-03-31&to=2026-03-31", "[2026-03-31=200.00]"},
+		// Без from ряд начинается с первой проводки
+		{"from first split", cash, "to=2026-02-06&step=day",
+			"[2026-02-05=1000.00 2026-02-06=1000.00]"},
+	}
+	for _, tt := range tests {
+		code, resp := history(tt.accountID, tt.query)
+		if code != 200 {
+			t.Fatalf("%s: %d %v", tt.name, code, resp)
+		}
+		if got := balances(resp); got != tt.want {
+			t.Errorf("%s: %s, expected %s", tt.name, got, tt.want)
+		}
+	}
+	if _, resp := history(card, "from=2026-01-01&to=2026-03-01"); resp["step"] != "day" || resp["currency"] != "RUB" {
+		t.Errorf("default step and currency: %v %v", resp["step"], resp["currency"])
+	}
+
+	for _, bad := range []string{"step=year", "from=2026-03-01&to=2026-02-01", "from=2000-01-01&step=day"} {
+		if code, resp := history(card, bad); code != 400 {
+			t.Errorf("%s: expected 400, got %d %v", bad, code, resp)
+		}
+	}
+	if code, _ := history(accountIDByName(t, h, owner, "Расчетный счет"), ""); code != 404 {
+		t.Errorf("foreign account: expected 404, got %d", code)
+	}
+}
+
+func TestAccountHistoryForeignChildren(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	dollars := accountIDByName(t, h, userID, "Сберегательный счет")
+	euros := accountIDByName(t, h, userID, "Наличные")
+	current := accountIDByName(t, h, userID, "Текущие активы")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	for _, c := range []struct {
+		account  int64
+		mnemonic string
+	}{{dollars, "USD"}, {euros, "EUR"}} {
+		if _, err := h.db.Exec(`UPDATE accounts SET commodity_id = (SELECT id FROM commodities WHERE mnemonic = ?)
+			WHERE id = ?`, c.mnemonic, c.account); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Курсы в далёком прошлом, чтобы не пересекаться с настоящими; курса EUR нет
+	for _, r := range []struct{ date, rate string }{{"1999-01-10", "80"}, {"1999-02-10", "90"}} {
+		if _, err := h.db.Exec(`
+			INSERT INTO currency_rates (code, name, rate, source, rate_date) VALUES ('USD/RUB', 'Доллар', ?, 'cbr', ?)
+		`, r.rate, r.date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { h.db.Exec("DELETE FROM currency_rates WHERE rate_date < '2000-01-01'") })
+
+	day := func(month, d int) time.Time { return time.Date(1999, time.Month(month), d, 0, 0, 0, 0, time.UTC) }
+	insertTx(t, h, userID, day(1, 5), "Зарплата", "", [3]int64{card, 100000, 100}, [3]int64{salary, -100000, 100})
+	insertTx(t, h, userID, day(1, 15), "Доллары", "", [3]int64{dollars, 1000, 100}, [3]int64{salary, -80000, 100})
+	insertTx(t, h, userID, day(1, 20), "Евро", "", [3]int64{euros, 500, 100}, [3]int64{salary, -45000, 100})
+
+	history := func(accountID int64) map[string]interface{} {
+		t.Helper()
+		rec := doRequest(t, h, userID, h.APIAccountHistory, "GET",
+			fmt.Sprintf("/api/v1/finance/account/%d/history?from=1999-01-09&to=1999-02-28&step=month", accountID),
+			nil, "", map[string]string{"id": fmt.Sprint(accountID)})
+		if rec.Code != 200 {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// Доллары пересчитываются по курсу на дату каждой точки, евро без курса не учтены
+	resp := history(current)
+	var got []string
+	for _, p := range resp["points"].([]interface{}) {
+		point := p.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%s=%.2f", point["date"], point["balance"]))
+	}
+	if want := "[1999-01-09=1000.00 1999-01-31=1800.00 1999-02-28=1900.00]"; fmt.Sprint(got) != want {
+		t.Errorf("placeholder: %v, expected %s", got, want)
+	}
+	if missing := fmt.Sprint(resp["missing_rates"]); missing != "[EUR]" {
+		t.Errorf("missing rates: %s", missing)
+	}
+
+	if missing := fmt.Sprint(history(card)["missing_rates"]); missing != "[]" {
+		t.Errorf("single-currency account reports missing rates: %s", missing)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/networth"
+)
+
+// accountParents возвращает отображение id счёта -> id родителя (0 — корень)
+func (h *Handler) accountParents(userID int64) (map[int64]int64, error) {
+	rows, err := h.db.Query("SELECT id, parent_id FROM accounts WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[int64]int64)
+	for rows.Next() {
+		var id int64
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = parentID.Int64
+	}
+	return parents, rows.Err()
+}
+
+// isInSubtree проверяет, что счёт id — это root или его потомок
+func isInSubtree(id, root int64, parents map[int64]int64) bool {
+	// Ограничение глубины защищает от уже существующих циклов
+	for depth := 0; id != 0 && depth <= len(parents); depth++ {
+		if id == root {
+			return true
+		}
+		id = parents[id]
+	}
+	return false
+}
+
+// checkAccountParent проверяет, что parentID может стать родителем счёта
+// accountID (0 — новый счёт): родитель не лежит в поддереве самого счёта,
+// иначе дерево счетов замкнётся в цикл. Контейнерным родитель быть не
+// обязан — в книгах GnuCash счета вкладывают и в обычные счета.
+// Принадлежность счетов пользователю проверяется раньше, в authorize.
+func (h *Handler) checkAccountParent(userID, accountID, parentID int64) error {
+	if parentID == 0 || accountID == 0 {
+		return nil
+	}
+	parents, err := h.accountParents(userID)
+	if err != nil {
+		return err
+	}
+	if isInSubtree(parentID, accountID, parents) {
+		return fmt.Errorf("Нельзя вложить счёт в самого себя или в свой дочерний счёт")
+	}
+	return nil
+}
+
+// APIAccountMove - перенос счёта в другой родительский счёт (drag & drop в
+// дереве счетов). Пустой parent_id переносит счёт на верхний уровень.
+func (h *Handler) APIAccountMove(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	accountID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		fail("Некорректный счёт")
+		return
+	}
+	var parentID int64
+	if parentStr := r.FormValue("parent_id"); parentStr != "" {
+		if parentID, err = strconv.ParseInt(parentStr, 10, 64); err != nil {
+			fail("Некорректный родительский счёт")
+			return
+		}
+	}
+
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID, parentID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	if err := h.checkAccountParent(userID, accountID, parentID); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	parent := sql.NullInt64{Int64: parentID, Valid: parentID != 0}
+	if _, err := h.db.Exec("UPDATE accounts SET parent_id = ? WHERE id = ? AND user_id = ?",
+		parent, accountID, userID); err != nil {
+		fmt.Printf("ERROR moving account %d: %v\n", accountID, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     accountID,
+	})
+}
+
+// APIAccountMerge - объединение счетов, например дублей после импорта.
+// Операции (см. moveAccountOperations) и дочерние счета source_id переносятся
+// в target_id, после чего source_id удаляется — всё в одной транзакции БД.
+// Счета должны быть в одной валюте: суммы сплитов (quantity) записаны в
+// валюте счёта.
+func (h *Handler) APIAccountMerge(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	sourceID, err1 := strconv.ParseInt(r.FormValue("source_id"), 10, 64)
+	targetID, err2 := strconv.ParseInt(r.FormValue("target_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		fail("Выберите счёт, с которым объединить")
+		return
+	}
+	if sourceID == targetID {
+		fail("Нельзя объединить счёт с самим собой")
+		return
+	}
+
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{sourceID, targetID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+
+	source, err := h.getAccount(userID, sourceID)
+	if err == nil {
+		var target *models.Account
+		target, err = h.getAccount(userID, targetID)
+		if err == nil {
+			err = h.checkAccountMerge(userID, source, target)
+		}
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		fmt.Printf("ERROR starting transaction: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	splits, err := moveAccountOperations(tx, userID, sourceID, targetID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE accounts SET parent_id = ? WHERE parent_id = ? AND user_id = ?",
+			targetID, sourceID, userID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", sourceID, userID)
+	}
+	if err == nil {
+		err = networth.Invalidate(tx, userID, time.Time{})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Printf("ERROR merging account %d into %d: %v\n", sourceID, targetID, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     targetID,
+		"splits": splits,
+	})
+}
+
+// moveAccountOperations переносит на счёт targetID всё, что записано в валюте
+// счёта sourceID: сплиты, шаблоны запланированных транзакций, идентификаторы
+// импортированных операций банка и бюджет, — и перенастраивает на него
+// профили импорта выписок. Возвращает число перенесённых сплитов.
+func moveAccountOperations(tx *sql.Tx, userID, sourceID, targetID int64) (int64, error) {
+	moved, err := tx.Exec("UPDATE splits SET account_id = ? WHERE account_id = ? AND user_id = ?",
+		targetID, sourceID, userID)
+	if err != nil {
+		return 0, err
+	}
+	splits, _ := moved.RowsAffected()
+	if _, err := tx.Exec("UPDATE scheduled_splits SET account_id = ? WHERE account_id = ? AND user_id = ?",
+		targetID, sourceID, userID); err != nil {
+		return 0, err
+	}
+	// FITID, уже известные у target, остаются за ним
+	if _, err := tx.Exec("UPDATE IGNORE statement_fitids SET account_id = ? WHERE account_id = ? AND user_id = ?",
+		targetID, sourceID, userID); err != nil {
+		return 0, err
+	}
+	// Бюджет на месяц, уже заданный у target, складывается с перенесённым:
+	// счета в одной валюте, и суммы записаны с одним знаменателем
+	if _, err := tx.Exec(`
+		INSERT INTO budgets (user_id, account_id, month, amount_num, amount_denom)
+		SELECT src.user_id, ?, src.month, src.num, src.denom
+		FROM (SELECT user_id, month, amount_num AS num, amount_denom AS denom
+		      FROM budgets WHERE account_id = ? AND user_id = ?) src
+		ON DUPLICATE KEY UPDATE amount_num = budgets.amount_num + src.num
+	`, targetID, sourceID, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM budgets WHERE account_id = ? AND user_id = ?", sourceID, userID); err != nil {
+		return 0, err
+	}
+	for _, column := range []string{"account_id", "counterpart_id"} {
+		if _, err := tx.Exec("UPDATE import_profiles SET "+column+" = ? WHERE "+column+" = ? AND user_id = ?",
+			targetID, sourceID, userID); err != nil {
+			return 0, err
+		}
+	}
+	return splits, nil
+}
+
+// checkAccountMerge проверяет, что source можно влить в target
+func (h *Handler) checkAccountMerge(userID int64, source, target *models.Account) error {
+	if source.CommodityID != target.CommodityID {
+		return fmt.Errorf("Счета в разных валютах объединить нельзя")
+	}
+
+	parents, err := h.accountParents(userID)
+	if err != nil {
+		return err
+	}
+	if isInSubtree(target.ID, source.ID, parents) {
+		return fmt.Errorf("Нельзя влить счёт в его дочерний счёт")
+	}
+
+	// Дочерние счета, как и в checkAccountParent, можно вложить в любой счёт
+	var splits int
+	h.db.QueryRow("SELECT COUNT(*) FROM splits WHERE account_id = ? AND user_id = ?",
+		source.ID, userID).Scan(&splits)
+	if splits > 0 && target.Placeholder == 1 {
+		return fmt.Errorf("Контейнерный счёт не может принять операции — выберите конечный счёт")
+	}
+	return nil
+}
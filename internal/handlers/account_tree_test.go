@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// postJSON отправляет форму в API и разбирает JSON-ответ
+func postJSON(t *testing.T, h *Handler, userID int64, handler http.HandlerFunc, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	rec := postForm(t, h, userID, handler, form.Encode())
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+// accountParentID возвращает родителя счёта (0 — верхний уровень)
+func accountParentID(t *testing.T, h *Handler, userID, accountID int64) int64 {
+	t.Helper()
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ParentID == nil {
+		return 0
+	}
+	return *account.ParentID
+}
+
+func TestAccountMoveRejectsCycles(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	assets := accountIDByName(t, h, userID, "Активы")
+	current := accountIDByName(t, h, userID, "Текущие активы")
+	expenses := accountIDByName(t, h, userID, "Расходы")
+	utilities := accountIDByName(t, h, userID, "Коммунальные услуги")
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+
+	rejects := []struct {
+		name   string
+		id     int64
+		parent int64
+	}{
+		{"self", assets, assets},
+		{"child", assets, current},
+		{"grandchild", assets, card},
+	}
+	for _, tt := range rejects {
+		code, resp := postJSON(t, h, userID, h.APIAccountMove, url.Values{
+			"id": {fmt.Sprint(tt.id)}, "parent_id": {fmt.Sprint(tt.parent)},
+		})
+		if code != 400 || resp["error"] == nil {
+			t.Errorf("%s: expected 400 with error, got %d %v", tt.name, code, resp)
+		}
+	}
+	if got := accountParentID(t, h, userID, assets); got != 0 {
+		t.Errorf("assets moved under %d", got)
+	}
+
+	// Коммунальные услуги → Текущие активы, затем на верхний уровень
+	if code, resp := postJSON(t, h, userID, h.APIAccountMove, url.Values{
+		"id": {fmt.Sprint(utilities)}, "parent_id": {fmt.Sprint(current)},
+	}); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("move failed: %d %v", code, resp)
+	}
+	if got := accountParentID(t, h, userID, utilities); got != current {
+		t.Errorf("utilities parent = %d, expected %d", got, current)
+	}
+	if code, _ := postJSON(t, h, userID, h.APIAccountMove, url.Values{"id": {fmt.Sprint(utilities)}}); code != 200 {
+		t.Fatalf("move to top level failed: %d", code)
+	}
+	if got := accountParentID(t, h, userID, utilities); got != 0 {
+		t.Errorf("utilities parent = %d, expected top level", got)
+	}
+
+	// Сохранение счёта через форму проверяет родителя так же
+	code, resp := postJSON(t, h, userID, h.APIAccountSave, url.Values{
+		"id":             {fmt.Sprint(expenses)},
+		"account_name":   {"Расходы"},
+		"account_type":   {"EXPENSE"},
+		"commodity_id":   {"1"},
+		"placeholder":    {"1"},
+		"account_parent": {fmt.Sprint(utilities)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save under utilities failed: %d %v", code, resp)
+	}
+	code, resp = postJSON(t, h, userID, h.APIAccountSave, url.Values{
+		"id":             {fmt.Sprint(utilities)},
+		"account_name":   {"Коммунальные услуги"},
+		"account_type":   {"EXPENSE"},
+		"commodity_id":   {"1"},
+		"placeholder":    {"1"},
+		"account_parent": {fmt.Sprint(expenses)},
+	})
+	if code != 400 || resp["error"] == nil {
+		t.Errorf("save cycle: expected 400 with error, got %d %v", code, resp)
+	}
+	if got := accountParentID(t, h, userID, utilities); got != 0 {
+		t.Errorf("utilities parent = %d after rejected save", got)
+	}
+
+	// Родитель не обязан быть контейнерным: в книгах GnuCash бывает
+	// Расходы:Продукты:Рестораны, и такой счёт можно править
+	food := accountIDByName(t, h, userID, "Продукты")
+	transport := accountIDByName(t, h, userID, "Транспорт")
+	if code, resp := postJSON(t, h, userID, h.APIAccountMove, url.Values{
+		"id": {fmt.Sprint(transport)}, "parent_id": {fmt.Sprint(food)},
+	}); code != 200 {
+		t.Fatalf("move under leaf account: %d %v", code, resp)
+	}
+	code, resp = postJSON(t, h, userID, h.APIAccountSave, url.Values{
+		"id":             {fmt.Sprint(transport)},
+		"account_name":   {"Рестораны"},
+		"account_type":   {"EXPENSE"},
+		"commodity_id":   {"1"},
+		"account_parent": {fmt.Sprint(food)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Errorf("rename under leaf parent: %d %v", code, resp)
+	}
+}
+
+func TestAccountMerge(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	savings := accountIDByName(t, h, userID, "Сберегательный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	transport := accountIDByName(t, h, userID, "Транспорт")
+	expenses := accountIDByName(t, h, userID, "Расходы")
+	utilities := accountIDByName(t, h, userID, "Коммунальные услуги")
+	gas := accountIDByName(t, h, userID, "Газ")
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Магазин", "", [3]int64{card, -1999, 100}, [3]int64{food, 1999, 100})
+	insertTx(t, h, userID, day, "Метро", "", [3]int64{card, -500, 100}, [3]int64{transport, 500, 100})
+
+	if _, err := h.db.Exec("UPDATE accounts SET commodity_id = 2 WHERE id = ?", savings); err != nil {
+		t.Fatal(err)
+	}
+	saveBudget(t, h, userID, food, "2026-03", "100")
+	saveBudget(t, h, userID, transport, "2026-03", "50")
+
+	rejects := []struct {
+		name           string
+		source, target int64
+	}{
+		{"same account", food, food},
+		{"other currency", card, savings},
+		{"splits into placeholder", food, expenses},
+		{"into own child", expenses, utilities},
+	}
+	for _, tt := range rejects {
+		code, resp := postJSON(t, h, userID, h.APIAccountMerge, url.Values{
+			"source_id": {fmt.Sprint(tt.source)}, "target_id": {fmt.Sprint(tt.target)},
+		})
+		if code != 400 || resp["error"] == nil {
+			t.Errorf("%s: expected 400 with error, got %d %v", tt.name, code, resp)
+		}
+	}
+
+	code, resp := postJSON(t, h, userID, h.APIAccountMerge, url.Values{
+		"source_id": {fmt.Sprint(food)}, "target_id": {fmt.Sprint(transport)},
+	})
+	if code != 200 || resp["result"] != "ok" || resp["splits"] != 1.0 {
+		t.Fatalf("merge failed: %d %v", code, resp)
+	}
+	balances := bookBalances(t, h, userID)
+	if got := balances["Расходы:Транспорт"]; got != "2499/100" {
+		t.Errorf("transport balance = %s, expected 2499/100", got)
+	}
+	if _, ok := balances["Расходы:Продукты"]; ok {
+		t.Error("merged account still exists")
+	}
+	if got := accountBudgets(t, h, transport); got != "2026-03=15000/100" {
+		t.Errorf("transport budgets = %s", got)
+	}
+
+	// Счёт с операциями и дочерними счетами вливается в обычный счёт:
+	// дочерние счета, как в GnuCash, вкладываются и в него
+	fun := accountIDByName(t, h, userID, "Развлечения")
+	clothes := accountIDByName(t, h, userID, "Одежда")
+	if _, err := h.db.Exec("UPDATE accounts SET parent_id = ? WHERE id = ?", transport, fun); err != nil {
+		t.Fatal(err)
+	}
+	code, resp = postJSON(t, h, userID, h.APIAccountMerge, url.Values{
+		"source_id": {fmt.Sprint(transport)}, "target_id": {fmt.Sprint(clothes)},
+	})
+	if code != 200 || resp["result"] != "ok" || resp["splits"] != 2.0 {
+		t.Fatalf("merge with children into leaf failed: %d %v", code, resp)
+	}
+	if got := accountParentID(t, h, userID, fun); got != clothes {
+		t.Errorf("child parent = %d, expected %d", got, clothes)
+	}
+
+	// Контейнерные счета: дочерние счета переходят в целевой
+	code, resp = postJSON(t, h, userID, h.APIAccountMerge, url.Values{
+		"source_id": {fmt.Sprint(utilities)}, "target_id": {fmt.Sprint(expenses)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("placeholder merge failed: %d %v", code, resp)
+	}
+	if got := accountParentID(t, h, userID, gas); got != expenses {
+		t.Errorf("gas parent = %d, expected %d", got, expenses)
+	}
+}
+
+func TestAccountSaveCommodityChange(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	savings := accountIDByName(t, h, userID, "Сберегательный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	current := accountIDByName(t, h, userID, "Текущие активы")
+	expenses := accountIDByName(t, h, userID, "Расходы")
+	var usd int64
+	h.db.QueryRow("SELECT id FROM commodities WHERE mnemonic = 'USD'").Scan(&usd)
+
+	insertTx(t, h, userID, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "Пополнение", "",
+		[3]int64{card, 10000, 100}, [3]int64{accountIDByName(t, h, userID, "Зарплата"), -10000, 100})
+	saveBudget(t, h, userID, food, "2026-03", "100")
+
+	save := func(id, parent int64, name, accountType string) (int, map[string]interface{}) {
+		return postJSON(t, h, userID, h.APIAccountSave, url.Values{
+			"id": {fmt.Sprint(id)}, "account_name": {name}, "account_type": {accountType},
+			"commodity_id": {fmt.Sprint(usd)}, "account_parent": {fmt.Sprint(parent)},
+		})
+	}
+	// Суммы записаны в валюте счёта: с операциями или бюджетом валюту не сменить
+	if code, resp := save(card, current, "Расчетный счет", "BANK"); code != 400 {
+		t.Errorf("account with splits: expected 400, got %d %v", code, resp)
+	}
+	if code, resp := save(food, expenses, "Продукты", "EXPENSE"); code != 400 {
+		t.Errorf("account with a budget: expected 400, got %d %v", code, resp)
+	}
+	if code, resp := save(savings, current, "Сберегательный счет", "BANK"); code != 200 || resp["result"] != "ok" {
+		t.Errorf("unused account: %d %v", code, resp)
+	}
+	var commodityID int64
+	h.db.QueryRow("SELECT commodity_id FROM accounts WHERE id = ?", card).Scan(&commodityID)
+	if commodityID == usd {
+		t.Error("rejected save changed the currency")
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// errNotOwned — объект из запроса не существует или принадлежит другому
+// пользователю. Клиенту оба случая неразличимы, чтобы чужие id нельзя было
+// перебрать: обработчики отвечают на эту ошибку 404.
+var errNotOwned = errors.New("not owned")
+
+// ownedRefs — ссылки на объекты пользователя, которые запрос на запись
+// собирается изменить или к которым собирается привязать новые строки
+type ownedRefs struct {
+	Accounts       []int64
+	Transactions   []int64
+	Splits         []int64
+	Schedules      []int64
+	Tags           []int64
+	ImportProfiles []int64
+}
+
+// authorize проверяет, что все объекты из refs принадлежат пользователю.
+// Через неё проходит каждый обработчик записи до того, как что-либо записать.
+// Нулевые id (новый объект, пустая ссылка) не проверяются.
+func (h *Handler) authorize(userID int64, refs ownedRefs) error {
+	for _, check := range []struct {
+		table string
+		ids   []int64
+	}{
+		{"accounts", refs.Accounts},
+		{"transactions", refs.Transactions},
+		{"splits", refs.Splits},
+		{"scheduled_transactions", refs.Schedules},
+		{"tags", refs.Tags},
+		{"import_profiles", refs.ImportProfiles},
+	} {
+		if err := h.requireOwned(userID, check.table, check.ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireOwned проверяет принадлежность строк таблицы одним запросом
+func (h *Handler) requireOwned(userID int64, table string, ids []int64) error {
+	unique := make(map[int64]bool, len(ids))
+	args := []interface{}{userID}
+	for _, id := range ids {
+		if id != 0 && !unique[id] {
+			unique[id] = true
+			args = append(args, id)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+
+	// table — только из authorize, не из запроса
+	var owned int
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(unique)), ",")
+	err := h.db.QueryRow(
+		"SELECT COUNT(*) FROM "+table+" WHERE user_id = ? AND id IN ("+placeholders+")", args...,
+	).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if owned != len(unique) {
+		return errNotOwned
+	}
+	return nil
+}
+
+// writeAuthzError отвечает на ошибку authorize: 404 для чужих объектов,
+// 500 для ошибки базы. Ответ — JSON {"error": ...}, как у остальных API записи.
+func writeAuthzError(w http.ResponseWriter, err error, notFound string) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, errNotOwned) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": notFound})
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestCrossUserWritesRejected проверяет, что ссылки на объекты другого
+// пользователя отклоняются с 404 и ничего не записывают
+func TestCrossUserWritesRejected(t *testing.T) {
+	h := testHandler(t)
+	owner := createTestUser(t, h)
+	intruder := createTestUser(t, h)
+	for _, userID := range []int64{owner, intruder} {
+		if err := h.createBaseAccounts(userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ownerCard := accountIDByName(t, h, owner, "Расчетный счет")
+	ownerFood := accountIDByName(t, h, owner, "Продукты")
+	ownerExpenses := accountIDByName(t, h, owner, "Расходы")
+	card := fmt.Sprint(accountIDByName(t, h, intruder, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, intruder, "Продукты"))
+
+	insertTx(t, h, owner, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{ownerCard, -1999, 100}, [3]int64{ownerFood, 1999, 100})
+	var ownerTx, ownerSplit int64
+	h.db.QueryRow("SELECT id FROM transactions WHERE user_id = ?", owner).Scan(&ownerTx)
+	h.db.QueryRow("SELECT id FROM splits WHERE user_id = ? AND account_id = ?", owner, ownerCard).Scan(&ownerSplit)
+
+	ownerBefore := bookBalances(t, h, owner)
+	accountsBefore := countRows(t, h, "accounts", intruder)
+
+	// Транзакции
+	withTx := splitForm("x", [3]string{food, "10", ""}, [3]string{card, "-10", ""})
+	withTx.Set("id", fmt.Sprint(ownerTx))
+	withRegister := splitForm("x", [3]string{food, "10", ""}, [3]string{card, "-10", ""})
+	withRegister.Set("account_id", fmt.Sprint(ownerCard))
+
+	txTests := []struct {
+		name string
+		form url.Values
+	}{
+		{"foreign split account", splitForm("x", [3]string{fmt.Sprint(ownerFood), "10", ""}, [3]string{card, "-10", ""})},
+		{"foreign placeholder", splitForm("x", [3]string{fmt.Sprint(ownerExpenses), "10", ""}, [3]string{card, "-10", ""})},
+		{"foreign transaction", withTx},
+		{"foreign register account", withRegister},
+		{"legacy form", url.Values{
+			"description":    {"x"},
+			"post_date":      {"2026-03-10"},
+			"value":          {"10"},
+			"debit_account":  {fmt.Sprint(ownerFood)},
+			"credit_account": {card},
+		}},
+	}
+	for _, tt := range txTests {
+		if code, resp := saveTransaction(t, h, intruder, tt.form); code != 404 || resp["error"] == nil {
+			t.Errorf("%s: expected 404 with error, got %d %v", tt.name, code, resp)
+		}
+	}
+	if n := countRows(t, h, "transactions", intruder); n != 0 {
+		t.Errorf("rejected saves wrote %d transactions", n)
+	}
+	if n := countRows(t, h, "splits", intruder); n != 0 {
+		t.Errorf("rejected saves wrote %d splits", n)
+	}
+
+	// Счета
+	accountTests := []struct {
+		name string
+		form url.Values
+	}{
+		{"foreign parent", url.Values{
+			"account_name":   {"Чужой"},
+			"account_type":   {"EXPENSE"},
+			"commodity_id":   {"1"},
+			"account_parent": {fmt.Sprint(ownerExpenses)},
+		}},
+		{"foreign account", url.Values{
+			"id":           {fmt.Sprint(ownerCard)},
+			"account_name": {"Взломан"},
+			"account_type": {"BANK"},
+			"commodity_id": {"1"},
+		}},
+	}
+	for _, tt := range accountTests {
+		if rec := postForm(t, h, intruder, h.APIAccountSave, tt.form.Encode()); rec.Code != 404 {
+			t.Errorf("%s: expected 404, got %d %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+	if n := countRows(t, h, "accounts", intruder); n != accountsBefore {
+		t.Errorf("rejected saves changed account count: %d -> %d", accountsBefore, n)
+	}
+	var name string
+	h.db.QueryRow("SELECT name FROM accounts WHERE id = ?", ownerCard).Scan(&name)
+	if name != "Расчетный счет" {
+		t.Errorf("foreign account renamed to %q", name)
+	}
+
+	// Сверка
+	code, resp := reconcile(t, h, intruder, url.Values{
+		"account_id":     {card},
+		"statement_date": {"2026-03-31"},
+		"split_id":       {fmt.Sprint(ownerSplit)},
+	})
+	if code != 404 || resp["error"] == nil {
+		t.Errorf("foreign split reconcile: expected 404, got %d %v", code, resp)
+	}
+	if got := fmt.Sprint(splitStates(t, h, owner, ownerCard)); got != "[n]" {
+		t.Errorf("foreign split state = %s", got)
+	}
+
+	// Удаление
+	deletes := []struct {
+		name    string
+		handler http.HandlerFunc
+		id      int64
+	}{
+		{"account", h.APIAccountDelete, ownerFood},
+		{"transaction", h.APITransactionDelete, ownerTx},
+	}
+	for _, tt := range deletes {
+		rec := doRequest(t, h, intruder, tt.handler, http.MethodDelete, fmt.Sprintf("/?id=%d", tt.id), nil, "", nil)
+		if rec.Code != 404 {
+			t.Errorf("delete foreign %s: expected 404, got %d", tt.name, rec.Code)
+		}
+	}
+
+	if got := bookBalances(t, h, owner); fmt.Sprint(got) != fmt.Sprint(ownerBefore) {
+		t.Errorf("owner book changed: %v -> %v", ownerBefore, got)
+	}
+	if n := countRows(t, h, "splits", owner); n != 2 {
+		t.Errorf("owner has %d splits, expected 2", n)
+	}
+}
@@ -0,0 +1,706 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/backup"
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/networth"
+	"github.com/evbogdanov/finforme/internal/schedule"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// APIExportJSON выгружает книгу пользователя целиком в формате backup.
+// Транзакции читаются из БД курсором и пишутся в ответ по одной,
+// поэтому выгрузка больших книг не требует памяти под все транзакции.
+func (h *Handler) APIExportJSON(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	accounts, err := h.exportAccounts(userID)
+	if err != nil {
+		log.Printf("Export: failed to load accounts for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	commodities, err := h.exportCommodities(userID)
+	if err != nil {
+		log.Printf("Export: failed to load commodities for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	extra, err := h.exportExtra(userID)
+	if err != nil {
+		log.Printf("Export: failed to load schedules, budgets and profiles for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fitids, err := h.exportFITIDs(userID)
+	if err != nil {
+		log.Printf("Export: failed to load statement FITIDs for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT t.id, t.currency_id, t.num, t.post_date, t.enter_date, t.description, `+tags.Column+`,
+		       s.account_id, s.value_num, s.value_denom, s.quantity_num, s.quantity_denom,
+		       s.memo, s.action,
+		       s.reconcile_state, s.reconcile_date
+		FROM transactions t
+		LEFT JOIN splits s ON s.tx_id = t.id
+		WHERE t.user_id = ?
+		ORDER BY t.post_date ASC, t.id ASC, s.id ASC
+	`, userID)
+	if err != nil {
+		log.Printf("Export: failed to query transactions for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	filename := fmt.Sprintf("finforme-%s.json", now.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// После начала записи статус ответа поменять уже нельзя — ошибки только логируем
+	bw := backup.NewWriter(w)
+	if err := bw.Begin(now, commodities, accounts); err != nil {
+		log.Printf("Export: failed to write header: %v", err)
+		return
+	}
+
+	var current *backup.Transaction
+	for rows.Next() {
+		var txID int64
+		var currencyID, splitAccountID, valueNum, valueDenom, quantityNum, quantityDenom sql.NullInt64
+		var num, description, tagList, memo, action, reconcileState sql.NullString
+		var postDate, enterDate time.Time
+		var reconcileDate sql.NullTime
+
+		if err := rows.Scan(&txID, &currencyID, &num, &postDate, &enterDate, &description, &tagList,
+			&splitAccountID, &valueNum, &valueDenom, &quantityNum, &quantityDenom, &memo, &action,
+			&reconcileState, &reconcileDate); err != nil {
+			log.Printf("Export: failed to scan transaction: %v", err)
+			return
+		}
+
+		if current == nil || current.ID != txID {
+			if current != nil {
+				if err := bw.WriteTransaction(current); err != nil {
+					log.Printf("Export: failed to write transaction %d: %v", current.ID, err)
+					return
+				}
+			}
+			current = &backup.Transaction{
+				ID:          txID,
+				CurrencyID:  1,
+				Num:         num.String,
+				PostDate:    postDate,
+				EnterDate:   enterDate,
+				Description: description.String,
+				Tags:        tags.Parse(tagList.String),
+				Splits:      []backup.Split{},
+				FITIDs:      fitids[txID],
+			}
+			if currencyID.Valid {
+				current.CurrencyID = currencyID.Int64
+			}
+		}
+
+		// У транзакции без сплитов LEFT JOIN вернёт одну строку с NULL
+		if splitAccountID.Valid {
+			denom := valueDenom.Int64
+			if denom == 0 {
+				denom = 100
+			}
+			split := backup.Split{
+				AccountID:      splitAccountID.Int64,
+				ValueNum:       valueNum.Int64,
+				ValueDenom:     denom,
+				QuantityNum:    valueNum.Int64,
+				QuantityDenom:  denom,
+				Memo:           memo.String,
+				Action:         action.String,
+				ReconcileState: reconcileState.String,
+			}
+			if quantityDenom.Valid && quantityDenom.Int64 != 0 {
+				split.QuantityNum = quantityNum.Int64
+				split.QuantityDenom = quantityDenom.Int64
+			}
+			if reconcileDate.Valid {
+				split.ReconcileDate = &reconcileDate.Time
+			}
+			current.Splits = append(current.Splits, split)
+		}
+	}
+	if current != nil {
+		if err := bw.WriteTransaction(current); err != nil {
+			log.Printf("Export: failed to write transaction %d: %v", current.ID, err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Export: failed to read transactions: %v", err)
+		return
+	}
+
+	if err := bw.End(extra); err != nil {
+		log.Printf("Export: failed to finish document: %v", err)
+		return
+	}
+
+	log.Printf("User %d exported %d accounts, %d transactions", userID, len(accounts), bw.Count())
+}
+
+// exportAccounts загружает все счета пользователя в порядке ID
+func (h *Handler) exportAccounts(userID int64) ([]backup.Account, error) {
+	rows, err := h.db.Query(`
+		SELECT id, parent_id, name, account_type, commodity_id, commodity_scu, non_std_scu,
+		       code, description, hidden, placeholder
+		FROM accounts
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]backup.Account, 0)
+	for rows.Next() {
+		var acc backup.Account
+		var parentID, commodityID sql.NullInt64
+		var code, description sql.NullString
+		var hidden, placeholder int
+
+		if err := rows.Scan(&acc.ID, &parentID, &acc.Name, &acc.AccountType, &commodityID,
+			&acc.CommoditySCU, &acc.NonStdSCU, &code, &description, &hidden, &placeholder); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+
+		if parentID.Valid {
+			pid := parentID.Int64
+			acc.ParentID = &pid
+		}
+		acc.CommodityID = 1
+		if commodityID.Valid {
+			acc.CommodityID = commodityID.Int64
+		}
+		acc.Code = code.String
+		acc.Description = description.String
+		acc.Hidden = hidden == 1
+		acc.Placeholder = placeholder == 1
+
+		accounts = append(accounts, acc)
+	}
+
+	return accounts, rows.Err()
+}
+
+// exportCommodities загружает валюты, на которые ссылаются счета, транзакции
+// и расписания пользователя
+func (h *Handler) exportCommodities(userID int64) ([]backup.Commodity, error) {
+	rows, err := h.db.Query(`
+		SELECT id, namespace, mnemonic, fullname, cusip, fraction, quote_source, quote_tz, sign
+		FROM commodities
+		WHERE id IN (SELECT commodity_id FROM accounts WHERE user_id = ?)
+		   OR id IN (SELECT currency_id FROM transactions WHERE user_id = ?)
+		   OR id IN (SELECT currency_id FROM scheduled_transactions WHERE user_id = ?)
+		ORDER BY id
+	`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commodities := make([]backup.Commodity, 0)
+	for rows.Next() {
+		var c backup.Commodity
+		var namespace, fullname, cusip, quoteSource, quoteTZ, sign sql.NullString
+
+		if err := rows.Scan(&c.ID, &namespace, &c.Mnemonic, &fullname, &cusip, &c.Fraction,
+			&quoteSource, &quoteTZ, &sign); err != nil {
+			return nil, fmt.Errorf("failed to scan commodity: %w", err)
+		}
+
+		c.Namespace = namespace.String
+		c.Fullname = fullname.String
+		c.Cusip = cusip.String
+		c.QuoteSource = quoteSource.String
+		c.QuoteTZ = quoteTZ.String
+		c.Sign = sign.String
+
+		commodities = append(commodities, c)
+	}
+
+	return commodities, rows.Err()
+}
+
+// exportFITIDs загружает FITID импортированных выписок по ID транзакции
+func (h *Handler) exportFITIDs(userID int64) (map[int64][]backup.FITID, error) {
+	rows, err := h.db.Query(`
+		SELECT tx_id, account_id, fitid
+		FROM statement_fitids
+		WHERE user_id = ?
+		ORDER BY tx_id, account_id, fitid
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fitids := make(map[int64][]backup.FITID)
+	for rows.Next() {
+		var txID int64
+		var f backup.FITID
+		if err := rows.Scan(&txID, &f.AccountID, &f.FITID); err != nil {
+			return nil, fmt.Errorf("failed to scan fitid: %w", err)
+		}
+		fitids[txID] = append(fitids[txID], f)
+	}
+	return fitids, rows.Err()
+}
+
+// exportExtra загружает разделы выгрузки после транзакций: цвета тегов,
+// расписания с обработанными датами, бюджеты и профили импорта
+func (h *Handler) exportExtra(userID int64) (*backup.Extra, error) {
+	extra := &backup.Extra{TagColors: make(map[string]string)}
+
+	rows, err := h.db.Query("SELECT name, color FROM tags WHERE user_id = ? AND color <> ''", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, color string
+		if err := rows.Scan(&name, &color); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		extra.TagColors[name] = color
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schedules, err := schedule.Load(h.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range schedules {
+		scheduled := backup.Scheduled{
+			ID:             s.ID,
+			Description:    s.Description,
+			Tags:           tags.Parse(s.Tags),
+			CurrencyID:     s.CurrencyID,
+			Rule:           s.Rule.Kind,
+			RuleInterval:   s.Rule.Interval,
+			RuleDay:        s.Rule.Day,
+			StartDate:      s.StartDate,
+			EndDate:        s.EndDate,
+			MaxOccurrences: s.MaxOccurrences,
+			Mode:           s.Mode,
+			Enabled:        s.Enabled,
+			Splits:         []backup.ScheduledSplit{},
+		}
+		for _, sp := range s.Splits {
+			scheduled.Splits = append(scheduled.Splits, backup.ScheduledSplit(sp))
+		}
+		extra.Scheduled = append(extra.Scheduled, scheduled)
+	}
+	byID := make(map[int64]*backup.Scheduled, len(extra.Scheduled))
+	for i := range extra.Scheduled {
+		byID[extra.Scheduled[i].ID] = &extra.Scheduled[i]
+	}
+
+	occurrenceRows, err := h.db.Query(`
+		SELECT scheduled_id, occurrence_date, status, tx_id, reviewed
+		FROM scheduled_occurrences
+		WHERE user_id = ?
+		ORDER BY scheduled_id, occurrence_date
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer occurrenceRows.Close()
+	for occurrenceRows.Next() {
+		var scheduledID int64
+		var o backup.Occurrence
+		var txID sql.NullInt64
+		if err := occurrenceRows.Scan(&scheduledID, &o.Date, &o.Status, &txID, &o.Reviewed); err != nil {
+			return nil, fmt.Errorf("failed to scan occurrence: %w", err)
+		}
+		if txID.Valid {
+			o.TxID = &txID.Int64
+		}
+		if s := byID[scheduledID]; s != nil {
+			s.Occurrences = append(s.Occurrences, o)
+		}
+	}
+	if err := occurrenceRows.Err(); err != nil {
+		return nil, err
+	}
+
+	budgetRows, err := h.db.Query(`
+		SELECT account_id, month, amount_num, amount_denom
+		FROM budgets
+		WHERE user_id = ?
+		ORDER BY account_id, month
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer budgetRows.Close()
+	for budgetRows.Next() {
+		var b backup.Budget
+		if err := budgetRows.Scan(&b.AccountID, &b.Month, &b.AmountNum, &b.AmountDenom); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		extra.Budgets = append(extra.Budgets, b)
+	}
+	if err := budgetRows.Err(); err != nil {
+		return nil, err
+	}
+
+	profiles, err := h.getCSVProfiles(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		profile := backup.ImportProfile{Name: p.Name, Profile: p.Profile}
+		if p.AccountID != 0 {
+			profile.AccountID = &p.AccountID
+		}
+		if p.CounterpartID != 0 {
+			profile.CounterpartID = &p.CounterpartID
+		}
+		extra.ImportProfiles = append(extra.ImportProfiles, profile)
+	}
+
+	return extra, nil
+}
+
+// APIImportJSON загружает книгу из документа, созданного APIExportJSON.
+// Принимает файл в поле "file" (multipart) или JSON в теле запроса.
+// Документ проверяется целиком до записи; все объекты получают новые ID
+// и вставляются в одной транзакции БД.
+func (h *Handler) APIImportJSON(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := h.getUserID(r)
+	w.Header().Set("Content-Type", "application/json")
+	if !authenticated {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Not authenticated"})
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to parse form"})
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to get file"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	doc, err := backup.Read(body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": err.Error()})
+		return
+	}
+
+	if err := backup.Validate(doc); err != nil {
+		var verr *backup.ValidationError
+		errors.As(err, &verr)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result":   "error",
+			"message":  "Файл не прошёл проверку",
+			"problems": verr.Problems,
+			"omitted":  verr.Omitted,
+		})
+		return
+	}
+
+	summary, err := h.importBackup(userID, doc)
+	if err != nil {
+		log.Printf("Error importing JSON backup for user %d: %v", userID, err)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": err.Error()})
+		return
+	}
+
+	log.Printf("User %d imported JSON backup: %d accounts, %d transactions, %d splits",
+		userID, summary.Accounts, summary.Transactions, summary.Splits)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":  "ok",
+		"summary": summary,
+	})
+}
+
+// importBackup записывает проверенный документ в книгу пользователя.
+// Валюты сопоставляются с существующими по mnemonic, счета, транзакции,
+// расписания и бюджеты создаются заново; ссылки между ними переводятся на
+// новые ID. Цвета тегов и профили импорта с совпадающими именами заменяются
+// значениями из документа.
+func (h *Handler) importBackup(userID int64, doc *backup.Document) (*backup.Summary, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary := &backup.Summary{}
+
+	// Валюты общие для всех пользователей — только сопоставляем
+	existingCommodities := make(map[string]int64)
+	commodityRows, err := tx.Query("SELECT id, mnemonic FROM commodities")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing commodities: %w", err)
+	}
+	for commodityRows.Next() {
+		var id int64
+		var mnemonic string
+		if err := commodityRows.Scan(&id, &mnemonic); err != nil {
+			commodityRows.Close()
+			return nil, fmt.Errorf("failed to scan commodity: %w", err)
+		}
+		existingCommodities[mnemonic] = id
+	}
+	commodityRows.Close()
+
+	commodityMap := make(map[int64]int64, len(doc.Commodities))
+	for _, c := range doc.Commodities {
+		id, ok := existingCommodities[c.Mnemonic]
+		if !ok {
+			return nil, fmt.Errorf("валюта %s не поддерживается", c.Mnemonic)
+		}
+		commodityMap[c.ID] = id
+		summary.Commodities++
+	}
+
+	// Счета вставляем без родителей, а связи проставляем вторым проходом:
+	// так порядок счетов в документе не имеет значения
+	accountMap := make(map[int64]int64, len(doc.Accounts))
+	for _, acc := range doc.Accounts {
+		hidden := 0
+		if acc.Hidden {
+			hidden = 1
+		}
+		placeholder := 0
+		if acc.Placeholder {
+			placeholder = 1
+		}
+		commoditySCU := acc.CommoditySCU
+		if commoditySCU == 0 {
+			commoditySCU = 100
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO accounts (user_id, name, account_type, commodity_id, commodity_scu,
+			                      non_std_scu, code, description, hidden, placeholder)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, acc.Name, acc.AccountType, commodityMap[acc.CommodityID],
+			commoditySCU, acc.NonStdSCU, acc.Code, acc.Description, hidden, placeholder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert account %s: %w", acc.Name, err)
+		}
+
+		newID, _ := result.LastInsertId()
+		accountMap[acc.ID] = newID
+		summary.Accounts++
+	}
+
+	for _, acc := range doc.Accounts {
+		if acc.ParentID == nil {
+			continue
+		}
+		_, err := tx.Exec(`UPDATE accounts SET parent_id = ? WHERE id = ? AND user_id = ?`,
+			accountMap[*acc.ParentID], accountMap[acc.ID], userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set parent of account %s: %w", acc.Name, err)
+		}
+	}
+
+	tagNames := make(map[string]bool)
+	txMap := make(map[int64]int64, len(doc.Transactions))
+	for _, t := range doc.Transactions {
+		enterDate := t.EnterDate
+		if enterDate.IsZero() {
+			enterDate = t.PostDate
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO transactions (user_id, currency_id, num, post_date, enter_date, description)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, commodityMap[t.CurrencyID], t.Num, t.PostDate, enterDate, t.Description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert transaction %d: %w", t.ID, err)
+		}
+
+		newTxID, _ := result.LastInsertId()
+		txMap[t.ID] = newTxID
+		summary.Transactions++
+		txTags := tags.Parse(strings.Join(t.Tags, ","))
+		if err := tags.Set(tx, userID, newTxID, txTags); err != nil {
+			return nil, fmt.Errorf("failed to tag transaction %d: %w", t.ID, err)
+		}
+		for _, tag := range txTags {
+			tagNames[strings.ToLower(tag)] = true
+		}
+
+		for _, s := range t.Splits {
+			quantityNum, quantityDenom := s.QuantityNum, s.QuantityDenom
+			if quantityDenom == 0 {
+				quantityNum, quantityDenom = s.ValueNum, s.ValueDenom
+			}
+			reconcileState := s.ReconcileState
+			if reconcileState == "" {
+				reconcileState = models.ReconcileNew
+			}
+			_, err := tx.Exec(`
+				INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom,
+				                    quantity_num, quantity_denom,
+				                    memo, action, reconcile_state, reconcile_date)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, newTxID, accountMap[s.AccountID], s.ValueNum, s.ValueDenom,
+				quantityNum, quantityDenom, s.Memo, s.Action, reconcileState, s.ReconcileDate)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert split of transaction %d: %w", t.ID, err)
+			}
+			summary.Splits++
+		}
+
+		for _, f := range t.FITIDs {
+			_, err := tx.Exec("INSERT INTO statement_fitids (account_id, fitid, user_id, tx_id) VALUES (?, ?, ?, ?)",
+				accountMap[f.AccountID], f.FITID, userID, newTxID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert fitid of transaction %d: %w", t.ID, err)
+			}
+		}
+	}
+	for name, color := range doc.TagColors {
+		tagID, err := tags.Ensure(tx, userID, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tag %s: %w", name, err)
+		}
+		if _, err := tx.Exec("UPDATE tags SET color = ? WHERE id = ?", strings.ToLower(color), tagID); err != nil {
+			return nil, fmt.Errorf("failed to set color of tag %s: %w", name, err)
+		}
+		tagNames[strings.ToLower(name)] = true
+	}
+	summary.Tags = len(tagNames)
+
+	for _, s := range doc.Scheduled {
+		var maxOccurrences interface{}
+		if s.MaxOccurrences > 0 {
+			maxOccurrences = s.MaxOccurrences
+		}
+		enabled := 0
+		if s.Enabled {
+			enabled = 1
+		}
+		result, err := tx.Exec(`
+			INSERT INTO scheduled_transactions (user_id, description, tags, currency_id, rule, rule_interval,
+			                                    rule_day, start_date, end_date, max_occurrences, mode, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, s.Description, strings.Join(tags.Parse(strings.Join(s.Tags, ",")), ","),
+			commodityMap[s.CurrencyID], s.Rule, s.RuleInterval, s.RuleDay, s.StartDate, s.EndDate,
+			maxOccurrences, s.Mode, enabled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert scheduled transaction %d: %w", s.ID, err)
+		}
+		newScheduledID, _ := result.LastInsertId()
+		summary.Scheduled++
+
+		for _, sp := range s.Splits {
+			_, err := tx.Exec(`
+				INSERT INTO scheduled_splits (user_id, scheduled_id, account_id, value_num, value_denom,
+				                              quantity_num, quantity_denom, memo, action)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, newScheduledID, accountMap[sp.AccountID], sp.ValueNum, sp.ValueDenom,
+				sp.QuantityNum, sp.QuantityDenom, sp.Memo, sp.Action)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert split of scheduled transaction %d: %w", s.ID, err)
+			}
+		}
+		// Обработанные даты переносятся вместе с расписанием, иначе
+		// следующий запуск создал бы уже проведённые транзакции заново
+		for _, o := range s.Occurrences {
+			var txID interface{}
+			if o.TxID != nil {
+				txID = txMap[*o.TxID]
+			}
+			reviewed := 0
+			if o.Reviewed {
+				reviewed = 1
+			}
+			_, err := tx.Exec(`
+				INSERT INTO scheduled_occurrences (user_id, scheduled_id, occurrence_date, status, tx_id, reviewed)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, userID, newScheduledID, o.Date, o.Status, txID, reviewed)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert occurrence of scheduled transaction %d: %w", s.ID, err)
+			}
+		}
+	}
+
+	for _, b := range doc.Budgets {
+		_, err := tx.Exec(`
+			INSERT INTO budgets (user_id, account_id, month, amount_num, amount_denom)
+			VALUES (?, ?, ?, ?, ?)
+		`, userID, accountMap[b.AccountID], b.Month, b.AmountNum, b.AmountDenom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert budget: %w", err)
+		}
+		summary.Budgets++
+	}
+
+	for _, p := range doc.ImportProfiles {
+		var accountID, counterpartID interface{}
+		if p.AccountID != nil {
+			accountID = accountMap[*p.AccountID]
+		}
+		if p.CounterpartID != nil {
+			counterpartID = accountMap[*p.CounterpartID]
+		}
+		if _, err := tx.Exec("DELETE FROM import_profiles WHERE user_id = ? AND name = ?", userID, p.Name); err != nil {
+			return nil, fmt.Errorf("failed to replace import profile %s: %w", p.Name, err)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO import_profiles (user_id, name, delimiter, encoding, skip_rows, date_format,
+			                             date_column, amount_column, debit_column, credit_column,
+			                             description_column, category_column, account_id, counterpart_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, p.Name, p.Delimiter, p.Encoding, p.SkipRows, p.DateFormat,
+			p.DateColumn, p.AmountColumn, p.DebitColumn, p.CreditColumn,
+			p.DescriptionColumn, p.CategoryColumn, accountID, counterpartID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert import profile %s: %w", p.Name, err)
+		}
+		summary.ImportProfiles++
+	}
+
+	if err := networth.Invalidate(tx, userID, time.Time{}); err != nil {
+		return nil, fmt.Errorf("failed to reset net worth snapshots: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/schedule"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// accountIDByName находит счёт пользователя по имени
+func accountIDByName(t *testing.T, h *Handler, userID int64, name string) int64 {
+	t.Helper()
+	var id int64
+	if err := h.db.QueryRow("SELECT id FROM accounts WHERE user_id = ? AND name = ?", userID, name).Scan(&id); err != nil {
+		t.Fatalf("account %q not found: %v", name, err)
+	}
+	return id
+}
+
+// insertTx записывает транзакцию со сплитами напрямую в БД; splits — тройки account, num, denom
+func insertTx(t *testing.T, h *Handler, userID int64, date time.Time, description, tagList string, splits ...[3]int64) int64 {
+	t.Helper()
+	result, err := h.db.Exec(`
+		INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description)
+		VALUES (?, 1, ?, ?, ?)
+	`, userID, date, date, description)
+	if err != nil {
+		t.Fatalf("failed to insert transaction: %v", err)
+	}
+	txID, _ := result.LastInsertId()
+	if err := tags.Set(h.db, userID, txID, tags.Parse(tagList)); err != nil {
+		t.Fatalf("failed to tag transaction: %v", err)
+	}
+	for _, s := range splits {
+		if _, err := h.db.Exec(`
+			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom, quantity_num, quantity_denom)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, userID, txID, s[0], s[1], s[2], s[1], s[2]); err != nil {
+			t.Fatalf("failed to insert split: %v", err)
+		}
+	}
+	return txID
+}
+
+func TestJSONExportImportRoundTrip(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatalf("createBaseAccounts: %v", err)
+	}
+	cash := accountIDByName(t, h, userID, "Наличные")
+	checking := accountIDByName(t, h, userID, "Расчетный счет")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	food := accountIDByName(t, h, userID, "Продукты")
+	opening := accountIDByName(t, h, userID, "Начальный баланс")
+	h.db.Exec("UPDATE accounts SET hidden = 1, code = 'X1' WHERE id = ?", opening)
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Остаток", "", [3]int64{cash, 500000, 100}, [3]int64{opening, -500000, 100})
+	insertTx(t, h, userID, day.AddDate(0, 0, 5), "Зарплата", "работа",
+		[3]int64{checking, 15000000, 100}, [3]int64{salary, -15000000, 100})
+	insertTx(t, h, userID, day.AddDate(0, 0, 7), "Магазин", "еда, отпуск-2026",
+		[3]int64{food, 19990, 1000}, [3]int64{food, 1001, 100}, [3]int64{cash, -3000, 100})
+
+	h.db.Exec(`UPDATE splits SET memo = 'хлеб', action = 'Buy', reconcile_state = 'y', reconcile_date = ?
+		WHERE user_id = ? AND account_id = ? AND value_denom = 1000`, day.AddDate(0, 0, 10), userID, food)
+
+	before := bookBalances(t, h, userID)
+
+	rec := doRequest(t, h, userID, h.APIExportJSON, http.MethodGet, "/", nil, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", rec.Code, rec.Body.String())
+	}
+	exported := rec.Body.Bytes()
+
+	rec = doRequest(t, h, userID, h.APIDataDelete, http.MethodDelete, "/", nil, "", nil)
+	if !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Fatalf("delete failed: %s", rec.Body.String())
+	}
+	if n := countRows(t, h, "accounts", userID); n != 0 {
+		t.Fatalf("%d accounts left after delete", n)
+	}
+
+	// Загружаем файлом, как это делает страница приветствия
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "finforme.json")
+	fw.Write(exported)
+	mw.Close()
+
+	rec = doRequest(t, h, userID, h.APIImportJSON, http.MethodPost, "/", &body, mw.FormDataContentType(), nil)
+	var resp struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+		Summary struct {
+			Accounts     int `json:"accounts"`
+			Transactions int `json:"transactions"`
+			Splits       int `json:"splits"`
+			Tags         int `json:"tags"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad import response: %v\n%s", err, rec.Body.String())
+	}
+	if resp.Result != "ok" {
+		t.Fatalf("import failed: %s", rec.Body.String())
+	}
+	if resp.Summary.Transactions != 3 || resp.Summary.Splits != 7 || resp.Summary.Tags != 3 {
+		t.Errorf("summary = %+v", resp.Summary)
+	}
+
+	after := bookBalances(t, h, userID)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("balances differ after round trip:\nbefore %v\nafter  %v", before, after)
+	}
+
+	var hidden int
+	var code string
+	h.db.QueryRow("SELECT hidden, code FROM accounts WHERE user_id = ? AND name = 'Начальный баланс'", userID).Scan(&hidden, &code)
+	if hidden != 1 || code != "X1" {
+		t.Errorf("account flags lost: hidden=%d code=%q", hidden, code)
+	}
+
+	var tagList string
+	h.db.QueryRow("SELECT "+tags.Column+" FROM transactions t WHERE t.user_id = ? AND t.description = 'Магазин'", userID).Scan(&tagList)
+	if tagList != "еда,отпуск-2026" {
+		t.Errorf("tags = %q", tagList)
+	}
+
+	var memo, action, state string
+	var reconciled time.Time
+	h.db.QueryRow(`SELECT memo, action, reconcile_state, reconcile_date FROM splits
+		WHERE user_id = ? AND value_denom = 1000`, userID).Scan(&memo, &action, &state, &reconciled)
+	if memo != "хлеб" || action != "Buy" || state != "y" || !reconciled.Equal(day.AddDate(0, 0, 10)) {
+		t.Errorf("split details lost: %q %q %q %v", memo, action, state, reconciled)
+	}
+	var unreconciled int
+	h.db.QueryRow(`SELECT COUNT(*) FROM splits
+		WHERE user_id = ? AND reconcile_state = 'n' AND reconcile_date IS NULL`, userID).Scan(&unreconciled)
+	if unreconciled != 6 {
+		t.Errorf("expected 6 unreconciled splits, got %d", unreconciled)
+	}
+}
+
+// reimport удаляет данные пользователя и загружает выгрузку exported обратно
+func reimport(t *testing.T, h *Handler, userID int64, exported []byte) map[string]int {
+	t.Helper()
+	rec := doRequest(t, h, userID, h.APIDataDelete, http.MethodDelete, "/", nil, "", nil)
+	if !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Fatalf("delete failed: %s", rec.Body.String())
+	}
+	rec = doRequest(t, h, userID, h.APIImportJSON, http.MethodPost, "/", bytes.NewReader(exported), "application/json", nil)
+	var resp struct {
+		Result  string         `json:"result"`
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Result != "ok" {
+		t.Fatalf("import failed: %s", rec.Body.String())
+	}
+	return resp.Summary
+}
+
+func TestJSONRoundTripKeepsSchedulesBudgetsAndProfiles(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	form := scheduleForm("Доставка", "monthly", "2026-01-31", food, card)
+	form.Set("max_occurrences", "4")
+	form.Set("tags", "дом")
+	if code, resp := postJSON(t, h, userID, h.APIScheduledSave, form); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("schedule save failed: %d %v", code, resp)
+	}
+	runSchedules(t, h, userID, "2026-03-15")
+	saveBudget(t, h, userID, food, "2026-03", "100")
+	tagID, _ := tags.Ensure(h.db, userID, "отпуск")
+	h.db.Exec("UPDATE tags SET color = '#ff8800' WHERE id = ?", tagID)
+	code, resp := postJSON(t, h, userID, h.APICSVProfileSave, url.Values{
+		"name": {"Мой банк"}, "delimiter": {";"}, "encoding": {"utf-8"}, "date_format": {"02.01.2006"},
+		"skip_rows": {"2"}, "date_column": {"1"}, "amount_column": {"2"}, "account_id": {fmt.Sprint(card)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("profile save failed: %d %v", code, resp)
+	}
+
+	rec := doRequest(t, h, userID, h.APIExportJSON, http.MethodGet, "/", nil, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", rec.Code, rec.Body.String())
+	}
+	summary := reimport(t, h, userID, rec.Body.Bytes())
+	if summary["scheduled"] != 1 || summary["budgets"] != 1 || summary["import_profiles"] != 1 {
+		t.Errorf("summary = %v", summary)
+	}
+
+	card = accountIDByName(t, h, userID, "Расчетный счет")
+	food = accountIDByName(t, h, userID, "Продукты")
+	schedules, err := schedule.Load(h.db, userID)
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("schedules after import: %v %v", schedules, err)
+	}
+	s := schedules[0]
+	if s.Tags != "дом" || s.MaxOccurrences != 4 || len(s.Splits) != 2 ||
+		s.Splits[0].AccountID != food || s.Splits[1].AccountID != card {
+		t.Errorf("schedule after import: %+v", s)
+	}
+	var linked int
+	h.db.QueryRow(`SELECT COUNT(*) FROM scheduled_occurrences o JOIN transactions t ON t.id = o.tx_id
+		WHERE o.user_id = ? AND t.user_id = ? AND o.status = 'created'`, userID, userID).Scan(&linked)
+	if linked != 2 {
+		t.Errorf("%d occurrences linked to imported transactions, expected 2", linked)
+	}
+	// Проведённые даты не создаются заново
+	if report := runSchedules(t, h, userID, "2026-03-15"); report.Created != 0 {
+		t.Errorf("run after import created %d transactions", report.Created)
+	}
+
+	if got := accountBudgets(t, h, food); got != "2026-03=10000/100" {
+		t.Errorf("food budgets = %q", got)
+	}
+	var color string
+	h.db.QueryRow("SELECT color FROM tags WHERE user_id = ? AND name = 'отпуск'", userID).Scan(&color)
+	if color != "#ff8800" {
+		t.Errorf("tag color = %q", color)
+	}
+	profiles, _ := h.getCSVProfiles(userID)
+	if len(profiles) != 1 || profiles[0].AccountID != card || profiles[0].CounterpartID != 0 || profiles[0].SkipRows != 2 {
+		t.Errorf("profiles after import: %+v", profiles)
+	}
+}
+
+func TestJSONRoundTripKeepsStatementFITIDs(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	form := url.Values{"account_id": {fmt.Sprint(card)}, "counterpart_id": {fmt.Sprint(food)}}
+	march := ofxStatementFile("RUB", "F1;20260301;-100.50;Shop", "F2;20260302;-20;Cafe")
+	if code, resp := uploadStatement(t, h, userID, h.APIOFXImport, march, form); code != 200 || resp["imported"] != 2.0 {
+		t.Fatalf("import: %d %v", code, resp)
+	}
+
+	rec := doRequest(t, h, userID, h.APIExportJSON, http.MethodGet, "/", nil, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", rec.Code, rec.Body.String())
+	}
+	reimport(t, h, userID, rec.Body.Bytes())
+
+	card = accountIDByName(t, h, userID, "Расчетный счет")
+	food = accountIDByName(t, h, userID, "Продукты")
+	var restored int
+	h.db.QueryRow(`SELECT COUNT(*) FROM statement_fitids f JOIN transactions t ON t.id = f.tx_id
+		WHERE f.account_id = ? AND t.user_id = ?`, card, userID).Scan(&restored)
+	if restored != 2 {
+		t.Errorf("%d FITIDs restored, expected 2", restored)
+	}
+
+	// Пересекающаяся выписка после восстановления не дублирует F2
+	form = url.Values{"account_id": {fmt.Sprint(card)}, "counterpart_id": {fmt.Sprint(food)}}
+	overlap := ofxStatementFile("RUB", "F2;20260302;-20;Cafe", "F3;20260303;-30;Cafe")
+	code, resp := uploadStatement(t, h, userID, h.APIOFXImport, overlap, form)
+	if code != 200 || resp["imported"] != 1.0 || resp["skipped"] != 1.0 {
+		t.Fatalf("re-import after restore: %d %v", code, resp)
+	}
+	if n := countRows(t, h, "transactions", userID); n != 3 {
+		t.Errorf("%d transactions after re-import, expected 3", n)
+	}
+}
+
+func TestJSONImportRejectsInvalid(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+
+	doc := `{"format":"finforme-book","version":1,
+		"commodities":[{"id":1,"namespace":"CURRENCY","mnemonic":"RUB","fraction":100}],
+		"accounts":[
+			{"id":1,"parent_id":null,"name":"Наличные","account_type":"CASH","commodity_id":1},
+			{"id":2,"parent_id":99,"name":"Еда","account_type":"EXPENSE","commodity_id":1}],
+		"transactions":[{"id":1,"currency_id":1,"post_date":"2026-01-01T00:00:00Z","description":"x",
+			"splits":[{"account_id":1,"value_num":-100,"value_denom":100},{"account_id":2,"value_num":99,"value_denom":100}]}]}`
+
+	rec := doRequest(t, h, userID, h.APIImportJSON, http.MethodPost, "/", strings.NewReader(doc), "application/json", nil)
+	var resp struct {
+		Result   string   `json:"result"`
+		Problems []string `json:"problems"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Result != "error" || len(resp.Problems) != 2 {
+		t.Errorf("expected 2 problems (parent, balance), got %s", rec.Body.String())
+	}
+	if n := countRows(t, h, "accounts", userID); n != 0 {
+		t.Errorf("invalid document wrote %d accounts", n)
+	}
+}
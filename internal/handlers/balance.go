@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+// splitFilter — отбор сплитов для sumSplits. Период задаётся по дате проводки
+// включительно, нулевая граница — без ограничения. С ByTag суммы разбиваются
+// по тегам транзакций; непустой Tags оставляет только эти теги.
+type splitFilter struct {
+	From, To time.Time
+	ByTag    bool
+	Tags     []int64
+}
+
+// balanceKey — ключ суммы sumSplits; Tag заполнен только с ByTag
+type balanceKey struct {
+	Account int64
+	Tag     int64
+}
+
+// sumSplits возвращает точные суммы сплитов пользователя по счетам в валютах
+// самих счетов (по quantity). База суммирует числители отдельно для каждого
+// знаменателя, а получившиеся дроби складываются уже без округления — поэтому
+// счета в JPY, BTC или акциях считаются так же верно, как рублёвые.
+func (h *Handler) sumSplits(userID int64, f splitFilter) (map[balanceKey]models.Amount, error) {
+	tag, group := "0", "s.account_id, s.quantity_denom"
+	query := " FROM splits s"
+	if !f.From.IsZero() || !f.To.IsZero() {
+		query += " JOIN transactions t ON t.id = s.tx_id"
+	}
+	if f.ByTag {
+		tag, group = "tt.tag_id", "s.account_id, tt.tag_id, s.quantity_denom"
+		query += " JOIN transaction_tags tt ON tt.tx_id = s.tx_id"
+	}
+	query += " WHERE s.user_id = ?"
+	args := []interface{}{userID}
+	if !f.From.IsZero() {
+		query += " AND t.post_date >= ?"
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		query += " AND t.post_date < ?"
+		args = append(args, f.To.AddDate(0, 0, 1))
+	}
+	if f.ByTag && len(f.Tags) > 0 {
+		query += " AND tt.tag_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.Tags)), ",") + ")"
+		for _, id := range f.Tags {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := h.db.Query("SELECT s.account_id, "+tag+", s.quantity_denom, SUM(s.quantity_num)"+
+		query+" GROUP BY "+group, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make(map[balanceKey]models.Amount)
+	for rows.Next() {
+		var key balanceKey
+		var denom, num int64
+		if err := rows.Scan(&key.Account, &key.Tag, &denom, &num); err != nil {
+			return nil, err
+		}
+		sums[key] = sums[key].Add(models.NewAmount(num, denom))
+	}
+	return sums, rows.Err()
+}
+
+// accountBalances возвращает точные балансы счетов пользователя в валютах самих
+// счетов. Счетов без сплитов в результате нет: их баланс — нулевое значение
+// models.Amount.
+func (h *Handler) accountBalances(userID int64) (map[int64]models.Amount, error) {
+	return h.accountBalancesBetween(userID, time.Time{}, time.Time{})
+}
+
+// accountBalancesBetween — суммы сплитов по счетам за период [from, to] по дате
+// проводки; нулевая граница — без ограничения
+func (h *Handler) accountBalancesBetween(userID int64, from, to time.Time) (map[int64]models.Amount, error) {
+	sums, err := h.sumSplits(userID, splitFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int64]models.Amount, len(sums))
+	for key, sum := range sums {
+		balances[key.Account] = sum
+	}
+	return balances, nil
+}
+
+// tagBalances — суммы сплитов за период [from, to] по тегам транзакций:
+// тег → счёт → сумма. Пустой tagIDs — все теги пользователя.
+func (h *Handler) tagBalances(userID int64, from, to time.Time, tagIDs []int64) (map[int64]map[int64]models.Amount, error) {
+	sums, err := h.sumSplits(userID, splitFilter{From: from, To: to, ByTag: true, Tags: tagIDs})
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int64]map[int64]models.Amount)
+	for key, sum := range sums {
+		if balances[key.Tag] == nil {
+			balances[key.Tag] = make(map[int64]models.Amount)
+		}
+		balances[key.Tag][key.Account] = sum
+	}
+	return balances, nil
+}
+
+// displayBalance переводит баланс счёта в знак, привычный пользователю:
+// доходы, капитал и обязательства в GnuCash хранятся отрицательными
+func displayBalance(account *models.Account, balance models.Amount) models.Amount {
+	if account.IsNegativeBalance() {
+		return balance.Neg()
+	}
+	return balance
+}
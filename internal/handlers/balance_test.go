@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccountBalancesMixedDenominators(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	savings := accountIDByName(t, h, userID, "Сберегательный счет")
+
+	// Целые единицы (как у JPY), сатоши и копейки на одном счёте
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Иены", "", [3]int64{savings, 12345, 1}, [3]int64{card, -12345, 1})
+	insertTx(t, h, userID, day.AddDate(0, 0, 1), "Сатоши", "", [3]int64{savings, 1, 100000000}, [3]int64{card, -1, 100000000})
+	insertTx(t, h, userID, day.AddDate(0, 0, 2), "Копейки", "", [3]int64{savings, 1999, 100}, [3]int64{card, -1999, 100})
+
+	balances, err := h.accountBalances(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := balances[savings].FloatString(8); got != "12364.99000001" {
+		t.Errorf("savings balance = %s", got)
+	}
+	if got := balances[savings].Add(balances[card]); !got.IsZero() {
+		t.Errorf("book does not balance: %s", got)
+	}
+
+	accounts, err := h.getAccountsWithBalance(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, acc := range accounts {
+		if acc.ID == savings && acc.Balance != 12364.99000001 {
+			t.Errorf("sidebar balance = %v", acc.Balance)
+		}
+	}
+
+	page, err := h.accountRegister(userID, savings, transactionFilter{Sort: "asc"}, registerPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := page.Rows
+	if len(txs) != 3 || txs[2]["account_balance"] != 12364.99000001 {
+		t.Errorf("register balance = %v", txs[len(txs)-1]["account_balance"])
+	}
+}
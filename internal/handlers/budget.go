@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+)
+
+// budgetLine — строка бюджета: план и факт по счёту за месяц в валюте счёта.
+// Для доходов факт приводится к положительному знаку, как в балансах.
+type budgetLine struct {
+	Account   *models.Account
+	Own       models.Amount // бюджет самого счёта, без дочерних
+	HasOwn    bool
+	Budget    models.Amount // с дочерними, если включено суммирование по дереву
+	Actual    models.Amount
+	HasBudget bool
+	Fraction  int64
+}
+
+// Remaining — остаток бюджета: план минус факт
+func (l *budgetLine) Remaining() models.Amount {
+	return l.Budget.Sub(l.Actual)
+}
+
+// Overspent — расходы месяца превысили бюджет
+func (l *budgetLine) Overspent() bool {
+	return l.HasBudget && l.Account.AccountType == models.AccountTypeExpense && l.Actual.Cmp(l.Budget) > 0
+}
+
+// format печатает сумму с числом знаков валюты счёта
+func (l *budgetLine) format(a models.Amount) string {
+	return money.FormatRat(a.Rat(), money.Places(l.Fraction))
+}
+
+// OwnText, BudgetText, ActualText, RemainingText — суммы строки для шаблона
+func (l *budgetLine) OwnText() string {
+	if !l.HasOwn {
+		return ""
+	}
+	return l.format(l.Own)
+}
+
+func (l *budgetLine) BudgetText() string    { return l.format(l.Budget) }
+func (l *budgetLine) ActualText() string    { return l.format(l.Actual) }
+func (l *budgetLine) RemainingText() string { return l.format(l.Remaining()) }
+
+// parseBudgetMonth разбирает месяц в формате 2006-01; пустая строка — текущий месяц
+func parseBudgetMonth(s string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse("2006-01", s)
+}
+
+// isBudgetAccount — бюджет задаётся только счетам доходов и расходов
+func isBudgetAccount(account *models.Account) bool {
+	return account.AccountType == models.AccountTypeIncome || account.AccountType == models.AccountTypeExpense
+}
+
+// budgetSum — бюджет и факт поддерева счёта в одной валюте
+type budgetSum struct {
+	Actual   models.Amount
+	Budget   models.Amount
+	Budgeted bool
+}
+
+// budgetLines собирает бюджет месяца по счетам доходов и расходов в порядке
+// дерева счетов. С rollup бюджет и факт родителя включают дочерние счета в той
+// же валюте — суммы в разных валютах не складываются. Скрытые счета в список
+// не попадают, но их суммы входят в итоги предков.
+func (h *Handler) budgetLines(userID int64, month time.Time, rollup bool) ([]*budgetLine, error) {
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fractions := make(map[int64]int64)
+	rows, err := h.db.Query("SELECT id, fraction FROM commodities")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, fraction int64
+		if err := rows.Scan(&id, &fraction); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fractions[id] = fraction
+	}
+	rows.Close()
+
+	actuals, err := h.accountBalancesBetween(userID, month, month.AddDate(0, 1, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]*budgetLine, 0)
+	byID := make(map[int64]*budgetLine)
+	accountsMap := make(map[int64]*models.Account, len(accounts))
+	for _, account := range accounts {
+		accountsMap[account.ID] = account
+		if !isBudgetAccount(account) {
+			continue
+		}
+		line := &budgetLine{
+			Account:  account,
+			Actual:   displayBalance(account, actuals[account.ID]),
+			Fraction: fractions[account.CommodityID],
+		}
+		if line.Fraction <= 0 {
+			line.Fraction = 100
+		}
+		byID[account.ID] = line
+		if account.Hidden == 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	rows, err = h.db.Query(`
+		SELECT account_id, amount_num, amount_denom FROM budgets WHERE user_id = ? AND month = ?
+	`, userID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var accountID, num, denom int64
+		if err := rows.Scan(&accountID, &num, &denom); err != nil {
+			return nil, err
+		}
+		if line := byID[accountID]; line != nil {
+			line.Own = models.NewAmount(num, denom)
+			line.HasOwn = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range byID {
+		line.Budget = line.Own
+		line.HasBudget = line.HasOwn
+	}
+	if !rollup {
+		return lines, nil
+	}
+
+	// Обходим дерево снизу вверх: суммы поддерева копятся по валютам, строка
+	// счёта получает итог в своей валюте. В getAccounts нет ROOT, поэтому
+	// buildAccountTree считает уровни на один меньше — отступы восстанавливаем.
+	var sumSubtree func(account *models.Account, level int) map[int64]budgetSum
+	sumSubtree = func(account *models.Account, level int) map[int64]budgetSum {
+		account.Level = level
+		sums := make(map[int64]budgetSum)
+		for _, child := range account.Childs {
+			for commodityID, sum := range sumSubtree(child, level+1) {
+				total := sums[commodityID]
+				total.Actual = total.Actual.Add(sum.Actual)
+				total.Budget = total.Budget.Add(sum.Budget)
+				total.Budgeted = total.Budgeted || sum.Budgeted
+				sums[commodityID] = total
+			}
+		}
+		if line := byID[account.ID]; line != nil {
+			total := sums[account.CommodityID]
+			total.Actual = total.Actual.Add(line.Actual)
+			total.Budget = total.Budget.Add(line.Own)
+			total.Budgeted = total.Budgeted || line.HasOwn
+			sums[account.CommodityID] = total
+			line.Actual, line.Budget, line.HasBudget = total.Actual, total.Budget, total.Budgeted
+		}
+		return sums
+	}
+	for _, root := range h.buildAccountTree(accounts, accountsMap) {
+		sumSubtree(root, 0)
+	}
+	return lines, nil
+}
+
+// FinanceBudget - бюджет месяца: план, факт и остаток по счетам доходов и расходов
+func (h *Handler) FinanceBudget(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	month, err := parseBudgetMonth(r.URL.Query().Get("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+	rollup := r.URL.Query().Get("rollup") != "0"
+
+	lines, err := h.budgetLines(userID, month, rollup)
+	if err != nil {
+		fmt.Printf("ERROR loading budget for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := h.pageData(userID, "budget")
+	data["Title"] = "Бюджет"
+	data["Month"] = month.Format("2006-01")
+	data["PrevMonth"] = month.AddDate(0, -1, 0).Format("2006-01")
+	data["NextMonth"] = month.AddDate(0, 1, 0).Format("2006-01")
+	data["Rollup"] = rollup
+	data["Lines"] = lines
+	h.renderTemplate(w, "finance_budget.html", data)
+}
+
+// overBudget возвращает счета расходов, превысившие бюджет текущего месяца,
+// для дашборда. Бюджет контейнерного счёта сравнивается с расходами всего
+// поддерева; предки без собственного бюджета не показываются, чтобы один
+// перерасход не повторялся по всей ветке.
+func (h *Handler) overBudget(userID int64) ([]map[string]interface{}, error) {
+	month, _ := parseBudgetMonth("")
+	lines, err := h.budgetLines(userID, month, true)
+	if err != nil {
+		return nil, err
+	}
+	var over []map[string]interface{}
+	for _, line := range lines {
+		if !line.HasOwn || !line.Overspent() {
+			continue
+		}
+		over = append(over, map[string]interface{}{
+			"ID":     line.Account.ID,
+			"Name":   line.Account.Name,
+			"Budget": line.BudgetText(),
+			"Actual": line.ActualText(),
+			"Over":   line.format(line.Remaining().Neg()),
+		})
+	}
+	return over, nil
+}
+
+// APIBudgetSave - бюджет счёта на месяц; пустая сумма удаляет бюджет
+func (h *Handler) APIBudgetSave(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	accountID, err := strconv.ParseInt(r.FormValue("account_id"), 10, 64)
+	if err != nil {
+		fail("Некорректный счёт")
+		return
+	}
+	month, err := parseBudgetMonth(r.FormValue("month"))
+	if err != nil || r.FormValue("month") == "" {
+		fail("Некорректный месяц")
+		return
+	}
+
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	if !isBudgetAccount(account) {
+		fail("Бюджет задаётся только для счетов доходов и расходов")
+		return
+	}
+
+	amount := r.FormValue("amount")
+	if amount == "" {
+		if _, err := h.db.Exec("DELETE FROM budgets WHERE account_id = ? AND user_id = ? AND month = ?",
+			accountID, userID, month); err != nil {
+			fmt.Printf("ERROR deleting budget: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+		return
+	}
+
+	// Бюджет хранится в долях валюты счёта, как quantity сплитов
+	fraction, err := h.commodityFraction(account.CommodityID)
+	if err != nil {
+		fraction = 100
+	}
+	num, err := money.ParseFraction(amount, fraction)
+	if err != nil {
+		fail(fmt.Sprintf("Некорректная сумма: %v", err))
+		return
+	}
+	if num < 0 {
+		fail("Бюджет не может быть отрицательным")
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO budgets (user_id, account_id, month, amount_num, amount_denom)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE amount_num = VALUES(amount_num), amount_denom = VALUES(amount_denom)
+	`, userID, accountID, month, num, fraction)
+	if err != nil {
+		fmt.Printf("ERROR saving budget: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+}
+
+// APIBudgetCopy - копирует бюджет предыдущего месяца в month.
+// Уже заданные в month суммы не перезаписываются.
+func (h *Handler) APIBudgetCopy(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	month, err := parseBudgetMonth(r.FormValue("month"))
+	if err != nil || r.FormValue("month") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Некорректный месяц"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		INSERT IGNORE INTO budgets (user_id, account_id, month, amount_num, amount_denom)
+		SELECT user_id, account_id, ?, amount_num, amount_denom
+		FROM budgets
+		WHERE user_id = ? AND month = ?
+	`, month, userID, month.AddDate(0, -1, 0))
+	if err != nil {
+		fmt.Printf("ERROR copying budget: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	copied, _ := result.RowsAffected()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"copied": copied,
+	})
+}
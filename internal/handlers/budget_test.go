@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// saveBudget задаёт бюджет счёта на месяц и проверяет ответ
+func saveBudget(t *testing.T, h *Handler, userID, accountID int64, month, amount string) {
+	t.Helper()
+	code, resp := postJSON(t, h, userID, h.APIBudgetSave, url.Values{
+		"account_id": {fmt.Sprint(accountID)}, "month": {month}, "amount": {amount},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("budget save failed: %d %v", code, resp)
+	}
+}
+
+// budgetByName возвращает строки бюджета по имени счёта
+func budgetByName(t *testing.T, h *Handler, userID int64, month string, rollup bool) map[string]*budgetLine {
+	t.Helper()
+	m, _ := parseBudgetMonth(month)
+	lines, err := h.budgetLines(userID, m, rollup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*budgetLine, len(lines))
+	for _, line := range lines {
+		byName[line.Account.Name] = line
+	}
+	return byName
+}
+
+func TestBudgetActualsAndRollup(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	power := accountIDByName(t, h, userID, "Электричество")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	march := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, march, "Магазин", "", [3]int64{food, 120000, 100}, [3]int64{card, -120000, 100})
+	insertTx(t, h, userID, march.AddDate(0, 0, 21), "Счёт за свет", "", [3]int64{power, 20000, 100}, [3]int64{card, -20000, 100})
+	insertTx(t, h, userID, march.AddDate(0, 1, 0), "Магазин", "", [3]int64{food, 5000, 100}, [3]int64{card, -5000, 100})
+	insertTx(t, h, userID, march, "Зарплата", "", [3]int64{card, 600000, 100}, [3]int64{salary, -600000, 100})
+
+	saveBudget(t, h, userID, food, "2026-03", "1 000")
+	saveBudget(t, h, userID, power, "2026-03", "300")
+	saveBudget(t, h, userID, salary, "2026-03", "5000")
+
+	lines := budgetByName(t, h, userID, "2026-03", true)
+	tests := []struct {
+		name, budget, actual, remaining string
+		overspent                       bool
+	}{
+		{"Продукты", "1000.00", "1200.00", "-200.00", true},
+		{"Электричество", "300.00", "200.00", "100.00", false},
+		{"Коммунальные услуги", "300.00", "200.00", "100.00", false},
+		{"Расходы", "1300.00", "1400.00", "-100.00", true},
+		// Доходы показываются положительными и не бывают перерасходом
+		{"Зарплата", "5000.00", "6000.00", "-1000.00", false},
+	}
+	for _, tt := range tests {
+		line := lines[tt.name]
+		if line == nil {
+			t.Fatalf("no budget line for %s", tt.name)
+		}
+		if line.BudgetText() != tt.budget || line.ActualText() != tt.actual ||
+			line.RemainingText() != tt.remaining || line.Overspent() != tt.overspent {
+			t.Errorf("%s: budget %s actual %s remaining %s overspent %v", tt.name,
+				line.BudgetText(), line.ActualText(), line.RemainingText(), line.Overspent())
+		}
+	}
+	if _, ok := lines["Расчетный счет"]; ok {
+		t.Error("asset accounts must not be budgeted")
+	}
+	if lines["Расходы"].Account.Level != 0 || lines["Продукты"].Account.Level != 1 {
+		t.Errorf("tree levels: %d %d", lines["Расходы"].Account.Level, lines["Продукты"].Account.Level)
+	}
+
+	// Скрытый счёт не показывается, но его факт и бюджет остаются в итогах предков
+	if _, err := h.db.Exec("UPDATE accounts SET hidden = 1 WHERE id = ?", power); err != nil {
+		t.Fatal(err)
+	}
+	lines = budgetByName(t, h, userID, "2026-03", true)
+	if _, ok := lines["Электричество"]; ok {
+		t.Error("hidden account must not be listed")
+	}
+	if line := lines["Коммунальные услуги"]; line.BudgetText() != "300.00" || line.ActualText() != "200.00" {
+		t.Errorf("hidden child lost from the parent: budget %s actual %s", line.BudgetText(), line.ActualText())
+	}
+	if _, err := h.db.Exec("UPDATE accounts SET hidden = 0 WHERE id = ?", power); err != nil {
+		t.Fatal(err)
+	}
+
+	// Без суммирования родитель без своего бюджета пуст
+	lines = budgetByName(t, h, userID, "2026-03", false)
+	if line := lines["Расходы"]; line.HasBudget || line.ActualText() != "0.00" {
+		t.Errorf("Расходы without rollup: budget %v actual %s", line.HasBudget, line.ActualText())
+	}
+
+	// Бюджет задаётся на каждый месяц отдельно
+	if lines := budgetByName(t, h, userID, "2026-04", true); lines["Продукты"].HasBudget {
+		t.Error("april has no budget yet")
+	}
+
+	// Пустая сумма удаляет бюджет
+	saveBudget(t, h, userID, power, "2026-03", "")
+	if lines := budgetByName(t, h, userID, "2026-03", true); lines["Электричество"].HasBudget ||
+		lines["Расходы"].BudgetText() != "1000.00" {
+		t.Errorf("budget not deleted: %s", lines["Расходы"].BudgetText())
+	}
+}
+
+func TestBudgetCopyPreviousMonth(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	food := accountIDByName(t, h, userID, "Продукты")
+	power := accountIDByName(t, h, userID, "Электричество")
+
+	saveBudget(t, h, userID, food, "2026-03", "1000")
+	saveBudget(t, h, userID, power, "2026-03", "300")
+	saveBudget(t, h, userID, food, "2026-04", "1500")
+
+	code, resp := postJSON(t, h, userID, h.APIBudgetCopy, url.Values{"month": {"2026-04"}})
+	if code != 200 || resp["copied"] != float64(1) {
+		t.Fatalf("copy: %d %v", code, resp)
+	}
+	lines := budgetByName(t, h, userID, "2026-04", false)
+	if lines["Продукты"].BudgetText() != "1500.00" || lines["Электричество"].BudgetText() != "300.00" {
+		t.Errorf("april budget: food %s power %s", lines["Продукты"].BudgetText(), lines["Электричество"].BudgetText())
+	}
+	if _, resp := postJSON(t, h, userID, h.APIBudgetCopy, url.Values{"month": {"2026-04"}}); resp["copied"] != float64(0) {
+		t.Errorf("second copy: %v", resp)
+	}
+}
+
+func TestBudgetSaveRejects(t *testing.T) {
+	h := testHandler(t)
+	owner := createTestUser(t, h)
+	userID := createTestUser(t, h)
+	for _, id := range []int64{owner, userID} {
+		if err := h.createBaseAccounts(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+
+	tests := []struct {
+		name string
+		form url.Values
+		code int
+	}{
+		{"foreign account", url.Values{"account_id": {fmt.Sprint(accountIDByName(t, h, owner, "Продукты"))},
+			"month": {"2026-03"}, "amount": {"10"}}, 404},
+		{"asset account", url.Values{"account_id": {fmt.Sprint(accountIDByName(t, h, userID, "Наличные"))},
+			"month": {"2026-03"}, "amount": {"10"}}, 400},
+		{"negative", url.Values{"account_id": {food}, "month": {"2026-03"}, "amount": {"-10"}}, 400},
+		{"bad amount", url.Values{"account_id": {food}, "month": {"2026-03"}, "amount": {"10.001"}}, 400},
+		{"bad month", url.Values{"account_id": {food}, "month": {"2026-13"}, "amount": {"10"}}, 400},
+		{"no month", url.Values{"account_id": {food}, "amount": {"10"}}, 400},
+	}
+	for _, tt := range tests {
+		if code, resp := postJSON(t, h, userID, h.APIBudgetSave, tt.form); code != tt.code {
+			t.Errorf("%s: expected %d, got %d %v", tt.name, tt.code, code, resp)
+		}
+	}
+	if n := countRows(t, h, "budgets", userID); n != 0 {
+		t.Errorf("rejected saves created %d budgets", n)
+	}
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/evbogdanov/finforme/internal/csvimport"
+)
+
+// maxStatementSize ограничивает размер загружаемой выписки
+const maxStatementSize = 10 << 20
+
+// csvSampleRows — сколько первых строк файла показывать для выбора колонок
+const csvSampleRows = 8
+
+// csvProfile — сохранённый профиль импорта CSV: как читать файл и куда проводить
+type csvProfile struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	csvimport.Profile
+	AccountID     int64 `json:"account_id"`
+	CounterpartID int64 `json:"counterpart_id"`
+}
+
+// parseCSVProfile читает профиль из полей формы; пустой номер колонки — 0
+func parseCSVProfile(r *http.Request) (csvimport.Profile, error) {
+	p := csvimport.Profile{
+		Delimiter:  r.FormValue("delimiter"),
+		Encoding:   r.FormValue("encoding"),
+		DateFormat: r.FormValue("date_format"),
+	}
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{
+		{"skip_rows", &p.SkipRows},
+		{"date_column", &p.DateColumn},
+		{"amount_column", &p.AmountColumn},
+		{"debit_column", &p.DebitColumn},
+		{"credit_column", &p.CreditColumn},
+		{"description_column", &p.DescriptionColumn},
+		{"category_column", &p.CategoryColumn},
+	} {
+		s := strings.TrimSpace(r.FormValue(field.name))
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return p, fmt.Errorf("Некорректное число в поле %s", field.name)
+		}
+		*field.value = n
+	}
+	return p, p.Validate()
+}
+
+// formID разбирает необязательный id из формы: пусто — 0
+func formID(r *http.Request, name string) (int64, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// getCSVProfiles возвращает профили импорта пользователя по имени
+func (h *Handler) getCSVProfiles(userID int64) ([]*csvProfile, error) {
+	rows, err := h.db.Query(`
+		SELECT id, name, delimiter, encoding, skip_rows, date_format, date_column, amount_column,
+		       debit_column, credit_column, description_column, category_column, account_id, counterpart_id
+		FROM import_profiles WHERE user_id = ? ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*csvProfile{}
+	for rows.Next() {
+		p := &csvProfile{}
+		var accountID, counterpartID sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.Name, &p.Delimiter, &p.Encoding, &p.SkipRows, &p.DateFormat,
+			&p.DateColumn, &p.AmountColumn, &p.DebitColumn, &p.CreditColumn, &p.DescriptionColumn,
+			&p.CategoryColumn, &accountID, &counterpartID); err != nil {
+			return nil, err
+		}
+		p.AccountID, p.CounterpartID = accountID.Int64, counterpartID.Int64
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// FinanceImportCSV - импорт банковской выписки в CSV: профиль, предпросмотр, проводка
+func (h *Handler) FinanceImportCSV(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	profiles, err := h.getCSVProfiles(userID)
+	if err != nil {
+		fmt.Printf("ERROR loading import profiles for user %d: %v\n", userID, err)
+	}
+	profilesJSON, err := json.Marshal(profiles)
+	if err != nil {
+		profilesJSON = []byte("[]")
+	}
+	accounts, _ := h.getAccounts(userID)
+
+	data := h.pageData(userID, "settings")
+	data["Title"] = "Импорт выписки CSV"
+	data["Profiles"] = profiles
+	data["ProfilesJSON"] = template.JS(profilesJSON)
+	data["Accounts"] = accounts
+	data["DateFormats"] = csvimport.DateFormats
+	h.renderTemplate(w, "finance_import_csv.html", data)
+}
+
+// csvStatement разбирает загруженную выписку по профилю из формы и сопоставляет
+// операции со счетами. Ошибки разбора возвращаются вместе с первыми строками
+// файла, чтобы по ним можно было поправить профиль.
+func (h *Handler) csvStatement(w http.ResponseWriter, r *http.Request, userID int64) (*statementImport, []statementLine, bool) {
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string, sample [][]string) {
+		w.WriteHeader(http.StatusBadRequest)
+		resp := map[string]interface{}{"error": message}
+		if sample != nil {
+			resp["sample"] = sample
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	if err := r.ParseMultipartForm(maxStatementSize); err != nil {
+		fail("Не удалось прочитать форму", nil)
+		return nil, nil, false
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		fail("Выберите файл выписки", nil)
+		return nil, nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxStatementSize+1))
+	if err != nil || len(data) > maxStatementSize {
+		fail("Файл выписки больше 10 МБ", nil)
+		return nil, nil, false
+	}
+
+	// Первые строки файла показываются и при неполном профиле — по ним
+	// выбирают колонки
+	profile, err := parseCSVProfile(r)
+	var sample [][]string
+	if records, _, err := csvimport.Records(data, profile); err == nil {
+		sample = records[:min(len(records), csvSampleRows)]
+	}
+	if err != nil {
+		fail(err.Error(), sample)
+		return nil, nil, false
+	}
+	accountID, err1 := formID(r, "account_id")
+	counterpartID, err2 := formID(r, "counterpart_id")
+	if err1 != nil || err2 != nil {
+		fail("Некорректный счёт", sample)
+		return nil, nil, false
+	}
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID, counterpartID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return nil, nil, false
+	}
+	imp, err := h.newStatementImport(userID, accountID, counterpartID)
+	if errors.Is(err, errNotOwned) {
+		writeAuthzError(w, err, "Счёт не найден")
+		return nil, nil, false
+	}
+	if err != nil {
+		fail(err.Error(), sample)
+		return nil, nil, false
+	}
+
+	rows, err := csvimport.Parse(data, profile)
+	if err != nil {
+		fail(err.Error(), sample)
+		return nil, nil, false
+	}
+	if len(rows) == 0 {
+		fail("В файле не найдено операций — проверьте колонки и число строк заголовка", sample)
+		return nil, nil, false
+	}
+
+	lines := make([]statementLine, 0, len(rows))
+	for _, row := range rows {
+		line, err := imp.line(row.Line, row.Date, row.Num, row.Denom, row.Description, row.Category)
+		if err != nil {
+			fail(err.Error(), sample)
+			return nil, nil, false
+		}
+		lines = append(lines, line)
+	}
+	return imp, lines, true
+}
+
+// APICSVImportPreview - предпросмотр импорта (multipart: file, поля профиля,
+// account_id, counterpart_id): операции с выбранными счетами и отметкой
+// возможных повторов — на счёте уже есть проводка той же даты и суммы
+func (h *Handler) APICSVImportPreview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	imp, lines, ok := h.csvStatement(w, r, userID)
+	if !ok {
+		return
+	}
+	duplicates, err := h.statementDuplicates(userID, imp, lines)
+	if err != nil {
+		fmt.Printf("ERROR looking for duplicates of statement lines: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"account": imp.Account.Name,
+		"rows":    imp.linesJSON(lines, duplicates),
+	})
+}
+
+// APICSVImport - проводит операции выписки; параметры как у предпросмотра,
+// skip — строки файла, которые не импортировать (можно несколько)
+func (h *Handler) APICSVImport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	imp, lines, ok := h.csvStatement(w, r, userID)
+	if !ok {
+		return
+	}
+	selected, err := selectStatementLines(r, lines)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ids, err := h.postStatement(userID, imp, selected)
+	if err != nil {
+		fmt.Printf("ERROR importing CSV statement for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":   "ok",
+		"imported": len(ids),
+		"skipped":  len(lines) - len(ids),
+	})
+}
+
+// APICSVProfileSave - сохраняет профиль импорта (id — изменить существующий,
+// name, поля профиля, account_id, counterpart_id)
+func (h *Handler) APICSVProfileSave(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	id, err := formID(r, "id")
+	if err != nil {
+		fail("Некорректный профиль")
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len([]rune(name)) > 255 {
+		fail("Укажите имя профиля")
+		return
+	}
+	profile, err := parseCSVProfile(r)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	accountID, err1 := formID(r, "account_id")
+	counterpartID, err2 := formID(r, "counterpart_id")
+	if err1 != nil || err2 != nil {
+		fail("Некорректный счёт")
+		return
+	}
+
+	if err := h.authorize(userID, ownedRefs{
+		ImportProfiles: []int64{id},
+		Accounts:       []int64{accountID, counterpartID},
+	}); err != nil {
+		writeAuthzError(w, err, "Профиль или счёт не найден")
+		return
+	}
+
+	var other int64
+	err = h.db.QueryRow("SELECT id FROM import_profiles WHERE user_id = ? AND name = ? AND id <> ?",
+		userID, name, id).Scan(&other)
+	if err == nil {
+		fail(fmt.Sprintf("Профиль «%s» уже есть", name))
+		return
+	}
+	if err != sql.ErrNoRows {
+		fmt.Printf("ERROR checking import profile name: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	nullable := func(id int64) interface{} {
+		if id == 0 {
+			return nil
+		}
+		return id
+	}
+	args := []interface{}{name, profile.Delimiter, profile.Encoding, profile.SkipRows, profile.DateFormat,
+		profile.DateColumn, profile.AmountColumn, profile.DebitColumn, profile.CreditColumn,
+		profile.DescriptionColumn, profile.CategoryColumn, nullable(accountID), nullable(counterpartID)}
+	if id != 0 {
+		_, err = h.db.Exec(`
+			UPDATE import_profiles SET name = ?, delimiter = ?, encoding = ?, skip_rows = ?, date_format = ?,
+			       date_column = ?, amount_column = ?, debit_column = ?, credit_column = ?,
+			       description_column = ?, category_column = ?, account_id = ?, counterpart_id = ?
+			WHERE id = ? AND user_id = ?
+		`, append(args, id, userID)...)
+	} else {
+		var result sql.Result
+		result, err = h.db.Exec(`
+			INSERT INTO import_profiles (name, delimiter, encoding, skip_rows, date_format,
+			       date_column, amount_column, debit_column, credit_column,
+			       description_column, category_column, account_id, counterpart_id, user_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, append(args, userID)...)
+		if err == nil {
+			id, _ = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		fmt.Printf("ERROR saving import profile: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     id,
+	})
+}
+
+// APICSVProfilesGet - профили импорта пользователя (JSON)
+func (h *Handler) APICSVProfilesGet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	profiles, err := h.getCSVProfiles(userID)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		fmt.Printf("ERROR loading import profiles for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"profiles": profiles})
+}
+
+// APICSVProfileDelete - удаляет профиль импорта (?id=)
+func (h *Handler) APICSVProfileDelete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.authorize(userID, ownedRefs{ImportProfiles: []int64{id}}); err != nil {
+		writeAuthzError(w, err, "Профиль не найден")
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM import_profiles WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		fmt.Printf("ERROR deleting import profile %d: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+}
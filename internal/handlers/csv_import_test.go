@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// uploadStatement отправляет выписку с полями формы в API импорта
+func uploadStatement(t *testing.T, h *Handler, userID int64, handler http.HandlerFunc, data string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "statement.csv")
+	fw.Write([]byte(data))
+	for name, values := range form {
+		for _, v := range values {
+			mw.WriteField(name, v)
+		}
+	}
+	mw.Close()
+
+	rec := doRequest(t, h, userID, handler, http.MethodPost, "/", &body, mw.FormDataContentType(), nil)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestCSVImport(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	other := accountIDByName(t, h, userID, "Электричество")
+
+	statement := "Дата;Сумма;Описание;Категория\n" +
+		"01.03.2026;-1 250,50;Магазин;продукты\n" +
+		"02.03.2026;50000;Аванс;Зарплата\n" +
+		"03.03.2026;-99;Неизвестно;Прочее\n"
+	form := url.Values{
+		"delimiter": {";"}, "encoding": {"utf-8"}, "skip_rows": {"1"}, "date_format": {"02.01.2006"},
+		"date_column": {"1"}, "amount_column": {"2"}, "description_column": {"3"}, "category_column": {"4"},
+		"account_id": {fmt.Sprint(card)}, "counterpart_id": {fmt.Sprint(other)},
+	}
+
+	// Предпросмотр ничего не проводит; категории сопоставлены по имени без учёта регистра
+	code, resp := uploadStatement(t, h, userID, h.APICSVImportPreview, statement, form)
+	if code != 200 {
+		t.Fatalf("preview: %d %v", code, resp)
+	}
+	rows := resp["rows"].([]interface{})
+	var got []string
+	for _, r := range rows {
+		row := r.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%v %v %v %v %v", row["line"], row["date"], row["amount"], row["counterpart_id"], row["duplicate"]))
+	}
+	want := []string{
+		fmt.Sprintf("2 2026-03-01 -1250.50 %d false", food),
+		fmt.Sprintf("3 2026-03-02 50000.00 %d false", salary),
+		fmt.Sprintf("4 2026-03-03 -99.00 %d false", other),
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("preview rows:\n%s\nexpected\n%s", strings.Join(got, "; "), strings.Join(want, "; "))
+	}
+	if n := countRows(t, h, "transactions", userID); n != 0 {
+		t.Fatalf("preview created %d transactions", n)
+	}
+
+	// Строка 4 исключена из импорта
+	importForm := url.Values{"skip": {"4"}}
+	for k, v := range form {
+		importForm[k] = v
+	}
+	code, resp = uploadStatement(t, h, userID, h.APICSVImport, statement, importForm)
+	if code != 200 || resp["imported"] != 2.0 || resp["skipped"] != 1.0 {
+		t.Fatalf("import: %d %v", code, resp)
+	}
+	balance := func(accountID int64) string {
+		t.Helper()
+		sum := new(big.Rat)
+		rows, err := h.db.Query("SELECT quantity_num, quantity_denom FROM splits WHERE account_id = ?", accountID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var num, denom int64
+			rows.Scan(&num, &denom)
+			sum.Add(sum, big.NewRat(num, denom))
+		}
+		return sum.FloatString(2)
+	}
+	if b := balance(card); b != "48749.50" {
+		t.Errorf("card balance %s", b)
+	}
+	if b := balance(food); b != "1250.50" {
+		t.Errorf("food balance %s", b)
+	}
+	if b := balance(other); b != "0.00" {
+		t.Errorf("skipped line was posted: %s", b)
+	}
+
+	// Повторная выписка: проведённые операции отмечены как возможные повторы
+	_, resp = uploadStatement(t, h, userID, h.APICSVImportPreview, statement, form)
+	var duplicates []bool
+	for _, r := range resp["rows"].([]interface{}) {
+		duplicates = append(duplicates, r.(map[string]interface{})["duplicate"].(bool))
+	}
+	if fmt.Sprint(duplicates) != "[true true false]" {
+		t.Errorf("duplicates: %v", duplicates)
+	}
+
+	// Ошибка разбора возвращается с началом файла
+	bad := url.Values{}
+	for k, v := range form {
+		bad[k] = v
+	}
+	bad.Set("skip_rows", "0")
+	code, resp = uploadStatement(t, h, userID, h.APICSVImportPreview, statement, bad)
+	if code != 400 || !strings.Contains(fmt.Sprint(resp["error"]), "Строка 1") || len(resp["sample"].([]interface{})) != 4 {
+		t.Errorf("bad profile: %d %v", code, resp)
+	}
+	bad.Set("skip_rows", "1")
+	bad.Set("counterpart_id", fmt.Sprint(card))
+	if code, resp = uploadStatement(t, h, userID, h.APICSVImportPreview, statement, bad); code != 400 {
+		t.Errorf("same accounts: %d %v", code, resp)
+	}
+
+	foreign := createTestUser(t, h)
+	if code, _ = uploadStatement(t, h, foreign, h.APICSVImport, statement, form); code != 404 {
+		t.Errorf("foreign accounts: expected 404, got %d", code)
+	}
+}
+
+func TestCSVImportProfiles(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+
+	form := url.Values{
+		"name": {"Мой банк"}, "delimiter": {","}, "encoding": {"windows-1251"}, "skip_rows": {"2"},
+		"date_format": {"2006-01-02"}, "date_column": {"1"}, "debit_column": {"2"}, "credit_column": {"3"},
+		"description_column": {"4"}, "account_id": {fmt.Sprint(card)},
+	}
+	code, resp := postJSON(t, h, userID, h.APICSVProfileSave, form)
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save: %d %v", code, resp)
+	}
+	id := int64(resp["id"].(float64))
+
+	if code, resp = postJSON(t, h, userID, h.APICSVProfileSave, form); code != 400 {
+		t.Errorf("duplicate name: %d %v", code, resp)
+	}
+	form.Set("id", fmt.Sprint(id))
+	form.Set("skip_rows", "3")
+	if code, resp = postJSON(t, h, userID, h.APICSVProfileSave, form); code != 200 {
+		t.Errorf("update: %d %v", code, resp)
+	}
+
+	profiles, err := h.getCSVProfiles(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || profiles[0].SkipRows != 3 || profiles[0].Encoding != "windows-1251" ||
+		profiles[0].CreditColumn != 3 || profiles[0].AccountID != card || profiles[0].CounterpartID != 0 {
+		t.Errorf("profiles: %+v", profiles)
+	}
+
+	foreign := createTestUser(t, h)
+	if code, _ = postJSON(t, h, foreign, h.APICSVProfileSave, form); code != 404 {
+		t.Errorf("foreign profile update: expected 404, got %d", code)
+	}
+	target := fmt.Sprintf("/api/v1/finance/import/profile/delete?id=%d", id)
+	if rec := doRequest(t, h, foreign, h.APICSVProfileDelete, http.MethodDelete, target, nil, "", nil); rec.Code != 404 {
+		t.Errorf("foreign profile delete: expected 404, got %d", rec.Code)
+	}
+	if rec := doRequest(t, h, userID, h.APICSVProfileDelete, http.MethodDelete, target, nil, "", nil); rec.Code != 200 {
+		t.Errorf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, h, "import_profiles", userID); n != 0 {
+		t.Errorf("%d profiles left", n)
+	}
+}
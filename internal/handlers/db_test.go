@@ -0,0 +1,189 @@
+package handlers
+
+// Вспомогательные функции для тестов, которым нужна настоящая БД.
+//
+// Тесты запускаются только если задана переменная TEST_DATABASE_DSN,
+// иначе пропускаются. База должна быть пустой или тестовой — InitDB
+// создаёт в ней таблицы, а каждый тест заводит своих пользователей
+// и удаляет их по завершении.
+//
+// Запуск:  TEST_DATABASE_DSN="root@tcp(localhost:3306)/finforme_test?parseTime=true" \
+//          go test ./internal/handlers/ -v
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/database"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// testHandler подключается к тестовой БД и создаёт Handler без шаблонов
+func testHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.InitDB(db); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	return &Handler{
+		db:    db,
+		store: sessions.NewCookieStore([]byte("test-secret")),
+	}
+}
+
+// createTestUser создаёт пользователя и удаляет его вместе со всеми данными после теста
+func createTestUser(t *testing.T, h *Handler) int64 {
+	t.Helper()
+
+	username := fmt.Sprintf("test-%s-%d", strings.ToLower(t.Name()), time.Now().UnixNano())
+	result, err := h.db.Exec(
+		"INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)",
+		username, username+"@example.com", "x",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	userID, _ := result.LastInsertId()
+
+	t.Cleanup(func() {
+		h.db.Exec("DELETE FROM scheduled_occurrences WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM scheduled_splits WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM scheduled_transactions WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM budgets WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM splits WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM transactions WHERE user_id = ?", userID)
+		h.db.Exec("UPDATE accounts SET parent_id = NULL WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM accounts WHERE user_id = ?", userID)
+		h.db.Exec("DELETE FROM users WHERE id = ?", userID)
+	})
+
+	return userID
+}
+
+// doRequest выполняет запрос к хендлеру от имени пользователя.
+// vars — переменные маршрута, как их выставил бы mux.
+func doRequest(t *testing.T, h *Handler, userID int64, handler http.HandlerFunc,
+	method, target string, body io.Reader, contentType string, vars map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Сессионная кука, как после логина
+	login := httptest.NewRecorder()
+	session, _ := h.store.Get(req, "session")
+	session.Values["user_id"] = userID
+	if err := session.Save(req, login); err != nil {
+		t.Fatalf("failed to save session: %v", err)
+	}
+	for _, c := range login.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// postForm отправляет форму от имени пользователя
+func postForm(t *testing.T, h *Handler, userID int64, handler http.HandlerFunc, form string) *httptest.ResponseRecorder {
+	t.Helper()
+	return doRequest(t, h, userID, handler, http.MethodPost, "/", bytes.NewBufferString(form),
+		"application/x-www-form-urlencoded", nil)
+}
+
+// bookBalances возвращает точные балансы счетов пользователя по полному пути счёта
+func bookBalances(t *testing.T, h *Handler, userID int64) map[string]string {
+	t.Helper()
+
+	names := make(map[int64]string)
+	parents := make(map[int64]int64)
+	rows, err := h.db.Query("SELECT id, name, parent_id FROM accounts WHERE user_id = ?", userID)
+	if err != nil {
+		t.Fatalf("failed to query accounts: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &name, &parentID); err != nil {
+			t.Fatalf("failed to scan account: %v", err)
+		}
+		names[id] = name
+		if parentID.Valid {
+			parents[id] = parentID.Int64
+		}
+	}
+	rows.Close()
+
+	path := func(id int64) string {
+		parts := []string{}
+		for id != 0 {
+			parts = append([]string{names[id]}, parts...)
+			id = parents[id]
+		}
+		return strings.Join(parts, ":")
+	}
+
+	sums := make(map[int64]*big.Rat)
+	for id := range names {
+		sums[id] = new(big.Rat)
+	}
+	rows, err = h.db.Query("SELECT account_id, quantity_num, quantity_denom FROM splits WHERE user_id = ?", userID)
+	if err != nil {
+		t.Fatalf("failed to query splits: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var accountID, num, denom int64
+		if err := rows.Scan(&accountID, &num, &denom); err != nil {
+			t.Fatalf("failed to scan split: %v", err)
+		}
+		sums[accountID].Add(sums[accountID], big.NewRat(num, denom))
+	}
+
+	balances := make(map[string]string, len(names))
+	for id, sum := range sums {
+		balances[path(id)] = sum.RatString()
+	}
+	return balances
+}
+
+// countRows возвращает количество строк пользователя в таблице
+func countRows(t *testing.T, h *Handler, table string, userID int64) int {
+	t.Helper()
+	var n int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", userID).Scan(&n); err != nil {
+		t.Fatalf("failed to count %s: %v", table, err)
+	}
+	return n
+}
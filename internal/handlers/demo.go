@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/evbogdanov/finforme/internal/networth"
+	"github.com/evbogdanov/finforme/internal/tags"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -214,27 +216,33 @@ func (h *Handler) seedDemoTransactions(userID int64) error {
 		}
 		valueNum := int64(e.amount * 100)
 		res, err := tx.Exec(`
-			INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description, tags)
-			VALUES (?, 1, ?, ?, ?, ?)
-		`, userID, e.date, e.date, e.desc, e.tags)
+			INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description)
+			VALUES (?, 1, ?, ?, ?)
+		`, userID, e.date, e.date, e.desc)
 		if err != nil {
 			return err
 		}
 		txID, _ := res.LastInsertId()
+		if err := tags.Set(tx, userID, txID, tags.Parse(e.tags)); err != nil {
+			return err
+		}
 		if _, err := tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, 100)
-		`, userID, txID, debitID, valueNum); err != nil {
+			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom, quantity_num, quantity_denom)
+			VALUES (?, ?, ?, ?, 100, ?, 100)
+		`, userID, txID, debitID, valueNum, valueNum); err != nil {
 			return err
 		}
 		if _, err := tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, 100)
-		`, userID, txID, creditID, -valueNum); err != nil {
+			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom, quantity_num, quantity_denom)
+			VALUES (?, ?, ?, ?, 100, ?, 100)
+		`, userID, txID, creditID, -valueNum, -valueNum); err != nil {
 			return err
 		}
 	}
 
+	if err := networth.Invalidate(tx, userID, time.Time{}); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
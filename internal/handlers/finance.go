@@ -3,17 +3,22 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"net/http"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/evbogdanov/finforme/internal/gnucash"
 	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/networth"
+	"github.com/evbogdanov/finforme/internal/tags"
 	"github.com/gorilla/mux"
 )
 
@@ -36,15 +41,18 @@ func (h *Handler) MortgageCalculator(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) FinanceIndex(w http.ResponseWriter, r *http.Request) {
 	userID, _ := h.getUserID(r)
 
+	balances, err := h.accountBalances(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Получаем все счета пользователя
 	rows, err := h.db.Query(`
-		SELECT a.id, a.name, a.account_type, a.commodity_id, a.commodity_scu,
-		       a.non_std_scu, a.parent_id, a.code, a.description, a.hidden, a.placeholder,
-		       COALESCE(SUM(s.value_num), 0) as balance
-		FROM accounts a
-		LEFT JOIN splits s ON a.id = s.account_id
-		WHERE a.user_id = ?
-		GROUP BY a.id
+		SELECT id, name, account_type, commodity_id, commodity_scu,
+		       non_std_scu, parent_id, code, description, hidden, placeholder
+		FROM accounts
+		WHERE user_id = ?
 	`, userID)
 
 	if err != nil {
@@ -58,13 +66,12 @@ func (h *Handler) FinanceIndex(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var acc models.Account
-		var balance int64
 		var parentID sql.NullInt64
 		var code, description sql.NullString
 
 		err := rows.Scan(&acc.ID, &acc.Name, &acc.AccountType, &acc.CommodityID,
 			&acc.CommoditySCU, &acc.NonStdSCU, &parentID, &code, &description,
-			&acc.Hidden, &acc.Placeholder, &balance)
+			&acc.Hidden, &acc.Placeholder)
 
 		if err != nil {
 			fmt.Printf("ERROR scanning account: %v\n", err)
@@ -82,11 +89,7 @@ func (h *Handler) FinanceIndex(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Вычисляем баланс с учетом типа счета
-		fraction := 100.0
-		acc.Balance = float64(balance) / fraction
-		if acc.IsNegativeBalance() {
-			acc.Balance = -acc.Balance
-		}
+		acc.Balance = displayBalance(&acc, balances[acc.ID]).Float64()
 
 		accounts = append(accounts, &acc)
 		accountsMap[acc.ID] = &acc
@@ -208,40 +211,20 @@ func (h *Handler) sortAccountsByID(accounts []*models.Account) {
 	}
 }
 
-// FinanceAccountView - просмотр транзакций счета
-func (h *Handler) FinanceAccountView(w http.ResponseWriter, r *http.Request) {
-	userID, _ := h.getUserID(r)
-	vars := mux.Vars(r)
-	accountIDStr := vars["id"]
-
-	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid account ID", http.StatusBadRequest)
-		return
-	}
-
-	// Получаем параметр сортировки из URL
-	sortOrder := r.URL.Query().Get("sort")
-	if sortOrder != "asc" && sortOrder != "desc" {
-		sortOrder = "desc" // По умолчанию - от новых к старым
-	}
-
-	// Получаем информацию о счете
+// getAccount загружает счёт пользователя без баланса
+func (h *Handler) getAccount(userID, accountID int64) (*models.Account, error) {
 	var account models.Account
 	var parentID sql.NullInt64
 	var code, description sql.NullString
-	err = h.db.QueryRow(`
+	err := h.db.QueryRow(`
 		SELECT id, name, account_type, commodity_id, commodity_scu, non_std_scu,
 		       parent_id, code, description, hidden, placeholder
 		FROM accounts WHERE id = ? AND user_id = ?
 	`, accountID, userID).Scan(&account.ID, &account.Name, &account.AccountType,
 		&account.CommodityID, &account.CommoditySCU, &account.NonStdSCU,
 		&parentID, &code, &description, &account.Hidden, &account.Placeholder)
-
 	if err != nil {
-		fmt.Printf("ERROR loading account %d: %v\n", accountID, err)
-		http.Error(w, "Account not found", http.StatusNotFound)
-		return
+		return nil, err
 	}
 
 	if parentID.Valid {
@@ -253,81 +236,85 @@ func (h *Handler) FinanceAccountView(w http.ResponseWriter, r *http.Request) {
 	if description.Valid {
 		account.Description = description.String
 	}
+	return &account, nil
+}
 
-	// Получаем транзакции счета с учетом сортировки
-	transactions := h.getAccountTransactions(userID, accountID, sortOrder)
-	accounts, _ := h.getAccounts(userID)
-	commodities, _ := h.getCommodities()
+// FinanceAccountView - просмотр транзакций счета
+func (h *Handler) FinanceAccountView(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	vars := mux.Vars(r)
+	accountIDStr := vars["id"]
 
-	// Определяем противоположный порядок сортировки для ссылки
-	oppositeSortOrder := "asc"
-	if sortOrder == "asc" {
-		oppositeSortOrder = "desc"
+	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
 	}
 
-	// Статистика и список доступных месяцев
-	var totalIncome, totalExpense float64
-	var incomeCount, expenseCount, totalCount int
-	monthsSet := make(map[string]bool)
+	// Фильтры и сортировка реестра из URL
+	now := time.Now()
+	filter, err := parseTransactionFilter(r.URL.Query(), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for _, tx := range transactions {
-		totalCount++
-		if v, ok := tx["plus_balance_changing"].(float64); ok && v > 0 {
-			totalIncome += v
-			incomeCount++
-		}
-		if v, ok := tx["balance_changing"].(float64); ok && v > 0 {
-			totalExpense += v
-			expenseCount++
-		}
-		if d, ok := tx["post_date"].(string); ok && len(d) >= 7 {
-			monthsSet[d[:7]] = true
-		}
+	// Получаем информацию о счете
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		fmt.Printf("ERROR loading account %d: %v\n", accountID, err)
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
 	}
 
-	monthNames := []string{
-		"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
-		"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+	// Первая страница реестра, итоги по всем страницам и месяцы для выбора периода
+	page, err := h.accountRegister(userID, accountID, filter, registerPageSize)
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	availableMonths := make([]map[string]string, 0, len(monthsSet))
-	for ym := range monthsSet {
-		parts := strings.SplitN(ym, "-", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		month, _ := strconv.Atoi(parts[1])
-		if month < 1 || month > 12 {
-			continue
-		}
-		availableMonths = append(availableMonths, map[string]string{
-			"Value": ym,
-			"Label": fmt.Sprintf("%s %s", monthNames[month-1], parts[0]),
-		})
+	if err != nil {
+		fmt.Printf("ERROR loading register of account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	// Сортируем месяцы по убыванию
-	for i := 0; i < len(availableMonths)-1; i++ {
-		for j := i + 1; j < len(availableMonths); j++ {
-			if availableMonths[i]["Value"] < availableMonths[j]["Value"] {
-				availableMonths[i], availableMonths[j] = availableMonths[j], availableMonths[i]
-			}
-		}
+	filter.Accounts = []int64{accountID}
+	stats, err := h.transactionStats(userID, filter)
+	if err != nil {
+		fmt.Printf("ERROR loading register stats of account %d: %v\n", accountID, err)
+	}
+	availableMonths, err := h.registerMonths(userID, accountID)
+	if err != nil {
+		fmt.Printf("ERROR loading register months of account %d: %v\n", accountID, err)
+	}
+	accounts, _ := h.getAccounts(userID)
+	commodities, _ := h.getCommodities()
+
+	// Определяем противоположный порядок сортировки для ссылки
+	oppositeSortOrder := "asc"
+	if filter.Sort == "asc" {
+		oppositeSortOrder = "desc"
 	}
 
 	data := h.pageData(userID, "transactions")
 	data["Title"] = account.Name
 	data["Account"] = account
-	data["Transactions"] = transactions
+	data["Transactions"] = page.Rows
+	data["PrevDate"] = page.PrevDate
+	data["MoreURL"] = registerMoreURL(accountID, filter, page)
+	data["Filter"] = filter
 	data["Accounts"] = accounts
 	data["Commodities"] = commodities
-	data["SortOrder"] = sortOrder
+	data["SortOrder"] = filter.Sort
 	data["OppositeSortOrder"] = oppositeSortOrder
 	data["ActiveAccountID"] = accountID
-	data["TotalIncome"] = totalIncome
-	data["TotalExpense"] = totalExpense
-	data["TotalCount"] = totalCount
-	data["IncomeCount"] = incomeCount
-	data["ExpenseCount"] = expenseCount
+	data["TotalIncome"] = stats.Income
+	data["TotalExpense"] = stats.Expense
+	data["TotalCount"] = stats.Count
+	data["IncomeCount"] = stats.IncomeCount
+	data["ExpenseCount"] = stats.ExpenseCount
 	data["AvailableMonths"] = availableMonths
+	data["TagColors"] = h.tagColors(userID)
 
 	h.renderTemplate(w, "finance_transactions.html", data)
 }
@@ -412,11 +399,11 @@ func (h *Handler) FinanceTransaction(w http.ResponseWriter, r *http.Request) {
 	accountID, _ := strconv.ParseInt(accountIDStr, 10, 64)
 
 	var transaction *models.Transaction
-	var debit, credit []map[string]interface{}
+	var splits []map[string]interface{}
 
 	if txIDStr != "" {
 		txID, _ := strconv.ParseInt(txIDStr, 10, 64)
-		transaction, debit, credit = h.getTransaction(userID, txID)
+		transaction, splits = h.getTransaction(userID, txID)
 	}
 
 	accounts, _ := h.getAccounts(userID)
@@ -424,100 +411,94 @@ func (h *Handler) FinanceTransaction(w http.ResponseWriter, r *http.Request) {
 	data := h.pageData(userID, "transactions")
 	data["Title"] = "Транзакция"
 	data["Transaction"] = transaction
-	data["Debit"] = debit
-	data["Credit"] = credit
+	data["Splits"] = splits
 	data["AccountID"] = accountID
 	data["Accounts"] = accounts
+	data["CurrencyID"] = h.formCurrencyID(userID, transaction, accountID)
 	h.renderTemplate(w, "finance_transaction.html", data)
 }
 
-// FinanceTransactionsByTag - транзакции по тегу
-func (h *Handler) FinanceTransactionsByTag(w http.ResponseWriter, r *http.Request) {
-	userID, _ := h.getUserID(r)
-	vars := mux.Vars(r)
-	tag := vars["tag"]
-
-	rows, err := h.db.Query(`
-		SELECT t.id, t.description, t.post_date, t.tags,
-		       a.id, a.name, a.account_type, a.commodity_id,
-		       s.id, s.value_num, s.value_denom
-		FROM transactions t
-		LEFT JOIN splits s ON t.id = s.tx_id
-		LEFT JOIN accounts a ON s.account_id = a.id
-		WHERE t.user_id = ? AND t.tags LIKE ?
-		ORDER BY t.post_date DESC
-	`, userID, "%"+tag+"%")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// formCurrencyID возвращает валюту для формы транзакции: валюту самой
+// транзакции при редактировании или валюту счёта, из которого она создаётся
+func (h *Handler) formCurrencyID(userID int64, transaction *models.Transaction, accountID int64) int64 {
+	if transaction != nil && transaction.CurrencyID != 0 {
+		return transaction.CurrencyID
 	}
-	defer rows.Close()
+	if currencyID, err := h.accountCommodity(userID, accountID); err == nil {
+		return currencyID
+	}
+	return 1
+}
 
-	transactionsMap := make(map[int64]map[string]interface{})
+// FinanceSettings - настройки
+func (h *Handler) FinanceSettings(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	data := h.pageData(userID, "settings")
+	data["Title"] = "Настройки"
 
-	for rows.Next() {
-		var txID, accountID, splitID, valueNum, valueDenom int64
-		var description, tags, accountName, accountType string
-		var postDate time.Time
-		var commodityID int64
-
-		rows.Scan(&txID, &description, &postDate, &tags, &accountID, &accountName,
-			&accountType, &commodityID, &splitID, &valueNum, &valueDenom)
-
-		if _, exists := transactionsMap[txID]; !exists {
-			transactionsMap[txID] = map[string]interface{}{
-				"id":          txID,
-				"description": description,
-				"post_date":   postDate.Format("02.01.2006"),
-				"tags":        strings.Split(tags, ","),
-				"splits":      []map[string]interface{}{},
-			}
+	// Валюту отчётности можно выбрать только среди валют (не ценных бумаг)
+	commodities, _ := h.getCommodities()
+	currencies := make([]*models.Commodity, 0, len(commodities))
+	for _, c := range commodities {
+		if c.Namespace == "CURRENCY" {
+			currencies = append(currencies, c)
 		}
+	}
+	data["Currencies"] = currencies
+	data["ReportingCurrencyID"] = int64(1)
+	if currency, err := h.reportingCurrency(userID); err == nil {
+		data["ReportingCurrencyID"] = currency.ID
+	}
 
-		split := map[string]interface{}{
-			"account_id":   accountID,
-			"account_name": accountName,
-			"value":        float64(valueNum) / float64(valueDenom),
-		}
+	h.renderTemplate(w, "finance_settings.html", data)
+}
 
-		splits := transactionsMap[txID]["splits"].([]map[string]interface{})
-		transactionsMap[txID]["splits"] = append(splits, split)
+// APISettingsReportingCurrency - сохраняет валюту отчётности пользователя
+func (h *Handler) APISettingsReportingCurrency(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
 	}
 
-	transactions := make([]map[string]interface{}, 0, len(transactionsMap))
-	for _, tx := range transactionsMap {
-		transactions = append(transactions, tx)
+	w.Header().Set("Content-Type", "application/json")
+
+	currencyID, err := strconv.ParseInt(r.FormValue("currency_id"), 10, 64)
+	var namespace string
+	if err == nil {
+		err = h.db.QueryRow("SELECT namespace FROM commodities WHERE id = ?", currencyID).Scan(&namespace)
+	}
+	if err != nil || namespace != "CURRENCY" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Некорректная валюта"})
+		return
 	}
 
-	data := h.pageData(userID, "transactions")
-	data["Title"] = fmt.Sprintf("Транзакции с тегом: %s", tag)
-	data["Tag"] = tag
-	data["Transactions"] = transactions
-	h.renderTemplate(w, "finance_transactions_by_tag.html", data)
-}
+	if _, err := h.db.Exec("UPDATE users SET reporting_currency_id = ? WHERE id = ?", currencyID, userID); err != nil {
+		fmt.Printf("ERROR saving reporting currency for user %d: %v\n", userID, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 
-// FinanceSettings - настройки
-func (h *Handler) FinanceSettings(w http.ResponseWriter, r *http.Request) {
-	userID, _ := h.getUserID(r)
-	data := h.pageData(userID, "settings")
-	data["Title"] = "Настройки"
-	h.renderTemplate(w, "finance_settings.html", data)
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
 }
 
 // Вспомогательные функции
 
 // getAccountsWithBalance загружает счета пользователя вместе с балансом (для сайдбара).
 func (h *Handler) getAccountsWithBalance(userID int64) ([]*models.Account, error) {
+	balances, err := h.accountBalances(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := h.db.Query(`
-		SELECT a.id, a.name, a.account_type, a.commodity_id, a.commodity_scu,
-		       a.non_std_scu, a.parent_id, a.code, a.description, a.hidden, a.placeholder,
-		       COALESCE(SUM(s.value_num), 0) AS balance
-		FROM accounts a
-		LEFT JOIN splits s ON a.id = s.account_id
-		WHERE a.user_id = ?
-		GROUP BY a.id
-		ORDER BY a.name
+		SELECT id, name, account_type, commodity_id, commodity_scu,
+		       non_std_scu, parent_id, code, description, hidden, placeholder
+		FROM accounts
+		WHERE user_id = ?
+		ORDER BY name
 	`, userID)
 	if err != nil {
 		return nil, err
@@ -531,11 +512,10 @@ func (h *Handler) getAccountsWithBalance(userID int64) ([]*models.Account, error
 		var acc models.Account
 		var parentID sql.NullInt64
 		var code, description sql.NullString
-		var balanceRaw int64
 
 		err := rows.Scan(&acc.ID, &acc.Name, &acc.AccountType, &acc.CommodityID,
 			&acc.CommoditySCU, &acc.NonStdSCU, &parentID, &code, &description,
-			&acc.Hidden, &acc.Placeholder, &balanceRaw)
+			&acc.Hidden, &acc.Placeholder)
 		if err != nil {
 			continue
 		}
@@ -550,10 +530,7 @@ func (h *Handler) getAccountsWithBalance(userID int64) ([]*models.Account, error
 			acc.Description = description.String
 		}
 
-		acc.Balance = float64(balanceRaw) / 100.0
-		if acc.IsNegativeBalance() {
-			acc.Balance = -acc.Balance
-		}
+		acc.Balance = displayBalance(&acc, balances[acc.ID]).Float64()
 
 		allAccounts = append(allAccounts, &acc)
 		accountsMap[acc.ID] = &acc
@@ -706,6 +683,22 @@ func (h *Handler) isPlaceholderAccount(userID, accountID int64) bool {
 	return ph == 1
 }
 
+// accountCommodity возвращает валюту (commodity) счёта пользователя
+func (h *Handler) accountCommodity(userID, accountID int64) (int64, error) {
+	var commodityID sql.NullInt64
+	err := h.db.QueryRow(
+		`SELECT commodity_id FROM accounts WHERE id = ? AND user_id = ?`,
+		accountID, userID,
+	).Scan(&commodityID)
+	if err != nil {
+		return 0, err
+	}
+	if !commodityID.Valid {
+		return 1, nil
+	}
+	return commodityID.Int64, nil
+}
+
 func (h *Handler) getCommodities() ([]*models.Commodity, error) {
 	rows, err := h.db.Query(`
 		SELECT id, namespace, mnemonic, fullname, cusip, fraction, quote_source, quote_tz, sign
@@ -754,97 +747,184 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-// renderDashboard — общая логика рендеринга дашборда (используется Index и Dashboard)
-func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, userID int64) {
-	data := h.pageData(userID, "dashboard")
-	data["Title"] = "Дашборд"
+// dashboardTotals — итоги дашборда в валюте отчётности, без округления
+type dashboardTotals struct {
+	Assets      models.Amount
+	Liabilities models.Amount
+	Income      models.Amount
+	Expense     models.Amount
+	TopAccounts []*dashboardAccount // Топ-7 счетов по абсолютному балансу
+}
+
+// dashboardAccount — счёт в списке крупнейших: баланс в валюте отчётности
+// и, если валюта счёта другая, в валюте счёта
+type dashboardAccount struct {
+	ID          int64
+	Name        string
+	AccountType string
+	Balance     models.Amount
+	Native      models.Amount
+	Mnemonic    string // пусто, если счёт в валюте отчётности
+
+	nativePlaces int
+}
+
+// NativeText — баланс в валюте счёта с её числом знаков
+func (a *dashboardAccount) NativeText() string {
+	return money.FormatRat(a.Native.Rat(), a.nativePlaces)
+}
 
-	// Загружаем балансы счетов, сгруппированные по типу
+// dashboardBalances считает итоги по типам счетов, пересчитывая баланс
+// каждого счёта из его валюты в валюту отчётности. Счета в валютах без
+// курса в итоги не попадают — converter запоминает такие валюты.
+func (h *Handler) dashboardBalances(userID int64, converter *currencyConverter) (*dashboardTotals, error) {
+	balances, err := h.accountBalances(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Активы и обязательства — те же типы, что в балансе и на графике
+	// чистого капитала
+	isAsset, isLiability := make(map[string]bool), make(map[string]bool)
+	types := []interface{}{userID, models.AccountTypeIncome, models.AccountTypeExpense, models.AccountTypeEquity}
+	for _, t := range balanceSheetSections[0].Types {
+		isAsset[t] = true
+		types = append(types, t)
+	}
+	for _, t := range balanceSheetSections[1].Types {
+		isLiability[t] = true
+		types = append(types, t)
+	}
 	rows, err := h.db.Query(`
-		SELECT a.account_type, SUM(s.value_num) / 100.0 AS balance
+		SELECT a.id, a.name, a.account_type, a.hidden, COALESCE(c.mnemonic, 'RUB'), COALESCE(c.fraction, 100)
 		FROM accounts a
-		LEFT JOIN splits s ON a.id = s.account_id
-		WHERE a.user_id = ? AND a.account_type IN ('ASSET','BANK','CASH','LIABILITY','INCOME','EXPENSE','EQUITY')
-		GROUP BY a.account_type
-	`, userID)
+		LEFT JOIN commodities c ON c.id = a.commodity_id
+		WHERE a.user_id = ? AND a.account_type IN (`+strings.TrimSuffix(strings.Repeat("?,", len(types)-1), ",")+`)
+	`, types...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	var totalAssets, totalLiabilities, totalIncome, totalExpense float64
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var accountType string
-			var balance float64
-			if err := rows.Scan(&accountType, &balance); err != nil {
-				continue
-			}
-			switch accountType {
-			case "ASSET", "BANK", "CASH":
-				totalAssets += balance
-			case "LIABILITY":
-				// LIABILITY в GnuCash хранится отрицательным — инвертируем
-				totalLiabilities += -balance
-			case "INCOME":
-				totalIncome += -balance
-			case "EXPENSE":
-				totalExpense += balance
-			}
+	totals := &dashboardTotals{}
+	for rows.Next() {
+		var id, fraction int64
+		var name, accountType, mnemonic string
+		var hidden bool
+		if err := rows.Scan(&id, &name, &accountType, &hidden, &mnemonic, &fraction); err != nil {
+			return nil, err
+		}
+		native := balances[id]
+		if native.IsZero() {
+			continue
+		}
+		balance, ok := converter.Convert(native, mnemonic)
+		if !ok {
+			continue
 		}
-	}
-	data["TotalAssets"] = totalAssets
-	data["TotalLiabilities"] = totalLiabilities
-	data["NetWorth"] = totalAssets - totalLiabilities
-	data["TotalIncome"] = totalIncome
-	data["TotalExpense"] = totalExpense
 
-	// Топ-7 счетов по абсолютному балансу (не ROOT, не INCOME/EXPENSE)
-	topRows, err := h.db.Query(`
-		SELECT a.id, a.name, a.account_type,
-		       COALESCE(SUM(s.value_num), 0) / 100.0 AS balance
-		FROM accounts a
-		LEFT JOIN splits s ON a.id = s.account_id
-		WHERE a.user_id = ?
-		  AND a.account_type IN ('ASSET','BANK','CASH','LIABILITY','EQUITY')
-		  AND a.hidden = 0
-		GROUP BY a.id, a.name, a.account_type
-		HAVING ABS(balance) > 0
-		ORDER BY ABS(balance) DESC
-		LIMIT 7
-	`, userID)
-	var topAccounts []map[string]interface{}
-	if err == nil {
-		defer topRows.Close()
-		for topRows.Next() {
-			var id int64
-			var name, accountType string
-			var balance float64
-			if err := topRows.Scan(&id, &name, &accountType, &balance); err != nil {
-				continue
-			}
-			// LIABILITY инвертируем
-			if accountType == "LIABILITY" {
-				balance = -balance
-			}
-			topAccounts = append(topAccounts, map[string]interface{}{
-				"ID":          id,
-				"Name":        name,
-				"AccountType": accountType,
-				"Balance":     balance,
-			})
+		switch {
+		case isAsset[accountType]:
+			totals.Assets = totals.Assets.Add(balance)
+		case isLiability[accountType]:
+			// Обязательства в GnuCash хранятся отрицательными — инвертируем
+			totals.Liabilities = totals.Liabilities.Sub(balance)
+		case accountType == models.AccountTypeIncome:
+			totals.Income = totals.Income.Sub(balance)
+		case accountType == models.AccountTypeExpense:
+			totals.Expense = totals.Expense.Add(balance)
+		}
+
+		// В крупнейшие счета не попадают INCOME/EXPENSE и скрытые счета
+		if hidden || accountType == "INCOME" || accountType == "EXPENSE" {
+			continue
+		}
+		if isLiability[accountType] {
+			balance, native = balance.Neg(), native.Neg()
 		}
+		account := &dashboardAccount{ID: id, Name: name, AccountType: accountType, Balance: balance}
+		if mnemonic != converter.target {
+			account.Native, account.Mnemonic = native, mnemonic
+			account.nativePlaces = money.Places(fraction)
+		}
+		totals.TopAccounts = append(totals.TopAccounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(totals.TopAccounts, func(i, j int) bool {
+		a, b := totals.TopAccounts[i].Balance.Rat(), totals.TopAccounts[j].Balance.Rat()
+		return new(big.Rat).Abs(a).Cmp(new(big.Rat).Abs(b)) > 0
+	})
+	if len(totals.TopAccounts) > 7 {
+		totals.TopAccounts = totals.TopAccounts[:7]
+	}
+	return totals, nil
+}
+
+// renderDashboard — общая логика рендеринга дашборда (используется Index и Dashboard)
+func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, userID int64) {
+	data := h.pageData(userID, "dashboard")
+	data["Title"] = "Дашборд"
+
+	// Балансы счетов хранятся в их собственных валютах — пересчитываем
+	// в валюту отчётности по последним курсам
+	currency, err := h.reportingCurrency(userID)
+	if err != nil {
+		fmt.Printf("ERROR loading reporting currency for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	data["TopAccounts"] = topAccounts
+	book, err := h.loadRateBook(time.Now())
+	if err != nil {
+		fmt.Printf("ERROR loading exchange rates: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	converter := newCurrencyConverter(book, currency.Mnemonic)
+
+	totals, err := h.dashboardBalances(userID, converter)
+	if err != nil {
+		fmt.Printf("ERROR loading balances for user %d: %v\n", userID, err)
+		totals = &dashboardTotals{}
+	}
+	places := money.Places(int64(currency.Fraction))
+	if currency.Fraction <= 0 {
+		places = 2
+	}
+	format := func(a models.Amount) string { return money.FormatRat(a.Rat(), places) }
+	netWorth := totals.Assets.Sub(totals.Liabilities)
+	data["TotalAssets"] = format(totals.Assets)
+	data["TotalLiabilities"] = format(totals.Liabilities)
+	data["HasLiabilities"] = totals.Liabilities.Sign() > 0
+	data["NetWorth"] = format(netWorth)
+	data["NetWorthNegative"] = netWorth.Sign() < 0
+	data["TotalIncome"] = format(totals.Income)
+	data["TotalExpense"] = format(totals.Expense)
+	data["TopAccounts"] = totals.TopAccounts
+	data["ReportingCurrency"] = currency
+	data["RatesUsed"] = converter.UsedRates()
+	data["MissingRates"] = converter.MissingCurrencies()
+
+	overBudget, err := h.overBudget(userID)
+	if err != nil {
+		fmt.Printf("ERROR loading budget for user %d: %v\n", userID, err)
+	}
+	data["OverBudget"] = overBudget
+	data["NetWorthJSON"] = h.netWorthChartJSON(userID)
 
 	// Последние 8 транзакций пользователя
 	recentRows, err := h.db.Query(`
 		SELECT DISTINCT t.id, t.description, DATE_FORMAT(t.post_date, '%Y-%m-%d') AS post_date,
-		       s.value_num / 100.0 AS amount,
+		       s.quantity_num, s.quantity_denom,
 		       a.name AS account_name, a.account_type
 		FROM transactions t
 		JOIN splits s ON s.tx_id = t.id
 		JOIN accounts a ON a.id = s.account_id
 		WHERE t.user_id = ?
 		  AND a.account_type NOT IN ('ROOT','EQUITY')
-		  AND s.value_num > 0
+		  AND s.quantity_num > 0
 		ORDER BY t.post_date DESC, t.id DESC
 		LIMIT 8
 	`, userID)
@@ -852,10 +932,10 @@ func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, userID
 	if err == nil {
 		defer recentRows.Close()
 		for recentRows.Next() {
-			var txID int64
+			var txID, quantityNum, quantityDenom int64
 			var description, postDate, accountName, accountType string
-			var amount float64
-			if err := recentRows.Scan(&txID, &description, &postDate, &amount, &accountName, &accountType); err != nil {
+			if err := recentRows.Scan(&txID, &description, &postDate, &quantityNum, &quantityDenom,
+				&accountName, &accountType); err != nil {
 				continue
 			}
 			if description == "" {
@@ -865,7 +945,7 @@ func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, userID
 				"ID":          txID,
 				"Description": description,
 				"PostDate":    postDate,
-				"Amount":      amount,
+				"Amount":      models.NewAmount(quantityNum, quantityDenom).Float64(),
 				"AccountName": accountName,
 				"AccountType": accountType,
 			})
@@ -876,138 +956,70 @@ func (h *Handler) renderDashboard(w http.ResponseWriter, r *http.Request, userID
 	h.renderTemplate(w, "index.html", data)
 }
 
-func (h *Handler) getAccountTransactions(userID, accountID int64, sortOrder string) []map[string]interface{} {
-	// Всегда получаем транзакции в хронологическом порядке для расчета баланса
-	// Используем JOIN вместо IN (SELECT ...) для лучшей производительности
-	rows, err := h.db.Query(`
-		SELECT t.id, t.description, t.post_date, t.tags,
-		       s.id, s.account_id, s.value_num, s.value_denom,
-		       a.name
-		FROM transactions t
-		JOIN splits acc_split ON t.id = acc_split.tx_id AND acc_split.account_id = ? AND acc_split.user_id = ?
-		JOIN splits s ON t.id = s.tx_id
-		LEFT JOIN accounts a ON s.account_id = a.id
-		WHERE t.user_id = ?
-		ORDER BY t.post_date ASC, t.id ASC
-	`, accountID, userID, userID)
-
-	if err != nil {
-		return []map[string]interface{}{}
-	}
-	defer rows.Close()
-
-	transactionsMap := make(map[int64]map[string]interface{})
-	transactionOrder := make([]int64, 0) // Сохраняем порядок транзакций
-
-	for rows.Next() {
-		var txID, splitID, splitAccountID, valueNum, valueDenom int64
-		var description, tags, accountName string
-		var postDate time.Time
-
-		rows.Scan(&txID, &description, &postDate, &tags, &splitID, &splitAccountID,
-			&valueNum, &valueDenom, &accountName)
-
-		if _, exists := transactionsMap[txID]; !exists {
-			transactionsMap[txID] = map[string]interface{}{
-				"id":            txID,
-				"description":   description,
-				"post_date":     postDate.Format("02.01.2006"),
-				"post_date_raw": postDate,
-				"tags":          strings.Split(tags, ","),
-			}
-			transactionOrder = append(transactionOrder, txID)
-		}
-
-		if splitAccountID == accountID {
-			value := float64(valueNum) / float64(valueDenom)
-			// Разделяем на приход (положительное) и расход (отрицательное)
-			if value > 0 {
-				transactionsMap[txID]["plus_balance_changing"] = value
-			} else {
-				transactionsMap[txID]["balance_changing"] = -value // Показываем расход как положительное число
-			}
-			transactionsMap[txID]["value_change"] = value // Сохраняем оригинальное значение для расчета баланса
-		} else {
-			transactionsMap[txID]["account_name"] = accountName
-			transactionsMap[txID]["account_id"] = splitAccountID
-		}
-	}
-
-	// Рассчитываем накопительный баланс (в хронологическом порядке)
-	var runningBalance float64 = 0
-	for _, txID := range transactionOrder {
-		if valueChange, ok := transactionsMap[txID]["value_change"].(float64); ok {
-			runningBalance += valueChange
-		}
-		transactionsMap[txID]["account_balance"] = runningBalance
-	}
-
-	// Формируем результат в нужном порядке
-	transactions := make([]map[string]interface{}, 0, len(transactionOrder))
-	if sortOrder == "desc" {
-		// Обратный порядок (от новых к старым)
-		for i := len(transactionOrder) - 1; i >= 0; i-- {
-			transactions = append(transactions, transactionsMap[transactionOrder[i]])
-		}
-	} else {
-		// Прямой порядок (от старых к новым)
-		for _, txID := range transactionOrder {
-			transactions = append(transactions, transactionsMap[txID])
-		}
-	}
-
-	return transactions
-}
-
-func (h *Handler) getTransaction(userID, txID int64) (*models.Transaction, []map[string]interface{}, []map[string]interface{}) {
+// getTransaction загружает транзакцию пользователя и её сплиты в порядке создания
+func (h *Handler) getTransaction(userID, txID int64) (*models.Transaction, []map[string]interface{}) {
 	var tx models.Transaction
 	err := h.db.QueryRow(`
-		SELECT id, description, post_date, enter_date, tags, currency_id
-		FROM transactions WHERE id = ? AND user_id = ?
+		SELECT t.id, t.description, t.post_date, t.enter_date, `+tags.Column+`, t.currency_id
+		FROM transactions t WHERE t.id = ? AND t.user_id = ?
 	`, txID, userID).Scan(&tx.ID, &tx.Description, &tx.PostDate, &tx.EnterDate, &tx.Tags, &tx.CurrencyID)
 
 	if err != nil {
-		return nil, nil, nil
+		return nil, nil
 	}
+	tx.Tags = strings.Join(tags.Parse(tx.Tags), ", ")
 
 	rows, err := h.db.Query(`
-		SELECT s.id, s.account_id, s.value_num, s.value_denom, a.name
+		SELECT s.id, s.account_id, s.value_num, s.value_denom, s.quantity_num, s.quantity_denom,
+		       s.memo, s.action, s.reconcile_state, s.reconcile_date,
+		       a.name, COALESCE(a.commodity_id, 1)
 		FROM splits s
 		LEFT JOIN accounts a ON s.account_id = a.id
 		WHERE s.tx_id = ? AND s.user_id = ?
+		ORDER BY s.id
 	`, txID, userID)
 
 	if err != nil {
-		return &tx, nil, nil
+		return &tx, nil
 	}
 	defer rows.Close()
 
-	debit := []map[string]interface{}{}
-	credit := []map[string]interface{}{}
+	splits := []map[string]interface{}{}
 
 	for rows.Next() {
-		var splitID, accountID, valueNum, valueDenom int64
-		var accountName string
-
-		rows.Scan(&splitID, &accountID, &valueNum, &valueDenom, &accountName)
-
-		value := float64(valueNum) / float64(valueDenom)
-		split := map[string]interface{}{
-			"id":           splitID,
-			"account_id":   accountID,
-			"account_name": accountName,
-			"value":        value,
-		}
-
-		if value < 0 {
-			split["value"] = -value
-			credit = append(credit, split)
-		} else {
-			debit = append(debit, split)
-		}
+		var splitID, accountID, valueNum, valueDenom, quantityNum, quantityDenom, commodityID int64
+		var memo, action, reconcileState, accountName string
+		var reconcileDate sql.NullTime
+
+		rows.Scan(&splitID, &accountID, &valueNum, &valueDenom, &quantityNum, &quantityDenom,
+			&memo, &action, &reconcileState, &reconcileDate, &accountName, &commodityID)
+
+		// Дата сверки в формате поля формы; пустая, если сплит не сверен
+		reconcileDateStr := ""
+		if reconcileDate.Valid {
+			reconcileDateStr = reconcileDate.Time.Format("2006-01-02")
+		}
+
+		// value — со знаком: положительное значение зачисляется на счёт;
+		// quantity — та же сумма в валюте счёта commodity_id.
+		// *_text — точная запись суммы для полей формы
+		splits = append(splits, map[string]interface{}{
+			"id":              splitID,
+			"account_id":      accountID,
+			"account_name":    accountName,
+			"commodity_id":    commodityID,
+			"value":           models.NewAmount(valueNum, valueDenom).Float64(),
+			"quantity":        models.NewAmount(quantityNum, quantityDenom).Float64(),
+			"value_text":      money.Format(valueNum, valueDenom, valueDenom),
+			"quantity_text":   money.Format(quantityNum, quantityDenom, quantityDenom),
+			"memo":            memo,
+			"action":          action,
+			"reconcile_state": reconcileState,
+			"reconcile_date":  reconcileDateStr,
+		})
 	}
 
-	return &tx, debit, credit
+	return &tx, splits
 }
 
 // APIAccountsGet - получение списка счетов (API)
@@ -1069,8 +1081,29 @@ func (h *Handler) APIAccountSave(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var accountID int64
+	if idStr != "" {
+		accountID, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Изменяемый счёт и родитель должны принадлежать пользователю
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID, parentID.Int64}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
+	if err := h.checkAccountParent(userID, accountID, parentID.Int64); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
 	if idStr == "" {
 		// Создание нового счета
 		result, err := h.db.Exec(`
@@ -1092,12 +1125,6 @@ func (h *Handler) APIAccountSave(w http.ResponseWriter, r *http.Request) {
 		})
 	} else {
 		// Обновление существующего счета
-		accountID, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			http.Error(w, "Invalid account ID", http.StatusBadRequest)
-			return
-		}
-
 		// Защита от противоречивых состояний placeholder
 		if placeholder == 1 {
 			var splits int
@@ -1123,6 +1150,30 @@ func (h *Handler) APIAccountSave(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		// Смена типа или валюты счёта меняет чистый капитал за всю историю
+		var oldType string
+		var oldCommodityID int64
+		h.db.QueryRow(`SELECT account_type, commodity_id FROM accounts WHERE id = ? AND user_id = ?`,
+			accountID, userID).Scan(&oldType, &oldCommodityID)
+
+		// Суммы сплитов, расписаний и бюджетов записаны в валюте счёта:
+		// смена валюты молча переименовала бы их, как при объединении счетов
+		if oldCommodityID != commodityID {
+			var used int
+			h.db.QueryRow(`
+				SELECT (SELECT COUNT(*) FROM splits WHERE account_id = ? AND user_id = ?)
+				     + (SELECT COUNT(*) FROM scheduled_splits WHERE account_id = ? AND user_id = ?)
+				     + (SELECT COUNT(*) FROM budgets WHERE account_id = ? AND user_id = ?)
+			`, accountID, userID, accountID, userID, accountID, userID).Scan(&used)
+			if used > 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "Нельзя сменить валюту счёта: по нему уже есть операции, расписания или бюджет",
+				})
+				return
+			}
+		}
+
 		_, err = h.db.Exec(`
 			UPDATE accounts
 			SET name = ?, account_type = ?, commodity_id = ?, parent_id = ?, description = ?,
@@ -1130,6 +1181,9 @@ func (h *Handler) APIAccountSave(w http.ResponseWriter, r *http.Request) {
 			WHERE id = ? AND user_id = ?
 		`, name, accountType, commodityID, parentID, description, hidden, placeholder, accountID, userID)
 
+		if err == nil && (oldType != accountType || oldCommodityID != commodityID) {
+			err = networth.Invalidate(h.db, userID, time.Time{})
+		}
 		if err != nil {
 			fmt.Printf("ERROR updating account: %v\n", err)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -1143,70 +1197,217 @@ func (h *Handler) APIAccountSave(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) APIAccountDelete(w http.ResponseWriter, r *http.Request) {
-	userID, _ := h.getUserID(r)
+// parseTransactionSplits читает сплиты из формы транзакции.
+// Сплиты передаются параллельными полями split_account, split_value,
+// split_quantity, split_memo, split_action, split_reconcile_state и
+// split_reconcile_date — по одному значению на сплит, все поля кроме счёта
+// и суммы необязательны; положительная сумма зачисляется на счёт,
+// отрицательная списывается. split_value — сумма в валюте транзакции,
+// split_quantity — в валюте счёта; если она не указана, QuantityDenom
+// остаётся нулевым и заполняется при сохранении.
+// Для старых клиентов принимается и форма из двух счетов: debit_account,
+// credit_account и value.
+func parseTransactionSplits(r *http.Request) ([]models.Split, error) {
+	accounts := r.Form["split_account"]
+	values := r.Form["split_value"]
+	quantities := r.Form["split_quantity"]
+	memos := r.Form["split_memo"]
+	actions := r.Form["split_action"]
+	states := r.Form["split_reconcile_state"]
+	dates := r.Form["split_reconcile_date"]
+
+	if len(accounts) == 0 && r.FormValue("debit_account") != "" {
+		accounts = []string{r.FormValue("debit_account"), r.FormValue("credit_account")}
+		value := strings.TrimSpace(r.FormValue("value"))
+		values = []string{value, "-" + value}
+		quantities, memos, actions, states, dates = nil, nil, nil, nil, nil
+	}
+
+	if len(values) != len(accounts) {
+		return nil, fmt.Errorf("Некорректный набор сплитов")
+	}
+	for _, optional := range [][]string{quantities, memos, actions, states, dates} {
+		if optional != nil && len(optional) != len(accounts) {
+			return nil, fmt.Errorf("Некорректный набор сплитов")
+		}
+	}
+
+	// field возвращает i-е значение необязательного поля
+	field := func(list []string, i int) string {
+		if list == nil {
+			return ""
+		}
+		return strings.TrimSpace(list[i])
+	}
+
+	var splits []models.Split
+	var sum models.Amount
+	maxDenom := int64(1)
+	for i := range accounts {
+		accountStr := strings.TrimSpace(accounts[i])
+		valueStr := strings.TrimSpace(values[i])
+		memo := field(memos, i)
+		action := field(actions, i)
+
+		// Пустые строки редактора просто пропускаем
+		if accountStr == "" && valueStr == "" && memo == "" && action == "" {
+			continue
+		}
+		if accountStr == "" {
+			return nil, fmt.Errorf("Строка %d: не выбран счёт", i+1)
+		}
 
-	// Получаем ID счета из параметров запроса
-	accountIDStr := r.URL.Query().Get("id")
-	if accountIDStr == "" {
-		http.Error(w, "Missing account ID", http.StatusBadRequest)
-		return
+		accountID, err := strconv.ParseInt(accountStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Строка %d: некорректный счёт", i+1)
+		}
+
+		// Суммы разбираем точно, к точности валют их приводит fillSplitQuantities
+		valueNum, valueDenom := int64(0), int64(1)
+		if valueStr != "" {
+			valueNum, valueDenom, err = money.Parse(valueStr)
+			if err != nil {
+				return nil, fmt.Errorf("Строка %d: %v", i+1, err)
+			}
+		}
+
+		var quantityNum, quantityDenom int64
+		if quantityStr := field(quantities, i); quantityStr != "" {
+			quantityNum, quantityDenom, err = money.Parse(quantityStr)
+			if err != nil {
+				return nil, fmt.Errorf("Строка %d: сумма в валюте счёта — %v", i+1, err)
+			}
+		}
+
+		reconcileState := field(states, i)
+		if reconcileState == "" {
+			reconcileState = models.ReconcileNew
+		}
+		if !models.IsKnownReconcileState(reconcileState) {
+			return nil, fmt.Errorf("Строка %d: некорректное состояние сверки", i+1)
+		}
+
+		var reconcileDate *time.Time
+		if dateStr := field(dates, i); dateStr != "" && reconcileState != models.ReconcileNew {
+			date, err := time.Parse("2006-01-02", dateStr)
+			if err != nil {
+				return nil, fmt.Errorf("Строка %d: некорректная дата сверки", i+1)
+			}
+			reconcileDate = &date
+		}
+
+		splits = append(splits, models.Split{
+			AccountID:      accountID,
+			ValueNum:       valueNum,
+			ValueDenom:     valueDenom,
+			QuantityNum:    quantityNum,
+			QuantityDenom:  quantityDenom,
+			Memo:           memo,
+			Action:         action,
+			ReconcileState: reconcileState,
+			ReconcileDate:  reconcileDate,
+		})
+		sum = sum.Add(models.NewAmount(valueNum, valueDenom))
+		maxDenom = max(maxDenom, valueDenom)
 	}
 
-	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid account ID", http.StatusBadRequest)
-		return
+	if len(splits) < 2 {
+		return nil, fmt.Errorf("В транзакции должно быть не меньше двух сплитов")
+	}
+	if !sum.IsZero() {
+		return nil, fmt.Errorf("Транзакция не сбалансирована: разница %s",
+			money.FormatRat(sum.Rat(), max(money.Places(maxDenom), 2)))
 	}
 
-	// Начинаем транзакцию
-	tx, err := h.db.Begin()
-	if err != nil {
-		fmt.Printf("ERROR starting transaction: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	return splits, nil
+}
+
+// transactionCurrency определяет валюту транзакции: явно переданную в
+// currency_id, иначе валюту счёта, из реестра которого она вводится
+// (account_id), иначе валюту счёта первого сплита
+func (h *Handler) transactionCurrency(r *http.Request, userID int64, splits []models.Split) (int64, error) {
+	if currencyStr := r.FormValue("currency_id"); currencyStr != "" && currencyStr != "0" {
+		currencyID, err := strconv.ParseInt(currencyStr, 10, 64)
+		var exists int
+		if err == nil {
+			err = h.db.QueryRow("SELECT COUNT(*) FROM commodities WHERE id = ?", currencyID).Scan(&exists)
+		}
+		if err != nil || exists == 0 {
+			return 0, fmt.Errorf("Неизвестная валюта транзакции")
+		}
+		return currencyID, nil
 	}
-	defer tx.Rollback()
 
-	// Сначала удаляем все splits, связанные со счетом
-	_, err = tx.Exec("DELETE FROM splits WHERE account_id = ? AND user_id = ?", accountID, userID)
+	accountID := splits[0].AccountID
+	if registerID, err := strconv.ParseInt(r.FormValue("account_id"), 10, 64); err == nil && registerID != 0 {
+		accountID = registerID
+	}
+	currencyID, err := h.accountCommodity(userID, accountID)
 	if err != nil {
-		fmt.Printf("ERROR deleting splits: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return 0, fmt.Errorf("Счёт не найден")
 	}
+	return currencyID, nil
+}
 
-	// Затем удаляем сам счет
-	result, err := tx.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", accountID, userID)
+// fillSplitQuantities заполняет суммы сплитов в валютах их счетов и приводит
+// суммы к точности валют: value — к fraction валюты транзакции, quantity —
+// к fraction валюты счёта; лишние знаки после запятой — ошибка, а не округление.
+// Для счёта в валюте транзакции quantity равна value; для счёта в другой
+// валюте сумма должна быть указана явно и иметь тот же знак.
+func (h *Handler) fillSplitQuantities(userID, currencyID int64, splits []models.Split) error {
+	currencyFraction, err := h.commodityFraction(currencyID)
 	if err != nil {
-		fmt.Printf("ERROR deleting account: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("Неизвестная валюта транзакции")
 	}
 
-	// Проверяем, был ли удален счет
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Account not found", http.StatusNotFound)
-		return
-	}
+	for i := range splits {
+		s := &splits[i]
+		commodityID, err := h.accountCommodity(userID, s.AccountID)
+		if err != nil {
+			return fmt.Errorf("Сплит %d: счёт не найден", i+1)
+		}
 
-	// Коммитим транзакцию
-	if err := tx.Commit(); err != nil {
-		fmt.Printf("ERROR committing transaction: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+		if s.ValueNum, err = money.Rescale(s.ValueNum, s.ValueDenom, currencyFraction); err != nil {
+			return fmt.Errorf("Сплит %d: %v", i+1, err)
+		}
+		s.ValueDenom = currencyFraction
 
-	// Возвращаем пустой ответ для HTMX
-	w.WriteHeader(http.StatusNoContent)
+		if commodityID == currencyID {
+			s.QuantityNum, s.QuantityDenom = s.ValueNum, s.ValueDenom
+			continue
+		}
+		if s.QuantityDenom == 0 {
+			return fmt.Errorf("Сплит %d: счёт в другой валюте — укажите сумму в валюте счёта", i+1)
+		}
+		commodityFraction, err := h.commodityFraction(commodityID)
+		if err != nil {
+			return fmt.Errorf("Сплит %d: неизвестная валюта счёта", i+1)
+		}
+		if s.QuantityNum, err = money.Rescale(s.QuantityNum, s.QuantityDenom, commodityFraction); err != nil {
+			return fmt.Errorf("Сплит %d: сумма в валюте счёта — %v", i+1, err)
+		}
+		s.QuantityDenom = commodityFraction
+
+		if (s.QuantityNum > 0) != (s.ValueNum > 0) || (s.QuantityNum == 0) != (s.ValueNum == 0) {
+			return fmt.Errorf("Сплит %d: суммы в валюте транзакции и в валюте счёта разного знака", i+1)
+		}
+	}
+	return nil
 }
 
-func (h *Handler) APITransactionsGet(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode([]interface{}{})
+// commodityFraction возвращает точность валюты — знаменатель её наименьшей доли
+func (h *Handler) commodityFraction(commodityID int64) (int64, error) {
+	var fraction int64
+	if err := h.db.QueryRow("SELECT fraction FROM commodities WHERE id = ?", commodityID).Scan(&fraction); err != nil {
+		return 0, err
+	}
+	if fraction <= 0 {
+		return 100, nil
+	}
+	return fraction, nil
 }
 
+// APITransactionSave - создание или обновление транзакции со всеми её сплитами
 func (h *Handler) APITransactionSave(w http.ResponseWriter, r *http.Request) {
 	userID, _ := h.getUserID(r)
 
@@ -1220,12 +1421,9 @@ func (h *Handler) APITransactionSave(w http.ResponseWriter, r *http.Request) {
 	idStr := r.FormValue("id")
 	description := r.FormValue("description")
 	postDateStr := r.FormValue("post_date")
-	tags := r.FormValue("tags")
-	valueStr := r.FormValue("value")
-	debitAccountStr := r.FormValue("debit_account")
-	creditAccountStr := r.FormValue("credit_account")
+	tagNames := tags.Parse(r.FormValue("tags"))
 
-	if description == "" || postDateStr == "" || valueStr == "" || debitAccountStr == "" || creditAccountStr == "" {
+	if description == "" || postDateStr == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
@@ -1237,64 +1435,87 @@ func (h *Handler) APITransactionSave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Парсим сумму
-	value, err := strconv.ParseFloat(valueStr, 64)
+	w.Header().Set("Content-Type", "application/json")
+
+	splits, err := parseTransactionSplits(r)
 	if err != nil {
-		http.Error(w, "Invalid value", http.StatusBadRequest)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	for _, name := range tagNames {
+		if err := tags.CheckName(name); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
 
-	// Парсим ID счетов
-	debitAccountID, err := strconv.ParseInt(debitAccountStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid debit account ID", http.StatusBadRequest)
-		return
+	var txID int64
+	if idStr != "" && idStr != "0" {
+		txID, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid transaction ID"})
+			return
+		}
 	}
 
-	creditAccountID, err := strconv.ParseInt(creditAccountStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid credit account ID", http.StatusBadRequest)
+	// Транзакция, счета сплитов и счёт реестра должны принадлежать пользователю
+	refs := ownedRefs{Transactions: []int64{txID}}
+	for _, s := range splits {
+		refs.Accounts = append(refs.Accounts, s.AccountID)
+	}
+	if registerID, err := strconv.ParseInt(r.FormValue("account_id"), 10, 64); err == nil {
+		refs.Accounts = append(refs.Accounts, registerID)
+	}
+	if err := h.authorize(userID, refs); err != nil {
+		writeAuthzError(w, err, "Транзакция или счёт не найдены")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
 	// Контейнерные (placeholder) счета не могут участвовать в транзакциях
-	if h.isPlaceholderAccount(userID, debitAccountID) || h.isPlaceholderAccount(userID, creditAccountID) {
+	for _, s := range splits {
+		if h.isPlaceholderAccount(userID, s.AccountID) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Контейнерный счёт не может участвовать в транзакции — выберите конечный счёт",
+			})
+			return
+		}
+	}
+
+	currencyID, err := h.transactionCurrency(r, userID, splits)
+	if err == nil {
+		err = h.fillSplitQuantities(userID, currencyID, splits)
+	}
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Контейнерный счёт не может участвовать в транзакции — выберите конечный счёт",
-		})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	// Конвертируем сумму в целые числа (value_num / value_denom)
-	valueNum := int64(value * 100)
-	valueDenom := int64(100)
-
-	// Проверяем, это обновление или создание
-	if idStr != "" && idStr != "0" {
-		// Обновление существующей транзакции
-		txID, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid transaction ID"})
-			return
-		}
+	// Начинаем транзакцию БД
+	tx, err := h.db.Begin()
+	if err != nil {
+		fmt.Printf("ERROR starting transaction: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
 
-		// Начинаем транзакцию БД
-		tx, err := h.db.Begin()
-		if err != nil {
-			fmt.Printf("ERROR starting transaction: %v\n", err)
+	if txID != 0 {
+		// Снимки чистого капитала устаревают и со старой даты, и с новой
+		if err := invalidateNetWorthForTransaction(tx, userID, txID); err != nil {
+			fmt.Printf("ERROR invalidating net worth snapshots: %v\n", err)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
-		defer tx.Rollback()
 
-		// Обновляем транзакцию
+		// Обновление существующей транзакции: сплиты пересоздаём целиком
 		_, err = tx.Exec(`
-			UPDATE transactions SET description = ?, post_date = ?, tags = ?
+			UPDATE transactions SET currency_id = ?, description = ?, post_date = ?
 			WHERE id = ? AND user_id = ?
-		`, description, postDate, tags, txID, userID)
+		`, currencyID, description, postDate, txID, userID)
 
 		if err != nil {
 			fmt.Printf("ERROR updating transaction: %v\n", err)
@@ -1302,61 +1523,18 @@ func (h *Handler) APITransactionSave(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Удаляем старые splits
 		_, err = tx.Exec("DELETE FROM splits WHERE tx_id = ? AND user_id = ?", txID, userID)
 		if err != nil {
 			fmt.Printf("ERROR deleting old splits: %v\n", err)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
-
-		// Создаем новые splits
-		_, err = tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, ?)
-		`, userID, txID, debitAccountID, valueNum, valueDenom)
-
-		if err != nil {
-			fmt.Printf("ERROR creating debit split: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-
-		_, err = tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, ?)
-		`, userID, txID, creditAccountID, -valueNum, valueDenom)
-
-		if err != nil {
-			fmt.Printf("ERROR creating credit split: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-
-		if err := tx.Commit(); err != nil {
-			fmt.Printf("ERROR committing transaction: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"result": "ok",
-			"id":     txID,
-		})
-	} else {
-		// Создание новой транзакции
-		tx, err := h.db.Begin()
-		if err != nil {
-			fmt.Printf("ERROR starting transaction: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-		defer tx.Rollback()
-
+	} else {
+		// Создание новой транзакции
 		result, err := tx.Exec(`
-			INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description, tags)
-			VALUES (?, 1, ?, ?, ?, ?)
-		`, userID, postDate, time.Now(), description, tags)
+			INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description)
+			VALUES (?, ?, ?, ?, ?)
+		`, userID, currencyID, postDate, time.Now(), description)
 
 		if err != nil {
 			fmt.Printf("ERROR creating transaction: %v\n", err)
@@ -1364,41 +1542,47 @@ func (h *Handler) APITransactionSave(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		txID, _ := result.LastInsertId()
+		txID, _ = result.LastInsertId()
+	}
 
+	for _, s := range splits {
 		_, err = tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, ?)
-		`, userID, txID, debitAccountID, valueNum, valueDenom)
+			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom,
+			                    quantity_num, quantity_denom,
+			                    memo, action, reconcile_state, reconcile_date)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, txID, s.AccountID, s.ValueNum, s.ValueDenom, s.QuantityNum, s.QuantityDenom,
+			s.Memo, s.Action, s.ReconcileState, s.ReconcileDate)
 
 		if err != nil {
-			fmt.Printf("ERROR creating debit split: %v\n", err)
+			fmt.Printf("ERROR creating split: %v\n", err)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
+	}
 
-		_, err = tx.Exec(`
-			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-			VALUES (?, ?, ?, ?, ?)
-		`, userID, txID, creditAccountID, -valueNum, valueDenom)
-
-		if err != nil {
-			fmt.Printf("ERROR creating credit split: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
+	if err := tags.Set(tx, userID, txID, tagNames); err != nil {
+		fmt.Printf("ERROR saving transaction tags: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 
-		if err := tx.Commit(); err != nil {
-			fmt.Printf("ERROR committing transaction: %v\n", err)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
+	if err := networth.Invalidate(tx, userID, postDate); err != nil {
+		fmt.Printf("ERROR invalidating net worth snapshots: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"result": "ok",
-			"id":     txID,
-		})
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("ERROR committing transaction: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
 	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     txID,
+	})
 }
 
 func (h *Handler) APITransactionDelete(w http.ResponseWriter, r *http.Request) {
@@ -1417,6 +1601,15 @@ func (h *Handler) APITransactionDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.authorize(userID, ownedRefs{Transactions: []int64{txID}}); err != nil {
+		if errors.Is(err, errNotOwned) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	// Начинаем транзакцию
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -1426,6 +1619,12 @@ func (h *Handler) APITransactionDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	if err := invalidateNetWorthForTransaction(tx, userID, txID); err != nil {
+		fmt.Printf("ERROR invalidating net worth snapshots: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Сначала удаляем все splits, связанные с транзакцией
 	_, err = tx.Exec("DELETE FROM splits WHERE tx_id = ? AND user_id = ?", txID, userID)
 	if err != nil {
@@ -1460,11 +1659,6 @@ func (h *Handler) APITransactionDelete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) APIExportJSON(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{})
-}
-
 func (h *Handler) APIDataDelete(w http.ResponseWriter, r *http.Request) {
 	userID, authenticated := h.getUserID(r)
 	if !authenticated {
@@ -1483,6 +1677,17 @@ func (h *Handler) APIDataDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	// Удаляем запланированные транзакции, бюджеты и снимки чистого капитала
+	for _, table := range []string{"scheduled_occurrences", "scheduled_splits", "scheduled_transactions", "budgets",
+		"net_worth_snapshots", "tags"} {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			fmt.Printf("ERROR deleting %s: %v\n", table, err)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": err.Error()})
+			return
+		}
+	}
+
 	// Удаляем все splits пользователя
 	_, err = tx.Exec("DELETE FROM splits WHERE user_id = ?", userID)
 	if err != nil {
@@ -1829,353 +2034,14 @@ func (h *Handler) createBaseAccounts(userID int64) error {
 	return nil
 }
 
-func (h *Handler) APIImportJSON(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
-}
-
-// APIImportGnuCash handles GnuCash SQLite database import
+// APIImportGnuCash handles GnuCash file import.
+// Формат (SQLite или XML) определяется по содержимому файла, поэтому
+// обработчик совпадает с APIImportGnuCashXML.
 func (h *Handler) APIImportGnuCash(w http.ResponseWriter, r *http.Request) {
-	userID, authenticated := h.getUserID(r)
-	if !authenticated {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Not authenticated"})
-		return
-	}
-
-	if r.Method != http.MethodPost {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Method not allowed"})
-		return
-	}
-
-	// Parse multipart form (max 32MB)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to parse form"})
-		return
-	}
-
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to get file"})
-		return
-	}
-	defer file.Close()
-
-	// Create temp directory if not exists
-	if err := os.MkdirAll("temp", 0755); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to create temp directory"})
-		return
-	}
-
-	// Save uploaded file
-	tempFile := fmt.Sprintf("temp/%d_gnucash.sqlite", userID)
-	dst, err := os.Create(tempFile)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to create temp file"})
-		return
-	}
-	defer dst.Close()
-	defer os.Remove(tempFile)
-
-	if _, err := io.Copy(dst, file); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": "Failed to save file"})
-		return
-	}
-
-	// Import from GnuCash database
-	if err := h.importFromGnuCash(userID, tempFile); err != nil {
-		log.Printf("Error importing GnuCash data: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": err.Error()})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok"})
-}
-
-// importFromGnuCash imports data from GnuCash SQLite database
-func (h *Handler) importFromGnuCash(userID int64, filename string) error {
-	// Open GnuCash database
-	importDB, err := sql.Open("sqlite3", filename)
-	if err != nil {
-		return fmt.Errorf("failed to open GnuCash database: %w", err)
-	}
-	defer importDB.Close()
-
-	// Start transaction
-	tx, err := h.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Map old IDs to new IDs
-	accountMap := make(map[string]int64)
-	commodityMap := make(map[string]int64)
-
-	// Get existing commodities from our database
-	existingCommodities := make(map[string]int64)
-	commodityRows, err := h.db.Query("SELECT id, mnemonic FROM commodities")
-	if err != nil {
-		return fmt.Errorf("failed to query existing commodities: %w", err)
-	}
-	defer commodityRows.Close()
-
-	for commodityRows.Next() {
-		var id int64
-		var mnemonic string
-		if err := commodityRows.Scan(&id, &mnemonic); err != nil {
-			return fmt.Errorf("failed to scan commodity: %w", err)
-		}
-		existingCommodities[mnemonic] = id
-	}
-
-	// Import commodities mapping from GnuCash
-	// First, let's check what columns exist in the commodities table
-	columnsRows, err := importDB.Query("PRAGMA table_info(commodities)")
-	if err != nil {
-		return fmt.Errorf("failed to get commodities table info: %w", err)
-	}
-
-	var columns []string
-	for columnsRows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull, dfltValue, pk interface{}
-		if err := columnsRows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk); err != nil {
-			columnsRows.Close()
-			return fmt.Errorf("failed to scan column info: %w", err)
-		}
-		columns = append(columns, name)
-	}
-	columnsRows.Close()
-
-	if len(columns) == 0 {
-		return fmt.Errorf("commodities table has no columns or doesn't exist")
-	}
-
-	// Try to find guid-like and mnemonic-like columns
-	guidCol := ""
-	mnemonicCol := ""
-	for _, col := range columns {
-		colLower := strings.ToLower(col)
-		// Look for id or guid columns
-		if colLower == "id" || colLower == "guid" || strings.Contains(colLower, "guid") {
-			guidCol = col
-		}
-		// Look for mnemonic, code, or symbol columns
-		if colLower == "mnemonic" || colLower == "code" || colLower == "symbol" {
-			mnemonicCol = col
-		}
-	}
-
-	if guidCol == "" || mnemonicCol == "" {
-		return fmt.Errorf("could not find required columns in commodities table. Available columns: %v (looking for id/guid and mnemonic/code/symbol)", columns)
-	}
-
-	// Now query with the correct column names
-	query := fmt.Sprintf("SELECT %s, %s FROM commodities", guidCol, mnemonicCol)
-	rows, err := importDB.Query(query)
-	if err != nil {
-		return fmt.Errorf("failed to query commodities: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var guid, mnemonic string
-
-		if err := rows.Scan(&guid, &mnemonic); err != nil {
-			return fmt.Errorf("failed to scan import commodity: %w", err)
-		}
-
-		if id, ok := existingCommodities[mnemonic]; ok {
-			commodityMap[guid] = id
-		} else {
-			commodityMap[guid] = 1 // Default to first commodity
-		}
-	}
-
-	// Import accounts (with hierarchy support)
-	accountRows, err := importDB.Query(`
-		SELECT guid, name, account_type, commodity_guid, commodity_scu, non_std_scu,
-		       parent_guid, code, description, hidden, placeholder
-		FROM accounts
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query accounts: %w", err)
-	}
-	defer accountRows.Close()
-
-	type gnucashAccount struct {
-		guid          string
-		name          string
-		accountType   string
-		commodityGuid sql.NullString
-		commodityScu  sql.NullInt64
-		nonStdScu     sql.NullInt64
-		parentGuid    sql.NullString
-		code          sql.NullString
-		description   sql.NullString
-		hidden        sql.NullInt64
-		placeholder   sql.NullInt64
-	}
-
-	var accounts []gnucashAccount
-	for accountRows.Next() {
-		var acc gnucashAccount
-		if err := accountRows.Scan(&acc.guid, &acc.name, &acc.accountType,
-			&acc.commodityGuid, &acc.commodityScu, &acc.nonStdScu,
-			&acc.parentGuid, &acc.code, &acc.description,
-			&acc.hidden, &acc.placeholder); err != nil {
-			return fmt.Errorf("failed to scan account: %w", err)
-		}
-		accounts = append(accounts, acc)
-	}
-
-	// Import accounts in multiple passes to handle hierarchy
-	maxPasses := 10
-	for pass := 0; pass < maxPasses && len(accounts) > 0; pass++ {
-		remaining := []gnucashAccount{}
-		for _, acc := range accounts {
-			// Check if parent exists or is null
-			canImport := !acc.parentGuid.Valid || accountMap[acc.parentGuid.String] != 0
-
-			if canImport {
-				commodityID := int64(1)
-				if acc.commodityGuid.Valid {
-					if id, ok := commodityMap[acc.commodityGuid.String]; ok {
-						commodityID = id
-					}
-				}
-
-				var parentID sql.NullInt64
-				if acc.parentGuid.Valid && accountMap[acc.parentGuid.String] != 0 {
-					parentID.Valid = true
-					parentID.Int64 = accountMap[acc.parentGuid.String]
-				}
-
-				result, err := tx.Exec(`
-					INSERT INTO accounts (user_id, name, type, commodity_id, commodity_scu,
-					                     non_std_scu, parent_id, code, description, hidden, placeholder)
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-				`, userID, acc.name, acc.accountType, commodityID,
-					acc.commodityScu, acc.nonStdScu, parentID,
-					acc.code, acc.description, acc.hidden, acc.placeholder)
-
-				if err != nil {
-					return fmt.Errorf("failed to insert account: %w", err)
-				}
-
-				newID, _ := result.LastInsertId()
-				accountMap[acc.guid] = newID
-			} else {
-				remaining = append(remaining, acc)
-			}
-		}
-		accounts = remaining
-	}
-
-	if len(accounts) > 0 {
-		return fmt.Errorf("failed to import %d accounts due to unresolved parent references", len(accounts))
-	}
-
-	// Import transactions
-	txRows, err := importDB.Query(`
-		SELECT guid, currency_guid, num, post_date, enter_date, description
-		FROM transactions
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query transactions: %w", err)
-	}
-	defer txRows.Close()
-
-	transactionMap := make(map[string]int64)
-	for txRows.Next() {
-		var guid, currencyGuid, num, postDate, enterDate, description string
-		if err := txRows.Scan(&guid, &currencyGuid, &num, &postDate, &enterDate, &description); err != nil {
-			return fmt.Errorf("failed to scan transaction: %w", err)
-		}
-
-		// Skip transactions without description
-		if description == "" {
-			continue
-		}
-
-		// Parse dates (GnuCash format: YYYYMMDDHHMMSS or YYYY-MM-DD HH:MM:SS)
-		var postTime, enterTime time.Time
-		if strings.Contains(postDate, "-") {
-			postTime, _ = time.Parse("2006-01-02 15:04:05", postDate)
-			enterTime, _ = time.Parse("2006-01-02 15:04:05", enterDate)
-		} else {
-			postTime, _ = time.Parse("20060102150405", postDate)
-			enterTime, _ = time.Parse("20060102150405", enterDate)
-		}
-
-		result, err := tx.Exec(`
-			INSERT INTO transactions (user_id, description, post_date, enter_date)
-			VALUES (?, ?, ?, ?)
-		`, userID, description, postTime, enterTime)
-
-		if err != nil {
-			return fmt.Errorf("failed to insert transaction: %w", err)
-		}
-
-		newTxID, _ := result.LastInsertId()
-		transactionMap[guid] = newTxID
-	}
-
-	// Import splits
-	splitRows, err := importDB.Query(`
-		SELECT guid, tx_guid, account_guid, memo, action, reconcile_state, reconcile_date,
-		       value_num, value_denom, quantity_num, quantity_denom, lot_guid
-		FROM splits
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query splits: %w", err)
-	}
-	defer splitRows.Close()
-
-	for splitRows.Next() {
-		var guid, txGuid, accountGuid string
-		var memo, action, reconcileState, reconcileDate, lotGuid sql.NullString
-		var valueNum, valueDenom, quantityNum, quantityDenom int64
-
-		if err := splitRows.Scan(&guid, &txGuid, &accountGuid, &memo, &action, &reconcileState, &reconcileDate, &valueNum, &valueDenom, &quantityNum, &quantityDenom, &lotGuid); err != nil {
-			return fmt.Errorf("failed to scan split: %w", err)
-		}
-
-		// Check if transaction and account exist in maps
-		txID, txExists := transactionMap[txGuid]
-		accountID, accExists := accountMap[accountGuid]
-
-		if txExists && accExists {
-			_, err := tx.Exec(`
-				INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-				VALUES (?, ?, ?, ?, ?)
-			`, userID, txID, accountID, valueNum, valueDenom)
-
-			if err != nil {
-				return fmt.Errorf("failed to insert split: %w", err)
-			}
-		}
-	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
+	h.APIImportGnuCashXML(w, r)
 }
 
-// APIImportGnuCashXML handles GnuCash XML file import (compressed gzip)
+// APIImportGnuCashXML handles GnuCash file import: SQLite, compressed gzip XML or plain XML
 func (h *Handler) APIImportGnuCashXML(w http.ResponseWriter, r *http.Request) {
 	userID, authenticated := h.getUserID(r)
 	if !authenticated {
@@ -2205,7 +2071,7 @@ func (h *Handler) APIImportGnuCashXML(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	log.Printf("Importing GnuCash XML file: %s", header.Filename)
+	log.Printf("Importing GnuCash file: %s", header.Filename)
 
 	// Read file content
 	fileData, err := io.ReadAll(file)
@@ -2215,24 +2081,24 @@ func (h *Handler) APIImportGnuCashXML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse GnuCash XML
-	parsedData, err := gnucash.ParseReaderWithFallback(fileData)
+	// Parse GnuCash file
+	parsedData, err := gnucash.Parse(fileData)
 	if err != nil {
-		log.Printf("Error parsing GnuCash XML: %v", err)
+		log.Printf("Error parsing GnuCash file: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": fmt.Sprintf("Failed to parse GnuCash file: %v", err)})
 		return
 	}
 
 	// Import parsed data
-	if err := h.importFromGnuCashXML(userID, parsedData); err != nil {
-		log.Printf("Error importing GnuCash XML data: %v", err)
+	if err := h.importGnuCash(userID, parsedData); err != nil {
+		log.Printf("Error importing GnuCash data: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{"result": "error", "message": err.Error()})
 		return
 	}
 
-	log.Printf("Successfully imported GnuCash XML: %d accounts, %d transactions",
+	log.Printf("Successfully imported GnuCash: %d accounts, %d transactions",
 		len(parsedData.Accounts), len(parsedData.Transactions))
 
 	w.Header().Set("Content-Type", "application/json")
@@ -2243,8 +2109,8 @@ func (h *Handler) APIImportGnuCashXML(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// importFromGnuCashXML imports data from parsed GnuCash XML
-func (h *Handler) importFromGnuCashXML(userID int64, data *gnucash.ParsedData) error {
+// importGnuCash imports parsed GnuCash data (from either SQLite or XML)
+func (h *Handler) importGnuCash(userID int64, data *gnucash.ParsedData) error {
 	// Start transaction
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -2363,9 +2229,9 @@ func (h *Handler) importFromGnuCashXML(userID int64, data *gnucash.ParsedData) e
 		}
 
 		result, err := tx.Exec(`
-			INSERT INTO transactions (user_id, currency_id, num, post_date, enter_date, description, tags)
-			VALUES (?, ?, ?, ?, ?, ?, ?)
-		`, userID, currencyID, t.Num, t.PostDate, t.EnterDate, t.Description, "")
+			INSERT INTO transactions (user_id, currency_id, num, post_date, enter_date, description)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, currencyID, t.Num, t.PostDate, t.EnterDate, t.Description)
 
 		if err != nil {
 			return fmt.Errorf("failed to insert transaction: %w", err)
@@ -2382,23 +2248,30 @@ func (h *Handler) importFromGnuCashXML(userID int64, data *gnucash.ParsedData) e
 				continue
 			}
 
-			// Normalize value_denom to 100 if needed
-			valueNum := s.ValueNum
-			valueDenom := s.ValueDenom
+			// Дроби сохраняем как есть: знаменатель задаёт точность валюты
+			// (1 для JPY, 100000000 для BTC), балансы считаются с его учётом
+			valueNum, valueDenom := s.ValueNum, s.ValueDenom
 			if valueDenom == 0 {
 				valueDenom = 100
 			}
+			quantityNum, quantityDenom := s.QuantityNum, s.QuantityDenom
+			if quantityDenom == 0 {
+				quantityNum, quantityDenom = valueNum, valueDenom
+			}
 
-			// Convert to standard denom (100)
-			if valueDenom != 100 {
-				valueNum = valueNum * 100 / valueDenom
-				valueDenom = 100
+			reconcileState := s.ReconcileState
+			if !models.IsKnownReconcileState(reconcileState) {
+				reconcileState = models.ReconcileNew
 			}
+			reconcileDate := sql.NullTime{Time: s.ReconcileDate, Valid: !s.ReconcileDate.IsZero()}
 
 			_, err := tx.Exec(`
-				INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom)
-				VALUES (?, ?, ?, ?, ?)
-			`, userID, newTxID, accountID, valueNum, valueDenom)
+				INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom,
+				                    quantity_num, quantity_denom,
+				                    memo, action, reconcile_state, reconcile_date)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, newTxID, accountID, valueNum, valueDenom, quantityNum, quantityDenom,
+				s.Memo, s.Action, reconcileState, reconcileDate)
 
 			if err != nil {
 				return fmt.Errorf("failed to insert split: %w", err)
@@ -2406,6 +2279,10 @@ func (h *Handler) importFromGnuCashXML(userID int64, data *gnucash.ParsedData) e
 		}
 	}
 
+	if err := networth.Invalidate(tx, userID, time.Time{}); err != nil {
+		return fmt.Errorf("failed to reset net worth snapshots: %w", err)
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -2424,49 +2301,67 @@ func (h *Handler) APITransactionFormGet(w http.ResponseWriter, r *http.Request)
 	accountID, _ := strconv.ParseInt(accountIDStr, 10, 64)
 
 	var transaction *models.Transaction
-	var debit, credit []map[string]interface{}
+	var splits []map[string]interface{}
 
 	if txIDStr != "" && txIDStr != "0" {
 		txID, _ := strconv.ParseInt(txIDStr, 10, 64)
-		transaction, debit, credit = h.getTransaction(userID, txID)
+		transaction, splits = h.getTransaction(userID, txID)
 	}
 
 	accounts, _ := h.getAccounts(userID)
 
 	data := map[string]interface{}{
 		"Transaction": transaction,
-		"Debit":       debit,
-		"Credit":      credit,
+		"Splits":      splits,
 		"AccountID":   accountID,
 		"Accounts":    accounts,
+		"CurrencyID":  h.formCurrencyID(userID, transaction, accountID),
 		"Today":       time.Now().Format("2006-01-02"),
 	}
 
 	h.renderTemplate(w, "finance_transaction_modal_form.html", data)
 }
 
-// APITransactionTableGet - возвращает HTML-фрагмент тела таблицы транзакций для обновления без перезагрузки
+// APITransactionTableGet - возвращает HTML-фрагмент строк реестра счёта: первую
+// страницу для обновления без перезагрузки или следующую (cursor) для подгрузки.
+// Параметры фильтров те же, что у страницы счёта.
 func (h *Handler) APITransactionTableGet(w http.ResponseWriter, r *http.Request) {
 	userID, _ := h.getUserID(r)
 
-	accountIDStr := r.URL.Query().Get("account_id")
-	sortOrder := r.URL.Query().Get("sort")
-
-	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
+	accountID, err := strconv.ParseInt(r.URL.Query().Get("account_id"), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid account ID", http.StatusBadRequest)
 		return
 	}
-
-	if sortOrder != "asc" && sortOrder != "desc" {
-		sortOrder = "desc"
+	now := time.Now()
+	filter, err := parseTransactionFilter(r.URL.Query(), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
 	}
 
-	transactions := h.getAccountTransactions(userID, accountID, sortOrder)
+	page, err := h.accountRegister(userID, accountID, filter, registerPageSize)
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR loading register of account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	data := map[string]interface{}{
-		"Transactions": transactions,
-		"Account":      map[string]interface{}{"ID": accountID},
+		"Transactions": page.Rows,
+		"PrevDate":     page.PrevDate,
+		"MoreURL":      registerMoreURL(accountID, filter, page),
+		"Account":      account,
+		"TagColors":    h.tagColors(userID),
 	}
 
 	h.renderTemplate(w, "finance_transactions_tbody.html", data)
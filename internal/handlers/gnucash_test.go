@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestImportGnuCashSQLite(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+
+	data, err := os.ReadFile("../gnucash/testdata/book.gnucash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "book.gnucash")
+	fw.Write(data)
+	mw.Close()
+
+	rec := doRequest(t, h, userID, h.APIImportGnuCash, http.MethodPost, "/", &body, mw.FormDataContentType(), nil)
+	var resp struct {
+		Result       string `json:"result"`
+		Accounts     int    `json:"accounts"`
+		Transactions int    `json:"transactions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Result != "ok" {
+		t.Fatalf("import failed: %s", rec.Body.String())
+	}
+	if resp.Accounts != 8 || resp.Transactions != 2 {
+		t.Errorf("imported %d accounts, %d transactions", resp.Accounts, resp.Transactions)
+	}
+
+	balances := bookBalances(t, h, userID)
+	expected := map[string]string{
+		"Root Account:Активы:Наличные":  "99975",
+		"Root Account:Доходы:Зарплата":  "-100000",
+		"Root Account:Расходы:Продукты": "25",
+		"Root Account:Активы:Доллары":   "0",
+		"Root Account:Активы":           "0",
+	}
+	for path, want := range expected {
+		if got := balances[path]; got != want {
+			t.Errorf("balance of %s = %s, expected %s", path, got, want)
+		}
+	}
+
+	var cleared int
+	h.db.QueryRow("SELECT COUNT(*) FROM splits WHERE user_id = ? AND reconcile_state = 'c'", userID).Scan(&cleared)
+	var memo, action string
+	h.db.QueryRow("SELECT memo FROM splits WHERE user_id = ? AND value_num = 10000000", userID).Scan(&memo)
+	h.db.QueryRow("SELECT action FROM splits WHERE user_id = ? AND value_num = -10000000", userID).Scan(&action)
+	if cleared != 1 || memo != "аванс" || action != "Income" {
+		t.Errorf("split details lost: cleared=%d memo=%q action=%q", cleared, memo, action)
+	}
+}
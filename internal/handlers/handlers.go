@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
 	"github.com/gorilla/sessions"
 )
 
@@ -53,10 +54,7 @@ func New(db *sql.DB, store *sessions.CookieStore) *Handler {
 			return result
 		},
 		"formatMoney": func(value float64) string {
-			if math.Abs(value) < 0.005 {
-				return "0.00"
-			}
-			return fmt.Sprintf("%.2f", value)
+			return money.FormatFloat(value, 100)
 		},
 		"derefInt64": func(ptr *int64) int64 {
 			if ptr != nil {
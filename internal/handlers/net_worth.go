@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/networth"
+)
+
+// invalidateNetWorthForTransaction — networth.Invalidate с даты проводки
+// существующей транзакции
+func invalidateNetWorthForTransaction(tx *sql.Tx, userID, txID int64) error {
+	var postDate time.Time
+	err := tx.QueryRow("SELECT post_date FROM transactions WHERE id = ? AND user_id = ?", txID, userID).Scan(&postDate)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return networth.Invalidate(tx, userID, postDate)
+}
+
+// netWorthBalance — остатки активов и обязательств в одной валюте;
+// обязательства положительные, как в балансе
+type netWorthBalance struct {
+	Assets      models.Amount
+	Liabilities models.Amount
+}
+
+// netWorthMonth — остатки по валютам на конец дня Date
+type netWorthMonth struct {
+	Date     time.Time
+	Balances map[int64]*netWorthBalance // валюта счёта → остатки
+}
+
+// netWorthPoint — точка ряда чистого капитала в валюте отчётности
+type netWorthPoint struct {
+	Date        time.Time
+	Assets      models.Amount
+	Liabilities models.Amount
+}
+
+// NetWorth — активы минус обязательства
+func (p netWorthPoint) NetWorth() models.Amount {
+	return p.Assets.Sub(p.Liabilities)
+}
+
+// endOfMonth возвращает последний день месяца даты d
+func endOfMonth(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+}
+
+// netWorthMonths возвращает остатки на конец каждого месяца с первой
+// проводки по балансовым счетам и на сегодня. Прошедшие месяцы берутся
+// из net_worth_snapshots; недостающие считаются по сплитам после последнего
+// снимка и сохраняются.
+func (h *Handler) netWorthMonths(userID int64, today time.Time) ([]*netWorthMonth, error) {
+	rows, err := h.db.Query(`
+		SELECT month, commodity_id, assets_num, assets_denom, liabilities_num, liabilities_denom
+		FROM net_worth_snapshots
+		WHERE user_id = ?
+		ORDER BY month
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var months []*netWorthMonth
+	for rows.Next() {
+		var month time.Time
+		var commodityID, assetsNum, assetsDenom, liabilitiesNum, liabilitiesDenom int64
+		if err := rows.Scan(&month, &commodityID, &assetsNum, &assetsDenom, &liabilitiesNum, &liabilitiesDenom); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(months) == 0 || !months[len(months)-1].Date.Equal(month) {
+			months = append(months, &netWorthMonth{Date: month, Balances: make(map[int64]*netWorthBalance)})
+		}
+		months[len(months)-1].Balances[commodityID] = &netWorthBalance{
+			Assets:      models.NewAmount(assetsNum, assetsDenom),
+			Liabilities: models.NewAmount(liabilitiesNum, liabilitiesDenom),
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Остатки последнего снимка — начальные для пересчёта
+	balances := make(map[int64]*netWorthBalance)
+	var after time.Time
+	if len(months) > 0 {
+		last := months[len(months)-1]
+		after = last.Date.AddDate(0, 0, 1)
+		for id, b := range last.Balances {
+			balances[id] = &netWorthBalance{Assets: b.Assets, Liabilities: b.Liabilities}
+		}
+	}
+
+	assetTypes := balanceSheetSections[0].Types
+	liabilityTypes := balanceSheetSections[1].Types
+	types := append(append([]string{}, assetTypes...), liabilityTypes...)
+	isLiability := make(map[string]bool)
+	for _, t := range liabilityTypes {
+		isLiability[t] = true
+	}
+
+	query := `
+		SELECT t.post_date, a.account_type, a.commodity_id, s.quantity_num, s.quantity_denom
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		JOIN accounts a ON a.id = s.account_id
+		WHERE s.user_id = ? AND t.post_date < ?
+		  AND a.account_type IN (` + strings.TrimSuffix(strings.Repeat("?,", len(types)), ",") + `)`
+	args := []interface{}{userID, today.AddDate(0, 0, 1)}
+	for _, t := range types {
+		args = append(args, t)
+	}
+	if !after.IsZero() {
+		query += " AND t.post_date >= ?"
+		args = append(args, after)
+	}
+	rows, err = h.db.Query(query+" ORDER BY t.post_date", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Снимок месяца фиксируется, когда встречается проводка следующего месяца
+	// или заканчиваются сплиты; текущий месяц не сохраняется — он ещё меняется
+	thisMonth := endOfMonth(today)
+	var fresh []*netWorthMonth
+	next := time.Time{}
+	if len(months) > 0 {
+		next = endOfMonth(after)
+	}
+	closeMonths := func(until time.Time) {
+		for !next.IsZero() && next.Before(until) && next.Before(thisMonth) {
+			month := &netWorthMonth{Date: next, Balances: make(map[int64]*netWorthBalance)}
+			for id, b := range balances {
+				month.Balances[id] = &netWorthBalance{Assets: b.Assets, Liabilities: b.Liabilities}
+			}
+			fresh = append(fresh, month)
+			next = endOfMonth(next.AddDate(0, 0, 1))
+		}
+	}
+	for rows.Next() {
+		var postDate time.Time
+		var accountType string
+		var commodityID, num, denom int64
+		if err := rows.Scan(&postDate, &accountType, &commodityID, &num, &denom); err != nil {
+			return nil, err
+		}
+		if next.IsZero() {
+			next = endOfMonth(postDate)
+		}
+		day := time.Date(postDate.Year(), postDate.Month(), postDate.Day(), 0, 0, 0, 0, time.UTC)
+		closeMonths(day)
+
+		b := balances[commodityID]
+		if b == nil {
+			b = &netWorthBalance{}
+			balances[commodityID] = b
+		}
+		if isLiability[accountType] {
+			b.Liabilities = b.Liabilities.Sub(models.NewAmount(num, denom))
+		} else {
+			b.Assets = b.Assets.Add(models.NewAmount(num, denom))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	closeMonths(thisMonth)
+
+	for _, month := range fresh {
+		for commodityID, b := range month.Balances {
+			assets, liabilities := b.Assets.Rat(), b.Liabilities.Rat()
+			// Снимок хранит точную дробь: урезанная до int64 исказила бы кеш
+			for _, r := range []*big.Rat{assets, liabilities} {
+				if !r.Num().IsInt64() || !r.Denom().IsInt64() {
+					return nil, money.ErrRange
+				}
+			}
+			_, err := h.db.Exec(`
+				INSERT IGNORE INTO net_worth_snapshots (user_id, month, commodity_id,
+				    assets_num, assets_denom, liabilities_num, liabilities_denom)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, userID, month.Date, commodityID, assets.Num().Int64(), assets.Denom().Int64(),
+				liabilities.Num().Int64(), liabilities.Denom().Int64())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	months = append(months, fresh...)
+
+	if len(balances) > 0 {
+		months = append(months, &netWorthMonth{Date: today, Balances: balances})
+	}
+	return months, nil
+}
+
+// netWorthHistory возвращает ряд чистого капитала в валюте отчётности:
+// конец каждого месяца по курсу на эту дату и сегодняшний день. Валюты
+// без курса не учитываются и возвращаются отдельным списком.
+func (h *Handler) netWorthHistory(userID int64, today time.Time) ([]netWorthPoint, []string, error) {
+	months, err := h.netWorthMonths(userID, today)
+	if err != nil {
+		return nil, nil, err
+	}
+	currency, err := h.reportingCurrency(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	mnemonics := make(map[int64]string)
+	rows, err := h.db.Query("SELECT id, mnemonic FROM commodities")
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var id int64
+		var mnemonic string
+		if err := rows.Scan(&id, &mnemonic); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		mnemonics[id] = mnemonic
+	}
+	rows.Close()
+
+	missing := make(map[string]bool)
+	points := make([]netWorthPoint, 0, len(months))
+	for _, month := range months {
+		point := netWorthPoint{Date: month.Date}
+		var converter *currencyConverter
+		for commodityID, b := range month.Balances {
+			if b.Assets.IsZero() && b.Liabilities.IsZero() {
+				continue
+			}
+			assets, liabilities := b.Assets, b.Liabilities
+			if mnemonic := mnemonics[commodityID]; mnemonic != currency.Mnemonic {
+				// Курсы грузим, только если в месяце есть другие валюты
+				if converter == nil {
+					book, err := h.loadRateBook(month.Date)
+					if err != nil {
+						return nil, nil, err
+					}
+					converter = newCurrencyConverter(book, currency.Mnemonic)
+				}
+				var ok bool
+				if assets, ok = converter.Convert(assets, mnemonic); !ok {
+					missing[mnemonic] = true
+					continue
+				}
+				liabilities, _ = converter.Convert(liabilities, mnemonic)
+			}
+			point.Assets = point.Assets.Add(assets)
+			point.Liabilities = point.Liabilities.Add(liabilities)
+		}
+		points = append(points, point)
+	}
+
+	var missingList []string
+	for m := range missing {
+		missingList = append(missingList, m)
+	}
+	sort.Strings(missingList)
+	return points, missingList, nil
+}
+
+// netWorthChartJSON — ряд чистого капитала для графика на дашборде
+func (h *Handler) netWorthChartJSON(userID int64) template.JS {
+	now := time.Now()
+	points, _, err := h.netWorthHistory(userID, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		fmt.Printf("ERROR loading net worth history for user %d: %v\n", userID, err)
+	}
+	series := make([]map[string]interface{}, 0, len(points))
+	for _, p := range points {
+		series = append(series, map[string]interface{}{
+			"date":        p.Date.Format("2006-01-02"),
+			"assets":      p.Assets.Float64(),
+			"liabilities": p.Liabilities.Float64(),
+			"net_worth":   p.NetWorth().Float64(),
+		})
+	}
+	out, err := json.Marshal(series)
+	if err != nil {
+		return template.JS("[]")
+	}
+	return template.JS(out)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/networth"
+)
+
+func TestNetWorthHistory(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	credit := accountIDByName(t, h, userID, "Кредитная карта")
+	food := accountIDByName(t, h, userID, "Продукты")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	insertTx(t, h, userID, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), "Зарплата", "",
+		[3]int64{card, 500000, 100}, [3]int64{salary, -500000, 100})
+	insertTx(t, h, userID, time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 120000, 100}, [3]int64{credit, -120000, 100})
+	insertTx(t, h, userID, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 50000, 100}, [3]int64{card, -50000, 100})
+
+	today := time.Date(2026, 4, 10, 0, 0, 0, 0, time.UTC)
+	series := func() string {
+		t.Helper()
+		points, missing, err := h.netWorthHistory(userID, today)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(missing) > 0 {
+			t.Errorf("unexpected missing rates: %v", missing)
+		}
+		var out []string
+		for _, p := range points {
+			out = append(out, fmt.Sprintf("%s=%s-%s=%s", p.Date.Format("2006-01-02"),
+				p.Assets.FloatString(2), p.Liabilities.FloatString(2), p.NetWorth().FloatString(2)))
+		}
+		return fmt.Sprint(out)
+	}
+
+	// Обязательства уменьшают капитал; последняя точка — сегодня
+	want := "[2026-01-31=5000.00-0.00=5000.00 2026-02-28=5000.00-1200.00=3800.00 " +
+		"2026-03-31=4500.00-1200.00=3300.00 2026-04-10=4500.00-1200.00=3300.00]"
+	if got := series(); got != want {
+		t.Fatalf("series: %s, expected %s", got, want)
+	}
+	// Закрытые месяцы сохранены, текущий — нет
+	if n := countRows(t, h, "net_worth_snapshots", userID); n != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", n)
+	}
+	// Повторный расчёт идёт по снимкам и даёт тот же ряд
+	if got := series(); got != want {
+		t.Errorf("series from snapshots: %s, expected %s", got, want)
+	}
+
+	// Транзакция задним числом сбрасывает снимки с февраля
+	form := splitForm("Премия",
+		[3]string{fmt.Sprint(card), "1000", ""},
+		[3]string{fmt.Sprint(salary), "-1000", ""})
+	form.Set("post_date", "2026-02-15")
+	if code, resp := saveTransaction(t, h, userID, form); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+	if n := countRows(t, h, "net_worth_snapshots", userID); n != 1 {
+		t.Errorf("expected only the January snapshot to survive, got %d", n)
+	}
+	want = "[2026-01-31=5000.00-0.00=5000.00 2026-02-28=6000.00-1200.00=4800.00 " +
+		"2026-03-31=5500.00-1200.00=4300.00 2026-04-10=5500.00-1200.00=4300.00]"
+	if got := series(); got != want {
+		t.Errorf("series after back-dated transaction: %s, expected %s", got, want)
+	}
+
+	// Кредитная карта типа CREDIT — обязательство и в итогах дашборда, и на графике
+	if _, err := h.db.Exec("UPDATE accounts SET account_type = 'CREDIT' WHERE id = ?", credit); err != nil {
+		t.Fatal(err)
+	}
+	if err := networth.Invalidate(h.db, userID, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	points, _, err := h.netWorthHistory(userID, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, _ := h.loadRateBook(today)
+	totals, err := h.dashboardBalances(userID, newCurrencyConverter(book, "RUB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := points[len(points)-1]
+	if totals.Liabilities.String() != "1200" || totals.Assets.Sub(totals.Liabilities).Cmp(last.NetWorth()) != 0 {
+		t.Errorf("dashboard %s-%s vs chart %s", totals.Assets, totals.Liabilities, last.NetWorth())
+	}
+
+	// Пустая книга — пустой ряд
+	other := createTestUser(t, h)
+	if points, _, err := h.netWorthHistory(other, today); err != nil || len(points) != 0 {
+		t.Errorf("empty book: %v %v", points, err)
+	}
+
+	// Дробь, которая не помещается в int64, не сохраняется урезанной
+	odd := createTestUser(t, h)
+	if err := h.createBaseAccounts(odd); err != nil {
+		t.Fatal(err)
+	}
+	oddCard := accountIDByName(t, h, odd, "Расчетный счет")
+	oddSalary := accountIDByName(t, h, odd, "Зарплата")
+	for _, denom := range []int64{1000003, 1000033, 1000037, 1000039} {
+		insertTx(t, h, odd, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), "Дробь", "",
+			[3]int64{oddCard, 1, denom}, [3]int64{oddSalary, -1, denom})
+	}
+	if _, _, err := h.netWorthHistory(odd, today); !errors.Is(err, money.ErrRange) {
+		t.Errorf("overflowing snapshot: expected ErrRange, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/ofx"
+)
+
+// ofxAccountTypes — счета, на которые проводится выписка OFX: банковские и
+// кредитные карты (в базовом плане счетов карта — обязательство)
+var ofxAccountTypes = map[string]bool{
+	models.AccountTypeBank:      true,
+	models.AccountTypeCredit:    true,
+	models.AccountTypeLiability: true,
+}
+
+// FinanceImportOFX - импорт банковской выписки OFX/QFX: предпросмотр и проводка
+func (h *Handler) FinanceImportOFX(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	accounts, _ := h.getAccounts(userID)
+	var statementAccounts []*models.Account
+	for _, a := range accounts {
+		if ofxAccountTypes[a.AccountType] && a.Placeholder == 0 {
+			statementAccounts = append(statementAccounts, a)
+		}
+	}
+
+	data := h.pageData(userID, "settings")
+	data["Title"] = "Импорт выписки OFX"
+	data["Accounts"] = accounts
+	data["StatementAccounts"] = statementAccounts
+	h.renderTemplate(w, "finance_import_ofx.html", data)
+}
+
+// ofxStatement разбирает загруженную выписку OFX (multipart: file, account_id,
+// counterpart_id) и сопоставляет операции со счетами. Номер операции — её
+// порядковый номер в файле, с 1.
+func (h *Handler) ofxStatement(w http.ResponseWriter, r *http.Request, userID int64) (*statementImport, *ofx.Statement, []statementLine, bool) {
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	if err := r.ParseMultipartForm(maxStatementSize); err != nil {
+		fail("Не удалось прочитать форму")
+		return nil, nil, nil, false
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		fail("Выберите файл выписки")
+		return nil, nil, nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxStatementSize+1))
+	if err != nil || len(data) > maxStatementSize {
+		fail("Файл выписки больше 10 МБ")
+		return nil, nil, nil, false
+	}
+
+	accountID, err1 := formID(r, "account_id")
+	counterpartID, err2 := formID(r, "counterpart_id")
+	if err1 != nil || err2 != nil {
+		fail("Некорректный счёт")
+		return nil, nil, nil, false
+	}
+	if err := h.authorize(userID, ownedRefs{Accounts: []int64{accountID, counterpartID}}); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return nil, nil, nil, false
+	}
+	imp, err := h.newStatementImport(userID, accountID, counterpartID)
+	if errors.Is(err, errNotOwned) {
+		writeAuthzError(w, err, "Счёт не найден")
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		fail(err.Error())
+		return nil, nil, nil, false
+	}
+	if !ofxAccountTypes[imp.Account.AccountType] {
+		fail("Выписку OFX можно провести только на банковский счёт или кредитную карту")
+		return nil, nil, nil, false
+	}
+
+	st, err := ofx.Parse(data)
+	if err != nil {
+		fail(err.Error())
+		return nil, nil, nil, false
+	}
+	if len(st.Transactions) == 0 {
+		fail("В выписке нет операций")
+		return nil, nil, nil, false
+	}
+	if st.Currency != "" {
+		mnemonics, err := h.commodityMnemonics()
+		if err != nil {
+			fail(err.Error())
+			return nil, nil, nil, false
+		}
+		if currency := mnemonics[imp.Account.CommodityID]; currency != st.Currency {
+			fail(fmt.Sprintf("Выписка в %s, а счёт «%s» — в %s", st.Currency, imp.Account.Name, currency))
+			return nil, nil, nil, false
+		}
+	}
+
+	lines := make([]statementLine, 0, len(st.Transactions))
+	for i, t := range st.Transactions {
+		description, memo := t.Name, t.Memo
+		if description == "" {
+			description, memo = t.Memo, ""
+		}
+		line, err := imp.line(i+1, t.Date, t.Num, t.Denom, description, "")
+		if err != nil {
+			fail(err.Error())
+			return nil, nil, nil, false
+		}
+		line.Memo = memo
+		line.FITID = t.FITID
+		lines = append(lines, line)
+	}
+	if err := h.markImported(userID, imp, lines); err != nil {
+		fmt.Printf("ERROR looking up imported FITIDs: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, nil, nil, false
+	}
+	return imp, st, lines, true
+}
+
+// APIOFXImportPreview - предпросмотр импорта OFX: операции с отметками
+// imported (FITID уже проведён на счёт — операция не будет импортирована)
+// и duplicate (то же или на счёте уже есть проводка той же даты и суммы)
+func (h *Handler) APIOFXImportPreview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	imp, st, lines, ok := h.ofxStatement(w, r, userID)
+	if !ok {
+		return
+	}
+	duplicates, err := h.statementDuplicates(userID, imp, lines)
+	if err != nil {
+		fmt.Printf("ERROR looking for duplicates of statement lines: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"account":      imp.Account.Name,
+		"bank_account": st.AccountID,
+		"currency":     st.Currency,
+		"rows":         imp.linesJSON(lines, duplicates),
+	})
+}
+
+// APIOFXImport - проводит операции выписки OFX; параметры как у предпросмотра,
+// skip — номера операций, которые не импортировать. Операции с уже
+// известным FITID пропускаются всегда, поэтому пересекающиеся выписки
+// можно загружать повторно.
+func (h *Handler) APIOFXImport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	imp, _, lines, ok := h.ofxStatement(w, r, userID)
+	if !ok {
+		return
+	}
+	selected, err := selectStatementLines(r, lines)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ids, err := h.postStatement(userID, imp, selected)
+	if err != nil {
+		fmt.Printf("ERROR importing OFX statement for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":   "ok",
+		"imported": len(ids),
+		"skipped":  len(lines) - len(ids),
+	})
+}
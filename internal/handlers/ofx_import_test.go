@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// ofxStatementFile собирает выписку OFX 1.x из операций «FITID;дата;сумма;имя»
+func ofxStatementFile(currency string, transactions ...string) string {
+	var b strings.Builder
+	b.WriteString("OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\nCHARSET:1252\n\n<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>")
+	b.WriteString("<CURDEF>" + currency + "<BANKACCTFROM><ACCTID>40817810</BANKACCTFROM><BANKTRANLIST>\n")
+	for _, t := range transactions {
+		f := strings.Split(t, ";")
+		fmt.Fprintf(&b, "<STMTTRN><TRNTYPE>OTHER<DTPOSTED>%s<TRNAMT>%s<FITID>%s<NAME>%s<MEMO>memo %s</STMTTRN>\n",
+			f[1], f[2], f[0], f[3], f[0])
+	}
+	b.WriteString("</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n")
+	return b.String()
+}
+
+func TestOFXImport(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	credit := accountIDByName(t, h, userID, "Кредитная карта")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	form := url.Values{"account_id": {fmt.Sprint(card)}, "counterpart_id": {fmt.Sprint(food)}}
+	march := ofxStatementFile("RUB", "F1;20260301;-100.50;Shop", "F2;20260302;-20;Cafe")
+
+	code, resp := uploadStatement(t, h, userID, h.APIOFXImportPreview, march, form)
+	if code != 200 || resp["bank_account"] != "40817810" || len(resp["rows"].([]interface{})) != 2 {
+		t.Fatalf("preview: %d %v", code, resp)
+	}
+	code, resp = uploadStatement(t, h, userID, h.APIOFXImport, march, form)
+	if code != 200 || resp["imported"] != 2.0 {
+		t.Fatalf("import: %d %v", code, resp)
+	}
+	var memo string
+	h.db.QueryRow("SELECT memo FROM splits WHERE account_id = ? AND quantity_num = -2000", card).Scan(&memo)
+	if memo != "memo F2" {
+		t.Errorf("memo of the statement split: %q", memo)
+	}
+
+	// Пересекающаяся выписка: F2 уже проведена, F3 такой же суммы и даты — только
+	// возможный повтор, F4 новая
+	overlap := ofxStatementFile("RUB", "F2;20260302;-20;Cafe", "F3;20260302;-20;Cafe", "F4;20260305;1000;Refund")
+	_, resp = uploadStatement(t, h, userID, h.APIOFXImportPreview, overlap, form)
+	var flags []string
+	for _, r := range resp["rows"].([]interface{}) {
+		row := r.(map[string]interface{})
+		flags = append(flags, fmt.Sprintf("%v:%v/%v", row["fitid"], row["imported"], row["duplicate"]))
+	}
+	if got := strings.Join(flags, " "); got != "F2:true/true F3:false/false F4:false/false" {
+		t.Errorf("overlap flags: %s", got)
+	}
+
+	// Даже без skip известный FITID не проводится повторно
+	for i := 0; i < 2; i++ {
+		code, resp = uploadStatement(t, h, userID, h.APIOFXImport, overlap, form)
+		want := []float64{2, 0}[i]
+		if code != 200 || resp["imported"] != want || resp["skipped"] != 3-want {
+			t.Fatalf("re-import %d: %d %v", i, code, resp)
+		}
+	}
+	if n := countRows(t, h, "transactions", userID); n != 4 {
+		t.Errorf("%d transactions after overlapping imports, expected 4", n)
+	}
+
+	// FITID переживает правку транзакции: её сплиты пересоздаются
+	var txID int64
+	h.db.QueryRow("SELECT tx_id FROM statement_fitids WHERE account_id = ? AND fitid = 'F1'", card).Scan(&txID)
+	edit := splitForm("Shop", [3]string{fmt.Sprint(card), "-100.50", ""}, [3]string{fmt.Sprint(food), "100.50", ""})
+	edit.Set("id", fmt.Sprint(txID))
+	status, saved := saveTransaction(t, h, userID, edit)
+	if status != 200 || saved["result"] != "ok" {
+		t.Fatalf("edit: %d %v", status, saved)
+	}
+	if _, resp = uploadStatement(t, h, userID, h.APIOFXImport, march, form); resp["imported"] != 0.0 {
+		t.Errorf("edited transaction imported again: %v", resp)
+	}
+
+	for name, bad := range map[string]struct {
+		data    string
+		account int64
+	}{
+		"currency":     {ofxStatementFile("USD", "U1;20260301;-1;X"), card},
+		"expense":      {march, food},
+		"not ofx":      {"Дата;Сумма\n", card},
+		"no operation": {ofxStatementFile("RUB"), card},
+	} {
+		f := url.Values{"account_id": {fmt.Sprint(bad.account)}, "counterpart_id": {fmt.Sprint(credit)}}
+		if code, resp := uploadStatement(t, h, userID, h.APIOFXImportPreview, bad.data, f); code != 400 {
+			t.Errorf("%s: expected 400, got %d %v", name, code, resp)
+		}
+	}
+
+	// Кредитная карта — тоже счёт выписки
+	form.Set("account_id", fmt.Sprint(credit))
+	if code, resp = uploadStatement(t, h, userID, h.APIOFXImportPreview, march, form); code != 200 {
+		t.Errorf("credit card: %d %v", code, resp)
+	}
+
+	foreign := createTestUser(t, h)
+	if code, _ = uploadStatement(t, h, foreign, h.APIOFXImport, march, form); code != 404 {
+		t.Errorf("foreign accounts: expected 404, got %d", code)
+	}
+}
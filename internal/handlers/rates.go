@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+// crossCurrencies — валюты, через которые строится кросс-курс, если прямой
+// пары нет. USD котируется почти всеми источниками, к RUB ЦБ котирует все валюты.
+var crossCurrencies = []string{"USD", "RUB"}
+
+// exchangeRate — котировка пары из currency_rates: для "USD/RUB" 1 USD стоит Rate RUB
+type exchangeRate struct {
+	Code   string
+	Source string
+	Date   time.Time
+	Rate   *big.Rat
+}
+
+// rateBook — последние на дату котировки всех пар
+type rateBook struct {
+	AsOf  time.Time
+	pairs map[string]exchangeRate
+}
+
+// loadRateBook загружает для каждой пары последний курс не позже asOf.
+// Если на одну дату есть курсы нескольких источников, предпочитаем ЦБ.
+func (h *Handler) loadRateBook(asOf time.Time) (*rateBook, error) {
+	rows, err := h.db.Query(`
+		SELECT cr.code, cr.source, cr.rate_date, cr.rate
+		FROM currency_rates cr
+		INNER JOIN (
+			SELECT code, MAX(rate_date) AS max_date
+			FROM currency_rates
+			WHERE rate_date <= ?
+			GROUP BY code
+		) latest ON cr.code = latest.code AND cr.rate_date = latest.max_date
+		ORDER BY cr.code, cr.source = 'cbr' DESC, cr.source
+	`, asOf.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	book := &rateBook{AsOf: asOf, pairs: make(map[string]exchangeRate)}
+	for rows.Next() {
+		var rate exchangeRate
+		var value string
+		if err := rows.Scan(&rate.Code, &rate.Source, &rate.Date, &value); err != nil {
+			return nil, err
+		}
+		if _, seen := book.pairs[rate.Code]; seen {
+			continue
+		}
+		r, ok := new(big.Rat).SetString(value)
+		if !ok || r.Sign() <= 0 {
+			continue
+		}
+		rate.Rate = r
+		book.pairs[rate.Code] = rate
+	}
+	return book, rows.Err()
+}
+
+// rateTimeline — котировки за период для пересчёта по датам по возрастанию:
+// книга на начало периода и следующие за ним котировки в порядке дат
+type rateTimeline struct {
+	book   *rateBook
+	quotes []exchangeRate
+	next   int
+}
+
+// loadRateTimeline загружает курсы для дат от from до to двумя запросами:
+// книгу на from и котировки после неё. Берутся только пары между currencies
+// и crossCurrencies — других пересчёт между currencies не использует.
+func (h *Handler) loadRateTimeline(from, to time.Time, currencies []string) (*rateTimeline, error) {
+	book, err := h.loadRateBook(from)
+	if err != nil {
+		return nil, err
+	}
+	timeline := &rateTimeline{book: book}
+
+	set := make(map[string]bool)
+	for _, c := range append(append([]string{}, currencies...), crossCurrencies...) {
+		set[c] = true
+	}
+	args := []interface{}{from.Format("2006-01-02"), to.Format("2006-01-02")}
+	for a := range set {
+		for b := range set {
+			if a != b {
+				args = append(args, a+"/"+b)
+			}
+		}
+	}
+	rows, err := h.db.Query(`
+		SELECT code, source, rate_date, rate
+		FROM currency_rates
+		WHERE rate_date > ? AND rate_date <= ? AND code IN (`+
+		strings.TrimSuffix(strings.Repeat("?,", len(args)-2), ",")+`)
+		ORDER BY rate_date, code, source = 'cbr' DESC, source
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rate exchangeRate
+		var value string
+		if err := rows.Scan(&rate.Code, &rate.Source, &rate.Date, &value); err != nil {
+			return nil, err
+		}
+		r, ok := new(big.Rat).SetString(value)
+		if !ok || r.Sign() <= 0 {
+			continue
+		}
+		rate.Rate = r
+		timeline.quotes = append(timeline.quotes, rate)
+	}
+	return timeline, rows.Err()
+}
+
+// At возвращает книгу котировок на date. Даты запросов должны идти по
+// возрастанию: книга одна и дополняется котировками до date.
+func (t *rateTimeline) At(date time.Time) *rateBook {
+	for ; t.next < len(t.quotes) && !t.quotes[t.next].Date.After(date); t.next++ {
+		quote := t.quotes[t.next]
+		// На одну дату первым идёт курс ЦБ, как в loadRateBook
+		if current, ok := t.book.pairs[quote.Code]; ok && !quote.Date.After(current.Date) {
+			continue
+		}
+		t.book.pairs[quote.Code] = quote
+	}
+	t.book.AsOf = date
+	return t.book
+}
+
+// direct ищет курс from→to по прямой или обратной паре
+func (b *rateBook) direct(from, to string) (*big.Rat, *exchangeRate, bool) {
+	if rate, ok := b.pairs[from+"/"+to]; ok {
+		return rate.Rate, &rate, true
+	}
+	if rate, ok := b.pairs[to+"/"+from]; ok {
+		return new(big.Rat).Inv(rate.Rate), &rate, true
+	}
+	return nil, nil, false
+}
+
+// Rate возвращает курс from→to и котировки, из которых он получен.
+// Без прямой пары курс считается как кросс через одну из crossCurrencies.
+func (b *rateBook) Rate(from, to string) (*big.Rat, []exchangeRate, bool) {
+	if from == to {
+		return big.NewRat(1, 1), nil, true
+	}
+	if r, rate, ok := b.direct(from, to); ok {
+		return r, []exchangeRate{*rate}, true
+	}
+	for _, pivot := range crossCurrencies {
+		if pivot == from || pivot == to {
+			continue
+		}
+		r1, rate1, ok1 := b.direct(from, pivot)
+		r2, rate2, ok2 := b.direct(pivot, to)
+		if ok1 && ok2 {
+			return new(big.Rat).Mul(r1, r2), []exchangeRate{*rate1, *rate2}, true
+		}
+	}
+	return nil, nil, false
+}
+
+// currencyConverter пересчитывает суммы в валюту отчётности и запоминает,
+// какие курсы для этого понадобились и для каких валют курса не нашлось
+type currencyConverter struct {
+	book    *rateBook
+	target  string
+	used    map[string]exchangeRate
+	missing map[string]bool
+}
+
+func newCurrencyConverter(book *rateBook, target string) *currencyConverter {
+	return &currencyConverter{
+		book:    book,
+		target:  target,
+		used:    make(map[string]exchangeRate),
+		missing: make(map[string]bool),
+	}
+}
+
+// Convert пересчитывает amount из валюты mnemonic в валюту отчётности
+func (c *currencyConverter) Convert(amount models.Amount, mnemonic string) (models.Amount, bool) {
+	r, rates, ok := c.book.Rate(mnemonic, c.target)
+	if !ok {
+		c.missing[mnemonic] = true
+		return models.Amount{}, false
+	}
+	for _, rate := range rates {
+		c.used[rate.Code] = rate
+	}
+	return amount.Mul(r), true
+}
+
+// UsedRates возвращает использованные котировки для показа пользователю
+func (c *currencyConverter) UsedRates() []map[string]interface{} {
+	codes := make([]string, 0, len(c.used))
+	for code := range c.used {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	result := make([]map[string]interface{}, 0, len(codes))
+	for _, code := range codes {
+		rate := c.used[code]
+		value, _ := rate.Rate.Float64()
+		result = append(result, map[string]interface{}{
+			"Code":   rate.Code,
+			"Rate":   value,
+			"Source": rate.Source,
+			"Date":   rate.Date.Format("02.01.2006"),
+		})
+	}
+	return result
+}
+
+// MissingCurrencies возвращает валюты, суммы в которых не удалось пересчитать
+func (c *currencyConverter) MissingCurrencies() []string {
+	result := make([]string, 0, len(c.missing))
+	for mnemonic := range c.missing {
+		result = append(result, mnemonic)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// reportingCurrency возвращает валюту отчётности пользователя (по умолчанию RUB)
+func (h *Handler) reportingCurrency(userID int64) (*models.Commodity, error) {
+	var c models.Commodity
+	var sign sql.NullString
+	err := h.db.QueryRow(`
+		SELECT c.id, c.mnemonic, c.fullname, c.fraction, c.sign
+		FROM users u
+		JOIN commodities c ON c.id = u.reporting_currency_id
+		WHERE u.id = ?
+	`, userID).Scan(&c.ID, &c.Mnemonic, &c.Fullname, &c.Fraction, &sign)
+	if err == sql.ErrNoRows {
+		err = h.db.QueryRow(`
+			SELECT id, mnemonic, fullname, fraction, sign FROM commodities WHERE id = 1
+		`).Scan(&c.ID, &c.Mnemonic, &c.Fullname, &c.Fraction, &sign)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Sign = sign.String
+	return &c, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateBookCrossRates(t *testing.T) {
+	book := &rateBook{pairs: map[string]exchangeRate{
+		"USD/RUB": {Code: "USD/RUB", Rate: big.NewRat(90, 1)},
+		"EUR/RUB": {Code: "EUR/RUB", Rate: big.NewRat(99, 1)},
+		"USD/ARS": {Code: "USD/ARS", Rate: big.NewRat(1000, 1)},
+	}}
+
+	tests := []struct {
+		from, to string
+		want     string
+		used     int
+	}{
+		{"RUB", "RUB", "1", 0},
+		{"USD", "RUB", "90", 1},
+		{"RUB", "USD", "1/90", 1},
+		{"ARS", "RUB", "9/100", 2}, // через USD
+		{"EUR", "USD", "11/10", 2}, // через RUB
+		{"EUR", "ARS", "", 0},      // двух пересчётов мало
+	}
+	for _, tt := range tests {
+		r, used, ok := book.Rate(tt.from, tt.to)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s→%s: expected no rate, got %s", tt.from, tt.to, r.RatString())
+			}
+			continue
+		}
+		if !ok || r.RatString() != tt.want || len(used) != tt.used {
+			t.Errorf("%s→%s = %v (%d rates), want %s (%d rates)", tt.from, tt.to, r, len(used), tt.want, tt.used)
+		}
+	}
+}
+
+func TestDashboardReportingCurrency(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	dollars := accountIDByName(t, h, userID, "Сберегательный счет")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	var usd int64
+	h.db.QueryRow("SELECT id FROM commodities WHERE mnemonic = 'USD'").Scan(&usd)
+	h.db.Exec("UPDATE accounts SET commodity_id = ? WHERE id = ?", usd, dollars)
+
+	// Курсы в далёком прошлом, чтобы не пересекаться с настоящими
+	for _, r := range []struct{ source, date, rate string }{
+		{"cbr", "2001-01-10", "90"},
+		{"other", "2001-01-10", "91"},
+		{"cbr", "2001-01-20", "100"},
+	} {
+		if _, err := h.db.Exec(`
+			INSERT INTO currency_rates (code, name, rate, source, rate_date) VALUES ('USD/RUB', 'Доллар', ?, ?, ?)
+		`, r.rate, r.source, r.date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { h.db.Exec("DELETE FROM currency_rates WHERE rate_date < '2002-01-01'") })
+
+	book, err := h.loadRateBook(time.Date(2001, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, ok := book.Rate("USD", "RUB"); !ok || r.RatString() != "90" {
+		t.Errorf("as-of rate = %v, want cbr 90", r)
+	}
+
+	// Курсы за период загружаются один раз и отдаются по датам так же, как loadRateBook
+	timeline, err := h.loadRateTimeline(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2001, 1, 31, 0, 0, 0, 0, time.UTC), []string{"USD", "RUB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		day  int
+		want string
+	}{{5, ""}, {10, "90"}, {19, "90"}, {25, "100"}} {
+		got := ""
+		if r, _, ok := timeline.At(time.Date(2001, 1, tt.day, 0, 0, 0, 0, time.UTC)).Rate("USD", "RUB"); ok {
+			got = r.RatString()
+		}
+		if got != tt.want {
+			t.Errorf("timeline rate on day %d = %q, want %q", tt.day, got, tt.want)
+		}
+	}
+
+	day := time.Date(2001, 1, 20, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Зарплата", "", [3]int64{card, 900000, 100}, [3]int64{salary, -900000, 100})
+	h.db.Exec(`
+		INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom, quantity_num, quantity_denom)
+		SELECT user_id, tx_id, ?, 0, 100, 10000, 100 FROM splits WHERE account_id = ? LIMIT 1
+	`, dollars, card)
+
+	// Валюта отчётности — доллары: 9 000 ₽ по 100 и 100 $ дают 190 $
+	if code := postForm(t, h, userID, h.APISettingsReportingCurrency, url.Values{
+		"currency_id": {fmt.Sprint(usd)},
+	}.Encode()).Code; code != 200 {
+		t.Fatalf("save reporting currency: %d", code)
+	}
+	currency, err := h.reportingCurrency(userID)
+	if err != nil || currency.Mnemonic != "USD" {
+		t.Fatalf("reporting currency = %v, %v", currency, err)
+	}
+
+	book, _ = h.loadRateBook(day)
+	converter := newCurrencyConverter(book, currency.Mnemonic)
+	totals, err := h.dashboardBalances(userID, converter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Assets.String() != "190" || totals.Income.String() != "90" {
+		t.Errorf("assets = %s, income = %s", totals.Assets, totals.Income)
+	}
+	// Крупнейший — долларовый счёт; рублёвый показывает и баланс в рублях
+	if top := totals.TopAccounts; len(top) != 2 || top[0].Mnemonic != "" ||
+		top[1].Balance.String() != "90" || top[1].NativeText()+" "+top[1].Mnemonic != "9000.00 RUB" {
+		t.Errorf("top accounts = %+v", top)
+	}
+	if used := converter.UsedRates(); len(used) != 1 || used[0]["Date"] != "20.01.2001" {
+		t.Errorf("used rates = %v", used)
+	}
+
+	if code := postForm(t, h, userID, h.APISettingsReportingCurrency, "currency_id=999999").Code; code != 400 {
+		t.Errorf("unknown currency: expected 400, got %d", code)
+	}
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/gorilla/mux"
+)
+
+// reconcileRank упорядочивает состояния сверки: чем больше, тем «сверённее».
+// В реестре счёта строка транзакции получает отметку наименее сверенного сплита.
+func reconcileRank(state string) int {
+	switch state {
+	case models.ReconcileCleared:
+		return 1
+	case models.ReconcileReconciled, models.ReconcileFrozen:
+		return 2
+	}
+	return 0
+}
+
+// reconcileCandidate — несверенный сплит счёта в окне сверки
+type reconcileCandidate struct {
+	ID          int64
+	PostDate    time.Time
+	Description string
+	Memo        string
+	State       string
+	Value       models.Amount
+}
+
+// reconcileSnapshot — сверенный остаток счёта и сплиты, ожидающие сверки.
+// Суммы уже приведены к знаку отображения счёта (см. Account.IsNegativeBalance).
+type reconcileSnapshot struct {
+	Reconciled models.Amount
+	Candidates []reconcileCandidate
+}
+
+// loadReconcileState читает сплиты счёта для сверки по выписке на statementDate.
+// Кандидаты — несверенные сплиты с датой не позже даты выписки.
+func (h *Handler) loadReconcileState(userID int64, account *models.Account, statementDate time.Time) (*reconcileSnapshot, error) {
+	rows, err := h.db.Query(`
+		SELECT s.id, s.quantity_num, s.quantity_denom, s.memo, s.reconcile_state,
+		       t.post_date, t.description
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.account_id = ? AND s.user_id = ?
+		ORDER BY t.post_date ASC, t.id ASC, s.id ASC
+	`, account.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nextDay := statementDate.AddDate(0, 0, 1)
+
+	state := &reconcileSnapshot{}
+	for rows.Next() {
+		var c reconcileCandidate
+		var quantityNum, quantityDenom int64
+		if err := rows.Scan(&c.ID, &quantityNum, &quantityDenom, &c.Memo, &c.State,
+			&c.PostDate, &c.Description); err != nil {
+			return nil, err
+		}
+		// Сверка идёт в валюте счёта, поэтому берём quantity, а не value
+		c.Value = displayBalance(account, models.NewAmount(quantityNum, quantityDenom))
+
+		switch {
+		case reconcileRank(c.State) == 2:
+			state.Reconciled = state.Reconciled.Add(c.Value)
+		case c.State == models.ReconcileVoided:
+			// Аннулированные сплиты в сверке не участвуют
+		case c.PostDate.Before(nextDay):
+			state.Candidates = append(state.Candidates, c)
+		}
+	}
+	return state, rows.Err()
+}
+
+// parseStatementBalance разбирает остаток по выписке: допускает пробелы
+// между разрядами и запятую в качестве десятичного разделителя
+func parseStatementBalance(s string) (models.Amount, bool) {
+	num, denom, err := money.Parse(s)
+	if err != nil {
+		return models.Amount{}, false
+	}
+	return models.NewAmount(num, denom), true
+}
+
+// FinanceAccountReconcile - страница сверки счёта с банковской выпиской
+func (h *Handler) FinanceAccountReconcile(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	accountID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	statementDate, err := time.Parse("2006-01-02", r.URL.Query().Get("statement_date"))
+	if err != nil {
+		now := time.Now()
+		statementDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	state, err := h.loadReconcileState(userID, account, statementDate)
+	if err != nil {
+		fmt.Printf("ERROR loading reconcile state for account %d: %v\n", accountID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Суммы показываем с точностью валюты счёта
+	fraction, err := h.commodityFraction(account.CommodityID)
+	if err != nil {
+		fraction = 100
+	}
+	places := money.Places(fraction)
+
+	splits := make([]map[string]interface{}, 0, len(state.Candidates))
+	for _, c := range state.Candidates {
+		splits = append(splits, map[string]interface{}{
+			"id":          c.ID,
+			"post_date":   c.PostDate.Format("02.01.2006"),
+			"description": c.Description,
+			"memo":        c.Memo,
+			"value":       c.Value.Float64(),
+			"value_exact": money.FormatRat(c.Value.Rat(), places),
+			"cleared":     c.State == models.ReconcileCleared,
+		})
+	}
+
+	data := h.pageData(userID, "transactions")
+	data["Title"] = "Сверка: " + account.Name
+	data["Account"] = account
+	data["ActiveAccountID"] = accountID
+	data["StatementDate"] = statementDate.Format("2006-01-02")
+	data["EndingBalance"] = r.URL.Query().Get("ending_balance")
+	data["ReconciledBalance"] = state.Reconciled.Float64()
+	data["ReconciledBalanceExact"] = money.FormatRat(state.Reconciled.Rat(), places)
+	data["Fraction"] = fraction
+	data["Places"] = places
+	data["Splits"] = splits
+
+	h.renderTemplate(w, "finance_account_reconcile.html", data)
+}
+
+// APIAccountReconcile - сохраняет результат сверки счёта.
+// Отмеченные сплиты (split_id) при finish=1 становятся сверенными с датой
+// выписки — только если остаток по выписке сошёлся; без finish сверка
+// откладывается: отмеченные сплиты помечаются подтверждёнными банком.
+// Снятые отметки в обоих случаях возвращают сплит в состояние «новый».
+func (h *Handler) APIAccountReconcile(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	accountID, err := strconv.ParseInt(r.FormValue("account_id"), 10, 64)
+	if err != nil {
+		fail("Некорректный счёт")
+		return
+	}
+	// Чужие сплиты — 404, как и чужой счёт; свои, но не из этой сверки — 400 ниже
+	refs := ownedRefs{Accounts: []int64{accountID}}
+	for _, idStr := range r.Form["split_id"] {
+		if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+			refs.Splits = append(refs.Splits, id)
+		}
+	}
+	if err := h.authorize(userID, refs); err != nil {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	account, err := h.getAccount(userID, accountID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Счёт не найден"})
+		return
+	}
+
+	statementDate, err := time.Parse("2006-01-02", r.FormValue("statement_date"))
+	if err != nil {
+		fail("Некорректная дата выписки")
+		return
+	}
+	finish := r.FormValue("finish") == "1"
+
+	state, err := h.loadReconcileState(userID, account, statementDate)
+	if err != nil {
+		fmt.Printf("ERROR loading reconcile state for account %d: %v\n", accountID, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	candidates := make(map[int64]reconcileCandidate, len(state.Candidates))
+	for _, c := range state.Candidates {
+		candidates[c.ID] = c
+	}
+
+	ticked := make(map[int64]bool)
+	cleared := state.Reconciled
+	for _, idStr := range r.Form["split_id"] {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		c, ok := candidates[id]
+		if err != nil || !ok {
+			fail("Сплит не относится к сверке этого счёта")
+			return
+		}
+		if !ticked[id] {
+			ticked[id] = true
+			cleared = cleared.Add(c.Value)
+		}
+	}
+
+	if finish {
+		ending, ok := parseStatementBalance(r.FormValue("ending_balance"))
+		if !ok {
+			fail("Некорректный остаток по выписке")
+			return
+		}
+		if diff := ending.Sub(cleared); !diff.IsZero() {
+			fraction, err := h.commodityFraction(account.CommodityID)
+			if err != nil {
+				fraction = 100
+			}
+			fail(fmt.Sprintf("Остаток не сходится с выпиской: разница %s",
+				money.FormatRat(diff.Rat(), money.Places(fraction))))
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var reconciled int
+	for id, c := range candidates {
+		var err error
+		switch {
+		case ticked[id] && finish:
+			_, err = tx.Exec(`
+				UPDATE splits SET reconcile_state = ?, reconcile_date = ?
+				WHERE id = ? AND user_id = ?
+			`, models.ReconcileReconciled, statementDate, id, userID)
+			reconciled++
+		case ticked[id] && c.State != models.ReconcileCleared:
+			_, err = tx.Exec("UPDATE splits SET reconcile_state = ? WHERE id = ? AND user_id = ?",
+				models.ReconcileCleared, id, userID)
+		case !ticked[id] && c.State == models.ReconcileCleared:
+			_, err = tx.Exec("UPDATE splits SET reconcile_state = ? WHERE id = ? AND user_id = ?",
+				models.ReconcileNew, id, userID)
+		}
+		if err != nil {
+			fmt.Printf("ERROR updating split %d: %v\n", id, err)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":     "ok",
+		"reconciled": reconciled,
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// reconcile отправляет форму сверки счёта и возвращает ответ
+func reconcile(t *testing.T, h *Handler, userID int64, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	rec := postForm(t, h, userID, h.APIAccountReconcile, form.Encode())
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+// splitStates возвращает состояния сверки сплитов счёта в порядке дат
+func splitStates(t *testing.T, h *Handler, userID, accountID int64) []string {
+	t.Helper()
+	rows, err := h.db.Query(`
+		SELECT s.reconcile_state FROM splits s JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id = ? ORDER BY t.post_date, s.id
+	`, userID, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var states []string
+	for rows.Next() {
+		var state string
+		rows.Scan(&state)
+		states = append(states, state)
+	}
+	return states
+}
+
+func TestAccountReconcile(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, day, "Зарплата", "", [3]int64{card, 10000000, 100}, [3]int64{salary, -10000000, 100})
+	insertTx(t, h, userID, day.AddDate(0, 0, 3), "Магазин", "", [3]int64{card, -1999, 100}, [3]int64{food, 1999, 100})
+	insertTx(t, h, userID, day.AddDate(0, 1, 0), "Апрель", "", [3]int64{card, -500, 100}, [3]int64{food, 500, 100})
+
+	var salarySplit, shopSplit, aprilSplit int64
+	h.db.QueryRow("SELECT id FROM splits WHERE user_id = ? AND account_id = ? AND value_num = 10000000", userID, card).Scan(&salarySplit)
+	h.db.QueryRow("SELECT id FROM splits WHERE user_id = ? AND account_id = ? AND value_num = -1999", userID, card).Scan(&shopSplit)
+	h.db.QueryRow("SELECT id FROM splits WHERE user_id = ? AND account_id = ? AND value_num = -500", userID, card).Scan(&aprilSplit)
+
+	form := url.Values{
+		"account_id":     {fmt.Sprint(card)},
+		"statement_date": {"2026-03-31"},
+		"ending_balance": {"99 980,01"},
+		"split_id":       {fmt.Sprint(salarySplit)},
+	}
+
+	// Отложенная сверка только помечает отмеченное подтверждённым банком
+	if code, resp := reconcile(t, h, userID, form); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("postpone failed: %d %v", code, resp)
+	}
+	if got := fmt.Sprint(splitStates(t, h, userID, card)); got != "[c n n]" {
+		t.Errorf("states after postpone = %s", got)
+	}
+
+	// Остаток не сходится — ничего не меняется
+	form.Set("finish", "1")
+	if code, resp := reconcile(t, h, userID, form); code != 400 || resp["error"] == nil {
+		t.Fatalf("expected difference error, got %d %v", code, resp)
+	}
+
+	// Сплит после даты выписки в сверку не попадает
+	form["split_id"] = []string{fmt.Sprint(salarySplit), fmt.Sprint(shopSplit), fmt.Sprint(aprilSplit)}
+	if code, _ := reconcile(t, h, userID, form); code != 400 {
+		t.Errorf("split after statement date accepted: %d", code)
+	}
+
+	form["split_id"] = []string{fmt.Sprint(salarySplit), fmt.Sprint(shopSplit)}
+	if code, resp := reconcile(t, h, userID, form); code != 200 || resp["reconciled"] != 2.0 {
+		t.Fatalf("finish failed: %d %v", code, resp)
+	}
+	if got := fmt.Sprint(splitStates(t, h, userID, card)); got != "[y y n]" {
+		t.Errorf("states after finish = %s", got)
+	}
+	var reconciledAt time.Time
+	h.db.QueryRow("SELECT reconcile_date FROM splits WHERE id = ?", shopSplit).Scan(&reconciledAt)
+	if reconciledAt.Format("2006-01-02") != "2026-03-31" {
+		t.Errorf("reconcile_date = %v", reconciledAt)
+	}
+
+	// Реестр показывает отметки и сверенный остаток рядом с текущим
+	page, err := h.accountRegister(userID, card, transactionFilter{Sort: "asc"}, registerPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := page.Rows
+	if len(txs) != 3 {
+		t.Fatalf("expected 3 register rows, got %d", len(txs))
+	}
+	if txs[1]["reconcile_state"] != "y" || txs[2]["reconcile_state"] != "n" {
+		t.Errorf("unexpected markers: %v %v", txs[1]["reconcile_state"], txs[2]["reconcile_state"])
+	}
+	if txs[2]["account_balance"] != 99975.01 || txs[2]["reconciled_balance"] != 99980.01 {
+		t.Errorf("balances = %v / %v", txs[2]["account_balance"], txs[2]["reconciled_balance"])
+	}
+
+	// Чужой счёт недоступен
+	other := createTestUser(t, h)
+	if code, _ := reconcile(t, h, other, form); code != 404 {
+		t.Errorf("foreign account: expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// registerPageSize — строк реестра счёта на одной странице
+const registerPageSize = 100
+
+// accountRegister возвращает страницу реестра счёта: не больше limit
+// транзакций после курсора с учётом фильтров. Баланс строк — настоящий
+// остаток счёта после транзакции: начальный остаток страницы считается
+// суммой всех более ранних сплитов, отфильтрованные транзакции в нём учтены.
+func (h *Handler) accountRegister(userID, accountID int64, f transactionFilter, limit int) (*transactionPage, error) {
+	page := &transactionPage{Rows: []map[string]interface{}{}}
+	f.Accounts = []int64{accountID}
+	ids, dates, err := h.pageTransactions(userID, f, limit, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	byID, err := h.registerRows(userID, accountID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Границы страницы в хронологическом порядке
+	first, last := 0, len(ids)-1
+	if f.Sort != "asc" {
+		first, last = last, first
+	}
+	if err := h.registerBalances(userID, accountID, byID,
+		dates[first], ids[first], dates[last], ids[last]); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		page.Rows = append(page.Rows, byID[id])
+	}
+	return page, nil
+}
+
+// registerRows загружает транзакции ids со всеми сплитами и собирает строки
+// реестра счёта: изменение баланса, отметку сверки и счёт-контрагент
+func (h *Handler) registerRows(userID, accountID int64, ids []int64) (map[int64]map[string]interface{}, error) {
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	// Суммы берём в валюте счёта (quantity), чтобы баланс был в ней же
+	rows, err := h.db.Query(`
+		SELECT t.id, t.description, t.post_date, `+tags.Column+`,
+		       s.account_id, s.quantity_num, s.quantity_denom, s.reconcile_state,
+		       COALESCE(a.name, '')
+		FROM transactions t
+		JOIN splits s ON s.tx_id = t.id
+		LEFT JOIN accounts a ON a.id = s.account_id
+		WHERE t.user_id = ? AND t.id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+`)
+		ORDER BY s.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]map[string]interface{})
+	// Изменения баланса считаем точно, в float переводим только для шаблона
+	changes := make(map[int64]models.Amount)
+	for rows.Next() {
+		var txID, splitAccountID, quantityNum, quantityDenom int64
+		var description, tagList, reconcileState, accountName string
+		var postDate time.Time
+		if err := rows.Scan(&txID, &description, &postDate, &tagList, &splitAccountID,
+			&quantityNum, &quantityDenom, &reconcileState, &accountName); err != nil {
+			return nil, err
+		}
+
+		tx, exists := byID[txID]
+		if !exists {
+			tx = map[string]interface{}{
+				"id":          txID,
+				"description": description,
+				"post_date":   postDate.Format("02.01.2006"),
+				"tags":        tags.Parse(tagList),
+			}
+			byID[txID] = tx
+		}
+
+		if splitAccountID == accountID {
+			// Сплитов на счёт в одной транзакции может быть несколько — суммируем
+			changes[txID] = changes[txID].Add(models.NewAmount(quantityNum, quantityDenom))
+			// Разделяем на приход (положительное) и расход (отрицательное)
+			delete(tx, "plus_balance_changing")
+			delete(tx, "balance_changing")
+			if change := changes[txID]; change.Sign() > 0 {
+				tx["plus_balance_changing"] = change.Float64()
+			} else {
+				tx["balance_changing"] = change.Neg().Float64() // Показываем расход как положительное число
+			}
+
+			// Отметка сверки строки — по наименее сверенному сплиту счёта
+			if prev, ok := tx["reconcile_state"].(string); !ok || reconcileRank(reconcileState) < reconcileRank(prev) {
+				tx["reconcile_state"] = reconcileState
+			}
+		} else {
+			tx["account_name"] = accountName
+			tx["account_id"] = splitAccountID
+		}
+	}
+	return byID, rows.Err()
+}
+
+// registerBalances проставляет строкам текущий и сверенный балансы счёта.
+// Остаток до первой (самой ранней) строки страницы база суммирует по
+// знаменателям; дальше сплиты счёта до последней строки складываются
+// по порядку, включая транзакции, скрытые фильтрами.
+func (h *Handler) registerBalances(userID, accountID int64, byID map[int64]map[string]interface{},
+	firstDate time.Time, firstID int64, lastDate time.Time, lastID int64) error {
+	rows, err := h.db.Query(`
+		SELECT s.quantity_denom, s.reconcile_state, SUM(s.quantity_num)
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id = ?
+		  AND (t.post_date < ? OR t.post_date = ? AND t.id < ?)
+		GROUP BY s.quantity_denom, s.reconcile_state
+	`, userID, accountID, firstDate, firstDate, firstID)
+	if err != nil {
+		return err
+	}
+	var balance, reconciled models.Amount
+	for rows.Next() {
+		var denom, num int64
+		var state string
+		if err := rows.Scan(&denom, &state, &num); err != nil {
+			rows.Close()
+			return err
+		}
+		balance = balance.Add(models.NewAmount(num, denom))
+		if state == models.ReconcileReconciled {
+			reconciled = reconciled.Add(models.NewAmount(num, denom))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = h.db.Query(`
+		SELECT t.id, s.quantity_num, s.quantity_denom, s.reconcile_state
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id = ?
+		  AND (t.post_date > ? OR t.post_date = ? AND t.id >= ?)
+		  AND (t.post_date < ? OR t.post_date = ? AND t.id <= ?)
+		ORDER BY t.post_date, t.id
+	`, userID, accountID, firstDate, firstDate, firstID, lastDate, lastDate, lastID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var prevID int64
+	record := func() {
+		if tx, ok := byID[prevID]; ok {
+			tx["account_balance"] = balance.Float64()
+			tx["reconciled_balance"] = reconciled.Float64()
+		}
+	}
+	for rows.Next() {
+		var txID, num, denom int64
+		var state string
+		if err := rows.Scan(&txID, &num, &denom, &state); err != nil {
+			return err
+		}
+		if txID != prevID {
+			record()
+			prevID = txID
+		}
+		balance = balance.Add(models.NewAmount(num, denom))
+		if state == models.ReconcileReconciled {
+			reconciled = reconciled.Add(models.NewAmount(num, denom))
+		}
+	}
+	record()
+	return rows.Err()
+}
+
+// registerMonths возвращает месяцы с проводками по счёту, от новых к старым
+func (h *Handler) registerMonths(userID, accountID int64) ([]map[string]string, error) {
+	rows, err := h.db.Query(`
+		SELECT DISTINCT DATE_FORMAT(t.post_date, '%Y-%m') AS ym
+		FROM transactions t
+		JOIN splits a ON a.tx_id = t.id AND a.account_id = ?
+		WHERE t.user_id = ?
+		ORDER BY ym DESC
+	`, accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := []map[string]string{}
+	for rows.Next() {
+		var ym string
+		if err := rows.Scan(&ym); err != nil {
+			return nil, err
+		}
+		month, err := time.Parse("2006-01", ym)
+		if err != nil {
+			continue
+		}
+		months = append(months, map[string]string{
+			"Value": ym,
+			"Label": fmt.Sprintf("%s %d", monthNames[month.Month()-1], month.Year()),
+		})
+	}
+	return months, rows.Err()
+}
+
+// registerMoreURL — адрес следующей страницы реестра; пустой, если её нет
+func registerMoreURL(accountID int64, f transactionFilter, page *transactionPage) string {
+	if page.NextCursor == 0 {
+		return ""
+	}
+	return fmt.Sprintf("/api/v1/finance/transaction/table?account_id=%d&%s", accountID,
+		f.Query("sort", f.Sort, "cursor", strconv.FormatInt(page.NextCursor, 10)))
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTransactionFilter(t *testing.T) {
+	today := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	f, err := parseTransactionFilter(url.Values{"period": {"quarter"}, "min": {"10,5"}, "q": {" кофе "}}, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Sort != "desc" || f.From.Format("2006-01-02") != "2025-12-15" || !f.To.IsZero() ||
+		f.MinNum != 105 || f.MinDenom != 10 || f.Text != "кофе" {
+		t.Errorf("unexpected filter: %+v", f)
+	}
+	if f.Period() != "quarter" || !f.HasFilters() {
+		t.Errorf("period %s, has filters %v", f.Period(), f.HasFilters())
+	}
+	if got := f.WithPeriod("all"); got != "min=10%2C5&q=%D0%BA%D0%BE%D1%84%D0%B5" {
+		t.Errorf("WithPeriod: %s", got)
+	}
+
+	// Месяц задаёт обе границы, явные даты их переопределяют
+	f, err = parseTransactionFilter(url.Values{"month": {"2026-02"}, "to": {"2026-02-10"}, "sort": {"asc"}}, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.From.Format("2006-01-02") != "2026-02-01" || f.To.Format("2006-01-02") != "2026-02-10" ||
+		f.Sort != "asc" || f.Period() != "custom" {
+		t.Errorf("unexpected filter: %+v", f)
+	}
+
+	for _, bad := range []string{"period=week", "month=2026-13", "from=2026-03-01&to=2026-02-01",
+		"min=abc", "min=-5", "min=10&max=5", "counterpart=x", "cursor=x"} {
+		query, _ := url.ParseQuery(bad)
+		if _, err := parseTransactionFilter(query, today); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestAccountRegister(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	cash := accountIDByName(t, h, userID, "Наличные")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	insertTx(t, h, userID, day(1), "Зарплата", "",
+		[3]int64{card, 500000, 100}, [3]int64{salary, -500000, 100})
+	insertTx(t, h, userID, day(2), "Кофе", "еда,кафе",
+		[3]int64{food, 25000, 100}, [3]int64{card, -25000, 100})
+	insertTx(t, h, userID, day(3), "Снятие", "",
+		[3]int64{cash, 100000, 100}, [3]int64{card, -100000, 100})
+	insertTx(t, h, userID, day(3), "Кофе с собой", "кафе",
+		[3]int64{food, 15000, 100}, [3]int64{card, -15000, 100})
+	insertTx(t, h, userID, day(5), "Магазин", "еда",
+		[3]int64{food, 60000, 100}, [3]int64{card, -60000, 100})
+
+	register := func(query string, limit int) *transactionPage {
+		t.Helper()
+		values, _ := url.ParseQuery(query)
+		f, err := parseTransactionFilter(values, day(15))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := h.accountRegister(userID, card, f, limit)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return page
+	}
+	rows := func(page *transactionPage) string {
+		var out []string
+		for _, row := range page.Rows {
+			out = append(out, fmt.Sprintf("%s=%.2f", row["description"], row["account_balance"]))
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Страницы по две строки от новых к старым; баланс страницы не зависит от остальных
+	page := register("", 2)
+	if got := rows(page); got != "Магазин=3000.00 Кофе с собой=3600.00" || page.NextCursor == 0 {
+		t.Fatalf("first page: %s, cursor %d", got, page.NextCursor)
+	}
+	page = register(fmt.Sprintf("cursor=%d", page.NextCursor), 2)
+	if got := rows(page); got != "Снятие=3750.00 Кофе=4750.00" || page.PrevDate != "03.03.2026" {
+		t.Fatalf("second page: %s, prev date %s", got, page.PrevDate)
+	}
+	page = register(fmt.Sprintf("cursor=%d", page.NextCursor), 2)
+	if got := rows(page); got != "Зарплата=5000.00" || page.NextCursor != 0 {
+		t.Fatalf("last page: %s, cursor %d", got, page.NextCursor)
+	}
+	if got := rows(register("sort=asc", 3)); got != "Зарплата=5000.00 Кофе=4750.00 Снятие=3750.00" {
+		t.Errorf("ascending: %s", got)
+	}
+
+	// Отфильтрованные транзакции остаются в балансе
+	tests := []struct{ query, want string }{
+		{"q=кофе", "Кофе с собой=3600.00 Кофе=4750.00"},
+		{"tag=еда", "Магазин=3000.00 Кофе=4750.00"},
+		{"min=200&max=1000", "Магазин=3000.00 Снятие=3750.00 Кофе=4750.00"},
+		{fmt.Sprintf("counterpart=%d", cash), "Снятие=3750.00"},
+		{"from=2026-03-02&to=2026-03-03", "Кофе с собой=3600.00 Снятие=3750.00 Кофе=4750.00"},
+		{"month=2026-02", ""},
+	}
+	for _, tt := range tests {
+		if got := rows(register(tt.query, registerPageSize)); got != tt.want {
+			t.Errorf("%s: %s, expected %s", tt.query, got, tt.want)
+		}
+	}
+
+	f, _ := parseTransactionFilter(url.Values{"q": {"кофе"}}, day(15))
+	f.Accounts = []int64{card}
+	stats, err := h.transactionStats(userID, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 2 || stats.ExpenseCount != 2 || stats.Expense != 400 || stats.IncomeCount != 0 {
+		t.Errorf("stats: %+v", stats)
+	}
+	if count, err := h.countTransactions(userID, f); err != nil || count != stats.Count {
+		t.Errorf("count = %d %v, expected %d", count, err, stats.Count)
+	}
+
+	// По поддереву счетов перевод между ними — ни приход, ни расход, а сплиты
+	// одной транзакции с разными знаменателями складываются точно
+	insertTx(t, h, userID, day(14), "Монеты", "",
+		[3]int64{cash, 1234, 1000}, [3]int64{card, -1, 100}, [3]int64{salary, -1224, 1000})
+	for q, want := range map[string]transactionStats{
+		"Снятие": {Count: 1},
+		"Монеты": {Count: 1, IncomeCount: 1, Income: 1.224},
+	} {
+		f, _ := parseTransactionFilter(url.Values{"q": {q}}, day(15))
+		f.Accounts = []int64{card, cash}
+		if stats, err := h.transactionStats(userID, f); err != nil || stats != want {
+			t.Errorf("%s stats: %+v %v", q, stats, err)
+		}
+	}
+	months, err := h.registerMonths(userID, card)
+	if err != nil || len(months) != 1 || months[0]["Label"] != "Март 2026" {
+		t.Errorf("months: %v %v", months, err)
+	}
+
+	// Фрагмент следующей страницы через API; удалённый курсор — ошибка
+	rec := doRequest(t, h, userID, h.APITransactionTableGet, "GET",
+		fmt.Sprintf("/api/v1/finance/transaction/table?account_id=%d&cursor=999999", card), nil, "", nil)
+	if rec.Code != 400 {
+		t.Errorf("stale cursor: expected 400, got %d", rec.Code)
+	}
+	other := createTestUser(t, h)
+	rec = doRequest(t, h, other, h.APITransactionTableGet, "GET",
+		fmt.Sprintf("/api/v1/finance/transaction/table?account_id=%d", card), nil, "", nil)
+	if rec.Code != 404 {
+		t.Errorf("foreign account: expected 404, got %d", rec.Code)
+	}
+}
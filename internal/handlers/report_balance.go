@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+// balanceSheetSections — разделы баланса. Торговые счета GnuCash
+// уравновешивают обмен валют и относятся к капиталу.
+var balanceSheetSections = []reportSectionSpec{
+	{Title: "Активы", Types: []string{models.AccountTypeAsset, models.AccountTypeBank, models.AccountTypeCash,
+		models.AccountTypeStock, models.AccountTypeMutual, models.AccountTypeReceivable, models.AccountTypeCurrency}},
+	{Title: "Обязательства", Types: []string{models.AccountTypeLiability, models.AccountTypeCredit,
+		models.AccountTypePayable}, Negate: true},
+	{Title: "Капитал", Types: []string{models.AccountTypeEquity, models.AccountTypeTrading}, Negate: true},
+}
+
+// balanceSheet — баланс на дату. Нераспределённая прибыль — накопленный
+// результат доходов и расходов. Курсовые разницы появляются, когда суммы
+// в разных валютах пересчитаны по курсу на дату баланса, а не на дату
+// операций, — с ними активы всегда равны обязательствам и капиталу.
+type balanceSheet struct {
+	Report               *report
+	Retained             []models.Amount
+	Difference           []models.Amount
+	Equity               []models.Amount // капитал вместе с расчётными строками
+	LiabilitiesAndEquity []models.Amount
+}
+
+// HasDifference — хотя бы в одной колонке есть курсовые разницы
+func (b *balanceSheet) HasDifference() bool {
+	for _, d := range b.Difference {
+		if !d.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *balanceSheet) RetainedTexts() []string   { return b.Report.formatAll(b.Retained) }
+func (b *balanceSheet) DifferenceTexts() []string { return b.Report.formatAll(b.Difference) }
+func (b *balanceSheet) EquityTexts() []string     { return b.Report.formatAll(b.Equity) }
+func (b *balanceSheet) LiabilitiesAndEquityTexts() []string {
+	return b.Report.formatAll(b.LiabilitiesAndEquity)
+}
+
+// balanceSheetColumns строит колонки баланса: на дату date (по умолчанию
+// сегодня) и, с compare=year, на ту же дату год назад
+func balanceSheetColumns(query url.Values) ([]reportColumn, error) {
+	now := time.Now()
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if s := query.Get("date"); s != "" {
+		var err error
+		if date, err = time.Parse("2006-01-02", s); err != nil {
+			return nil, errors.New("Некорректная дата")
+		}
+	}
+
+	columns := []reportColumn{{Label: periodLabel(time.Time{}, date), To: date}}
+	switch query.Get("compare") {
+	case "":
+	case "year":
+		_, prev := yearAgo(date, date)
+		columns = append(columns, reportColumn{Label: periodLabel(time.Time{}, prev), To: prev})
+	default:
+		return nil, errors.New("Неизвестный вид сравнения")
+	}
+	return columns, nil
+}
+
+// balanceSheet строит баланс по сплитам, проведённым не позже даты колонки
+func (h *Handler) balanceSheet(userID int64, columns []reportColumn) (*balanceSheet, error) {
+	rep, err := h.buildReport(userID, columns, balanceSheetSections)
+	if err != nil {
+		return nil, err
+	}
+	assets, liabilities, equity := rep.Sections[0], rep.Sections[1], rep.Sections[2]
+
+	sheet := &balanceSheet{
+		Report:               rep,
+		Retained:             make([]models.Amount, len(columns)),
+		Difference:           make([]models.Amount, len(columns)),
+		Equity:               make([]models.Amount, len(columns)),
+		LiabilitiesAndEquity: make([]models.Amount, len(columns)),
+	}
+	profit := rep.typeTotals(models.AccountTypeIncome, models.AccountTypeExpense)
+	for i := range columns {
+		// Доходы хранятся отрицательными, расходы — положительными
+		sheet.Retained[i] = profit[i].Neg()
+		sheet.Difference[i] = assets.Totals[i].Sub(liabilities.Totals[i]).Sub(equity.Totals[i]).Sub(sheet.Retained[i])
+		sheet.Equity[i] = equity.Totals[i].Add(sheet.Retained[i]).Add(sheet.Difference[i])
+		sheet.LiabilitiesAndEquity[i] = liabilities.Totals[i].Add(sheet.Equity[i])
+	}
+	return sheet, nil
+}
+
+// FinanceBalanceSheet - баланс на дату: активы, обязательства и капитал
+func (h *Handler) FinanceBalanceSheet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	query := r.URL.Query()
+
+	columns, err := balanceSheetColumns(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sheet, err := h.balanceSheet(userID, columns)
+	if err != nil {
+		fmt.Printf("ERROR building balance sheet for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	thisYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	data := h.pageData(userID, "reports")
+	data["Title"] = "Баланс"
+	data["Sheet"] = sheet
+	data["Report"] = sheet.Report
+	data["Date"] = columns[0].To.Format("2006-01-02")
+	data["CompareYear"] = query.Get("compare") == "year"
+	data["Presets"] = []map[string]string{
+		{"Label": "Сегодня", "Date": now.Format("2006-01-02")},
+		{"Label": "Конец прошлого месяца", "Date": thisMonth.AddDate(0, 0, -1).Format("2006-01-02")},
+		{"Label": "Конец прошлого года", "Date": thisYear.AddDate(0, 0, -1).Format("2006-01-02")},
+	}
+	h.renderTemplate(w, "finance_report_balance.html", data)
+}
+
+// APIBalanceSheet - баланс в JSON; параметры те же, что у страницы:
+// date и compare=year
+func (h *Handler) APIBalanceSheet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	columns, err := balanceSheetColumns(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	sheet, err := h.balanceSheet(userID, columns)
+	if err != nil {
+		fmt.Printf("ERROR building balance sheet for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	rep := sheet.Report
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"currency":               rep.Currency.Mnemonic,
+		"columns":                rep.columnsJSON(),
+		"assets":                 rep.sectionJSON(rep.Sections[0]),
+		"liabilities":            rep.sectionJSON(rep.Sections[1]),
+		"equity":                 rep.sectionJSON(rep.Sections[2]),
+		"retained_earnings":      sheet.RetainedTexts(),
+		"exchange_difference":    sheet.DifferenceTexts(),
+		"equity_total":           sheet.EquityTexts(),
+		"liabilities_and_equity": sheet.LiabilitiesAndEquityTexts(),
+		"missing_rates":          rep.Missing,
+	})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBalanceSheet(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	credit := accountIDByName(t, h, userID, "Кредитная карта")
+	opening := accountIDByName(t, h, userID, "Начальный баланс")
+	food := accountIDByName(t, h, userID, "Продукты")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	insertTx(t, h, userID, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), "Начальный остаток", "",
+		[3]int64{card, 100000, 100}, [3]int64{opening, -100000, 100})
+	insertTx(t, h, userID, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), "Зарплата", "",
+		[3]int64{card, 500000, 100}, [3]int64{salary, -500000, 100})
+	insertTx(t, h, userID, time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 120000, 100}, [3]int64{credit, -120000, 100})
+	// После даты баланса — не учитывается
+	insertTx(t, h, userID, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 5000, 100}, [3]int64{card, -5000, 100})
+
+	rec := doRequest(t, h, userID, h.APIBalanceSheet, "GET",
+		"/api/v1/finance/reports/balance-sheet?date=2026-02-28", nil, "", nil)
+	if rec.Code != 200 {
+		t.Fatalf("balance sheet: %d %s", rec.Code, rec.Body.String())
+	}
+	type section struct {
+		Rows []struct {
+			Name   string
+			Values []string
+		}
+		Totals []string
+	}
+	var resp struct {
+		Columns              []map[string]string
+		Assets               section
+		Liabilities          section
+		Equity               section
+		RetainedEarnings     []string `json:"retained_earnings"`
+		ExchangeDifference   []string `json:"exchange_difference"`
+		EquityTotal          []string `json:"equity_total"`
+		LiabilitiesAndEquity []string `json:"liabilities_and_equity"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Columns) != 1 || resp.Columns[0]["to"] != "2026-02-28" || resp.Columns[0]["from"] != "" {
+		t.Fatalf("columns: %v", resp.Columns)
+	}
+
+	values := make(map[string]string)
+	for _, s := range []section{resp.Assets, resp.Liabilities, resp.Equity} {
+		for _, row := range s.Rows {
+			values[row.Name] = row.Values[0]
+		}
+	}
+	tests := []struct{ name, value string }{
+		{"Активы", "6000.00"},
+		{"Текущие активы", "6000.00"},
+		{"Расчетный счет", "6000.00"},
+		{"Кредитная карта", "1200.00"},
+		{"Обязательства", "1200.00"},
+		{"Начальный баланс", "1000.00"},
+	}
+	for _, tt := range tests {
+		if values[tt.name] != tt.value {
+			t.Errorf("%s: %q, expected %s", tt.name, values[tt.name], tt.value)
+		}
+	}
+	// В баланс попадают только балансовые счета
+	for _, name := range []string{"Продукты", "Зарплата", "Наличные"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("%s must not be in the balance sheet", name)
+		}
+	}
+	if resp.RetainedEarnings[0] != "3800.00" || resp.ExchangeDifference[0] != "0.00" ||
+		resp.EquityTotal[0] != "4800.00" {
+		t.Errorf("equity: retained %v difference %v total %v",
+			resp.RetainedEarnings, resp.ExchangeDifference, resp.EquityTotal)
+	}
+	if resp.Assets.Totals[0] != resp.LiabilitiesAndEquity[0] {
+		t.Errorf("assets %v != liabilities and equity %v", resp.Assets.Totals, resp.LiabilitiesAndEquity)
+	}
+
+	// Сравнение с той же датой год назад, когда книга ещё пуста
+	columns, err := balanceSheetColumns(url.Values{"date": {"2026-01-05"}, "compare": {"year"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := h.balanceSheet(userID, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sheet.Report.Sections[0].TotalTexts; got[0] != "1000.00" || got[1] != "0.00" {
+		t.Errorf("assets on 2026-01-05 and a year before: %v", got)
+	}
+	if got := sheet.RetainedTexts(); got[0] != "0.00" {
+		t.Errorf("retained earnings before the salary: %v", got)
+	}
+	if sheet.HasDifference() {
+		t.Errorf("single-currency book must balance: %v", sheet.DifferenceTexts())
+	}
+
+	for _, bad := range []string{"date=2026-02-30", "compare=prev"} {
+		rec := doRequest(t, h, userID, h.APIBalanceSheet, "GET",
+			"/api/v1/finance/reports/balance-sheet?"+bad, nil, "", nil)
+		if rec.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+}
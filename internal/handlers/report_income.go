@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+// maxReportColumns ограничивает разбивку по месяцам: три года
+const maxReportColumns = 36
+
+// incomeStatementSections — разделы отчёта о доходах и расходах
+var incomeStatementSections = []reportSectionSpec{
+	{Title: "Доходы", Types: []string{models.AccountTypeIncome}, Negate: true},
+	{Title: "Расходы", Types: []string{models.AccountTypeExpense}},
+}
+
+// reportPeriod разбирает from и to (включительно) в формате 2006-01-02;
+// без них — текущий месяц
+func reportPeriod(query url.Values) (time.Time, time.Time, error) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+
+	var err error
+	if s := query.Get("from"); s != "" {
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, errors.New("Некорректная дата начала периода")
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, errors.New("Некорректная дата конца периода")
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("Конец периода раньше начала")
+	}
+	return from, to, nil
+}
+
+// previousPeriod возвращает период той же длины перед [from, to]; целые
+// месяцы сдвигаются на число месяцев, чтобы март сравнивался с февралём целиком
+func previousPeriod(from, to time.Time) (time.Time, time.Time) {
+	if isWholeMonths(from, to) {
+		months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1
+		return from.AddDate(0, -months, 0), from.AddDate(0, 0, -1)
+	}
+	days := int(to.Sub(from).Hours()/24) + 1
+	return from.AddDate(0, 0, -days), from.AddDate(0, 0, -1)
+}
+
+// yearAgo сдвигает период на год назад; конец месяца остаётся концом месяца
+// (29 февраля → 28 февраля)
+func yearAgo(from, to time.Time) (time.Time, time.Time) {
+	prevTo := to.AddDate(-1, 0, 0)
+	if to.AddDate(0, 0, 1).Day() == 1 {
+		prevTo = time.Date(to.Year()-1, to.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	prevFrom := from.AddDate(-1, 0, 0)
+	if prevFrom.Month() != from.Month() {
+		prevFrom = time.Date(from.Year()-1, from.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	return prevFrom, prevTo
+}
+
+// incomeStatementColumns строит колонки отчёта: период и колонки сравнения
+// (compare=prev — предыдущий период, compare=year — тот же период год назад)
+// или, с group=month, по колонке на каждый месяц периода
+func incomeStatementColumns(query url.Values) ([]reportColumn, error) {
+	from, to, err := reportPeriod(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Get("group") == "month" {
+		return monthColumns(from, to)
+	}
+
+	columns := []reportColumn{{Label: periodLabel(from, to), From: from, To: to}}
+	for _, compare := range query["compare"] {
+		var prevFrom, prevTo time.Time
+		switch compare {
+		case "prev":
+			prevFrom, prevTo = previousPeriod(from, to)
+		case "year":
+			prevFrom, prevTo = yearAgo(from, to)
+		default:
+			return nil, errors.New("Неизвестный вид сравнения")
+		}
+		columns = append(columns, reportColumn{Label: periodLabel(prevFrom, prevTo), From: prevFrom, To: prevTo})
+	}
+	return columns, nil
+}
+
+// monthColumns разбивает период по месяцам; крайние месяцы обрезаются по периоду
+func monthColumns(from, to time.Time) ([]reportColumn, error) {
+	var columns []reportColumn
+	for start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !start.After(to); start = start.AddDate(0, 1, 0) {
+		if len(columns) == maxReportColumns {
+			return nil, fmt.Errorf("Не больше %d месяцев в разбивке по месяцам", maxReportColumns)
+		}
+		colFrom, colTo := start, start.AddDate(0, 1, -1)
+		if colFrom.Before(from) {
+			colFrom = from
+		}
+		if colTo.After(to) {
+			colTo = to
+		}
+		columns = append(columns, reportColumn{Label: periodLabel(colFrom, colTo), From: colFrom, To: colTo})
+	}
+	return columns, nil
+}
+
+// incomeStatement строит отчёт о доходах и расходах и итог (доходы − расходы)
+func (h *Handler) incomeStatement(userID int64, columns []reportColumn) (*report, []models.Amount, error) {
+	rep, err := h.buildReport(userID, columns, incomeStatementSections)
+	if err != nil {
+		return nil, nil, err
+	}
+	income, expense := rep.Sections[0], rep.Sections[1]
+	net := make([]models.Amount, len(columns))
+	for i := range columns {
+		net[i] = income.Totals[i].Sub(expense.Totals[i])
+	}
+	return rep, net, nil
+}
+
+// FinanceIncomeStatement - отчёт о доходах и расходах за период
+func (h *Handler) FinanceIncomeStatement(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	query := r.URL.Query()
+
+	columns, err := incomeStatementColumns(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rep, net, err := h.incomeStatement(userID, columns)
+	if err != nil {
+		fmt.Printf("ERROR building income statement for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, _ := reportPeriod(query)
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	thisYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	compare := make(map[string]bool)
+	for _, c := range query["compare"] {
+		compare[c] = true
+	}
+
+	data := h.pageData(userID, "reports")
+	data["Title"] = "Доходы и расходы"
+	data["Report"] = rep
+	data["Net"] = net
+	data["NetTexts"] = rep.formatAll(net)
+	data["From"] = from.Format("2006-01-02")
+	data["To"] = to.Format("2006-01-02")
+	data["ComparePrev"] = compare["prev"]
+	data["CompareYear"] = compare["year"]
+	data["GroupMonth"] = query.Get("group") == "month"
+	data["Presets"] = []map[string]string{
+		{"Label": "Этот месяц", "From": thisMonth.Format("2006-01-02"), "To": thisMonth.AddDate(0, 1, -1).Format("2006-01-02")},
+		{"Label": "Прошлый месяц", "From": thisMonth.AddDate(0, -1, 0).Format("2006-01-02"), "To": thisMonth.AddDate(0, 0, -1).Format("2006-01-02")},
+		{"Label": "Этот год", "From": thisYear.Format("2006-01-02"), "To": thisYear.AddDate(1, 0, -1).Format("2006-01-02")},
+		{"Label": "Прошлый год", "From": thisYear.AddDate(-1, 0, 0).Format("2006-01-02"), "To": thisYear.AddDate(0, 0, -1).Format("2006-01-02")},
+	}
+	h.renderTemplate(w, "finance_report_income.html", data)
+}
+
+// APIIncomeStatement - отчёт о доходах и расходах в JSON; параметры те же,
+// что у страницы: from, to, compare=prev|year (можно оба), group=month
+func (h *Handler) APIIncomeStatement(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	columns, err := incomeStatementColumns(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	rep, net, err := h.incomeStatement(userID, columns)
+	if err != nil {
+		fmt.Printf("ERROR building income statement for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"currency":      rep.Currency.Mnemonic,
+		"columns":       rep.columnsJSON(),
+		"income":        rep.sectionJSON(rep.Sections[0]),
+		"expense":       rep.sectionJSON(rep.Sections[1]),
+		"net":           rep.formatAll(net),
+		"missing_rates": rep.Missing,
+	})
+}
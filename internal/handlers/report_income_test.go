@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+func TestIncomeStatementColumns(t *testing.T) {
+	tests := []struct {
+		query  string
+		labels []string
+		from   string
+		to     string
+	}{
+		{"from=2026-03-01&to=2026-03-31&compare=prev&compare=year",
+			[]string{"Март 2026", "Февраль 2026", "Март 2025"}, "2026-02-01", "2026-02-28"},
+		{"from=2026-01-01&to=2026-03-31&compare=prev",
+			[]string{"01.01.2026 – 31.03.2026", "01.10.2025 – 31.12.2025"}, "2025-10-01", "2025-12-31"},
+		// Произвольный период сдвигается на столько же дней
+		{"from=2026-03-05&to=2026-03-14&compare=prev",
+			[]string{"05.03.2026 – 14.03.2026", "23.02.2026 – 04.03.2026"}, "2026-02-23", "2026-03-04"},
+		// Конец февраля високосного года — конец февраля прошлого года
+		{"from=2028-02-01&to=2028-02-29&compare=year",
+			[]string{"Февраль 2028", "Февраль 2027"}, "2027-02-01", "2027-02-28"},
+		// Разбивка по месяцам обрезает крайние месяцы по границам периода
+		{"from=2026-01-15&to=2026-03-31&group=month&compare=prev",
+			[]string{"15.01.2026 – 31.01.2026", "Февраль 2026", "Март 2026"}, "2026-02-01", "2026-02-28"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		columns, err := incomeStatementColumns(query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var labels []string
+		for _, col := range columns {
+			labels = append(labels, col.Label)
+		}
+		if len(labels) != len(tt.labels) {
+			t.Fatalf("%s: columns %v, expected %v", tt.query, labels, tt.labels)
+		}
+		for i := range labels {
+			if labels[i] != tt.labels[i] {
+				t.Errorf("%s: columns %v, expected %v", tt.query, labels, tt.labels)
+				break
+			}
+		}
+		if from := columns[1].From.Format("2006-01-02"); from != tt.from {
+			t.Errorf("%s: second column from %s, expected %s", tt.query, from, tt.from)
+		}
+		if to := columns[1].To.Format("2006-01-02"); to != tt.to {
+			t.Errorf("%s: second column to %s, expected %s", tt.query, to, tt.to)
+		}
+	}
+
+	for _, bad := range []string{"from=2026-03-31&to=2026-03-01", "from=2026-13-01", "compare=week",
+		"from=2020-01-01&to=2026-12-31&group=month"} {
+		query, _ := url.ParseQuery(bad)
+		if _, err := incomeStatementColumns(query); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestIncomeStatement(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	power := accountIDByName(t, h, userID, "Электричество")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+
+	march := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	insertTx(t, h, userID, march, "Зарплата", "", [3]int64{card, 600000, 100}, [3]int64{salary, -600000, 100})
+	insertTx(t, h, userID, march, "Магазин", "", [3]int64{food, 120000, 100}, [3]int64{card, -120000, 100})
+	insertTx(t, h, userID, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), "Свет", "",
+		[3]int64{power, 20000, 100}, [3]int64{card, -20000, 100})
+	insertTx(t, h, userID, march.AddDate(0, -1, 0), "Магазин", "", [3]int64{food, 50000, 100}, [3]int64{card, -50000, 100})
+	insertTx(t, h, userID, march.AddDate(-1, 0, 0), "Магазин", "", [3]int64{food, 30000, 100}, [3]int64{card, -30000, 100})
+	insertTx(t, h, userID, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), "Магазин", "",
+		[3]int64{food, 5000, 100}, [3]int64{card, -5000, 100})
+
+	rec := doRequest(t, h, userID, h.APIIncomeStatement, "GET",
+		"/api/v1/finance/reports/income-statement?from=2026-03-01&to=2026-03-31&compare=prev&compare=year",
+		nil, "", nil)
+	if rec.Code != 200 {
+		t.Fatalf("income statement: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Currency string
+		Columns  []map[string]string
+		Income   struct{ Totals []string }
+		Expense  struct {
+			Rows []struct {
+				Name   string
+				Level  int
+				Values []string
+			}
+			Totals []string
+		}
+		Net []string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Currency != "RUB" || len(resp.Columns) != 3 || resp.Columns[2]["from"] != "2025-03-01" {
+		t.Fatalf("unexpected header: %s %v", resp.Currency, resp.Columns)
+	}
+
+	expenses := make(map[string][]string)
+	var names []string
+	for _, row := range resp.Expense.Rows {
+		expenses[row.Name] = row.Values
+		names = append(names, row.Name)
+	}
+	tests := []struct {
+		name   string
+		values []string
+	}{
+		{"Расходы", []string{"1400.00", "500.00", "300.00"}},
+		{"Продукты", []string{"1200.00", "500.00", "300.00"}},
+		{"Коммунальные услуги", []string{"200.00", "0.00", "0.00"}},
+		{"Электричество", []string{"200.00", "0.00", "0.00"}},
+	}
+	for _, tt := range tests {
+		got := expenses[tt.name]
+		if len(got) != 3 || got[0] != tt.values[0] || got[1] != tt.values[1] || got[2] != tt.values[2] {
+			t.Errorf("%s: %v, expected %v", tt.name, got, tt.values)
+		}
+	}
+	// Счета без оборотов в отчёт не попадают
+	if _, ok := expenses["Транспорт"]; ok || len(names) != 4 {
+		t.Errorf("unexpected expense rows: %v", names)
+	}
+	if got := resp.Income.Totals; got[0] != "6000.00" || got[1] != "0.00" {
+		t.Errorf("income totals: %v", got)
+	}
+	if got := resp.Net; got[0] != "4600.00" || got[1] != "-500.00" || got[2] != "-300.00" {
+		t.Errorf("net: %v", got)
+	}
+
+	// Разбивка по месяцам: апрельская покупка попадает только в свою колонку
+	columns, _ := incomeStatementColumns(url.Values{"from": {"2026-01-01"}, "to": {"2026-04-30"}, "group": {"month"}})
+	rep, net, err := h.incomeStatement(userID, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rep.Sections[1].TotalTexts; len(got) != 4 || got[0] != "0.00" || got[1] != "500.00" ||
+		got[2] != "1400.00" || got[3] != "50.00" {
+		t.Errorf("monthly expense totals: %v", got)
+	}
+	if got := rep.formatAll(net); got[2] != "4600.00" || got[3] != "-50.00" {
+		t.Errorf("monthly net: %v", got)
+	}
+
+	rec = doRequest(t, h, userID, h.APIIncomeStatement, "GET",
+		"/api/v1/finance/reports/income-statement?from=2026-03-31&to=2026-03-01", nil, "", nil)
+	if rec.Code != 400 {
+		t.Errorf("reversed period: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestReportSectionParentCycle(t *testing.T) {
+	// Цикл родителей из импортированной книги не должен подвешивать отчёт
+	food, cafe := int64(1), int64(2)
+	rep := &report{
+		Columns: []reportColumn{{Label: "Март"}},
+		places:  2,
+		accounts: []*models.Account{
+			{ID: food, Name: "Продукты", AccountType: "EXPENSE", ParentID: &cafe},
+			{ID: cafe, Name: "Кафе", AccountType: "EXPENSE", ParentID: &food},
+		},
+		converted: []map[int64]models.Amount{{food: models.NewAmount(1000, 100)}},
+	}
+	section := rep.section(reportSectionSpec{Title: "Расходы", Types: []string{"EXPENSE"}})
+	if got := section.TotalTexts[0]; got != "10.00" {
+		t.Errorf("total = %s, expected 10.00", got)
+	}
+	if len(section.Rows) != 2 {
+		t.Errorf("%d rows, expected 2", len(section.Rows))
+	}
+}
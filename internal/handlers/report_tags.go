@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+)
+
+// tagReportMonths — период отчёта по тегам без from и to: год по текущий месяц
+const tagReportMonths = 12
+
+// tagReportRow — тег в отчёте: расходы и доходы по колонкам в валюте отчёта.
+// Расходы — сплиты по счетам расходов, доходы — по счетам доходов с обратным
+// знаком; возвраты уменьшают сумму.
+type tagReportRow struct {
+	Tag          *models.Tag
+	Expense      []models.Amount
+	Income       []models.Amount
+	ExpenseTotal models.Amount
+	IncomeTotal  models.Amount
+
+	ExpenseTexts     []string
+	IncomeTexts      []string
+	ExpenseTotalText string
+	IncomeTotalText  string
+}
+
+// tagReport — расходы и доходы по тегам. Транзакция с несколькими тегами
+// учитывается у каждого из них, поэтому общего итога по тегам нет.
+type tagReport struct {
+	Currency *models.Commodity
+	Columns  []reportColumn
+	Rows     []*tagReportRow
+	Missing  []string
+
+	places int
+}
+
+// tagReportColumns — колонки отчёта по тегам: по месяцу на колонку;
+// без from и to — последние tagReportMonths месяцев
+func tagReportColumns(query url.Values) ([]reportColumn, error) {
+	if query.Get("from") == "" && query.Get("to") == "" {
+		now := time.Now()
+		thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		query = url.Values{
+			"from": {thisMonth.AddDate(0, 1-tagReportMonths, 0).Format("2006-01-02")},
+			"to":   {thisMonth.AddDate(0, 1, -1).Format("2006-01-02")},
+		}
+	}
+	from, to, err := reportPeriod(query)
+	if err != nil {
+		return nil, err
+	}
+	return monthColumns(from, to)
+}
+
+// tagReportCurrency — валюта отчёта: currency (id валюты) или валюта
+// отчётности пользователя
+func (h *Handler) tagReportCurrency(userID int64, query url.Values) (*models.Commodity, error) {
+	s := query.Get("currency")
+	if s == "" {
+		return h.reportingCurrency(userID)
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, errors.New("Некорректная валюта")
+	}
+	commodities, err := h.getCommodities()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range commodities {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, errors.New("Неизвестная валюта")
+}
+
+// buildTagReport считает расходы и доходы по тегам names (пустой — все теги)
+// в валюте currency; суммы колонки пересчитываются по курсам на конец её
+// периода. Теги без движений в отчёт не попадают; строки — по убыванию
+// расходов за весь период.
+func (h *Handler) buildTagReport(userID int64, currency *models.Commodity, columns []reportColumn, names []string) (*tagReport, error) {
+	list, err := h.getTags(userID, "")
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	mnemonics, err := h.commodityMnemonics()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &tagReport{
+		Currency: currency,
+		Columns:  columns,
+		places:   money.Places(int64(currency.Fraction)),
+	}
+	if currency.Fraction <= 0 {
+		rep.places = 2
+	}
+
+	// Имена тегов сравниваются без учёта регистра, как в справочнике тегов
+	var tagIDs []int64
+	if len(names) > 0 {
+		wanted := make(map[string]bool, len(names))
+		for _, name := range names {
+			wanted[strings.ToLower(name)] = true
+		}
+		for _, tag := range list {
+			if wanted[strings.ToLower(tag.Name)] {
+				tagIDs = append(tagIDs, tag.ID)
+			}
+		}
+		if len(tagIDs) == 0 {
+			return rep, nil
+		}
+	}
+
+	// В отчёт идут только сплиты по счетам доходов и расходов
+	accountsMap := make(map[int64]*models.Account, len(accounts))
+	for _, account := range accounts {
+		if account.AccountType == models.AccountTypeIncome || account.AccountType == models.AccountTypeExpense {
+			accountsMap[account.ID] = account
+		}
+	}
+
+	byID := make(map[int64]*tagReportRow)
+	missing := make(map[string]bool)
+	for i, col := range columns {
+		sums, err := h.tagBalances(userID, col.From, col.To, tagIDs)
+		if err != nil {
+			return nil, err
+		}
+		book, err := h.loadRateBook(col.To)
+		if err != nil {
+			return nil, err
+		}
+		converter := newCurrencyConverter(book, currency.Mnemonic)
+
+		for tagID, byAccount := range sums {
+			for accountID, sum := range byAccount {
+				account := accountsMap[accountID]
+				if account == nil {
+					continue
+				}
+				row := byID[tagID]
+				if row == nil {
+					row = &tagReportRow{
+						Expense: make([]models.Amount, len(columns)),
+						Income:  make([]models.Amount, len(columns)),
+					}
+					byID[tagID] = row
+				}
+				mnemonic := mnemonics[account.CommodityID]
+				if mnemonic == "" {
+					mnemonic = "RUB"
+				}
+				value, ok := converter.Convert(sum, mnemonic)
+				if !ok {
+					continue
+				}
+				if account.AccountType == models.AccountTypeIncome {
+					row.Income[i] = row.Income[i].Sub(value)
+				} else {
+					row.Expense[i] = row.Expense[i].Add(value)
+				}
+			}
+		}
+		for _, m := range converter.MissingCurrencies() {
+			missing[m] = true
+		}
+	}
+	for m := range missing {
+		rep.Missing = append(rep.Missing, m)
+	}
+	sort.Strings(rep.Missing)
+
+	for _, tag := range list {
+		row := byID[tag.ID]
+		if row == nil {
+			continue
+		}
+		row.Tag = tag
+		for i := range columns {
+			row.ExpenseTotal = row.ExpenseTotal.Add(row.Expense[i])
+			row.IncomeTotal = row.IncomeTotal.Add(row.Income[i])
+		}
+		if row.ExpenseTotal.IsZero() && row.IncomeTotal.IsZero() {
+			continue
+		}
+		row.ExpenseTexts = rep.formatAll(row.Expense)
+		row.IncomeTexts = rep.formatAll(row.Income)
+		row.ExpenseTotalText = rep.format(row.ExpenseTotal)
+		row.IncomeTotalText = rep.format(row.IncomeTotal)
+		rep.Rows = append(rep.Rows, row)
+	}
+	sort.SliceStable(rep.Rows, func(i, j int) bool {
+		a, b := rep.Rows[i], rep.Rows[j]
+		if c := a.ExpenseTotal.Cmp(b.ExpenseTotal); c != 0 {
+			return c > 0
+		}
+		if c := a.IncomeTotal.Cmp(b.IncomeTotal); c != 0 {
+			return c > 0
+		}
+		return strings.ToLower(a.Tag.Name) < strings.ToLower(b.Tag.Name)
+	})
+	return rep, nil
+}
+
+// format печатает сумму с точностью валюты отчёта
+func (r *tagReport) format(a models.Amount) string {
+	return money.FormatRat(a.Rat(), r.places)
+}
+
+func (r *tagReport) formatAll(values []models.Amount) []string {
+	texts := make([]string, len(values))
+	for i, v := range values {
+		texts[i] = r.format(v)
+	}
+	return texts
+}
+
+// chartJSON — ряды для графика: расходы и доходы тегов по месяцам
+func (r *tagReport) chartJSON() template.JS {
+	labels := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		labels[i] = col.Label
+	}
+	series := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		expense := make([]float64, len(row.Expense))
+		income := make([]float64, len(row.Income))
+		for i := range row.Expense {
+			expense[i] = row.Expense[i].Float64()
+			income[i] = row.Income[i].Float64()
+		}
+		series = append(series, map[string]interface{}{
+			"name":    row.Tag.Name,
+			"color":   row.Tag.Color,
+			"expense": expense,
+			"income":  income,
+		})
+	}
+	out, err := json.Marshal(map[string]interface{}{"labels": labels, "tags": series})
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(out)
+}
+
+// FinanceTagReport - расходы и доходы по тегам помесячно: from, to,
+// currency (id валюты), tag (можно несколько)
+func (h *Handler) FinanceTagReport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	query := r.URL.Query()
+
+	columns, err := tagReportColumns(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	currency, err := h.tagReportCurrency(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rep, err := h.buildTagReport(userID, currency, columns, query["tag"])
+	if err != nil {
+		fmt.Printf("ERROR building tag report for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	commodities, _ := h.getCommodities()
+
+	data := h.pageData(userID, "reports")
+	data["Title"] = "Отчёт по тегам"
+	data["Report"] = rep
+	data["ChartJSON"] = rep.chartJSON()
+	data["From"] = columns[0].From.Format("2006-01-02")
+	data["To"] = columns[len(columns)-1].To.Format("2006-01-02")
+	data["Tags"] = query["tag"]
+	data["Commodities"] = commodities
+	h.renderTemplate(w, "finance_report_tags.html", data)
+}
+
+// APITagReport - отчёт по тегам в JSON; параметры те же, что у страницы
+func (h *Handler) APITagReport(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+	query := r.URL.Query()
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(code int, err error) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	columns, err := tagReportColumns(query)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	currency, err := h.tagReportCurrency(userID, query)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	rep, err := h.buildTagReport(userID, currency, columns, query["tag"])
+	if err != nil {
+		fmt.Printf("ERROR building tag report for user %d: %v\n", userID, err)
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+
+	rows := make([]map[string]interface{}, 0, len(rep.Rows))
+	for _, row := range rep.Rows {
+		rows = append(rows, map[string]interface{}{
+			"id":            row.Tag.ID,
+			"name":          row.Tag.Name,
+			"color":         row.Tag.Color,
+			"expense":       row.ExpenseTexts,
+			"income":        row.IncomeTexts,
+			"expense_total": row.ExpenseTotalText,
+			"income_total":  row.IncomeTotalText,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"currency":      currency.Mnemonic,
+		"columns":       reportColumnsJSON(rep.Columns),
+		"tags":          rows,
+		"missing_rates": rep.Missing,
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+)
+
+func TestTagReport(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	var usd int64
+	h.db.QueryRow("SELECT id FROM commodities WHERE mnemonic = 'USD'").Scan(&usd)
+
+	// Курсы в далёком прошлом, чтобы не пересекаться с настоящими: каждый
+	// месяц пересчитывается по курсу на свой конец
+	for _, r := range []struct{ date, rate string }{{"2000-01-10", "100"}, {"2000-02-10", "50"}} {
+		if _, err := h.db.Exec(`
+			INSERT INTO currency_rates (code, name, rate, source, rate_date) VALUES ('USD/RUB', 'Доллар', ?, 'cbr', ?)
+		`, r.rate, r.date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { h.db.Exec("DELETE FROM currency_rates WHERE rate_date < '2001-01-01'") })
+
+	day := func(month, d int) time.Time { return time.Date(2000, time.Month(month), d, 0, 0, 0, 0, time.UTC) }
+	insertTx(t, h, userID, day(1, 15), "Билеты", "отпуск,работа", [3]int64{food, 10000, 100}, [3]int64{card, -10000, 100})
+	insertTx(t, h, userID, day(2, 3), "Отель", "отпуск", [3]int64{food, 7000, 100}, [3]int64{card, -7000, 100})
+	insertTx(t, h, userID, day(2, 20), "Возврат за отель", "отпуск", [3]int64{food, -2000, 100}, [3]int64{card, 2000, 100})
+	insertTx(t, h, userID, day(2, 25), "Гонорар", "работа", [3]int64{card, 30000, 100}, [3]int64{salary, -30000, 100})
+	insertTx(t, h, userID, day(4, 1), "Вне периода", "отпуск", [3]int64{food, 100, 100}, [3]int64{card, -100, 100})
+	insertTx(t, h, userID, day(2, 1), "Перевод", "отпуск", [3]int64{card, 100, 100}, [3]int64{card, -100, 100})
+
+	type response struct {
+		Currency string
+		Columns  []map[string]string
+		Tags     []struct {
+			Name         string
+			Expense      []string
+			Income       []string
+			ExpenseTotal string `json:"expense_total"`
+			IncomeTotal  string `json:"income_total"`
+		}
+	}
+	get := func(query string) response {
+		t.Helper()
+		rec := doRequest(t, h, userID, h.APITagReport, "GET", "/api/v1/finance/reports/tags?"+query, nil, "", nil)
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	rows := func(resp response) string {
+		var out []string
+		for _, tag := range resp.Tags {
+			out = append(out, fmt.Sprintf("%s:%s=%s/%s=%s", tag.Name,
+				strings.Join(tag.Expense, ","), tag.ExpenseTotal, strings.Join(tag.Income, ","), tag.IncomeTotal))
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Транзакция с двумя тегами учитывается у обоих, возврат уменьшает расход,
+	// перевод между активами в отчёт не попадает
+	resp := get("from=2000-01-01&to=2000-03-31")
+	if resp.Currency != "RUB" || len(resp.Columns) != 3 || resp.Columns[1]["label"] != "Февраль 2000" {
+		t.Fatalf("unexpected header: %s %v", resp.Currency, resp.Columns)
+	}
+	want := "отпуск:100.00,50.00,0.00=150.00/0.00,0.00,0.00=0.00 работа:100.00,0.00,0.00=100.00/0.00,300.00,0.00=300.00"
+	if got := rows(resp); got != want {
+		t.Errorf("RUB report:\n%s\nexpected\n%s", got, want)
+	}
+
+	// В долларах январь идёт по 100, февраль — по 50
+	want = "отпуск:1.00,1.00=2.00/0.00,0.00=0.00 работа:1.00,0.00=1.00/0.00,6.00=6.00"
+	if got := rows(get(fmt.Sprintf("from=2000-01-01&to=2000-02-29&currency=%d", usd))); got != want {
+		t.Errorf("USD report:\n%s\nexpected\n%s", got, want)
+	}
+	if got := rows(get("from=2000-01-01&to=2000-01-31&tag=работа")); got != "работа:100.00=100.00/0.00=0.00" {
+		t.Errorf("tag filter: %s", got)
+	}
+	if got := rows(get("from=2000-01-01&to=2000-01-31&tag=РАБОТА&tag=нет-такого")); got != "работа:100.00=100.00/0.00=0.00" {
+		t.Errorf("tag filter ignoring case: %s", got)
+	}
+	if got := rows(get("from=2000-01-01&to=2000-01-31&tag=нет-такого")); got != "" {
+		t.Errorf("unknown tag must not mean all tags: %s", got)
+	}
+
+	// Итоги на странице тега — за весь период
+	totals, err := h.tagTotals(userID, &models.Tag{Name: "отпуск"}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals.Rows) != 1 || totals.Rows[0].ExpenseTotalText != "151.00" || totals.Rows[0].IncomeTotalText != "0.00" {
+		t.Errorf("tag totals: %+v", totals.Rows)
+	}
+
+	columns, err := tagReportColumns(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if len(columns) != tagReportMonths || columns[len(columns)-1].To.Month() != now.Month() || columns[0].From.Day() != 1 {
+		t.Errorf("default period: %d columns, %v – %v", len(columns), columns[0].From, columns[len(columns)-1].To)
+	}
+
+	for _, bad := range []string{"currency=x", "currency=999999", "from=2000-03-01&to=2000-01-01", "from=1990-01-01&to=2000-01-01"} {
+		rec := doRequest(t, h, userID, h.APITagReport, "GET", "/api/v1/finance/reports/tags?"+bad, nil, "", nil)
+		if rec.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+	other := createTestUser(t, h)
+	rec := doRequest(t, h, other, h.APITagReport, "GET", "/api/v1/finance/reports/tags?from=2000-01-01&to=2000-03-31", nil, "", nil)
+	if strings.Contains(rec.Body.String(), "отпуск") {
+		t.Errorf("foreign tags in report: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+)
+
+// reportColumn — колонка отчёта: период с From по To включительно.
+// Нулевой From — с начала книги (для балансовых отчётов на дату).
+type reportColumn struct {
+	Label string
+	From  time.Time
+	To    time.Time
+}
+
+// reportSectionSpec — какие типы счетов попадают в раздел отчёта.
+// Negate переворачивает знак для счетов, хранящихся в GnuCash отрицательными.
+type reportSectionSpec struct {
+	Title  string
+	Types  []string
+	Negate bool
+}
+
+// reportRow — счёт в отчёте: суммы по колонкам вместе с дочерними счетами
+// того же раздела, в валюте отчётности
+type reportRow struct {
+	Account *models.Account
+	Values  []models.Amount
+	Texts   []string
+}
+
+// reportSection — раздел отчёта со строками счетов и итогом по колонкам
+type reportSection struct {
+	Title      string
+	Rows       []*reportRow
+	Totals     []models.Amount
+	TotalTexts []string
+}
+
+// report — многоколоночный отчёт по дереву счетов. Суммы каждой колонки
+// пересчитываются в валюту отчётности по курсам на конец её периода.
+type report struct {
+	Currency *models.Commodity
+	Columns  []reportColumn
+	Sections []*reportSection
+	Missing  []string
+
+	places    int
+	accounts  []*models.Account
+	converted []map[int64]models.Amount // по колонкам: счёт → сумма в валюте отчётности
+}
+
+// buildReport считает суммы по колонкам и раскладывает счета по разделам.
+// Строки идут в порядке дерева счетов; счета с нулём во всех колонках
+// (вместе с дочерними) в отчёт не попадают.
+func (h *Handler) buildReport(userID int64, columns []reportColumn, specs []reportSectionSpec) (*report, error) {
+	currency, err := h.reportingCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mnemonics, err := h.commodityMnemonics()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report{
+		Currency:  currency,
+		Columns:   columns,
+		places:    money.Places(int64(currency.Fraction)),
+		accounts:  accounts,
+		converted: make([]map[int64]models.Amount, len(columns)),
+	}
+	if currency.Fraction <= 0 {
+		rep.places = 2
+	}
+
+	missing := make(map[string]bool)
+	for i, col := range columns {
+		sums, err := h.accountBalancesBetween(userID, col.From, col.To)
+		if err != nil {
+			return nil, err
+		}
+		book, err := h.loadRateBook(col.To)
+		if err != nil {
+			return nil, err
+		}
+		converter := newCurrencyConverter(book, currency.Mnemonic)
+
+		rep.converted[i] = make(map[int64]models.Amount, len(sums))
+		for _, account := range accounts {
+			sum := sums[account.ID]
+			if sum.IsZero() {
+				continue
+			}
+			mnemonic := mnemonics[account.CommodityID]
+			if mnemonic == "" {
+				mnemonic = "RUB"
+			}
+			if value, ok := converter.Convert(sum, mnemonic); ok {
+				rep.converted[i][account.ID] = value
+			}
+		}
+		for _, m := range converter.MissingCurrencies() {
+			missing[m] = true
+		}
+	}
+	for m := range missing {
+		rep.Missing = append(rep.Missing, m)
+	}
+	sort.Strings(rep.Missing)
+
+	for _, spec := range specs {
+		rep.Sections = append(rep.Sections, rep.section(spec))
+	}
+	return rep, nil
+}
+
+// commodityMnemonics возвращает коды всех валют по id
+func (h *Handler) commodityMnemonics() (map[int64]string, error) {
+	rows, err := h.db.Query("SELECT id, mnemonic FROM commodities")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mnemonics := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var mnemonic string
+		if err := rows.Scan(&id, &mnemonic); err != nil {
+			return nil, err
+		}
+		mnemonics[id] = mnemonic
+	}
+	return mnemonics, rows.Err()
+}
+
+// section собирает раздел отчёта: сумма каждого счёта добавляется к нему
+// и ко всем его предкам из того же раздела
+func (r *report) section(spec reportSectionSpec) *reportSection {
+	inSection := make(map[int64]bool)
+	for _, account := range r.accounts {
+		for _, t := range spec.Types {
+			if account.AccountType == t {
+				inSection[account.ID] = true
+			}
+		}
+	}
+	parents := make(map[int64]int64)
+	for _, account := range r.accounts {
+		if account.ParentID != nil {
+			parents[account.ID] = *account.ParentID
+		}
+	}
+
+	section := &reportSection{Title: spec.Title, Totals: make([]models.Amount, len(r.Columns))}
+	byID := make(map[int64]*reportRow)
+	for _, account := range r.accounts {
+		if inSection[account.ID] {
+			row := &reportRow{Account: account, Values: make([]models.Amount, len(r.Columns))}
+			byID[account.ID] = row
+		}
+	}
+	for i := range r.Columns {
+		for id, value := range r.converted[i] {
+			if !inSection[id] {
+				continue
+			}
+			if spec.Negate {
+				value = value.Neg()
+			}
+			section.Totals[i] = section.Totals[i].Add(value)
+			byID[id].Values[i] = byID[id].Values[i].Add(value)
+			// Ограничение глубины защищает от циклов в импортированных книгах
+			parent, ok := parents[id]
+			for depth := 0; ok && parent != id && depth < len(parents); depth++ {
+				if row := byID[parent]; row != nil {
+					row.Values[i] = row.Values[i].Add(value)
+				}
+				parent, ok = parents[parent]
+			}
+		}
+	}
+
+	for _, account := range r.accounts {
+		row := byID[account.ID]
+		if row == nil {
+			continue
+		}
+		nonZero := false
+		for _, v := range row.Values {
+			if !v.IsZero() {
+				nonZero = true
+			}
+		}
+		if nonZero {
+			row.Texts = r.formatAll(row.Values)
+			section.Rows = append(section.Rows, row)
+		}
+	}
+	section.TotalTexts = r.formatAll(section.Totals)
+	return section
+}
+
+// typeTotals возвращает по колонкам сумму счетов указанных типов без смены знака
+func (r *report) typeTotals(types ...string) []models.Amount {
+	totals := make([]models.Amount, len(r.Columns))
+	for _, account := range r.accounts {
+		for _, t := range types {
+			if account.AccountType != t {
+				continue
+			}
+			for i := range r.Columns {
+				totals[i] = totals[i].Add(r.converted[i][account.ID])
+			}
+		}
+	}
+	return totals
+}
+
+// format печатает сумму с числом знаков валюты отчётности
+func (r *report) format(a models.Amount) string {
+	return money.FormatRat(a.Rat(), r.places)
+}
+
+func (r *report) formatAll(values []models.Amount) []string {
+	texts := make([]string, len(values))
+	for i, v := range values {
+		texts[i] = r.format(v)
+	}
+	return texts
+}
+
+// sectionJSON — раздел отчёта для JSON API: суммы строками, без потери точности
+func (r *report) sectionJSON(section *reportSection) map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(section.Rows))
+	for _, row := range section.Rows {
+		rows = append(rows, map[string]interface{}{
+			"account_id":   row.Account.ID,
+			"name":         row.Account.Name,
+			"account_type": row.Account.AccountType,
+			"level":        row.Account.Level,
+			"placeholder":  row.Account.Placeholder == 1,
+			"values":       row.Texts,
+		})
+	}
+	return map[string]interface{}{
+		"title":  section.Title,
+		"rows":   rows,
+		"totals": section.TotalTexts,
+	}
+}
+
+// columnsJSON — колонки отчёта для JSON API
+func (r *report) columnsJSON() []map[string]string {
+	return reportColumnsJSON(r.Columns)
+}
+
+func reportColumnsJSON(reportColumns []reportColumn) []map[string]string {
+	columns := make([]map[string]string, 0, len(reportColumns))
+	for _, col := range reportColumns {
+		column := map[string]string{"label": col.Label, "to": col.To.Format("2006-01-02")}
+		if !col.From.IsZero() {
+			column["from"] = col.From.Format("2006-01-02")
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// monthNames — названия месяцев для подписей колонок
+var monthNames = [...]string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// isWholeMonths — период начинается первого числа и кончается последним днём месяца
+func isWholeMonths(from, to time.Time) bool {
+	return from.Day() == 1 && to.AddDate(0, 0, 1).Day() == 1
+}
+
+// periodLabel подписывает колонку: «Март 2026» для целого месяца,
+// иначе диапазон дат
+func periodLabel(from, to time.Time) string {
+	if isWholeMonths(from, to) && from.Year() == to.Year() && from.Month() == to.Month() {
+		return fmt.Sprintf("%s %d", monthNames[from.Month()-1], from.Year())
+	}
+	if from.IsZero() {
+		return "на " + to.Format("02.01.2006")
+	}
+	return from.Format("02.01.2006") + " – " + to.Format("02.01.2006")
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/schedule"
+)
+
+// scheduledOccurrences возвращает повторения для страницы обзора:
+// непросмотренные с последнего визита и все ждущие проведения напоминания
+func (h *Handler) scheduledOccurrences(userID int64) ([]map[string]interface{}, error) {
+	rows, err := h.db.Query(`
+		SELECT o.id, o.occurrence_date, o.status, o.tx_id, s.description,
+		       (SELECT MIN(ss.account_id) FROM scheduled_splits ss WHERE ss.scheduled_id = s.id)
+		FROM scheduled_occurrences o
+		JOIN scheduled_transactions s ON s.id = o.scheduled_id
+		WHERE o.user_id = ? AND (o.reviewed = 0 OR o.status = ?)
+		ORDER BY o.occurrence_date DESC, o.id DESC
+	`, userID, schedule.StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id int64
+		var date time.Time
+		var status, description string
+		var txID, accountID *int64
+		if err := rows.Scan(&id, &date, &status, &txID, &description, &accountID); err != nil {
+			return nil, err
+		}
+		occurrence := map[string]interface{}{
+			"id":          id,
+			"date":        date.Format("02.01.2006"),
+			"status":      status,
+			"description": description,
+			"tx_id":       int64(0),
+			"account_id":  int64(0),
+		}
+		if txID != nil {
+			occurrence["tx_id"] = *txID
+		}
+		if accountID != nil {
+			occurrence["account_id"] = *accountID
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences, rows.Err()
+}
+
+// FinanceScheduled - запланированные транзакции: что создано с последнего
+// просмотра, напоминания к проведению, список расписаний и форма нового
+func (h *Handler) FinanceScheduled(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	schedules, err := schedule.Load(h.db, userID)
+	if err != nil {
+		fmt.Printf("ERROR loading schedules: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	occurrences, err := h.scheduledOccurrences(userID)
+	if err != nil {
+		fmt.Printf("ERROR loading scheduled occurrences: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	today := time.Now()
+	list := make([]map[string]interface{}, 0, len(schedules))
+	for _, s := range schedules {
+		// Сумма шаблона — сумма зачислений, как «Сумма» транзакции
+		var amount int64
+		var denom int64 = 100
+		for _, sp := range s.Splits {
+			if sp.ValueNum > 0 {
+				amount += sp.ValueNum
+				denom = sp.ValueDenom
+			}
+		}
+		item := map[string]interface{}{
+			"id":          s.ID,
+			"description": s.Description,
+			"rule":        s.Rule.Describe(),
+			"mode":        s.Mode,
+			"enabled":     s.Enabled,
+			"amount":      money.Format(amount, denom, denom),
+			"next":        "",
+		}
+		if next, ok := s.Next(today); ok && s.Enabled {
+			item["next"] = next.Format("02.01.2006")
+		}
+		list = append(list, item)
+	}
+
+	accounts, _ := h.getAccounts(userID)
+
+	data := h.pageData(userID, "scheduled")
+	data["Title"] = "Запланированные транзакции"
+	data["Schedules"] = list
+	data["Occurrences"] = occurrences
+	data["Accounts"] = accounts
+	data["CurrencyID"] = h.formCurrencyID(userID, nil, 0)
+	data["Today"] = today.Format("2006-01-02")
+	h.renderTemplate(w, "finance_scheduled.html", data)
+}
+
+// parseSchedule читает расписание из формы: правило повторения, даты и
+// шаблон сплитов в тех же полях, что и у формы транзакции
+func (h *Handler) parseSchedule(r *http.Request, userID int64) (*schedule.Schedule, error) {
+	s := &schedule.Schedule{
+		UserID:      userID,
+		Description: r.FormValue("description"),
+		Tags:        r.FormValue("tags"),
+		Mode:        r.FormValue("mode"),
+		Enabled:     r.FormValue("enabled") != "0",
+	}
+	if s.Description == "" {
+		return nil, fmt.Errorf("Укажите описание")
+	}
+	if s.Mode != schedule.ModeRemind {
+		s.Mode = schedule.ModeAuto
+	}
+
+	var err error
+	if s.StartDate, err = time.Parse("2006-01-02", r.FormValue("start_date")); err != nil {
+		return nil, fmt.Errorf("Некорректная дата начала")
+	}
+	if endStr := r.FormValue("end_date"); endStr != "" {
+		endDate, err := time.Parse("2006-01-02", endStr)
+		if err != nil || endDate.Before(s.StartDate) {
+			return nil, fmt.Errorf("Некорректная дата окончания")
+		}
+		s.EndDate = &endDate
+	}
+	if countStr := r.FormValue("max_occurrences"); countStr != "" {
+		if s.MaxOccurrences, err = strconv.Atoi(countStr); err != nil || s.MaxOccurrences < 0 {
+			return nil, fmt.Errorf("Некорректное число повторений")
+		}
+	}
+
+	// Без явного дня — день даты начала
+	s.Rule = schedule.Rule{Kind: r.FormValue("rule"), Interval: 1}
+	switch s.Rule.Kind {
+	case schedule.RuleMonthly:
+		s.Rule.Day = s.StartDate.Day()
+	case schedule.RuleWeekly:
+		s.Rule.Day = int(s.StartDate.Weekday())
+	}
+	if dayStr := r.FormValue("rule_day"); dayStr != "" {
+		if s.Rule.Day, err = strconv.Atoi(dayStr); err != nil {
+			return nil, fmt.Errorf("Некорректный день повторения")
+		}
+	}
+	if intervalStr := r.FormValue("rule_interval"); intervalStr != "" {
+		if s.Rule.Interval, err = strconv.Atoi(intervalStr); err != nil {
+			return nil, fmt.Errorf("Некорректный интервал повторения")
+		}
+	}
+	if err := s.Rule.Validate(); err != nil {
+		return nil, fmt.Errorf("Правило повторения: %v", err)
+	}
+	return s, nil
+}
+
+// APIScheduledSave - создание или обновление запланированной транзакции
+func (h *Handler) APIScheduledSave(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	s, err := h.parseSchedule(r, userID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if idStr := r.FormValue("id"); idStr != "" && idStr != "0" {
+		if s.ID, err = strconv.ParseInt(idStr, 10, 64); err != nil {
+			fail("Некорректное расписание")
+			return
+		}
+	}
+
+	splits, err := parseTransactionSplits(r)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	refs := ownedRefs{Schedules: []int64{s.ID}}
+	for _, sp := range splits {
+		refs.Accounts = append(refs.Accounts, sp.AccountID)
+	}
+	if err := h.authorize(userID, refs); err != nil {
+		writeAuthzError(w, err, "Расписание или счёт не найдены")
+		return
+	}
+
+	for _, sp := range splits {
+		if h.isPlaceholderAccount(userID, sp.AccountID) {
+			fail("Контейнерный счёт не может участвовать в транзакции — выберите конечный счёт")
+			return
+		}
+	}
+	if s.CurrencyID, err = h.transactionCurrency(r, userID, splits); err == nil {
+		err = h.fillSplitQuantities(userID, s.CurrencyID, splits)
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	for _, sp := range splits {
+		s.Splits = append(s.Splits, schedule.Split{
+			AccountID:     sp.AccountID,
+			ValueNum:      sp.ValueNum,
+			ValueDenom:    sp.ValueDenom,
+			QuantityNum:   sp.QuantityNum,
+			QuantityDenom: sp.QuantityDenom,
+			Memo:          sp.Memo,
+			Action:        sp.Action,
+		})
+	}
+
+	id, err := schedule.Save(h.db, s)
+	if err != nil {
+		fmt.Printf("ERROR saving schedule: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     id,
+	})
+}
+
+// APIScheduledDelete - удаление расписания; созданные транзакции остаются
+func (h *Handler) APIScheduledDelete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := schedule.Delete(h.db, userID, id); err != nil {
+		if errors.Is(err, schedule.ErrNotFound) {
+			http.Error(w, "Schedule not found", http.StatusNotFound)
+			return
+		}
+		fmt.Printf("ERROR deleting schedule %d: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIScheduledRun - создаёт наступившие повторения расписаний пользователя,
+// не дожидаясь запуска cmd/schedule-runner
+func (h *Handler) APIScheduledRun(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	report, err := schedule.Run(h.db, userID, time.Now())
+	if err != nil {
+		fmt.Printf("ERROR running schedules for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	problems := make([]string, 0, len(report.Errors))
+	for _, e := range report.Errors {
+		problems = append(problems, e.Error())
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":    "ok",
+		"created":   report.Created,
+		"reminders": report.Reminders,
+		"errors":    problems,
+	})
+}
+
+// APIScheduledOccurrence - проведение (action=post) или пропуск (action=skip)
+// напоминания запланированной транзакции
+func (h *Handler) APIScheduledOccurrence(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	var txID int64
+	switch {
+	case err != nil:
+		err = schedule.ErrNotFound
+	case r.FormValue("action") == "skip":
+		err = schedule.Skip(h.db, userID, id)
+	default:
+		txID, err = schedule.Post(h.db, userID, id)
+	}
+
+	switch {
+	case errors.Is(err, schedule.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Напоминание не найдено"})
+	case errors.Is(err, schedule.ErrNotPending), errors.Is(err, schedule.ErrUnbalanced):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	case err != nil:
+		fmt.Printf("ERROR handling occurrence %d: %v\n", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": "ok",
+			"tx_id":  txID,
+		})
+	}
+}
+
+// APIScheduledReviewed - отмечает созданное по расписаниям просмотренным;
+// непроведённые напоминания остаются на странице
+func (h *Handler) APIScheduledReviewed(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := h.db.Exec("UPDATE scheduled_occurrences SET reviewed = 1 WHERE user_id = ? AND status <> ?",
+		userID, schedule.StatusPending)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/schedule"
+)
+
+// scheduleForm — форма расписания «Продукты с карты» на 19.99
+func scheduleForm(description, rule, start string, food, card int64) url.Values {
+	form := splitForm(description, [3]string{fmt.Sprint(food), "19.99", ""}, [3]string{fmt.Sprint(card), "-19.99", ""})
+	form.Del("post_date")
+	form.Set("rule", rule)
+	form.Set("start_date", start)
+	return form
+}
+
+// runSchedules запускает расписания пользователя на дату today
+func runSchedules(t *testing.T, h *Handler, userID int64, today string) *schedule.Report {
+	t.Helper()
+	d, _ := time.Parse("2006-01-02", today)
+	report, err := schedule.Run(h.db, userID, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range report.Errors {
+		t.Errorf("run error: %v", e)
+	}
+	return report
+}
+
+func TestScheduledAutoRunIsIdempotent(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	form := scheduleForm("Доставка", "monthly", "2026-01-31", food, card)
+	form.Set("max_occurrences", "4")
+	code, resp := postJSON(t, h, userID, h.APIScheduledSave, form)
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+
+	if report := runSchedules(t, h, userID, "2026-03-15"); report.Created != 2 {
+		t.Errorf("first run created %d, expected 2", report.Created)
+	}
+	if report := runSchedules(t, h, userID, "2026-03-15"); report.Created != 0 {
+		t.Errorf("second run created %d, expected 0", report.Created)
+	}
+	var dates []string
+	rows, _ := h.db.Query("SELECT post_date FROM transactions WHERE user_id = ? ORDER BY post_date", userID)
+	for rows.Next() {
+		var d time.Time
+		rows.Scan(&d)
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	rows.Close()
+	if fmt.Sprint(dates) != "[2026-01-31 2026-02-28]" {
+		t.Errorf("unexpected transaction dates %v", dates)
+	}
+	if got := bookBalances(t, h, userID)["Расходы:Продукты"]; got != "1999/50" {
+		t.Errorf("food balance = %s, expected 39.98", got)
+	}
+
+	// Удалённая транзакция не создаётся заново
+	var txID int64
+	h.db.QueryRow("SELECT id FROM transactions WHERE user_id = ? ORDER BY post_date LIMIT 1", userID).Scan(&txID)
+	h.db.Exec("DELETE FROM splits WHERE tx_id = ?", txID)
+	h.db.Exec("DELETE FROM transactions WHERE id = ?", txID)
+	// ON DELETE SET NULL — на случай тестовой БД без внешних ключей
+	h.db.Exec("UPDATE scheduled_occurrences SET tx_id = NULL WHERE tx_id = ?", txID)
+
+	// MaxOccurrences = 4: к 30 июня добавляются только март и апрель
+	if report := runSchedules(t, h, userID, "2026-06-30"); report.Created != 2 {
+		t.Errorf("run after deletion created %d, expected 2", report.Created)
+	}
+	if n := countRows(t, h, "transactions", userID); n != 3 {
+		t.Errorf("expected 3 transactions, got %d", n)
+	}
+}
+
+func TestScheduledRemindPostAndSkip(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	form := scheduleForm("Рынок", "weekly", "2026-03-02", food, card)
+	form.Set("mode", "remind")
+	form.Set("end_date", "2026-03-09")
+	if code, resp := postJSON(t, h, userID, h.APIScheduledSave, form); code != 200 {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+
+	if report := runSchedules(t, h, userID, "2026-03-31"); report.Reminders != 2 || report.Created != 0 {
+		t.Fatalf("expected 2 reminders, got %+v", report)
+	}
+	if n := countRows(t, h, "transactions", userID); n != 0 {
+		t.Fatalf("remind mode created %d transactions", n)
+	}
+
+	occurrences, err := h.scheduledOccurrences(userID)
+	if err != nil || len(occurrences) != 2 {
+		t.Fatalf("expected 2 pending occurrences, got %v %v", occurrences, err)
+	}
+	first := fmt.Sprint(occurrences[0]["id"])
+	second := fmt.Sprint(occurrences[1]["id"])
+
+	post := url.Values{"id": {first}, "action": {"post"}}
+	if code, resp := postJSON(t, h, userID, h.APIScheduledOccurrence, post); code != 200 || resp["tx_id"] == float64(0) {
+		t.Fatalf("post failed: %d %v", code, resp)
+	}
+	if code, _ := postJSON(t, h, userID, h.APIScheduledOccurrence, post); code != 400 {
+		t.Errorf("second post: expected 400, got %d", code)
+	}
+	if code, _ := postJSON(t, h, userID, h.APIScheduledOccurrence, url.Values{"id": {second}, "action": {"skip"}}); code != 200 {
+		t.Errorf("skip: expected 200, got %d", code)
+	}
+	if n := countRows(t, h, "transactions", userID); n != 1 {
+		t.Errorf("expected 1 transaction, got %d", n)
+	}
+
+	// Чужое напоминание не найдено
+	other := createTestUser(t, h)
+	if code, _ := postJSON(t, h, other, h.APIScheduledOccurrence, url.Values{"id": {second}, "action": {"skip"}}); code != 404 {
+		t.Errorf("foreign occurrence: expected 404, got %d", code)
+	}
+
+	// «Отметить просмотренным» убирает обработанные повторения со страницы
+	if code, _ := postJSON(t, h, userID, h.APIScheduledReviewed, url.Values{}); code != 200 {
+		t.Fatalf("reviewed failed: %d", code)
+	}
+	if occurrences, _ := h.scheduledOccurrences(userID); len(occurrences) != 0 {
+		t.Errorf("expected no occurrences after review, got %v", occurrences)
+	}
+	if report := runSchedules(t, h, userID, "2026-03-31"); report.Reminders != 0 {
+		t.Errorf("rerun created %d reminders", report.Reminders)
+	}
+}
+
+func TestScheduledSaveRejects(t *testing.T) {
+	h := testHandler(t)
+	owner := createTestUser(t, h)
+	userID := createTestUser(t, h)
+	for _, id := range []int64{owner, userID} {
+		if err := h.createBaseAccounts(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	ownerFood := accountIDByName(t, h, owner, "Продукты")
+
+	code, resp := postJSON(t, h, owner, h.APIScheduledSave, scheduleForm("Чужое", "monthly", "2026-01-01", ownerFood,
+		accountIDByName(t, h, owner, "Расчетный счет")))
+	if code != 200 {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+	ownerSchedule := fmt.Sprint(int64(resp["id"].(float64)))
+
+	badDay := scheduleForm("x", "monthly", "2026-01-01", food, card)
+	badDay.Set("rule_day", "32")
+	badEnd := scheduleForm("x", "days", "2026-01-01", food, card)
+	badEnd.Set("end_date", "2025-12-31")
+	foreignSchedule := scheduleForm("x", "days", "2026-01-01", food, card)
+	foreignSchedule.Set("id", ownerSchedule)
+
+	tests := []struct {
+		name string
+		form url.Values
+		code int
+	}{
+		{"foreign account", scheduleForm("x", "monthly", "2026-01-01", ownerFood, card), http.StatusNotFound},
+		{"foreign schedule", foreignSchedule, http.StatusNotFound},
+		{"unknown rule", scheduleForm("x", "yearly", "2026-01-01", food, card), http.StatusBadRequest},
+		{"bad day", badDay, http.StatusBadRequest},
+		{"end before start", badEnd, http.StatusBadRequest},
+		{"unbalanced", func() url.Values {
+			f := scheduleForm("x", "days", "2026-01-01", food, card)
+			f["split_value"] = []string{"10", "-9"}
+			return f
+		}(), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code, resp := postJSON(t, h, userID, h.APIScheduledSave, tt.form); code != tt.code {
+			t.Errorf("%s: expected %d, got %d %v", tt.name, tt.code, code, resp)
+		}
+	}
+	if n := countRows(t, h, "scheduled_transactions", userID); n != 0 {
+		t.Errorf("rejected saves created %d schedules", n)
+	}
+
+	rec := doRequest(t, h, userID, h.APIScheduledDelete, http.MethodDelete, "/?id="+ownerSchedule, nil, "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("foreign delete: expected 404, got %d", rec.Code)
+	}
+	rec = doRequest(t, h, owner, h.APIScheduledDelete, http.MethodDelete, "/?id="+ownerSchedule, nil, "", nil)
+	if rec.Code != http.StatusNoContent || countRows(t, h, "scheduled_splits", owner) != 0 {
+		t.Errorf("delete: expected 204 and no template splits, got %d", rec.Code)
+	}
+}
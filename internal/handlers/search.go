@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// maxSearchPageSize ограничивает параметр limit поиска транзакций
+const maxSearchPageSize = 500
+
+// parseSearch разбирает параметры поиска по книге и размер страницы limit
+// (по умолчанию registerPageSize). Счёт account раскрывается вместе с
+// дочерними; чужой счёт — ошибка errNotOwned.
+func (h *Handler) parseSearch(userID int64, query url.Values) (transactionFilter, int, error) {
+	now := time.Now()
+	f, err := parseTransactionFilter(query, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return f, 0, err
+	}
+	limit := registerPageSize
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxSearchPageSize {
+			return f, 0, fmt.Errorf("limit должен быть от 1 до %d", maxSearchPageSize)
+		}
+	}
+	if f.Account != 0 {
+		if err := h.authorize(userID, ownedRefs{Accounts: []int64{f.Account}}); err != nil {
+			return f, 0, err
+		}
+		if f.Accounts, err = h.subtreeAccounts(userID, f.Account); err != nil {
+			return f, 0, err
+		}
+	}
+	return f, limit, nil
+}
+
+// subtreeAccounts возвращает счёт и всех его потомков
+func (h *Handler) subtreeAccounts(userID, accountID int64) ([]int64, error) {
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{accountID}
+	inTree := map[int64]bool{accountID: true}
+	// getAccounts отдаёт дерево в порядке обхода: родитель раньше детей
+	for _, a := range accounts {
+		if a.ParentID != nil && inTree[*a.ParentID] {
+			inTree[a.ID] = true
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids, nil
+}
+
+// searchTransactions возвращает страницу найденных транзакций. Сумма строки —
+// движение по счетам поиска в валюте транзакции, а без счёта — сумма
+// транзакции (всё, что зачислено на её счета).
+func (h *Handler) searchTransactions(userID int64, f transactionFilter, limit int) (*transactionPage, error) {
+	page := &transactionPage{Rows: []map[string]interface{}{}}
+	ids, _, err := h.pageTransactions(userID, f, limit, page)
+	if err != nil || len(ids) == 0 {
+		return page, err
+	}
+
+	anchors := make(map[int64]bool)
+	for _, id := range f.Accounts {
+		anchors[id] = true
+	}
+
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := h.db.Query(`
+		SELECT t.id, t.description, t.post_date, `+tags.Column+`, COALESCE(c.mnemonic, ''),
+		       COALESCE(c.fraction, 100), s.account_id, COALESCE(a.name, ''), s.value_num, s.value_denom,
+		       s.quantity_num, s.quantity_denom, s.memo
+		FROM transactions t
+		LEFT JOIN commodities c ON c.id = t.currency_id
+		JOIN splits s ON s.tx_id = t.id
+		LEFT JOIN accounts a ON a.id = s.account_id
+		WHERE t.user_id = ? AND t.id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+`)
+		ORDER BY s.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]map[string]interface{})
+	totals := make(map[int64]models.Amount)
+	changes := make(map[int64]models.Amount)
+	places := make(map[int64]int)
+	for rows.Next() {
+		var txID, fraction, accountID, valueNum, valueDenom, quantityNum, quantityDenom int64
+		var description, tagList, currency, accountName, memo string
+		var postDate time.Time
+		if err := rows.Scan(&txID, &description, &postDate, &tagList, &currency, &fraction, &accountID, &accountName,
+			&valueNum, &valueDenom, &quantityNum, &quantityDenom, &memo); err != nil {
+			return nil, err
+		}
+
+		tx, exists := byID[txID]
+		if !exists {
+			tx = map[string]interface{}{
+				"id":          txID,
+				"description": description,
+				"post_date":   postDate.Format("02.01.2006"),
+				"date":        postDate.Format("2006-01-02"),
+				"tags":        tags.Parse(tagList),
+				"currency":    currency,
+				"splits":      []map[string]interface{}{},
+			}
+			byID[txID] = tx
+			places[txID] = money.Places(fraction)
+		}
+
+		value := models.NewAmount(valueNum, valueDenom)
+		if value.Sign() > 0 {
+			totals[txID] = totals[txID].Add(value)
+		}
+		if anchors[accountID] {
+			changes[txID] = changes[txID].Add(value)
+		}
+		tx["splits"] = append(tx["splits"].([]map[string]interface{}), map[string]interface{}{
+			"account_id":   accountID,
+			"account_name": accountName,
+			"value":        money.Format(valueNum, valueDenom, valueDenom),
+			"quantity":     money.Format(quantityNum, quantityDenom, quantityDenom),
+			"memo":         memo,
+			"anchor":       anchors[accountID],
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		tx := byID[id]
+		amount := totals[id]
+		if len(anchors) > 0 {
+			// Знак — зачисление на счета поиска или списание с них
+			amount = changes[id]
+		}
+		// Суммы — точные десятичные строки с числом знаков валюты транзакции
+		tx["amount"] = money.FormatRat(amount.Rat(), places[id])
+		tx["amount_abs"] = money.FormatRat(new(big.Rat).Abs(amount.Rat()), places[id])
+		tx["sign"] = amount.Sign()
+		page.Rows = append(page.Rows, tx)
+	}
+	return page, nil
+}
+
+// searchMoreURL — адрес следующей страницы поиска; пустой, если её нет
+func searchMoreURL(f transactionFilter, page *transactionPage) string {
+	if page.NextCursor == 0 {
+		return ""
+	}
+	return "/api/v1/finance/transactions/table?" +
+		f.Query("sort", f.Sort, "cursor", strconv.FormatInt(page.NextCursor, 10))
+}
+
+// FinanceTransactionSearch - поиск транзакций по всей книге
+func (h *Handler) FinanceTransactionSearch(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	filter, limit, err := h.parseSearch(userID, r.URL.Query())
+	if errors.Is(err, errNotOwned) {
+		http.Error(w, "Счёт не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Без условий поиска показываем только форму
+	page := &transactionPage{}
+	var found int
+	if filter.HasFilters() || filter.Period() != "all" {
+		page, err = h.searchTransactions(userID, filter, limit)
+		if errors.Is(err, errStaleCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fmt.Printf("ERROR searching transactions for user %d: %v\n", userID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if found, err = h.countTransactions(userID, filter); err != nil {
+			fmt.Printf("ERROR counting found transactions for user %d: %v\n", userID, err)
+		}
+	}
+	accounts, _ := h.getAccounts(userID)
+	commodities, _ := h.getCommodities()
+
+	data := h.pageData(userID, "search")
+	data["Title"] = "Поиск транзакций"
+	data["Filter"] = filter
+	data["Searched"] = filter.HasFilters() || filter.Period() != "all"
+	data["Found"] = found
+	data["Transactions"] = page.Rows
+	data["PrevDate"] = page.PrevDate
+	data["MoreURL"] = searchMoreURL(filter, page)
+	data["Account"] = map[string]interface{}{"ID": filter.Account}
+	data["Search"] = true
+	data["Accounts"] = accounts
+	data["Commodities"] = commodities
+	data["TagColors"] = h.tagColors(userID)
+	h.renderTemplate(w, "finance_search.html", data)
+}
+
+// APITransactionSearchTableGet - HTML-строки следующей страницы поиска
+func (h *Handler) APITransactionSearchTableGet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	filter, limit, err := h.parseSearch(userID, r.URL.Query())
+	if errors.Is(err, errNotOwned) {
+		http.Error(w, "Счёт не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.searchTransactions(userID, filter, limit)
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR searching transactions for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Transactions": page.Rows,
+		"PrevDate":     page.PrevDate,
+		"MoreURL":      searchMoreURL(filter, page),
+		"Account":      map[string]interface{}{"ID": filter.Account},
+		"Search":       true,
+		"TagColors":    h.tagColors(userID),
+	}
+	h.renderTemplate(w, "finance_transactions_tbody.html", data)
+}
+
+// APITransactionsGet - поиск транзакций по всей книге (API):
+// GET /api/v1/finance/transactions/get?q=&amount=&min=&max=&from=&to=&account=&tag=&commodity=&sort=&cursor=&limit=.
+// Счёт account ищется вместе с дочерними; суммы и валюта относятся к одному
+// сплиту транзакции. Следующая страница — с cursor=next_cursor, 0 — страниц больше нет.
+func (h *Handler) APITransactionsGet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	filter, limit, err := h.parseSearch(userID, r.URL.Query())
+	if errors.Is(err, errNotOwned) {
+		writeAuthzError(w, err, "Счёт не найден")
+		return
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	page, err := h.searchTransactions(userID, filter, limit)
+	if errors.Is(err, errStaleCursor) {
+		fail(err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR searching transactions for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	transactions := make([]map[string]interface{}, 0, len(page.Rows))
+	for _, tx := range page.Rows {
+		splits := make([]map[string]interface{}, 0)
+		for _, s := range tx["splits"].([]map[string]interface{}) {
+			splits = append(splits, map[string]interface{}{
+				"account_id":   s["account_id"],
+				"account_name": s["account_name"],
+				"value":        s["value"],
+				"quantity":     s["quantity"],
+				"memo":         s["memo"],
+			})
+		}
+		tagList := tx["tags"].([]string)
+		if tagList == nil {
+			tagList = []string{}
+		}
+		transactions = append(transactions, map[string]interface{}{
+			"id":          tx["id"],
+			"date":        tx["date"],
+			"description": tx["description"],
+			"tags":        tagList,
+			"currency":    tx["currency"],
+			"amount":      tx["amount"],
+			"splits":      splits,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"transactions": transactions,
+		"next_cursor":  page.NextCursor,
+	})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPITransactionsGet(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	cash := accountIDByName(t, h, userID, "Наличные")
+	salary := accountIDByName(t, h, userID, "Зарплата")
+	food := accountIDByName(t, h, userID, "Продукты")
+	current := accountIDByName(t, h, userID, "Текущие активы")
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	insertTx(t, h, userID, day(1), "Зарплата", "",
+		[3]int64{card, 500000, 100}, [3]int64{salary, -500000, 100})
+	insertTx(t, h, userID, day(2), "Кофе", "еда,кафе",
+		[3]int64{food, 25000, 100}, [3]int64{card, -25000, 100})
+	insertTx(t, h, userID, day(3), "Снятие", "",
+		[3]int64{cash, 100000, 100}, [3]int64{card, -100000, 100})
+	insertTx(t, h, userID, day(4), "Кофе наличными", "кафе",
+		[3]int64{food, 15000, 100}, [3]int64{cash, -15000, 100})
+
+	type response struct {
+		Transactions []struct {
+			ID          int64    `json:"id"`
+			Date        string   `json:"date"`
+			Description string   `json:"description"`
+			Tags        []string `json:"tags"`
+			Amount      string   `json:"amount"`
+			Splits      []struct {
+				AccountID int64  `json:"account_id"`
+				Value     string `json:"value"`
+				Quantity  string `json:"quantity"`
+			} `json:"splits"`
+		} `json:"transactions"`
+		NextCursor int64 `json:"next_cursor"`
+	}
+	search := func(query string) response {
+		t.Helper()
+		rec := doRequest(t, h, userID, h.APITransactionsGet, "GET", "/api/v1/finance/transactions/get?"+query, nil, "", nil)
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	found := func(resp response) string {
+		var out []string
+		for _, tx := range resp.Transactions {
+			out = append(out, tx.Description+"="+tx.Amount)
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Без счёта сумма — вся транзакция, со счётом — движение по его поддереву
+	tests := []struct{ query, want string }{
+		{"q=кофе", "Кофе наличными=150.00 Кофе=250.00"},
+		{"amount=250", "Кофе=250.00"},
+		{"min=200&max=1000", "Снятие=1000.00 Кофе=250.00"},
+		{"from=2026-03-02&to=2026-03-03&sort=asc", "Кофе=250.00 Снятие=1000.00"},
+		{"tag=кафе&tag=еда", "Кофе=250.00"},
+		{fmt.Sprintf("account=%d", cash), "Кофе наличными=-150.00 Снятие=1000.00"},
+		{fmt.Sprintf("account=%d&q=кофе", current), "Кофе наличными=-150.00 Кофе=-250.00"},
+		{"commodity=1&q=Зарплата", "Зарплата=5000.00"},
+		{"commodity=2", ""},
+	}
+	for _, tt := range tests {
+		if got := found(search(tt.query)); got != tt.want {
+			t.Errorf("%s: %s, expected %s", tt.query, got, tt.want)
+		}
+	}
+
+	resp := search("q=Кофе&limit=1")
+	tx := resp.Transactions[0]
+	if tx.Date != "2026-03-04" || len(tx.Tags) != 1 || tx.Tags[0] != "кафе" || len(tx.Splits) != 2 || resp.NextCursor == 0 {
+		t.Fatalf("first page: %+v", resp)
+	}
+	if tx.Amount != "150.00" || tx.Splits[0].Value != "150.00" || tx.Splits[1].Quantity != "-150.00" {
+		t.Errorf("exact amounts: %+v", tx)
+	}
+	resp = search(fmt.Sprintf("q=Кофе&limit=1&cursor=%d", resp.NextCursor))
+	if got := found(resp); got != "Кофе=250.00" || resp.NextCursor != 0 {
+		t.Errorf("last page: %s, cursor %d", got, resp.NextCursor)
+	}
+	if tags := search("q=Снятие").Transactions[0].Tags; tags == nil || len(tags) != 0 {
+		t.Errorf("empty tags: %v", tags)
+	}
+
+	for _, bad := range []string{"limit=0", "limit=501", "amount=x", "cursor=999999", "commodity=x"} {
+		rec := doRequest(t, h, userID, h.APITransactionsGet, "GET", "/api/v1/finance/transactions/get?"+bad, nil, "", nil)
+		if rec.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+	other := createTestUser(t, h)
+	rec := doRequest(t, h, other, h.APITransactionsGet, "GET",
+		fmt.Sprintf("/api/v1/finance/transactions/get?account=%d", card), nil, "", nil)
+	if rec.Code != 404 {
+		t.Errorf("foreign account: expected 404, got %d", rec.Code)
+	}
+	if got := len(search("").Transactions); got != 4 {
+		t.Errorf("empty search: %d transactions", got)
+	}
+
+	// Символы шаблона LIKE в запросе — обычные символы
+	insertTx(t, h, userID, day(5), "Скидка 10%", "",
+		[3]int64{food, -1000, 100}, [3]int64{card, 1000, 100})
+	for query, want := range map[string]string{"q=0%25": "Скидка 10%=10.00", "q=%25": "Скидка 10%=10.00", "q=_": ""} {
+		if got := found(search(query)); got != want {
+			t.Errorf("%s: %s, expected %s", query, got, want)
+		}
+	}
+}
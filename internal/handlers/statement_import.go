@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/networth"
+)
+
+// statementLine — операция банковской выписки, готовая к проводке: сумма
+// в валюте счёта выписки (плюс — зачисление) и счёт второй стороны
+type statementLine struct {
+	Line        int // строка или номер операции в файле — по нему операцию исключают из импорта
+	Date        time.Time
+	Num         int64 // знаменатель — fraction валюты счёта выписки
+	Description string
+	Memo        string // комментарий сплита счёта выписки
+	Category    string
+	Counterpart *models.Account
+
+	FITID    string // идентификатор операции в банке, если выписка его даёт
+	Imported bool   // операция с этим FITID уже проведена на счёт
+}
+
+// statementImport — счёт выписки и счета второй стороны для её операций
+type statementImport struct {
+	Account     *models.Account
+	Fraction    int64
+	Counterpart *models.Account // для операций без подходящей категории
+
+	categories map[string]*models.Account // имя счёта в нижнем регистре → счёт
+}
+
+// newStatementImport проверяет счёт выписки и счёт второй стороны: оба не
+// контейнерные, в одной валюте. Категории выписки сопоставляются со счетами
+// доходов и расходов в той же валюте по имени без учёта регистра.
+// Принадлежность счетов пользователю проверяет вызывающий через authorize.
+func (h *Handler) newStatementImport(userID, accountID, counterpartID int64) (*statementImport, error) {
+	if accountID == 0 {
+		return nil, errors.New("Выберите счёт выписки")
+	}
+	if counterpartID == 0 {
+		return nil, errors.New("Выберите счёт для операций без категории")
+	}
+	if accountID == counterpartID {
+		return nil, errors.New("Счёт выписки и счёт для операций без категории совпадают")
+	}
+	accounts, err := h.getAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := &statementImport{categories: make(map[string]*models.Account)}
+	for _, a := range accounts {
+		switch a.ID {
+		case accountID:
+			imp.Account = a
+		case counterpartID:
+			imp.Counterpart = a
+		}
+	}
+	if imp.Account == nil || imp.Counterpart == nil {
+		return nil, errNotOwned
+	}
+	if imp.Account.Placeholder == 1 || imp.Counterpart.Placeholder == 1 {
+		return nil, errors.New("В контейнерный счёт проводить операции нельзя")
+	}
+	if imp.Counterpart.CommodityID != imp.Account.CommodityID {
+		return nil, errors.New("Счёт для операций без категории в другой валюте")
+	}
+	if imp.Fraction, err = h.commodityFraction(imp.Account.CommodityID); err != nil {
+		return nil, err
+	}
+
+	for _, a := range accounts {
+		if a.Placeholder == 1 || a.ID == accountID || a.CommodityID != imp.Account.CommodityID ||
+			(a.AccountType != models.AccountTypeIncome && a.AccountType != models.AccountTypeExpense) {
+			continue
+		}
+		key := strings.ToLower(a.Name)
+		if imp.categories[key] == nil {
+			imp.categories[key] = a
+		}
+	}
+	return imp, nil
+}
+
+// line переводит сумму num/denom в валюту счёта выписки и выбирает счёт
+// второй стороны по категории
+func (imp *statementImport) line(line int, date time.Time, num, denom int64, description, category string) (statementLine, error) {
+	quantity, err := money.Rescale(num, denom, imp.Fraction)
+	if err != nil {
+		return statementLine{}, fmt.Errorf("Строка %d: %v", line, err)
+	}
+	counterpart := imp.categories[strings.ToLower(strings.TrimSpace(category))]
+	if counterpart == nil {
+		counterpart = imp.Counterpart
+	}
+	return statementLine{
+		Line:        line,
+		Date:        date,
+		Num:         quantity,
+		Description: description,
+		Category:    category,
+		Counterpart: counterpart,
+	}, nil
+}
+
+// selectStatementLines убирает операции, перечисленные в skip формы
+func selectStatementLines(r *http.Request, lines []statementLine) ([]statementLine, error) {
+	skip := make(map[int]bool)
+	for _, s := range r.Form["skip"] {
+		line, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("Некорректный номер строки")
+		}
+		skip[line] = true
+	}
+	var selected []statementLine
+	for _, l := range lines {
+		if !skip[l.Line] {
+			selected = append(selected, l)
+		}
+	}
+	return selected, nil
+}
+
+// markImported отмечает операции, FITID которых уже проведены на счёт
+func (h *Handler) markImported(userID int64, imp *statementImport, lines []statementLine) error {
+	var fitids []interface{}
+	for _, l := range lines {
+		if l.FITID != "" {
+			fitids = append(fitids, l.FITID)
+		}
+	}
+	if len(fitids) == 0 {
+		return nil
+	}
+	rows, err := h.db.Query(`
+		SELECT fitid FROM statement_fitids
+		WHERE user_id = ? AND account_id = ? AND fitid IN (`+strings.TrimSuffix(strings.Repeat("?,", len(fitids)), ",")+`)
+	`, append([]interface{}{userID, imp.Account.ID}, fitids...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool)
+	for rows.Next() {
+		var fitid string
+		if err := rows.Scan(&fitid); err != nil {
+			return err
+		}
+		known[fitid] = true
+	}
+	for i := range lines {
+		lines[i].Imported = lines[i].FITID != "" && known[lines[i].FITID]
+	}
+	return rows.Err()
+}
+
+// statementDuplicates отмечает операции, которые уже есть на счёте: та же
+// дата и та же сумма. Каждая проводка счёта покрывает не больше одной
+// операции, поэтому две одинаковые покупки за день при одной записи в книге
+// дают один повтор. Операции, уже импортированные по FITID, — повторы
+// всегда и сопоставляются со своими проводками первыми.
+func (h *Handler) statementDuplicates(userID int64, imp *statementImport, lines []statementLine) ([]bool, error) {
+	duplicates := make([]bool, len(lines))
+	if len(lines) == 0 {
+		return duplicates, nil
+	}
+	from, to := lines[0].Date, lines[0].Date
+	for _, l := range lines {
+		if l.Date.Before(from) {
+			from = l.Date
+		}
+		if l.Date.After(to) {
+			to = l.Date
+		}
+	}
+
+	rows, err := h.db.Query(`
+		SELECT t.post_date, s.quantity_num, s.quantity_denom
+		FROM splits s
+		JOIN transactions t ON t.id = s.tx_id
+		WHERE s.user_id = ? AND s.account_id = ? AND t.post_date >= ? AND t.post_date < ?
+	`, userID, imp.Account.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	key := func(date time.Time, amount *big.Rat) string {
+		return date.Format("2006-01-02") + " " + amount.RatString()
+	}
+	existing := make(map[string]int)
+	for rows.Next() {
+		var postDate time.Time
+		var num, denom int64
+		if err := rows.Scan(&postDate, &num, &denom); err != nil {
+			return nil, err
+		}
+		if denom == 0 {
+			continue
+		}
+		existing[key(postDate, big.NewRat(num, denom))]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, imported := range []bool{true, false} {
+		for i, l := range lines {
+			if l.Imported != imported {
+				continue
+			}
+			k := key(l.Date, big.NewRat(l.Num, imp.Fraction))
+			if existing[k] > 0 {
+				existing[k]--
+				duplicates[i] = true
+			}
+			duplicates[i] = duplicates[i] || l.Imported
+		}
+	}
+	return duplicates, nil
+}
+
+// linesJSON — операции выписки для предпросмотра
+func (imp *statementImport) linesJSON(lines []statementLine, duplicates []bool) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(lines))
+	for i, l := range lines {
+		result = append(result, map[string]interface{}{
+			"line":           l.Line,
+			"date":           l.Date.Format("2006-01-02"),
+			"amount":         money.Format(l.Num, imp.Fraction, imp.Fraction),
+			"description":    l.Description,
+			"memo":           l.Memo,
+			"category":       l.Category,
+			"counterpart_id": l.Counterpart.ID,
+			"counterpart":    l.Counterpart.Name,
+			"duplicate":      duplicates[i],
+			"fitid":          l.FITID,
+			"imported":       l.Imported,
+		})
+	}
+	return result
+}
+
+// postStatement проводит операции выписки одной транзакцией БД: по
+// транзакции на операцию, сплит счёта выписки отмечается подтверждённым
+// банком. Операции с FITID, уже проведённым на счёт, пропускаются — так
+// пересекающиеся выписки не создают дублей. Возвращает id созданных транзакций.
+func (h *Handler) postStatement(userID int64, imp *statementImport, lines []statementLine) ([]int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	var from time.Time
+	for _, l := range lines {
+		if l.FITID != "" {
+			var known int
+			err := tx.QueryRow("SELECT COUNT(*) FROM statement_fitids WHERE account_id = ? AND fitid = ?",
+				imp.Account.ID, l.FITID).Scan(&known)
+			if err != nil {
+				return nil, err
+			}
+			if known > 0 {
+				continue
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description)
+			VALUES (?, ?, ?, ?, ?)
+		`, userID, imp.Account.CommodityID, l.Date, time.Now(), l.Description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transaction: %w", err)
+		}
+		txID, _ := result.LastInsertId()
+
+		for _, s := range []struct {
+			accountID int64
+			num       int64
+			memo      string
+			state     string
+		}{
+			{imp.Account.ID, l.Num, l.Memo, models.ReconcileCleared},
+			{l.Counterpart.ID, -l.Num, "", models.ReconcileNew},
+		} {
+			_, err := tx.Exec(`
+				INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom,
+				                    quantity_num, quantity_denom, memo, reconcile_state)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, txID, s.accountID, s.num, imp.Fraction, s.num, imp.Fraction, s.memo, s.state)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create split: %w", err)
+			}
+		}
+		if l.FITID != "" {
+			_, err := tx.Exec("INSERT INTO statement_fitids (account_id, fitid, user_id, tx_id) VALUES (?, ?, ?, ?)",
+				imp.Account.ID, l.FITID, userID, txID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to save FITID: %w", err)
+			}
+		}
+		ids = append(ids, txID)
+		if from.IsZero() || l.Date.Before(from) {
+			from = l.Date
+		}
+	}
+
+	if len(ids) > 0 {
+		if err := networth.Invalidate(tx, userID, from); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/tags"
+	"github.com/gorilla/mux"
+)
+
+// tagColorPattern — цвет тега в форме #rrggbb
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// tagSuggestLimit — сколько тегов подсказывать в поле ввода
+const tagSuggestLimit = 10
+
+// getTags возвращает теги пользователя с числом транзакций. С префиксом prefix —
+// только подходящие, самые используемые первыми (для подсказок); без него — все по имени.
+func (h *Handler) getTags(userID int64, prefix string) ([]*models.Tag, error) {
+	query := `
+		SELECT tg.id, tg.name, tg.color, COUNT(tt.tx_id)
+		FROM tags tg
+		LEFT JOIN transaction_tags tt ON tt.tag_id = tg.id
+		WHERE tg.user_id = ?`
+	args := []interface{}{userID}
+	if prefix != "" {
+		query += ` AND tg.name LIKE ? ESCAPE '\\'
+		GROUP BY tg.id, tg.name, tg.color
+		ORDER BY COUNT(tt.tx_id) DESC, tg.name
+		LIMIT ` + strconv.Itoa(tagSuggestLimit)
+		args = append(args, escapeLike(prefix)+"%")
+	} else {
+		query += `
+		GROUP BY tg.id, tg.name, tg.color
+		ORDER BY tg.name`
+	}
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*models.Tag{}
+	for rows.Next() {
+		tag := &models.Tag{UserID: userID}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, tag)
+	}
+	return list, rows.Err()
+}
+
+// escapeLike экранирует символы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// tagColors возвращает цвета тегов пользователя по имени; теги без цвета не входят
+func (h *Handler) tagColors(userID int64) map[string]string {
+	colors := make(map[string]string)
+	rows, err := h.db.Query("SELECT name, color FROM tags WHERE user_id = ? AND color <> ''", userID)
+	if err != nil {
+		fmt.Printf("ERROR loading tag colors for user %d: %v\n", userID, err)
+		return colors
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, color string
+		if rows.Scan(&name, &color) == nil {
+			colors[name] = color
+		}
+	}
+	return colors
+}
+
+// replaceScheduledTag заменяет тег from на to в шаблонах расписаний пользователя;
+// пустой to убирает тег. Расписания хранят теги строкой и создают их при проведении.
+func replaceScheduledTag(tx *sql.Tx, userID int64, from, to string) error {
+	rows, err := tx.Query("SELECT id, tags FROM scheduled_transactions WHERE user_id = ? AND tags <> ''", userID)
+	if err != nil {
+		return err
+	}
+	updated := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var tagList string
+		if err := rows.Scan(&id, &tagList); err != nil {
+			rows.Close()
+			return err
+		}
+		names := tags.Parse(tagList)
+		changed := false
+		for i, name := range names {
+			if strings.EqualFold(name, from) {
+				names[i], changed = to, true
+			}
+		}
+		if changed {
+			updated[id] = strings.Join(tags.Parse(strings.Join(names, ",")), ", ")
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, tagList := range updated {
+		if _, err := tx.Exec("UPDATE scheduled_transactions SET tags = ? WHERE id = ? AND user_id = ?",
+			tagList, id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FinanceTags - управление тегами: переименование, цвет, объединение, удаление
+func (h *Handler) FinanceTags(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	list, err := h.getTags(userID, "")
+	if err != nil {
+		fmt.Printf("ERROR loading tags for user %d: %v\n", userID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := h.pageData(userID, "tags")
+	data["Title"] = "Теги"
+	data["Tags"] = list
+	h.renderTemplate(w, "finance_tags.html", data)
+}
+
+// FinanceTransactionsByTag - транзакции с тегом; тег совпадает с именем целиком
+func (h *Handler) FinanceTransactionsByTag(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	tag := &models.Tag{UserID: userID}
+	err := h.db.QueryRow("SELECT id, name, color FROM tags WHERE user_id = ? AND name = ?",
+		userID, mux.Vars(r)["tag"]).Scan(&tag.ID, &tag.Name, &tag.Color)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Тег не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("tag", tag.Name)
+	filter, limit, err := h.parseSearch(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.searchTransactions(userID, filter, limit)
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR loading transactions with tag %d: %v\n", tag.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := h.transactionStats(userID, filter)
+	if err != nil {
+		fmt.Printf("ERROR counting transactions with tag %d: %v\n", tag.ID, err)
+	}
+	totals, err := h.tagTotals(userID, tag, filter.From, filter.To)
+	if err != nil {
+		fmt.Printf("ERROR summing transactions with tag %d: %v\n", tag.ID, err)
+	}
+
+	data := h.pageData(userID, "tags")
+	data["Title"] = fmt.Sprintf("Транзакции с тегом: %s", tag.Name)
+	data["Tag"] = tag
+	data["Found"] = stats.Count
+	data["Totals"] = totals
+	data["Transactions"] = page.Rows
+	data["PrevDate"] = page.PrevDate
+	data["MoreURL"] = searchMoreURL(filter, page)
+	data["Account"] = map[string]interface{}{"ID": int64(0)}
+	data["Search"] = true
+	data["TagColors"] = h.tagColors(userID)
+	h.renderTemplate(w, "finance_transactions_by_tag.html", data)
+}
+
+// tagTotals — расходы и доходы по тегу за период в валюте отчётности по курсам
+// на конец периода; нулевой to — по сегодняшний день
+func (h *Handler) tagTotals(userID int64, tag *models.Tag, from, to time.Time) (*tagReport, error) {
+	if to.IsZero() {
+		now := time.Now()
+		to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	currency, err := h.reportingCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	return h.buildTagReport(userID, currency, []reportColumn{{From: from, To: to}}, []string{tag.Name})
+}
+
+// APITagsGet - теги пользователя (JSON). С q — подсказки для поля ввода:
+// теги, начинающиеся с q, самые используемые первыми.
+func (h *Handler) APITagsGet(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	list, err := h.getTags(userID, strings.TrimSpace(r.URL.Query().Get("q")))
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		fmt.Printf("ERROR loading tags for user %d: %v\n", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": list})
+}
+
+// APITagSave - переименование тега и выбор его цвета (id, name, color).
+// Имя другого тега занять нельзя — такие теги объединяются через APITagMerge.
+func (h *Handler) APITagSave(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		fail("Некорректный тег")
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if err := tags.CheckName(name); err != nil {
+		fail(err.Error())
+		return
+	}
+	color := strings.ToLower(r.FormValue("color"))
+	if color != "" && !tagColorPattern.MatchString(color) {
+		fail("Цвет задаётся в виде #rrggbb")
+		return
+	}
+
+	if err := h.authorize(userID, ownedRefs{Tags: []int64{id}}); err != nil {
+		writeAuthzError(w, err, "Тег не найден")
+		return
+	}
+
+	var other int64
+	err = h.db.QueryRow("SELECT id FROM tags WHERE user_id = ? AND name = ? AND id <> ?",
+		userID, name, id).Scan(&other)
+	if err == nil {
+		fail(fmt.Sprintf("Тег «%s» уже есть — объедините теги", name))
+		return
+	}
+	if err != sql.ErrNoRows {
+		fmt.Printf("ERROR checking tag name: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		fmt.Printf("ERROR starting transaction: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow("SELECT name FROM tags WHERE id = ? AND user_id = ?", id, userID).Scan(&oldName)
+	if err == nil {
+		_, err = tx.Exec("UPDATE tags SET name = ?, color = ? WHERE id = ? AND user_id = ?", name, color, id, userID)
+	}
+	if err == nil && oldName != name {
+		err = replaceScheduledTag(tx, userID, oldName, name)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Printf("ERROR saving tag %d: %v\n", id, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": "ok",
+		"id":     id,
+	})
+}
+
+// APITagMerge - объединение тегов: транзакции с тегом source_id получают
+// тег target_id, тег source_id удаляется
+func (h *Handler) APITagMerge(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	sourceID, err1 := strconv.ParseInt(r.FormValue("source_id"), 10, 64)
+	targetID, err2 := strconv.ParseInt(r.FormValue("target_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		fail("Выберите тег, с которым объединить")
+		return
+	}
+	if sourceID == targetID {
+		fail("Нельзя объединить тег с самим собой")
+		return
+	}
+
+	if err := h.authorize(userID, ownedRefs{Tags: []int64{sourceID, targetID}}); err != nil {
+		writeAuthzError(w, err, "Тег не найден")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		fmt.Printf("ERROR starting transaction: %v\n", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var sourceName, targetName string
+	err = tx.QueryRow("SELECT name FROM tags WHERE id = ? AND user_id = ?", sourceID, userID).Scan(&sourceName)
+	if err == nil {
+		err = tx.QueryRow("SELECT name FROM tags WHERE id = ? AND user_id = ?", targetID, userID).Scan(&targetName)
+	}
+	// Транзакции с обоими тегами сохраняют одну связь
+	var moved sql.Result
+	if err == nil {
+		moved, err = tx.Exec(`
+			INSERT IGNORE INTO transaction_tags (tx_id, tag_id)
+			SELECT tx_id, ? FROM transaction_tags WHERE tag_id = ?
+		`, targetID, sourceID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM tags WHERE id = ? AND user_id = ?", sourceID, userID)
+	}
+	if err == nil {
+		err = replaceScheduledTag(tx, userID, sourceName, targetName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Printf("ERROR merging tag %d into %d: %v\n", sourceID, targetID, err)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	transactions, _ := moved.RowsAffected()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":       "ok",
+		"id":           targetID,
+		"transactions": transactions,
+	})
+}
+
+// APITagDelete - удаление тега: транзакции остаются, тег снимается с них
+// и из шаблонов расписаний
+func (h *Handler) APITagDelete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.getUserID(r)
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.authorize(userID, ownedRefs{Tags: []int64{id}}); err != nil {
+		writeAuthzError(w, err, "Тег не найден")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM tags WHERE id = ? AND user_id = ?", id, userID).Scan(&name)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM tags WHERE id = ? AND user_id = ?", id, userID)
+	}
+	if err == nil {
+		err = replaceScheduledTag(tx, userID, name, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Printf("ERROR deleting tag %d: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
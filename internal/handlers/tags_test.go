@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/database"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// txTags возвращает теги транзакции через запятую, по алфавиту
+func txTags(t *testing.T, h *Handler, txID int64) string {
+	t.Helper()
+	var list string
+	if err := h.db.QueryRow("SELECT "+tags.Column+" FROM transactions t WHERE t.id = ?", txID).Scan(&list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// tagID находит тег пользователя по имени
+func tagID(t *testing.T, h *Handler, userID int64, name string) int64 {
+	t.Helper()
+	var id int64
+	if err := h.db.QueryRow("SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&id); err != nil {
+		t.Fatalf("tag %q not found: %v", name, err)
+	}
+	return id
+}
+
+func TestTransactionTags(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := fmt.Sprint(accountIDByName(t, h, userID, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+
+	// Повторы и регистр схлопываются, пустые теги отбрасываются
+	form := splitForm("Такси", [3]string{food, "300", ""}, [3]string{card, "-300", ""})
+	form.Set("tags", " car , Car,, поездка ")
+	code, resp := saveTransaction(t, h, userID, form)
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save: %d %v", code, resp)
+	}
+	taxi := int64(resp["id"].(float64))
+	if got := txTags(t, h, taxi); got != "car,поездка" {
+		t.Errorf("tags after create: %q", got)
+	}
+
+	form.Set("id", fmt.Sprint(taxi))
+	form.Set("tags", "carsharing")
+	if code, resp := saveTransaction(t, h, userID, form); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("update: %d %v", code, resp)
+	}
+	if got := txTags(t, h, taxi); got != "carsharing" {
+		t.Errorf("tags after update: %q", got)
+	}
+
+	form.Set("tags", "a,"+strings.Repeat("я", tags.MaxNameLength+1))
+	if code, _ := saveTransaction(t, h, userID, form); code != 400 {
+		t.Errorf("long tag: expected 400, got %d", code)
+	}
+
+	// Тег совпадает целиком: car не находит carsharing
+	insertTx(t, h, userID, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), "Бензин", "car",
+		[3]int64{accountIDByName(t, h, userID, "Продукты"), 200000, 100},
+		[3]int64{accountIDByName(t, h, userID, "Расчетный счет"), -200000, 100})
+	rec := doRequest(t, h, userID, h.APITransactionsGet, "GET", "/api/v1/finance/transactions/get?tag=car", nil, "", nil)
+	var found struct {
+		Transactions []struct {
+			Description string `json:"description"`
+		} `json:"transactions"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &found)
+	if len(found.Transactions) != 1 || found.Transactions[0].Description != "Бензин" {
+		t.Errorf("tag=car: %s", rec.Body.String())
+	}
+
+	// Подсказки: по началу имени, самые используемые первыми
+	rec = doRequest(t, h, userID, h.APITagsGet, "GET", "/api/v1/finance/tags/get?q=CA", nil, "", nil)
+	var suggest struct {
+		Tags []struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		} `json:"tags"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &suggest)
+	if len(suggest.Tags) != 2 || suggest.Tags[0].Name != "car" || suggest.Tags[0].Count != 1 {
+		t.Errorf("suggest: %s", rec.Body.String())
+	}
+	rec = doRequest(t, h, userID, h.APITagsGet, "GET", "/api/v1/finance/tags/get?q=%25", nil, "", nil)
+	json.Unmarshal(rec.Body.Bytes(), &suggest)
+	if len(suggest.Tags) != 0 {
+		t.Errorf("LIKE pattern is not escaped: %s", rec.Body.String())
+	}
+}
+
+func TestTagManagement(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	both := insertTx(t, h, userID, day, "Такси", "car,carsharing", [3]int64{food, 100, 1}, [3]int64{card, -100, 1})
+	single := insertTx(t, h, userID, day, "Аренда", "carsharing", [3]int64{food, 50, 1}, [3]int64{card, -50, 1})
+	if _, err := h.db.Exec(`
+		INSERT INTO scheduled_transactions (user_id, description, tags, rule, start_date)
+		VALUES (?, 'Подписка', 'carsharing, поездка', 'monthly', '2026-01-01')
+	`, userID); err != nil {
+		t.Fatal(err)
+	}
+	scheduledTags := func() string {
+		var list string
+		h.db.QueryRow("SELECT tags FROM scheduled_transactions WHERE user_id = ?", userID).Scan(&list)
+		return list
+	}
+	car := tagID(t, h, userID, "car")
+	sharing := tagID(t, h, userID, "carsharing")
+
+	// Переименование и цвет
+	code, resp := postJSON(t, h, userID, h.APITagSave, url.Values{
+		"id": {fmt.Sprint(sharing)}, "name": {"каршеринг"}, "color": {"#FF8800"}})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("rename: %d %v", code, resp)
+	}
+	var color string
+	h.db.QueryRow("SELECT color FROM tags WHERE id = ?", sharing).Scan(&color)
+	if got := txTags(t, h, single); got != "каршеринг" || color != "#ff8800" {
+		t.Errorf("after rename: %q, color %q", got, color)
+	}
+	if got := scheduledTags(); got != "каршеринг, поездка" {
+		t.Errorf("scheduled tags after rename: %q", got)
+	}
+
+	for _, form := range []url.Values{
+		{"id": {fmt.Sprint(sharing)}, "name": {"CAR"}},
+		{"id": {fmt.Sprint(sharing)}, "name": {"a,b"}},
+		{"id": {fmt.Sprint(sharing)}, "name": {"x"}, "color": {"red"}},
+		{"id": {"x"}, "name": {"x"}},
+	} {
+		if code, _ := postJSON(t, h, userID, h.APITagSave, form); code != 400 {
+			t.Errorf("%v: expected 400, got %d", form, code)
+		}
+	}
+	other := createTestUser(t, h)
+	if code, _ := postJSON(t, h, other, h.APITagSave, url.Values{"id": {fmt.Sprint(car)}, "name": {"x"}}); code != 404 {
+		t.Errorf("foreign tag: expected 404, got %d", code)
+	}
+	if code, _ := postJSON(t, h, other, h.APITagMerge, url.Values{
+		"source_id": {fmt.Sprint(sharing)}, "target_id": {fmt.Sprint(car)}}); code != 404 {
+		t.Errorf("foreign merge: expected 404, got %d", code)
+	}
+
+	// Объединение: транзакция с обоими тегами сохраняет один
+	code, resp = postJSON(t, h, userID, h.APITagMerge, url.Values{
+		"source_id": {fmt.Sprint(sharing)}, "target_id": {fmt.Sprint(car)}})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("merge: %d %v", code, resp)
+	}
+	if txTags(t, h, both) != "car" || txTags(t, h, single) != "car" || countRows(t, h, "tags", userID) != 1 {
+		t.Errorf("after merge: %q %q", txTags(t, h, both), txTags(t, h, single))
+	}
+	if got := scheduledTags(); got != "car, поездка" {
+		t.Errorf("scheduled tags after merge: %q", got)
+	}
+
+	// Удаление тега не трогает транзакции
+	rec := doRequest(t, h, userID, h.APITagDelete, "DELETE", fmt.Sprintf("/api/v1/finance/tag/delete?id=%d", car), nil, "", nil)
+	if rec.Code != 200 {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if txTags(t, h, both) != "" || countRows(t, h, "transactions", userID) != 2 {
+		t.Errorf("after delete: %q", txTags(t, h, both))
+	}
+	if got := scheduledTags(); got != "поездка" {
+		t.Errorf("scheduled tags after delete: %q", got)
+	}
+}
+
+func TestMigrateTransactionTags(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Книга в прежнем формате: теги строкой в transactions.tags
+	if _, err := h.db.Exec("ALTER TABLE transactions ADD COLUMN tags TEXT"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := h.db.Exec(`
+		INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description, tags)
+		VALUES (?, 1, NOW(), NOW(), 'Старая', 'еда, Кафе,еда,')
+	`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txID, _ := result.LastInsertId()
+
+	if err := database.InitDB(h.db); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if got := txTags(t, h, txID); got != "еда,Кафе" {
+		t.Errorf("migrated tags: %q", got)
+	}
+	var columns int
+	h.db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'transactions' AND column_name = 'tags'
+	`).Scan(&columns)
+	if columns != 0 {
+		t.Error("legacy column is not dropped")
+	}
+}
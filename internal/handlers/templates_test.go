@@ -14,11 +14,14 @@ import (
 	"fmt"
 	"html/template"
 	"math"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/evbogdanov/finforme/internal/csvimport"
 	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
 )
 
 // buildTestTemplates загружает все шаблоны с той же funcMap, что и основной код.
@@ -52,10 +55,7 @@ func buildTestTemplates(t *testing.T) *template.Template {
 			return 0
 		},
 		"formatMoney": func(v float64) string {
-			if math.Abs(v) < 0.005 {
-				return "0.00"
-			}
-			return fmt.Sprintf("%.2f", v)
+			return money.FormatFloat(v, 100)
 		},
 		"formatMoneyShort": func(v float64) string {
 			abs := math.Abs(v)
@@ -163,6 +163,8 @@ func testTransactions() []map[string]interface{} {
 			"plus_balance_changing": 500.0,
 			"balance_changing":      0.0,
 			"account_balance":       1234.56,
+			"reconcile_state":       "y",
+			"reconciled_balance":    1234.56,
 			"tags":                 []string{"food"},
 		},
 		{
@@ -174,6 +176,8 @@ func testTransactions() []map[string]interface{} {
 			"plus_balance_changing": 0.0,
 			"balance_changing":      200.0,
 			"account_balance":       734.56,
+			"reconcile_state":       "c",
+			"reconciled_balance":    734.56,
 			"tags":                 []string{},
 		},
 	}
@@ -234,19 +238,39 @@ func TestTemplates_Index(t *testing.T) {
 	u := testUser()
 	data := baseData(u, testAccountTree())
 	data["Title"] = "Дашборд"
-	data["TotalAssets"] = 150000.0
-	data["TotalLiabilities"] = 30000.0
-	data["NetWorth"] = 120000.0
-	data["TotalIncome"] = 50000.0
-	data["TotalExpense"] = 20000.0
-	data["TopAccounts"] = []map[string]interface{}{
-		{"ID": int64(1), "Name": "Сбербанк", "AccountType": "BANK", "Balance": 100000.0},
+	data["TotalAssets"] = "150000.00"
+	data["TotalLiabilities"] = "30000.00"
+	data["HasLiabilities"] = true
+	data["NetWorth"] = "120000.00"
+	data["NetWorthNegative"] = false
+	data["TotalIncome"] = "50000.00"
+	data["TotalExpense"] = "20000.00"
+	data["TopAccounts"] = []*dashboardAccount{
+		{ID: 1, Name: "Сбербанк", AccountType: "BANK", Balance: models.NewAmount(10000000, 100)},
+		{ID: 2, Name: "Доллары", AccountType: "BANK", Balance: models.NewAmount(900000, 100),
+			Native: models.NewAmount(10000, 100), Mnemonic: "USD", nativePlaces: 2},
 	}
 	data["RecentTransactions"] = []map[string]interface{}{
 		{"ID": int64(1), "Description": "Зарплата", "PostDate": "2024-03-15", "Amount": 50000.0, "AccountName": "Сбербанк", "AccountType": "BANK"},
 	}
-	if err := render(tmpl, "index.html", data); err != nil {
-		t.Errorf("index.html: %v", err)
+	data["ReportingCurrency"] = &models.Commodity{ID: 1, Mnemonic: "RUB"}
+	data["RatesUsed"] = []map[string]interface{}{
+		{"Code": "USD/RUB", "Rate": 90.0, "Source": "cbr", "Date": "15.03.2024"},
+	}
+	data["MissingRates"] = []string{"GBP"}
+	data["OverBudget"] = []map[string]interface{}{
+		{"ID": int64(5), "Name": "Продукты", "Budget": "1000.00", "Actual": "1200.00", "Over": "200.00"},
+	}
+	data["NetWorthJSON"] = template.JS(`[{"date":"2024-02-29","assets":150000,"liabilities":30000,"net_worth":120000}]`)
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "index.html", data); err != nil {
+		t.Fatalf("index.html: %v", err)
+	}
+	for _, want := range []string{"USD/RUB 90.0000 на 15.03.2024", "нет курса для GBP", `title="100.00 USD"`, "120000.00", "100.0K",
+		"1200.00 из 1000.00", "Чистый капитал по месяцам", `"net_worth":120000`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("index.html: missing %q", want)
+		}
 	}
 }
 
@@ -326,10 +350,19 @@ func TestTemplates_FinanceTransactions(t *testing.T) {
 	data["AvailableMonths"] = []map[string]string{
 		{"Value": "2024-03", "Label": "Март 2024"},
 	}
-	data["Accounts"] = []*models.Account{acc}
+	data["Accounts"] = []*models.Account{acc, testAccount(3, models.AccountTypeExpense)}
 	data["Commodities"] = []*models.Commodity{}
-	if err := render(tmpl, "finance_transactions.html", data); err != nil {
-		t.Errorf("finance_transactions.html: %v", err)
+	data["Filter"] = transactionFilter{Sort: "desc", Values: url.Values{"q": {"кофе"}, "counterpart": {"3"}}}
+	data["PrevDate"] = ""
+	data["MoreURL"] = "/api/v1/finance/transaction/table?account_id=2&cursor=1&q=%D0%BA"
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_transactions.html", data); err != nil {
+		t.Fatalf("finance_transactions.html: %v", err)
+	}
+	for _, want := range []string{`value="кофе"`, `<option value="3" selected>`, "Сбросить", "Показать ещё"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("finance_transactions.html: missing %q", want)
+		}
 	}
 }
 
@@ -339,9 +372,82 @@ func TestTemplates_FinanceTransactionsTbody(t *testing.T) {
 	data := map[string]interface{}{
 		"Transactions": testTransactions(),
 		"Account":      acc,
+		"PrevDate":     "2024-03-15",
+		"MoreURL":      "",
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_transactions_tbody.html", data); err != nil {
+		t.Fatalf("finance_transactions_tbody.html: %v", err)
+	}
+	// Следующая страница не повторяет заголовок даты предыдущей и без курсора не предлагает подгрузку
+	if out := buf.String(); strings.Count(out, "date-group-row") != 1 || strings.Contains(out, "Показать ещё") {
+		t.Errorf("finance_transactions_tbody.html: unexpected group headers or load button")
+	}
+}
+
+func TestTemplates_FinanceSearch(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Поиск транзакций"
+	data["ActivePage"] = "search"
+	data["Filter"] = transactionFilter{Sort: "desc", Values: url.Values{"q": {"кофе"}}}
+	data["Searched"] = true
+	data["Found"] = 2
+	data["Transactions"] = []map[string]interface{}{
+		{"id": int64(7), "post_date": "15.03.2024", "description": "Кофе", "tags": []string{"кафе"},
+			"currency": "RUB", "amount_abs": "250.00", "sign": 1, "splits": []map[string]interface{}{
+				{"account_id": int64(3), "account_name": "Продукты", "anchor": false},
+				{"account_id": int64(2), "account_name": "Сбербанк", "anchor": true},
+			}},
+	}
+	data["PrevDate"] = ""
+	data["MoreURL"] = "/api/v1/finance/transactions/table?cursor=7&q=%D0%BA"
+	data["Account"] = map[string]interface{}{"ID": int64(2)}
+	data["Search"] = true
+	data["Accounts"] = []*models.Account{testAccount(2, models.AccountTypeBank)}
+	data["Commodities"] = []*models.Commodity{{ID: 1, Mnemonic: "RUB"}}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_search.html", data); err != nil {
+		t.Fatalf("finance_search.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Найдено: 2", `value="кофе"`, "+250.00", "Продукты", "Показать ещё"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("finance_search.html: missing %q", want)
+		}
 	}
-	if err := render(tmpl, "finance_transactions_tbody.html", data); err != nil {
-		t.Errorf("finance_transactions_tbody.html: %v", err)
+	// Счёт поиска в колонке счетов не повторяется
+	if strings.Contains(out, ">Сбербанк</a>") {
+		t.Error("finance_search.html: anchor account is listed")
+	}
+}
+
+func TestTemplates_FinanceAccountReconcile(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	acc := testAccount(2, models.AccountTypeBank)
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Сверка: " + acc.Name
+	data["Account"] = acc
+	data["ActiveAccountID"] = int64(2)
+	data["ActivePage"] = "transactions"
+	data["StatementDate"] = "2024-03-31"
+	data["EndingBalance"] = "1 234,56"
+	data["ReconciledBalance"] = 1000.0
+	data["ReconciledBalanceExact"] = "1000.00"
+	data["Fraction"] = int64(100)
+	data["Places"] = 2
+	data["Splits"] = []map[string]interface{}{
+		{"id": int64(5), "post_date": "15.03.2024", "description": "Зарплата", "memo": "",
+			"value": 234.56, "value_exact": "234.56", "cleared": true},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_account_reconcile.html", data); err != nil {
+		t.Fatalf("finance_account_reconcile.html: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, `data-value="234.56"`) || !strings.Contains(out, "checked") {
+		t.Error("cleared split is not rendered as ticked")
 	}
 }
 
@@ -393,6 +499,58 @@ func TestTemplates_FinanceAccountDrawerForm(t *testing.T) {
 	}
 }
 
+func TestTemplates_FinanceAccountDrawerForm_Edit(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	account := testAccount(2, models.AccountTypeBank)
+	// Родитель — обычный, не контейнерный счёт, как бывает в книгах GnuCash
+	parentID := int64(1)
+	account.ParentID = &parentID
+	data := map[string]interface{}{
+		"Account":     account,
+		"Accounts":    []*models.Account{testAccount(1, models.AccountTypeAsset), account},
+		"Commodities": []*models.Commodity{{ID: 1, Fullname: "Ruble", Sign: "₽"}},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_account_drawer_form.html", data); err != nil {
+		t.Fatalf("finance_account_drawer_form.html (edit): %v", err)
+	}
+	if !strings.Contains(buf.String(), "modal-merge_target") {
+		t.Error("drawer form: missing merge section")
+	}
+	parents := buf.String()[strings.Index(buf.String(), `id="modal-account_parent"`):]
+	if i := strings.Index(parents, `<option value="1"`); i < 0 || !strings.HasPrefix(strings.TrimSpace(parents[i+len(`<option value="1"`):]), "selected") {
+		t.Error("drawer form: current non-placeholder parent is not selected")
+	}
+}
+
+func TestTemplates_FinanceAccountDeleteForm(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	parent := testAccount(1, models.AccountTypeAsset)
+	account := testAccount(2, models.AccountTypeBank)
+	data := map[string]interface{}{
+		"Preview": &accountDeletion{
+			Account:      account,
+			Parent:       parent,
+			Children:     1,
+			Transactions: 3,
+			Splits:       3,
+			Scheduled:    1,
+			Budgets:      2,
+			Profiles:     []string{"Мой банк"},
+		},
+		"Accounts": []*models.Account{parent, account, testAccount(3, models.AccountTypeBank)},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_account_delete_form.html", data); err != nil {
+		t.Fatalf("finance_account_delete_form.html: %v", err)
+	}
+	for _, want := range []string{"транзакций — 3", "запланированных транзакций — 1", "месяцев бюджета — 2", "Профили импорта «Мой банк»", "value=\"move\"", "<option value=\"3\">"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("delete form: missing %q", want)
+		}
+	}
+}
+
 func TestTemplates_FinanceTransactionModalForm(t *testing.T) {
 	tmpl := buildTestTemplates(t)
 	acc := testAccount(2, models.AccountTypeBank)
@@ -400,14 +558,57 @@ func TestTemplates_FinanceTransactionModalForm(t *testing.T) {
 		"Transaction": nil,
 		"Account":     acc,
 		"Accounts":    []*models.Account{testAccount(1, models.AccountTypeAsset), acc},
-		"Debit":       []map[string]interface{}{},
-		"Credit":      []map[string]interface{}{},
+		"Splits":      []map[string]interface{}{},
+		"AccountID":   int64(2),
 	}
 	if err := render(tmpl, "finance_transaction_modal_form.html", data); err != nil {
 		t.Errorf("finance_transaction_modal_form.html: %v", err)
 	}
 }
 
+func TestTemplates_FinanceTransactionModalForm_Splits(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	acc := testAccount(2, models.AccountTypeBank)
+	data := map[string]interface{}{
+		"Transaction": &models.Transaction{ID: 7, Description: "Магазин", PostDate: time.Now(), Tags: "еда, дача"},
+		"Accounts":    []*models.Account{testAccount(1, models.AccountTypeExpense), acc},
+		"Splits": []map[string]interface{}{
+			{"id": int64(1), "account_id": int64(1), "account_name": "Еда", "commodity_id": int64(1),
+				"value": 19.99, "quantity": 19.99, "value_text": "19.99", "quantity_text": "19.99", "memo": "хлеб",
+				"action": "Buy", "reconcile_state": "n", "reconcile_date": ""},
+			{"id": int64(2), "account_id": int64(1), "account_name": "Еда", "commodity_id": int64(1),
+				"value": 5.01, "quantity": 5.01, "value_text": "5.01", "quantity_text": "5.01", "memo": "",
+				"action": "", "reconcile_state": "c", "reconcile_date": ""},
+			{"id": int64(3), "account_id": int64(2), "account_name": "Карта", "commodity_id": int64(2),
+				"value": -25.0, "quantity": -0.28, "value_text": "-25.00", "quantity_text": "-0.28", "memo": "",
+				"action": "", "reconcile_state": "y", "reconcile_date": "2026-03-31"},
+		},
+		"AccountID":  int64(2),
+		"CurrencyID": int64(1),
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_transaction_modal_form.html", data); err != nil {
+		t.Fatalf("finance_transaction_modal_form.html: %v", err)
+	}
+	out := buf.String()
+	// 3 строки сплитов + шаблон пустой строки
+	if n := strings.Count(out, `name="split_account"`); n != 4 {
+		t.Errorf("expected 4 split rows, got %d", n)
+	}
+	// Поле суммы в валюте счёта открыто только у сплита в другой валюте
+	if n := strings.Count(out, `<div class="split-quantity-row" >`); n != 1 {
+		t.Errorf("expected 1 visible quantity field, got %d", n)
+	}
+	for _, want := range []string{`value="19.99"`, `value="-25.00"`, `value="хлеб"`, `value="Buy"`,
+		`name="split_reconcile_state" value="c"`, `value="2026-03-31"`, `title="Сверен 2026-03-31">R<`,
+		`name="currency_id" value="1"`, `value="-0.28"`, `id="modal-tags" name="tags" value="еда, дача"`,
+		`oninput="suggestTags(this)"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+}
+
 func TestTemplates_FinanceTransaction(t *testing.T) {
 	tmpl := buildTestTemplates(t)
 	u := testUser()
@@ -415,9 +616,9 @@ func TestTemplates_FinanceTransaction(t *testing.T) {
 	data := baseData(u, testAccountTree())
 	data["Title"] = "Транзакция"
 	data["Transaction"] = nil
-	data["Debit"] = []map[string]interface{}{}
-	data["Credit"] = []map[string]interface{}{}
+	data["Splits"] = []map[string]interface{}{}
 	data["AccountID"] = int64(2)
+	data["CurrencyID"] = int64(1)
 	data["Accounts"] = []*models.Account{testAccount(1, models.AccountTypeAsset), acc}
 	data["ActivePage"] = "transactions"
 	if err := render(tmpl, "finance_transaction.html", data); err != nil {
@@ -425,24 +626,275 @@ func TestTemplates_FinanceTransaction(t *testing.T) {
 	}
 }
 
+func TestTemplates_FinanceScheduled(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Запланированные транзакции"
+	data["ActivePage"] = "scheduled"
+	data["Schedules"] = []map[string]interface{}{
+		{"id": int64(1), "description": "Квартплата", "rule": "ежемесячно, 10-го числа", "mode": "auto",
+			"enabled": true, "amount": "5 000.00", "next": "10.04.2026"},
+		{"id": int64(2), "description": "Рынок", "rule": "еженедельно по субботам", "mode": "remind",
+			"enabled": false, "amount": "1 500.00", "next": ""},
+	}
+	data["Occurrences"] = []map[string]interface{}{
+		{"id": int64(7), "date": "10.03.2026", "status": "created", "description": "Квартплата",
+			"tx_id": int64(15), "account_id": int64(2)},
+		{"id": int64(8), "date": "07.03.2026", "status": "pending", "description": "Рынок",
+			"tx_id": int64(0), "account_id": int64(2)},
+	}
+	data["Accounts"] = []*models.Account{testAccount(1, models.AccountTypeAsset), testAccount(2, models.AccountTypeBank)}
+	data["CurrencyID"] = int64(1)
+	data["Today"] = "2026-03-15"
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_scheduled.html", data); err != nil {
+		t.Fatalf("finance_scheduled.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`href="/finance/transaction/2/15"`, "Провести", "(выключено)",
+		`value="2026-03-15"`, `name="split_account"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+}
+
+func TestTemplates_FinanceBudget(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	expenses := testAccount(4, models.AccountTypeExpense)
+	food := testAccount(5, models.AccountTypeExpense)
+	food.Level = 1
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Бюджет"
+	data["ActivePage"] = "budget"
+	data["Month"] = "2026-03"
+	data["PrevMonth"] = "2026-02"
+	data["NextMonth"] = "2026-04"
+	data["Rollup"] = true
+	data["Lines"] = []*budgetLine{
+		{Account: expenses, Budget: models.NewAmount(100000, 100), Actual: models.NewAmount(120000, 100),
+			HasBudget: true, Fraction: 100},
+		{Account: food, Own: models.NewAmount(100000, 100), HasOwn: true, Budget: models.NewAmount(100000, 100),
+			Actual: models.NewAmount(120000, 100), HasBudget: true, Fraction: 100},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_budget.html", data); err != nil {
+		t.Fatalf("finance_budget.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"всего 1000.00", `value="1000.00"`, `title="Перерасход"`, "-200.00",
+		"padding-left:28px", `href="/finance/budget?month=2026-02"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+}
+
+func TestTemplates_FinanceReportIncome(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	income := testAccount(4, models.AccountTypeIncome)
+	salary := testAccount(5, models.AccountTypeIncome)
+	salary.Level = 1
+	rep := &report{
+		Currency: &models.Commodity{Mnemonic: "RUB", Fraction: 100},
+		Columns: []reportColumn{
+			{Label: "Март 2026"}, {Label: "Февраль 2026"},
+		},
+		Sections: []*reportSection{
+			{Title: "Доходы", Rows: []*reportRow{
+				{Account: income, Texts: []string{"6000.00", "5000.00"}},
+				{Account: salary, Texts: []string{"6000.00", "5000.00"}},
+			}, TotalTexts: []string{"6000.00", "5000.00"}},
+			{Title: "Расходы", TotalTexts: []string{"0.00", "0.00"}},
+		},
+		Missing: []string{"USD"},
+	}
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Доходы и расходы"
+	data["ActivePage"] = "reports"
+	data["Report"] = rep
+	data["Net"] = []models.Amount{models.NewAmount(600000, 100), models.NewAmount(-100, 100)}
+	data["NetTexts"] = []string{"6000.00", "-1.00"}
+	data["From"] = "2026-03-01"
+	data["To"] = "2026-03-31"
+	data["ComparePrev"] = true
+	data["CompareYear"] = false
+	data["GroupMonth"] = false
+	data["Presets"] = []map[string]string{{"Label": "Этот месяц", "From": "2026-03-01", "To": "2026-03-31"}}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_report_income.html", data); err != nil {
+		t.Fatalf("finance_report_income.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Февраль 2026", "padding-left:28px", "Нет операций за период",
+		"Нет курсов для USD", `value="prev" checked`, `<td class="mono right text-red" style="font-weight:700;">-1.00</td>`,
+		`class="sort-tab active"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+}
+
+func TestTemplates_FinanceReportTags(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	rep := &tagReport{
+		Currency: &models.Commodity{ID: 1, Mnemonic: "RUB", Fraction: 100},
+		Columns: []reportColumn{
+			{Label: "Март 2026", From: march, To: march.AddDate(0, 1, -1)},
+			{Label: "Апрель 2026", From: march.AddDate(0, 1, 0), To: march.AddDate(0, 2, -1)},
+		},
+		Rows: []*tagReportRow{{
+			Tag:          &models.Tag{ID: 1, Name: "отпуск-2026", Color: "#22aa55"},
+			Expense:      []models.Amount{models.NewAmount(1000, 1), {}},
+			Income:       []models.Amount{{}, {}},
+			ExpenseTotal: models.NewAmount(1000, 1),
+			ExpenseTexts: []string{"1000.00", "0.00"}, IncomeTexts: []string{"0.00", "0.00"},
+			ExpenseTotalText: "1000.00", IncomeTotalText: "0.00",
+		}},
+	}
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Отчёт по тегам"
+	data["ActivePage"] = "reports"
+	data["Report"] = rep
+	data["ChartJSON"] = rep.chartJSON()
+	data["From"] = "2026-03-01"
+	data["To"] = "2026-04-30"
+	data["Tags"] = []string{"отпуск-2026"}
+	data["Commodities"] = []*models.Commodity{{ID: 1, Mnemonic: "RUB"}, {ID: 2, Mnemonic: "USD"}}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_report_tags.html", data); err != nil {
+		t.Fatalf("finance_report_tags.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Апрель 2026", `<option value="1" selected>RUB</option>`, "background:#22aa55",
+		`href="/finance/tag/%d0%be%d1%82%d0%bf%d1%83%d1%81%d0%ba-2026?from=2026-03-01&to=2026-03-31"`,
+		`<input type="hidden" name="tag" value="отпуск-2026">`, `"expense":[1000,0]`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+	// Раздел доходов без сумм пуст
+	if strings.Count(out, `-2026?from=2026-03-01&to=2026-04-30"`) != 1 {
+		t.Errorf("tag with no income is listed under income")
+	}
+}
+
+func TestTemplates_FinanceReportBalance(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	assets := testAccount(1, models.AccountTypeAsset)
+	rep := &report{
+		Currency: &models.Commodity{Mnemonic: "RUB", Fraction: 100},
+		Columns:  []reportColumn{{Label: "на 28.02.2026"}},
+		Sections: []*reportSection{
+			{Title: "Активы", Rows: []*reportRow{{Account: assets, Texts: []string{"16000.00"}}},
+				TotalTexts: []string{"16000.00"}},
+			{Title: "Обязательства", TotalTexts: []string{"0.00"}},
+			{Title: "Капитал", TotalTexts: []string{"10000.00"}},
+		},
+		places: 2,
+	}
+	sheet := &balanceSheet{
+		Report:               rep,
+		Retained:             []models.Amount{models.NewAmount(580000, 100)},
+		Difference:           []models.Amount{models.NewAmount(20000, 100)},
+		Equity:               []models.Amount{models.NewAmount(1600000, 100)},
+		LiabilitiesAndEquity: []models.Amount{models.NewAmount(1600000, 100)},
+	}
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Баланс"
+	data["ActivePage"] = "reports"
+	data["Sheet"] = sheet
+	data["Report"] = rep
+	data["Date"] = "2026-02-28"
+	data["CompareYear"] = false
+	data["Presets"] = []map[string]string{{"Label": "Конец прошлого месяца", "Date": "2026-02-28"}}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_report_balance.html", data); err != nil {
+		t.Fatalf("finance_report_balance.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Нераспределённая прибыль", "5800.00", "Курсовые разницы", "200.00",
+		"Нет остатков", "Итого: Капитал", `href="/finance/reports/balance-sheet?date=2026-02-28"`,
+		`class="sort-tab active" href="/finance/reports/balance-sheet"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s", want)
+		}
+	}
+}
+
 func TestTemplates_FinanceTransactionsByTag(t *testing.T) {
 	tmpl := buildTestTemplates(t)
 	u := testUser()
 	data := baseData(u, testAccountTree())
 	data["Title"] = "Транзакции с тегом: food"
-	data["Tag"] = "food"
+	data["Tag"] = &models.Tag{ID: 1, Name: "food", Color: "#22aa55"}
+	data["Found"] = 1
 	data["Transactions"] = []map[string]interface{}{
 		{
-			"id": int64(1), "post_date": "2024-03-15",
-			"description": "Test", "value": 100.0,
+			"id": int64(1), "post_date": "15.03.2024", "description": "Test",
+			"tags": []string{"food", "trip"}, "currency": "RUB", "amount_abs": "100.00", "sign": 1,
 			"splits": []map[string]interface{}{
-				{"account_name": "Bank", "value": 100.0},
+				{"account_id": int64(2), "account_name": "Bank", "anchor": false},
 			},
 		},
 	}
-	data["ActivePage"] = "transactions"
-	if err := render(tmpl, "finance_transactions_by_tag.html", data); err != nil {
-		t.Errorf("finance_transactions_by_tag.html: %v", err)
+	data["PrevDate"] = ""
+	data["MoreURL"] = ""
+	data["Account"] = map[string]interface{}{"ID": int64(0)}
+	data["Search"] = true
+	data["TagColors"] = map[string]string{"food": "#22aa55"}
+	data["ActivePage"] = "tags"
+	data["Totals"] = &tagReport{
+		Currency: &models.Commodity{Mnemonic: "RUB"},
+		Rows:     []*tagReportRow{{ExpenseTotalText: "100.00", IncomeTotalText: "0.00"}},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_transactions_by_tag.html", data); err != nil {
+		t.Fatalf("finance_transactions_by_tag.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`href="/finance/tag/food"`, "background:#22aa55", `href="/finance/tag/trip"`, "Найдено: 1",
+		`Расходы: <span class="mono">100.00</span>`, `href="/finance/reports/tags?tag=food"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("finance_transactions_by_tag.html: missing %q", want)
+		}
+	}
+}
+
+func TestTemplates_FinanceTags(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	data := baseData(u, testAccountTree())
+	data["Title"] = "Теги"
+	data["ActivePage"] = "tags"
+	data["Tags"] = []*models.Tag{
+		{ID: 1, Name: "car", Color: "#3366cc", Count: 4},
+		{ID: 2, Name: "carsharing", Count: 0},
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, "finance_tags.html", data); err != nil {
+		t.Fatalf("finance_tags.html: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`value="car"`, `value="#3366cc"`, `href="/finance/tag/carsharing"`, `<option value="2">carsharing</option>`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("finance_tags.html: missing %q", want)
+		}
+	}
+
+	data["Tags"] = []*models.Tag{}
+	buf.Reset()
+	if err := tmpl.ExecuteTemplate(&buf, "finance_tags.html", data); err != nil {
+		t.Fatalf("finance_tags.html (empty): %v", err)
+	}
+	if !strings.Contains(buf.String(), "Тегов пока нет") {
+		t.Error("finance_tags.html: missing empty state")
 	}
 }
 
@@ -452,11 +904,60 @@ func TestTemplates_FinanceSettings(t *testing.T) {
 	data := baseData(u, testAccountTree())
 	data["Title"] = "Настройки"
 	data["ActivePage"] = "settings"
+	data["Currencies"] = []*models.Commodity{{ID: 1, Mnemonic: "RUB"}, {ID: 2, Mnemonic: "USD"}}
+	data["ReportingCurrencyID"] = int64(2)
 	if err := render(tmpl, "finance_settings.html", data); err != nil {
 		t.Errorf("finance_settings.html: %v", err)
 	}
 }
 
+func TestTemplates_FinanceImportCSV(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	tree := testAccountTree()
+	data := baseData(u, tree)
+	data["Title"] = "Импорт выписки CSV"
+	data["ActivePage"] = "settings"
+	data["Accounts"] = tree
+	data["DateFormats"] = csvimport.DateFormats
+	data["Profiles"] = []*csvProfile{{ID: 7, Name: "Банк <Тест>"}}
+	data["ProfilesJSON"] = template.JS(`[{"id":7,"name":"Банк"}]`)
+
+	var sb strings.Builder
+	if err := tmpl.ExecuteTemplate(&sb, "finance_import_csv.html", data); err != nil {
+		t.Fatalf("finance_import_csv.html: %v", err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		`<option value="7">Банк &lt;Тест&gt;</option>`,
+		`<option value="02.01.2006">ДД.ММ.ГГГГ</option>`,
+		`var csvProfiles = [{"id":7,"name":"Банк"}] || [];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("finance_import_csv.html: missing %s", want)
+		}
+	}
+}
+
+func TestTemplates_FinanceImportOFX(t *testing.T) {
+	tmpl := buildTestTemplates(t)
+	u := testUser()
+	tree := testAccountTree()
+	data := baseData(u, tree)
+	data["Title"] = "Импорт выписки OFX"
+	data["ActivePage"] = "settings"
+	data["Accounts"] = tree
+	data["StatementAccounts"] = []*models.Account{testAccount(2, models.AccountTypeBank)}
+
+	var sb strings.Builder
+	if err := tmpl.ExecuteTemplate(&sb, "finance_import_ofx.html", data); err != nil {
+		t.Fatalf("finance_import_ofx.html: %v", err)
+	}
+	if !strings.Contains(sb.String(), `<option value="2">Test Account 2</option>`) {
+		t.Error("finance_import_ofx.html: statement account missing")
+	}
+}
+
 func TestTemplates_Currency(t *testing.T) {
 	tmpl := buildTestTemplates(t)
 	u := testUser()
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/money"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// errStaleCursor — транзакция, с которой продолжается список, удалена
+var errStaleCursor = errors.New("Список изменился — обновите страницу")
+
+// transactionFilter — фильтры и позиция страницы списка транзакций:
+// реестра счёта или поиска по всей книге
+type transactionFilter struct {
+	Sort        string    // asc — от старых к новым, desc — от новых к старым
+	From, To    time.Time // дни проводки включительно; нулевые — без границы
+	Text        string    // подстрока описания
+	Tags        []string  // все теги должны быть у транзакции
+	Counterpart int64     // счёт, который участвует в транзакции
+	Account     int64     // счёт поиска; вместе с дочерними попадает в Accounts
+	CommodityID int64     // валюта счёта сплита a
+	Cursor      int64     // последняя транзакция предыдущей страницы; 0 — первая страница
+
+	// Accounts — счета, по которым должен быть сплит a; пустой — любой счёт
+	Accounts []int64
+
+	// Границы суммы сплита a в валюте его счёта без учёта знака;
+	// нулевой знаменатель — без границы
+	MinNum, MinDenom int64
+	MaxNum, MaxDenom int64
+
+	// Values — заданные параметры фильтров (без cursor) для ссылок и полей формы
+	Values url.Values
+}
+
+// parseTransactionFilter разбирает параметры списка: sort, period
+// (month|quarter|year|all — от сегодняшнего дня today), month (ГГГГ-ММ),
+// from и to (переопределяют период), amount или min и max, q, tag (можно
+// несколько через запятую), counterpart, account, commodity и cursor
+func parseTransactionFilter(query url.Values, today time.Time) (transactionFilter, error) {
+	f := transactionFilter{Sort: "desc", Values: url.Values{}}
+	keep := func(key string) string {
+		v := strings.TrimSpace(query.Get(key))
+		if v != "" {
+			f.Values.Set(key, v)
+		}
+		return v
+	}
+	id := func(key, message string) (int64, error) {
+		s := keep(key)
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, errors.New(message)
+		}
+		return n, nil
+	}
+
+	if query.Get("sort") == "asc" {
+		f.Sort = keep("sort")
+	}
+	switch keep("period") {
+	case "", "all":
+	case "month":
+		f.From = today.AddDate(0, -1, 0)
+	case "quarter":
+		f.From = today.AddDate(0, -3, 0)
+	case "year":
+		f.From = today.AddDate(-1, 0, 0)
+	default:
+		return f, errors.New("Период должен быть month, quarter, year или all")
+	}
+	if s := keep("month"); s != "" {
+		month, err := time.Parse("2006-01", s)
+		if err != nil {
+			return f, errors.New("Некорректный месяц")
+		}
+		f.From, f.To = month, month.AddDate(0, 1, -1)
+	}
+	var err error
+	if s := keep("from"); s != "" {
+		if f.From, err = time.Parse("2006-01-02", s); err != nil {
+			return f, errors.New("Некорректная дата начала периода")
+		}
+	}
+	if s := keep("to"); s != "" {
+		if f.To, err = time.Parse("2006-01-02", s); err != nil {
+			return f, errors.New("Некорректная дата конца периода")
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		return f, errors.New("Конец периода раньше начала")
+	}
+
+	// Точная сумма — обе границы сразу
+	if s := keep("amount"); s != "" {
+		if f.MinNum, f.MinDenom, err = money.Parse(s); err != nil || f.MinNum < 0 {
+			return f, errors.New("Некорректная сумма")
+		}
+		f.MaxNum, f.MaxDenom = f.MinNum, f.MinDenom
+	}
+	if s := keep("min"); s != "" {
+		if f.MinNum, f.MinDenom, err = money.Parse(s); err != nil || f.MinNum < 0 {
+			return f, errors.New("Некорректная минимальная сумма")
+		}
+	}
+	if s := keep("max"); s != "" {
+		if f.MaxNum, f.MaxDenom, err = money.Parse(s); err != nil || f.MaxNum < 0 {
+			return f, errors.New("Некорректная максимальная сумма")
+		}
+	}
+	if f.MinDenom != 0 && f.MaxDenom != 0 &&
+		models.NewAmount(f.MinNum, f.MinDenom).Cmp(models.NewAmount(f.MaxNum, f.MaxDenom)) > 0 {
+		return f, errors.New("Минимальная сумма больше максимальной")
+	}
+
+	f.Text = keep("q")
+	f.Tags = tags.Parse(strings.Join(query["tag"], ","))
+	if len(f.Tags) > 0 {
+		f.Values.Set("tag", strings.Join(f.Tags, ","))
+	}
+	if f.Counterpart, err = id("counterpart", "Некорректный счёт-контрагент"); err != nil {
+		return f, err
+	}
+	if f.Account, err = id("account", "Некорректный счёт"); err != nil {
+		return f, err
+	}
+	if f.CommodityID, err = id("commodity", "Некорректная валюта"); err != nil {
+		return f, err
+	}
+	if s := query.Get("cursor"); s != "" {
+		if f.Cursor, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return f, errors.New("Некорректный курсор")
+		}
+	}
+	return f, nil
+}
+
+// Query возвращает параметры фильтров, заменив в них пары ключ-значение;
+// пустое значение убирает параметр
+func (f transactionFilter) Query(pairs ...string) string {
+	q := url.Values{}
+	for k, v := range f.Values {
+		q[k] = v
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			q.Del(pairs[i])
+		} else {
+			q.Set(pairs[i], pairs[i+1])
+		}
+	}
+	return q.Encode()
+}
+
+// WithPeriod — Query с другим периодом: даты и месяц сбрасываются
+func (f transactionFilter) WithPeriod(period string) string {
+	if period == "all" {
+		period = ""
+	}
+	return f.Query("period", period, "month", "", "from", "", "to", "")
+}
+
+// Period — выбранная вкладка периода: custom, если заданы месяц или даты
+func (f transactionFilter) Period() string {
+	if f.Values.Get("month") != "" || f.Values.Get("from") != "" || f.Values.Get("to") != "" {
+		return "custom"
+	}
+	if p := f.Values.Get("period"); p != "" {
+		return p
+	}
+	return "all"
+}
+
+// HasFilters — заданы ли фильтры помимо периода и сортировки
+func (f transactionFilter) HasFilters() bool {
+	for _, key := range []string{"amount", "min", "max", "q", "tag", "counterpart", "account", "commodity"} {
+		if f.Values.Get(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// where возвращает условия фильтров на транзакцию t и её сплит a
+func (f transactionFilter) where() (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+	if len(f.Accounts) > 0 {
+		sb.WriteString(" AND a.account_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.Accounts)), ",") + ")")
+		for _, id := range f.Accounts {
+			args = append(args, id)
+		}
+	}
+	if f.CommodityID != 0 {
+		sb.WriteString(" AND a.account_id IN (SELECT ca.id FROM accounts ca WHERE ca.commodity_id = ?)")
+		args = append(args, f.CommodityID)
+	}
+	if !f.From.IsZero() {
+		sb.WriteString(" AND t.post_date >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		sb.WriteString(" AND t.post_date < ?")
+		args = append(args, f.To.AddDate(0, 0, 1))
+	}
+	// Суммы сравниваются без округления: |num/denom| >= minNum/minDenom
+	if f.MinDenom != 0 {
+		sb.WriteString(" AND ABS(a.quantity_num) * ? >= ? * a.quantity_denom")
+		args = append(args, f.MinDenom, f.MinNum)
+	}
+	if f.MaxDenom != 0 {
+		sb.WriteString(" AND ABS(a.quantity_num) * ? <= ? * a.quantity_denom")
+		args = append(args, f.MaxDenom, f.MaxNum)
+	}
+	// % и _ в запросе ищутся как обычные символы
+	if f.Text != "" {
+		sb.WriteString(` AND t.description LIKE ? ESCAPE '\\'`)
+		args = append(args, "%"+escapeLike(f.Text)+"%")
+	}
+	// Тег совпадает целиком: car не находит carsharing
+	for _, tag := range f.Tags {
+		sb.WriteString(` AND t.id IN (SELECT tt.tx_id FROM transaction_tags tt
+			JOIN tags tg ON tg.id = tt.tag_id WHERE tg.user_id = t.user_id AND tg.name = ?)`)
+		args = append(args, tag)
+	}
+	if f.Counterpart != 0 {
+		sb.WriteString(" AND t.id IN (SELECT c.tx_id FROM splits c WHERE c.account_id = ?)")
+		args = append(args, f.Counterpart)
+	}
+	return sb.String(), args
+}
+
+// transactionPage — страница списка транзакций
+type transactionPage struct {
+	Rows       []map[string]interface{}
+	NextCursor int64  // курсор следующей страницы; 0 — страница последняя
+	PrevDate   string // дата последней строки предыдущей страницы
+}
+
+// pageTransactions выбирает не больше limit транзакций пользователя после
+// курсора, подходящих под фильтры, и возвращает их id и даты проводки
+// в порядке сортировки; курсор следующей страницы записывается в page
+func (h *Handler) pageTransactions(userID int64, f transactionFilter, limit int, page *transactionPage) ([]int64, []time.Time, error) {
+	cmp, order := "<", "DESC"
+	if f.Sort == "asc" {
+		cmp, order = ">", "ASC"
+	}
+
+	where, whereArgs := f.where()
+	query := `
+		SELECT DISTINCT t.id, t.post_date
+		FROM transactions t
+		JOIN splits a ON a.tx_id = t.id
+		WHERE t.user_id = ?` + where
+	args := append([]interface{}{userID}, whereArgs...)
+	if f.Cursor != 0 {
+		var cursorDate time.Time
+		err := h.db.QueryRow("SELECT post_date FROM transactions WHERE id = ? AND user_id = ?",
+			f.Cursor, userID).Scan(&cursorDate)
+		if err == sql.ErrNoRows {
+			return nil, nil, errStaleCursor
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		query += " AND (t.post_date " + cmp + " ? OR t.post_date = ? AND t.id " + cmp + " ?)"
+		args = append(args, cursorDate, cursorDate, f.Cursor)
+		page.PrevDate = cursorDate.Format("02.01.2006")
+	}
+	query += " ORDER BY t.post_date " + order + ", t.id " + order + " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var dates []time.Time
+	for rows.Next() {
+		var id int64
+		var postDate time.Time
+		if err := rows.Scan(&id, &postDate); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		dates = append(dates, postDate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) > limit {
+		ids, dates = ids[:limit], dates[:limit]
+		page.NextCursor = ids[limit-1]
+	}
+	return ids, dates, nil
+}
+
+// countTransactions считает транзакции списка по всем страницам — без сумм,
+// которые нужны только реестру счёта
+func (h *Handler) countTransactions(userID int64, f transactionFilter) (int, error) {
+	where, whereArgs := f.where()
+	var count int
+	err := h.db.QueryRow(`
+		SELECT COUNT(DISTINCT t.id)
+		FROM transactions t
+		JOIN splits a ON a.tx_id = t.id
+		WHERE t.user_id = ?`+where, append([]interface{}{userID}, whereArgs...)...).Scan(&count)
+	return count, err
+}
+
+// transactionStats — итоги всех страниц списка по сплитам a: приход и расход
+type transactionStats struct {
+	Income, Expense           float64
+	IncomeCount, ExpenseCount int
+	Count                     int
+}
+
+// transactionStats считает итоги списка по всем страницам; суммы имеют
+// смысл, когда сплиты a в одной валюте (реестр счёта). Направление
+// транзакции — знак суммы её сплитов a: точный при одном знаменателе,
+// при разных — по десятичной дроби. Суммы база считает по знаменателям,
+// как в registerBalances.
+func (h *Handler) transactionStats(userID int64, f transactionFilter) (transactionStats, error) {
+	var stats transactionStats
+	where, whereArgs := f.where()
+	args := append([]interface{}{userID}, whereArgs...)
+	directions := `
+		SELECT t.id,
+		       CASE WHEN MIN(a.quantity_denom) = MAX(a.quantity_denom) THEN SIGN(SUM(a.quantity_num))
+		            ELSE SIGN(SUM(CAST(a.quantity_num AS DECIMAL(38, 18)) / a.quantity_denom)) END AS direction
+		FROM transactions t
+		JOIN splits a ON a.tx_id = t.id
+		WHERE t.user_id = ?` + where + `
+		GROUP BY t.id`
+
+	rows, err := h.db.Query("SELECT d.direction, COUNT(*) FROM ("+directions+") d GROUP BY d.direction", args...)
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var direction, count int
+		if err := rows.Scan(&direction, &count); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		stats.Count += count
+		switch direction {
+		case 1:
+			stats.IncomeCount = count
+		case -1:
+			stats.ExpenseCount = count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	rows, err = h.db.Query(`
+		SELECT d.direction, a.quantity_denom, SUM(a.quantity_num)
+		FROM (`+directions+`) d
+		JOIN transactions t ON t.id = d.id
+		JOIN splits a ON a.tx_id = t.id
+		WHERE d.direction <> 0 AND t.user_id = ?`+where+`
+		GROUP BY d.direction, a.quantity_denom`,
+		append(append([]interface{}{}, args...), args...)...)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	var income, expense models.Amount
+	for rows.Next() {
+		var direction int
+		var denom, num int64
+		if err := rows.Scan(&direction, &denom, &num); err != nil {
+			return stats, err
+		}
+		if direction > 0 {
+			income = income.Add(models.NewAmount(num, denom))
+		} else {
+			expense = expense.Sub(models.NewAmount(num, denom))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+	stats.Income, stats.Expense = income.Float64(), expense.Float64()
+	return stats, nil
+}
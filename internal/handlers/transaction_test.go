@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+// saveTransaction отправляет форму сохранения транзакции и возвращает ответ
+func saveTransaction(t *testing.T, h *Handler, userID int64, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	rec := postForm(t, h, userID, h.APITransactionSave, form.Encode())
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func splitForm(description string, splits ...[3]string) url.Values {
+	form := url.Values{
+		"description": {description},
+		"post_date":   {"2026-03-10"},
+	}
+	for _, s := range splits {
+		form.Add("split_account", s[0])
+		form.Add("split_value", s[1])
+		form.Add("split_memo", s[2])
+	}
+	return form
+}
+
+func TestTransactionSaveMultiSplit(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := fmt.Sprint(accountIDByName(t, h, userID, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+	fun := fmt.Sprint(accountIDByName(t, h, userID, "Развлечения"))
+
+	code, resp := saveTransaction(t, h, userID, splitForm("Гипермаркет",
+		[3]string{food, "19.99", "хлеб"},
+		[3]string{fun, "30.01", "кино"},
+		[3]string{"", "", ""}, // пустая строка редактора
+		[3]string{card, "-50", ""},
+	))
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+	txID := int64(resp["id"].(float64))
+
+	tx, splits := h.getTransaction(userID, txID)
+	if tx == nil || len(splits) != 3 {
+		t.Fatalf("expected 3 splits, got %v", splits)
+	}
+	if splits[0]["memo"] != "хлеб" || splits[0]["value"] != 19.99 || splits[2]["value"] != -50.0 {
+		t.Errorf("unexpected splits: %v", splits)
+	}
+
+	// Редактирование заменяет набор сплитов целиком
+	form := splitForm("Гипермаркет", [3]string{food, "50", ""}, [3]string{card, "-50", ""})
+	form.Set("id", fmt.Sprint(txID))
+	if code, resp := saveTransaction(t, h, userID, form); code != 200 || resp["result"] != "ok" {
+		t.Fatalf("update failed: %d %v", code, resp)
+	}
+	if _, splits := h.getTransaction(userID, txID); len(splits) != 2 {
+		t.Errorf("expected 2 splits after update, got %v", splits)
+	}
+}
+
+func TestTransactionSaveSplitDetails(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := fmt.Sprint(accountIDByName(t, h, userID, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+
+	form := splitForm("Магазин", [3]string{food, "10", "хлеб"}, [3]string{card, "-10", ""})
+	form["split_action"] = []string{"Buy", ""}
+	form["split_reconcile_state"] = []string{"n", "y"}
+	form["split_reconcile_date"] = []string{"2026-03-01", "2026-03-31"}
+	code, resp := saveTransaction(t, h, userID, form)
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+
+	_, splits := h.getTransaction(userID, int64(resp["id"].(float64)))
+	if len(splits) != 2 {
+		t.Fatalf("expected 2 splits, got %v", splits)
+	}
+	// Дата сверки у несверенного сплита не сохраняется
+	if splits[0]["action"] != "Buy" || splits[0]["reconcile_state"] != "n" || splits[0]["reconcile_date"] != "" {
+		t.Errorf("unexpected first split: %v", splits[0])
+	}
+	if splits[1]["reconcile_state"] != "y" || splits[1]["reconcile_date"] != "2026-03-31" {
+		t.Errorf("unexpected second split: %v", splits[1])
+	}
+
+	form["split_reconcile_state"] = []string{"n", "x"}
+	if code, resp := saveTransaction(t, h, userID, form); code != 400 || resp["error"] == nil {
+		t.Errorf("expected 400 for unknown reconcile state, got %d %v", code, resp)
+	}
+}
+
+func TestTransactionSaveRejects(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := fmt.Sprint(accountIDByName(t, h, userID, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+	expenses := fmt.Sprint(accountIDByName(t, h, userID, "Расходы"))
+
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"unbalanced", splitForm("x", [3]string{food, "10", ""}, [3]string{card, "-9.99", ""})},
+		{"single split", splitForm("x", [3]string{food, "0", ""})},
+		{"placeholder", splitForm("x", [3]string{expenses, "10", ""}, [3]string{card, "-10", ""})},
+		{"missing account", splitForm("x", [3]string{food, "10", ""}, [3]string{"", "-10", ""})},
+		{"bad amount", splitForm("x", [3]string{food, "abc", ""}, [3]string{card, "-10", ""})},
+	}
+
+	for _, tt := range tests {
+		code, resp := saveTransaction(t, h, userID, tt.form)
+		if code != 400 || resp["error"] == nil {
+			t.Errorf("%s: expected 400 with error, got %d %v", tt.name, code, resp)
+		}
+	}
+
+	if n := countRows(t, h, "transactions", userID); n != 0 {
+		t.Errorf("rejected saves wrote %d transactions", n)
+	}
+}
+
+func TestTransactionSaveLegacyForm(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := accountIDByName(t, h, userID, "Расчетный счет")
+	food := accountIDByName(t, h, userID, "Продукты")
+
+	code, resp := saveTransaction(t, h, userID, url.Values{
+		"description":    {"Кафе"},
+		"post_date":      {"2026-03-10"},
+		"value":          {"19.99"},
+		"debit_account":  {fmt.Sprint(food)},
+		"credit_account": {fmt.Sprint(card)},
+	})
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+
+	balances := bookBalances(t, h, userID)
+	if got := balances["Расходы:Продукты"]; got != "1999/100" {
+		t.Errorf("food balance = %s, expected 1999/100", got)
+	}
+}
+
+func TestTransactionSaveMultiCurrency(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	cardID := accountIDByName(t, h, userID, "Расчетный счет")
+	dollarsID := accountIDByName(t, h, userID, "Сберегательный счет")
+	var usd int64
+	if err := h.db.QueryRow("SELECT id FROM commodities WHERE mnemonic = 'USD'").Scan(&usd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.db.Exec("UPDATE accounts SET commodity_id = ? WHERE id = ?", usd, dollarsID); err != nil {
+		t.Fatal(err)
+	}
+	card, dollars := fmt.Sprint(cardID), fmt.Sprint(dollarsID)
+
+	// Покупка 100 долларов за 9 000 рублей: сумма транзакции в рублях,
+	// у долларового сплита количество в долларах
+	form := splitForm("Покупка валюты", [3]string{dollars, "9000", ""}, [3]string{card, "-9000", ""})
+	form.Set("account_id", card)
+	form["split_quantity"] = []string{"100", ""}
+	code, resp := saveTransaction(t, h, userID, form)
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+	txID := int64(resp["id"].(float64))
+
+	tx, splits := h.getTransaction(userID, txID)
+	if tx == nil || tx.CurrencyID != 1 {
+		t.Fatalf("expected RUB transaction, got %+v", tx)
+	}
+	if splits[0]["value"] != 9000.0 || splits[0]["quantity"] != 100.0 || splits[1]["quantity"] != -9000.0 {
+		t.Errorf("unexpected splits: %v", splits)
+	}
+
+	balances := bookBalances(t, h, userID)
+	if got := balances["Активы:Текущие активы:Сберегательный счет"]; got != "100" {
+		t.Errorf("USD balance = %s, want 100", got)
+	}
+	if got := balances["Активы:Текущие активы:Расчетный счет"]; got != "-9000" {
+		t.Errorf("RUB balance = %s, want -9000", got)
+	}
+
+	// Без суммы в валюте счёта сохранить нельзя
+	form["split_quantity"] = []string{"", ""}
+	if code, resp := saveTransaction(t, h, userID, form); code != 400 || resp["error"] == nil {
+		t.Errorf("expected 400 without quantity, got %d %v", code, resp)
+	}
+	// Знак количества должен совпадать со знаком суммы
+	form["split_quantity"] = []string{"-100", ""}
+	if code, _ := saveTransaction(t, h, userID, form); code != 400 {
+		t.Errorf("expected 400 for opposite sign quantity, got %d", code)
+	}
+}
+
+func TestTransactionSaveExactAmounts(t *testing.T) {
+	h := testHandler(t)
+	userID := createTestUser(t, h)
+	if err := h.createBaseAccounts(userID); err != nil {
+		t.Fatal(err)
+	}
+	card := fmt.Sprint(accountIDByName(t, h, userID, "Расчетный счет"))
+	food := fmt.Sprint(accountIDByName(t, h, userID, "Продукты"))
+	fun := fmt.Sprint(accountIDByName(t, h, userID, "Развлечения"))
+
+	// Запятая, пробелы между разрядами и суммы, терявшие копейку через float64
+	code, resp := saveTransaction(t, h, userID, splitForm("Покупки",
+		[3]string{food, "1 234,29", ""},
+		[3]string{fun, "0.29", ""},
+		[3]string{card, "-1 234.58", ""},
+	))
+	if code != 200 || resp["result"] != "ok" {
+		t.Fatalf("save failed: %d %v", code, resp)
+	}
+	_, splits := h.getTransaction(userID, int64(resp["id"].(float64)))
+	if len(splits) != 3 || splits[0]["value_text"] != "1234.29" || splits[1]["value_text"] != "0.29" {
+		t.Errorf("unexpected splits: %v", splits)
+	}
+	var num, denom int64
+	h.db.QueryRow("SELECT value_num, value_denom FROM splits WHERE user_id = ? AND account_id = ?", userID, fun).Scan(&num, &denom)
+	if num != 29 || denom != 100 {
+		t.Errorf("stored %d/%d, want 29/100", num, denom)
+	}
+
+	// Больше знаков, чем у рубля, — ошибка, а не тихое округление
+	code, resp = saveTransaction(t, h, userID, splitForm("Округление",
+		[3]string{food, "1.005", ""}, [3]string{card, "-1.005", ""}))
+	if code != 400 || resp["error"] == nil {
+		t.Errorf("expected 400 for extra precision, got %d %v", code, resp)
+	}
+	if code, _ := saveTransaction(t, h, userID, splitForm("Мусор",
+		[3]string{food, "12abc", ""}, [3]string{card, "-12", ""})); code != 400 {
+		t.Errorf("expected 400 for bad amount, got %d", code)
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import "math/big"
+
+// Amount — точная денежная сумма в виде дроби num/denom, как value_num/value_denom
+// и quantity_num/quantity_denom в GnuCash. Сложение сумм с разными знаменателями
+// (рубли в сотых, иены в целых, биткоины в стомиллионных) не теряет точности.
+// Нулевое значение Amount — ноль; методы не изменяют получателя.
+type Amount struct {
+	rat *big.Rat
+}
+
+// NewAmount создаёт сумму num/denom. Нулевой знаменатель встречается
+// в записях, сделанных до появления поля, — такие суммы хранились в сотых.
+func NewAmount(num, denom int64) Amount {
+	if denom == 0 {
+		denom = 100
+	}
+	return Amount{rat: big.NewRat(num, denom)}
+}
+
+// AmountFromRat создаёт сумму из big.Rat (значение копируется)
+func AmountFromRat(r *big.Rat) Amount {
+	return Amount{rat: new(big.Rat).Set(r)}
+}
+
+// Rat возвращает сумму как big.Rat (копию)
+func (a Amount) Rat() *big.Rat {
+	if a.rat == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(a.rat)
+}
+
+// Add возвращает a + b
+func (a Amount) Add(b Amount) Amount {
+	return Amount{rat: new(big.Rat).Add(a.Rat(), b.Rat())}
+}
+
+// Sub возвращает a - b
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{rat: new(big.Rat).Sub(a.Rat(), b.Rat())}
+}
+
+// Neg возвращает -a
+func (a Amount) Neg() Amount {
+	return Amount{rat: new(big.Rat).Neg(a.Rat())}
+}
+
+// Mul возвращает a, умноженную на r (например, на курс валюты)
+func (a Amount) Mul(r *big.Rat) Amount {
+	return Amount{rat: new(big.Rat).Mul(a.Rat(), r)}
+}
+
+// Sign возвращает -1, 0 или +1
+func (a Amount) Sign() int {
+	if a.rat == nil {
+		return 0
+	}
+	return a.rat.Sign()
+}
+
+// IsZero проверяет, что сумма равна нулю
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// Cmp сравнивает суммы: -1 если a < b, 0 если равны, +1 если a > b
+func (a Amount) Cmp(b Amount) int {
+	return a.Rat().Cmp(b.Rat())
+}
+
+// Float64 возвращает ближайшее float64 — только для отображения и графиков
+func (a Amount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+// FloatString форматирует сумму с prec знаками после точки (с округлением)
+func (a Amount) FloatString(prec int) string {
+	return a.Rat().FloatString(prec)
+}
+
+// String возвращает сумму в виде несократимой дроби ("1/3", "-5")
+func (a Amount) String() string {
+	return a.Rat().RatString()
+}
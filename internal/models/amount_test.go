@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestAmountArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want string
+	}{
+		{"zero value", Amount{}, "0"},
+		{"mixed denominators", NewAmount(1999, 100).Add(NewAmount(1, 1000)), "19991/1000"},
+		{"satoshi", NewAmount(1, 100000000).Add(NewAmount(2, 100000000)), "3/100000000"},
+		{"legacy zero denom", NewAmount(150, 0), "3/2"},
+		{"sub to zero", NewAmount(5, 1).Sub(NewAmount(500, 100)), "0"},
+		{"neg", NewAmount(-7, 10).Neg(), "7/10"},
+	}
+	for _, tt := range tests {
+		if s := tt.got.String(); s != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, s, tt.want)
+		}
+	}
+
+	// Тысячи сложений копеек не накапливают ошибку, в отличие от float64
+	var sum Amount
+	for i := 0; i < 10000; i++ {
+		sum = sum.Add(NewAmount(1, 100))
+	}
+	if sum.Cmp(NewAmount(100, 1)) != 0 || sum.FloatString(2) != "100.00" {
+		t.Errorf("sum of cents = %s", sum)
+	}
+
+	// Методы не изменяют получателя
+	a := NewAmount(1, 2)
+	a.Add(NewAmount(1, 2))
+	if a.String() != "1/2" || !(Amount{}).IsZero() || a.Sign() != 1 {
+		t.Errorf("receiver changed: %s", a)
+	}
+}
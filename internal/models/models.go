@@ -52,27 +52,46 @@ type Transaction struct {
 	Value       float64   `json:"value,omitempty"`
 }
 
-// Split представляет часть транзакции
+// Tag представляет тег транзакций
+type Tag struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+	Count  int    `json:"count"` // Число транзакций с тегом
+}
+
+// Split представляет часть транзакции.
+// Value — сумма в валюте транзакции, Quantity — в валюте (commodity) счёта;
+// для счёта в валюте транзакции они совпадают.
+// ReconcileState хранит состояние сверки в кодах GnuCash (ReconcileNew и др.)
 type Split struct {
-	ID         int64 `json:"id"`
-	UserID     int64 `json:"user_id"`
-	TxID       int64 `json:"tx_id"`
-	AccountID  int64 `json:"account_id"`
-	ValueNum   int64 `json:"value_num"`
-	ValueDenom int64 `json:"value_denom"`
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"user_id"`
+	TxID           int64      `json:"tx_id"`
+	AccountID      int64      `json:"account_id"`
+	ValueNum       int64      `json:"value_num"`
+	ValueDenom     int64      `json:"value_denom"`
+	QuantityNum    int64      `json:"quantity_num"`
+	QuantityDenom  int64      `json:"quantity_denom"`
+	Memo           string     `json:"memo"`
+	Action         string     `json:"action"`
+	ReconcileState string     `json:"reconcile_state"`
+	ReconcileDate  *time.Time `json:"reconcile_date,omitempty"`
 }
 
 // User представляет пользователя
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	IsActive     bool      `json:"is_active"`
-	IsAdmin      bool      `json:"is_admin"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID                  int64     `json:"id"`
+	Username            string    `json:"username"`
+	Email               string    `json:"email"`
+	PasswordHash        string    `json:"-"`
+	FirstName           string    `json:"first_name"`
+	LastName            string    `json:"last_name"`
+	IsActive            bool      `json:"is_active"`
+	IsAdmin             bool      `json:"is_admin"`
+	ReportingCurrencyID int64     `json:"reporting_currency_id"` // Валюта итогов дашборда
+	CreatedAt           time.Time `json:"created_at"`
 }
 
 // CurrencyRate представляет запись курса валюты
@@ -106,8 +125,47 @@ const (
 	AccountTypeIncome    = "INCOME"
 	AccountTypeExpense   = "EXPENSE"
 	AccountTypeEquity    = "EQUITY"
+
+	// Типы счетов GnuCash, которые приходят при импорте
+	AccountTypeCredit     = "CREDIT"
+	AccountTypeStock      = "STOCK"
+	AccountTypeMutual     = "MUTUAL"
+	AccountTypeReceivable = "RECEIVABLE"
+	AccountTypePayable    = "PAYABLE"
+	AccountTypeTrading    = "TRADING"
+	AccountTypeCurrency   = "CURRENCY"
+)
+
+// Состояния сверки сплита (как в GnuCash)
+const (
+	ReconcileNew        = "n" // не сверен
+	ReconcileCleared    = "c" // подтверждён, но ещё не сверен с выпиской
+	ReconcileReconciled = "y" // сверен с выпиской
+	ReconcileFrozen     = "f"
+	ReconcileVoided     = "v"
 )
 
+// IsKnownReconcileState проверяет, что состояние сверки поддерживается
+func IsKnownReconcileState(state string) bool {
+	switch state {
+	case ReconcileNew, ReconcileCleared, ReconcileReconciled, ReconcileFrozen, ReconcileVoided:
+		return true
+	}
+	return false
+}
+
+// IsKnownAccountType проверяет, что тип счета поддерживается
+func IsKnownAccountType(accountType string) bool {
+	switch accountType {
+	case AccountTypeRoot, AccountTypeAsset, AccountTypeCash, AccountTypeBank,
+		AccountTypeLiability, AccountTypeIncome, AccountTypeExpense, AccountTypeEquity,
+		AccountTypeCredit, AccountTypeStock, AccountTypeMutual, AccountTypeReceivable,
+		AccountTypePayable, AccountTypeTrading, AccountTypeCurrency:
+		return true
+	}
+	return false
+}
+
 // GetBalance вычисляет баланс счета
 func (a *Account) GetBalance() float64 {
 	if a.Balance != 0 {
@@ -0,0 +1,143 @@
+// Package money разбирает и форматирует денежные суммы без потери точности.
+// Суммы хранятся как в GnuCash — дробью num/denom, где denom обычно равен
+// fraction валюты (100 для рубля, 1 для иены, 100000000 для биткоина).
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSyntax — строка не является суммой
+	ErrSyntax = errors.New("некорректная сумма")
+	// ErrPrecision — у суммы больше знаков после запятой, чем допускает валюта
+	ErrPrecision = errors.New("слишком много знаков после запятой")
+	// ErrRange — сумма не помещается в int64
+	ErrRange = errors.New("слишком большая сумма")
+)
+
+// spaces — разделители разрядов, которые встречаются во вводе и при
+// копировании из банковских выписок: пробел, неразрывный и узкие пробелы
+var spaces = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "\u2009", "")
+
+// Parse точно разбирает десятичную сумму, введённую пользователем, в дробь
+// num/denom, где denom — степень десяти по числу знаков после запятой
+// ("19,99" → 1999/100, "5" → 5/1). Десятичный разделитель — запятая или
+// точка (один), разряды можно разделять пробелами; допускается знак + или -.
+func Parse(s string) (num, denom int64, err error) {
+	s = spaces.Replace(strings.TrimSpace(s))
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"), strings.HasPrefix(s, "+"):
+		negative = s[0] == '-'
+		s = s[1:]
+	case strings.HasPrefix(s, "−"): // типографский минус
+		negative = true
+		s = strings.TrimPrefix(s, "−")
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexAny(s, ",."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+		if strings.ContainsAny(fracPart, ",.") {
+			return 0, 0, ErrSyntax
+		}
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, 0, ErrSyntax
+	}
+
+	denom = 1
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, 0, ErrSyntax
+			}
+			if num > (math.MaxInt64-9)/10 {
+				return 0, 0, ErrRange
+			}
+			num = num*10 + int64(c-'0')
+		}
+	}
+	for range fracPart {
+		if denom > math.MaxInt64/10 {
+			return 0, 0, ErrRange
+		}
+		denom *= 10
+	}
+
+	if negative {
+		num = -num
+	}
+	return num, denom, nil
+}
+
+// Rescale переводит дробь num/denom к знаменателю fraction. Если сумму нельзя
+// записать с таким знаменателем без округления, возвращается ErrPrecision.
+func Rescale(num, denom, fraction int64) (int64, error) {
+	if denom <= 0 || fraction <= 0 {
+		return 0, ErrSyntax
+	}
+	scaled := new(big.Int).Mul(big.NewInt(num), big.NewInt(fraction))
+	quo, rem := new(big.Int).QuoRem(scaled, big.NewInt(denom), new(big.Int))
+	if rem.Sign() != 0 {
+		return 0, ErrPrecision
+	}
+	if !quo.IsInt64() {
+		return 0, ErrRange
+	}
+	return quo.Int64(), nil
+}
+
+// ParseFraction разбирает сумму сразу в числитель со знаменателем fraction
+func ParseFraction(s string, fraction int64) (int64, error) {
+	num, denom, err := Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	return Rescale(num, denom, fraction)
+}
+
+// Places возвращает число знаков после запятой для валюты с данным fraction.
+// Для fraction, не являющегося степенью десяти, берётся ближайшая большая степень.
+func Places(fraction int64) int {
+	places := 0
+	for p := int64(1); p < fraction && p <= math.MaxInt64/10; p *= 10 {
+		places++
+	}
+	return places
+}
+
+// FormatRat форматирует сумму с places знаками после точки, округляя
+// половину от нуля; отрицательный ноль печатается как ноль
+func FormatRat(r *big.Rat, places int) string {
+	s := r.FloatString(places)
+	if strings.HasPrefix(s, "-") && strings.Trim(s, "-0.") == "" {
+		return s[1:]
+	}
+	return s
+}
+
+// Format форматирует дробь num/denom с числом знаков валюты fraction
+func Format(num, denom, fraction int64) string {
+	if denom == 0 {
+		denom = 100
+	}
+	return FormatRat(big.NewRat(num, denom), Places(fraction))
+}
+
+// FormatFloat форматирует приближённое значение (из шаблонов и графиков)
+// с числом знаков валюты fraction. Округляется десятичная запись числа из 15
+// значащих цифр, а не его двоичное представление: 0.285 печатается как 0.29,
+// хотя в float64 это 0.28499999…
+func FormatFloat(value float64, fraction int64) string {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', 15, 64))
+	if !ok {
+		return FormatRat(new(big.Rat), Places(fraction)) // NaN и бесконечности
+	}
+	return FormatRat(r, Places(fraction))
+}
@@ -0,0 +1,100 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParseFraction(t *testing.T) {
+	tests := []struct {
+		input    string
+		fraction int64
+		want     int64
+		err      error
+	}{
+		// Суммы, которые через float64 и int64(value*100) теряли копейку
+		{"19.99", 100, 1999, nil},
+		{"0.29", 100, 29, nil},
+		{"1.15", 100, 115, nil},
+		{"4.35", 100, 435, nil},
+		{"1234567.89", 100, 123456789, nil},
+		{"-8.20", 100, -820, nil},
+
+		// Разделители
+		{"19,99", 100, 1999, nil},
+		{"1 234,50", 100, 123450, nil},
+		{"1 234 567", 100, 123456700, nil},
+		{"  +5 ", 100, 500, nil},
+		{"−12,5", 100, -1250, nil},
+		{".5", 100, 50, nil},
+		{"7.", 100, 700, nil},
+
+		// fraction валюты
+		{"1500", 1, 1500, nil},
+		{"1500.0", 1, 1500, nil},
+		{"1500.5", 1, 0, ErrPrecision},
+		{"0.00000001", 100000000, 1, nil},
+		{"1.005", 100, 0, ErrPrecision},
+		{"1.234", 1000, 1234, nil},
+
+		// Ошибки
+		{"", 100, 0, ErrSyntax},
+		{"-", 100, 0, ErrSyntax},
+		{"1,234.56", 100, 0, ErrSyntax},
+		{"12a", 100, 0, ErrSyntax},
+		{"1e3", 100, 0, ErrSyntax},
+		{"--1", 100, 0, ErrSyntax},
+		{"99999999999999999999", 100, 0, ErrRange},
+		{"92233720368547758.07", 1000, 0, ErrRange},
+	}
+	for _, tt := range tests {
+		got, err := ParseFraction(tt.input, tt.fraction)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseFraction(%q, %d) = %d, %v; want %d, %v", tt.input, tt.fraction, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	num, denom, err := Parse("19,990")
+	if err != nil || num != 19990 || denom != 1000 {
+		t.Errorf("Parse(19,990) = %d/%d, %v", num, denom, err)
+	}
+}
+
+func TestPlaces(t *testing.T) {
+	for fraction, want := range map[int64]int{1: 0, 10: 1, 100: 2, 1000: 3, 100000000: 8, 0: 0, 12: 2} {
+		if got := Places(fraction); got != want {
+			t.Errorf("Places(%d) = %d, want %d", fraction, got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{Format(1999, 100, 100), "19.99"},
+		{Format(-820, 100, 100), "-8.20"},
+		{Format(1500, 1, 1), "1500"},
+		{Format(1, 100000000, 100000000), "0.00000001"},
+		{Format(12345, 1000, 100), "12.35"}, // половина — от нуля
+		{Format(-12345, 1000, 100), "-12.35"},
+		{Format(-1, 1000, 100), "0.00"}, // без отрицательного нуля
+		{Format(150, 0, 100), "1.50"},
+		{FormatFloat(0.285, 100), "0.29"},
+		{FormatFloat(1.005, 100), "1.01"},
+		{FormatFloat(19.99, 100), "19.99"},
+		{FormatFloat(-0.001, 100), "0.00"},
+		{FormatFloat(1e6, 100), "1000000.00"},
+		{FormatFloat(123.456, 1), "123"},
+		{FormatRat(big.NewRat(2, 3), 2), "0.67"},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("case %d: got %s, want %s", i, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package networth обслуживает кеш чистого капитала: помесячные снимки
+// net_worth_snapshots считаются при показе графика и сбрасываются при любом
+// изменении проводок — из веб-интерфейса, импорта или по расписанию.
+package networth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Execer — *sql.DB или *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Invalidate удаляет снимки чистого капитала, которые включают проводки
+// с датой from: они пересчитаются при следующем показе. Нулевой from — все
+// снимки пользователя (смена типа или валюты счёта, перенос операций между
+// счетами, импорт).
+func Invalidate(db Execer, userID int64, from time.Time) error {
+	if from.IsZero() {
+		_, err := db.Exec("DELETE FROM net_worth_snapshots WHERE user_id = ?", userID)
+		return err
+	}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	_, err := db.Exec("DELETE FROM net_worth_snapshots WHERE user_id = ? AND month >= ?", userID, day)
+	return err
+}
@@ -0,0 +1,170 @@
+// Package ofx читает банковские выписки OFX (QFX — тот же OFX из Quicken).
+// Версии 1.x записаны в SGML, где листовые элементы не закрываются
+// (<TRNAMT>-12.50), версии 2.x — в XML. Разбор у них общий: элемент с
+// текстом считается листом, остальные — агрегатами.
+package ofx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/evbogdanov/finforme/internal/money"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Transaction — операция выписки (STMTTRN)
+type Transaction struct {
+	FITID      string    // идентификатор операции в банке, уникален в пределах счёта
+	Type       string    // TRNTYPE: DEBIT, CREDIT, FEE, ...
+	Date       time.Time // DTPOSTED без времени
+	Num, Denom int64     // TRNAMT: плюс — зачисление, минус — списание
+	Name       string
+	Memo       string
+}
+
+// Statement — выписка по одному счёту: банковскому (STMTRS) или карточному (CCSTMTRS)
+type Statement struct {
+	Currency     string // CURDEF, например USD
+	AccountID    string // ACCTID — номер счёта или карты в банке
+	Transactions []Transaction
+}
+
+// Parse разбирает выписку OFX. Выписки по нескольким счетам в одном файле
+// не поддерживаются: операции нельзя было бы разнести по счетам книги.
+func Parse(data []byte) (*Statement, error) {
+	start := bytes.Index(data, []byte("<OFX>"))
+	if start < 0 {
+		return nil, errors.New("Файл не похож на OFX")
+	}
+	body, err := decode(string(data[:start]), data[start:])
+	if err != nil {
+		return nil, err
+	}
+
+	var st Statement
+	var tx *Transaction
+	statements := 0
+	for s := body; ; {
+		open := strings.IndexByte(s, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(s[open:], '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.ToUpper(strings.TrimSpace(s[open+1 : open+end]))
+		s = s[open+end+1:]
+		value := s
+		if next := strings.IndexByte(s, '<'); next >= 0 {
+			value = s[:next]
+		}
+		value = strings.TrimSpace(html.UnescapeString(value))
+
+		switch {
+		case tag == "" || tag[0] == '?' || tag[0] == '!' || strings.HasSuffix(tag, "/"):
+			// Инструкции, комментарии и пустые элементы
+		case tag == "STMTRS" || tag == "CCSTMTRS":
+			statements++
+		case tag == "STMTTRN":
+			tx = &Transaction{}
+		case tag == "/STMTTRN":
+			if tx == nil {
+				return nil, errors.New("Некорректный OFX: лишний </STMTTRN>")
+			}
+			if err := tx.validate(len(st.Transactions) + 1); err != nil {
+				return nil, err
+			}
+			st.Transactions = append(st.Transactions, *tx)
+			tx = nil
+		case tag == "ACCTID" && tx == nil:
+			// ACCTID внутри операции — счёт получателя перевода (BANKACCTTO)
+			if st.AccountID != "" && st.AccountID != value {
+				return nil, errors.New("В файле выписки по нескольким счетам — выгрузите их по отдельности")
+			}
+			st.AccountID = value
+		case tag == "CURDEF":
+			st.Currency = strings.ToUpper(value)
+		case tx != nil:
+			if err := tx.set(tag, value, len(st.Transactions)+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if statements == 0 {
+		return nil, errors.New("В файле нет выписки по банковскому счёту или карте")
+	}
+	if tx != nil {
+		return nil, errors.New("Некорректный OFX: операция не закрыта")
+	}
+	return &st, nil
+}
+
+// set заполняет поле операции по листовому элементу
+func (tx *Transaction) set(tag, value string, n int) error {
+	var err error
+	switch tag {
+	case "FITID":
+		tx.FITID = value
+	case "TRNTYPE":
+		tx.Type = strings.ToUpper(value)
+	case "DTPOSTED":
+		// ГГГГММДД, дальше необязательны время и часовой пояс: дата — банковская
+		if len(value) < 8 {
+			return fmt.Errorf("Операция %d: некорректная дата %q", n, value)
+		}
+		if tx.Date, err = time.Parse("20060102", value[:8]); err != nil {
+			return fmt.Errorf("Операция %d: некорректная дата %q", n, value)
+		}
+	case "TRNAMT":
+		if tx.Num, tx.Denom, err = money.Parse(value); err != nil {
+			return fmt.Errorf("Операция %d: сумма %q: %v", n, value, err)
+		}
+	case "NAME":
+		// NAME бывает и прямо в STMTTRN, и в агрегате PAYEE
+		if tx.Name == "" {
+			tx.Name = value
+		}
+	case "MEMO":
+		tx.Memo = value
+	}
+	return nil
+}
+
+// validate проверяет обязательные поля закрытой операции
+func (tx *Transaction) validate(n int) error {
+	switch {
+	case tx.FITID == "":
+		return fmt.Errorf("Операция %d: нет FITID", n)
+	case tx.Date.IsZero():
+		return fmt.Errorf("Операция %d: нет даты", n)
+	case tx.Denom == 0:
+		return fmt.Errorf("Операция %d: нет суммы", n)
+	}
+	return nil
+}
+
+// decode переводит выписку в UTF-8 по заголовку: CHARSET:1251 в SGML или
+// encoding="windows-1251" в XML. Иначе файл в UTF-8, а если он не
+// в UTF-8 — в Windows-1252, кодировке по умолчанию для OFX 1.x.
+func decode(header string, body []byte) (string, error) {
+	header = strings.ToUpper(header)
+	var decoder *charmap.Charmap
+	switch {
+	case strings.Contains(header, "CHARSET:1251") || strings.Contains(header, "WINDOWS-1251"):
+		decoder = charmap.Windows1251
+	case utf8.Valid(body):
+		return string(body), nil
+	default:
+		decoder = charmap.Windows1252
+	}
+	decoded, _, err := transform.Bytes(decoder.NewDecoder(), body)
+	return string(decoded), err
+}
@@ -0,0 +1,108 @@
+package ofx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describe — операции выписки одной строкой для сравнения
+func describe(st *Statement) string {
+	var out []string
+	for _, tx := range st.Transactions {
+		out = append(out, fmt.Sprintf("%s %s %s %d/%d %s|%s", tx.FITID, tx.Type, tx.Date.Format("2006-01-02"),
+			tx.Num, tx.Denom, tx.Name, tx.Memo))
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestParseSGML(t *testing.T) {
+	statement := "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nENCODING:USASCII\r\nCHARSET:1252\r\n\r\n" +
+		"<OFX><SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>\r\n" +
+		"<BANKMSGSRSV1><STMTTRNRS><TRNUID>1<STMTRS><CURDEF>usd\r\n" +
+		"<BANKACCTFROM><BANKID>121000248<ACCTID>12345<ACCTTYPE>CHECKING</BANKACCTFROM>\r\n" +
+		"<BANKTRANLIST><DTSTART>20260301<DTEND>20260331\r\n" +
+		"<STMTTRN><TRNTYPE>debit<DTPOSTED>20260302120000.000[-5:EST]<TRNAMT>-12.50<FITID>A1\r\n" +
+		"<NAME>Caf\xe9 &amp; Bar<MEMO>Card 1234</STMTTRN>\r\n" +
+		"<STMTTRN><TRNTYPE>XFER<DTPOSTED>20260305<TRNAMT>+1000<FITID>A2\r\n" +
+		"<PAYEE><NAME>Employer<ADDR1>Main st.</PAYEE><BANKACCTTO><BANKID>1<ACCTID>999<ACCTTYPE>SAVINGS</BANKACCTTO></STMTTRN>\r\n" +
+		"</BANKTRANLIST><LEDGERBAL><BALAMT>987.50<DTASOF>20260331</LEDGERBAL></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\r\n"
+
+	st, err := Parse([]byte(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Currency != "USD" || st.AccountID != "12345" {
+		t.Errorf("statement: %s %s", st.Currency, st.AccountID)
+	}
+	want := "A1 DEBIT 2026-03-02 -1250/100 Café & Bar|Card 1234, A2 XFER 2026-03-05 1000/1 Employer|"
+	if got := describe(st); got != want {
+		t.Errorf("transactions:\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	statement := `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <TRNUID>1</TRNUID>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM><ACCTID>4111********1111</ACCTID></CCACCTFROM>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20260410</DTPOSTED>
+            <TRNAMT>-7,90</TRNAMT>
+            <FITID>2026041000001</FITID>
+            <NAME>Bäckerei &lt;Nord&gt;</NAME>
+            <MEMO/>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>CREDIT</TRNTYPE>
+            <DTPOSTED>20260411093000</DTPOSTED>
+            <TRNAMT>100.00</TRNAMT>
+            <FITID>2026041100002</FITID>
+            <MEMO>Payment, thank you</MEMO>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>`
+
+	st, err := Parse([]byte(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Currency != "EUR" || st.AccountID != "4111********1111" {
+		t.Errorf("statement: %s %s", st.Currency, st.AccountID)
+	}
+	want := "2026041000001 DEBIT 2026-04-10 -790/100 Bäckerei <Nord>|, 2026041100002 CREDIT 2026-04-11 10000/100 |Payment, thank you"
+	if got := describe(st); got != want {
+		t.Errorf("transactions:\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	trn := func(fields string) string {
+		return "<OFX><STMTRS><CURDEF>USD<BANKACCTFROM><ACCTID>1</BANKACCTFROM><STMTTRN>" + fields + "</STMTTRN></STMTRS></OFX>"
+	}
+	for name, tt := range map[string]struct{ data, err string }{
+		"not ofx":      {"Date;Amount\n", "не похож на OFX"},
+		"investments":  {"<OFX><INVSTMTRS></INVSTMTRS></OFX>", "нет выписки"},
+		"no fitid":     {trn("<DTPOSTED>20260301<TRNAMT>1"), "Операция 1: нет FITID"},
+		"no amount":    {trn("<DTPOSTED>20260301<FITID>X"), "нет суммы"},
+		"bad date":     {trn("<DTPOSTED>2026-03-01<TRNAMT>1<FITID>X"), "некорректная дата"},
+		"bad amount":   {trn("<DTPOSTED>20260301<TRNAMT>1e3<FITID>X"), "сумма"},
+		"unclosed":     {"<OFX><STMTRS><STMTTRN><FITID>X</OFX>", "не закрыта"},
+		"two accounts": {"<OFX><STMTRS><ACCTID>1</STMTRS><STMTRS><ACCTID>2</STMTRS></OFX>", "нескольким счетам"},
+	} {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, expected %q", name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package schedule — запланированные (повторяющиеся) транзакции: правила
+// повторения, шаблоны сплитов и создание транзакций по наступившим датам.
+// Запускается из cmd/schedule-runner по крону и из интерфейса по кнопке.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Виды правил повторения
+const (
+	// RuleMonthly — каждые Interval месяцев в день Day (1–31); в коротких
+	// месяцах — в последний день месяца
+	RuleMonthly = "monthly"
+	// RuleWeekly — каждые Interval недель в день недели Day (0 — воскресенье)
+	RuleWeekly = "weekly"
+	// RuleDays — каждые Interval дней начиная с даты начала
+	RuleDays = "days"
+	// RuleLastBusinessDay — каждые Interval месяцев в последний будний день
+	// месяца; праздники не учитываются
+	RuleLastBusinessDay = "last_business_day"
+)
+
+// maxDates ограничивает число дат одного расписания за один расчёт:
+// «каждый день» за 10 лет — это 3653 даты
+const maxDates = 10000
+
+// Rule — правило повторения
+type Rule struct {
+	Kind     string
+	Interval int
+	Day      int
+}
+
+// Validate проверяет параметры правила
+func (r Rule) Validate() error {
+	if r.Interval < 1 {
+		return errors.New("интервал повторения должен быть не меньше 1")
+	}
+	switch r.Kind {
+	case RuleMonthly:
+		if r.Day < 1 || r.Day > 31 {
+			return errors.New("день месяца должен быть от 1 до 31")
+		}
+	case RuleWeekly:
+		if r.Day < 0 || r.Day > 6 {
+			return errors.New("некорректный день недели")
+		}
+	case RuleDays, RuleLastBusinessDay:
+	default:
+		return errors.New("неизвестное правило повторения")
+	}
+	return nil
+}
+
+// weekdays — дни недели для Describe: «по понедельникам»
+var weekdays = [...]string{"воскресеньям", "понедельникам", "вторникам", "средам", "четвергам", "пятницам", "субботам"}
+
+// Describe возвращает правило словами: «ежемесячно, 5-го числа»
+func (r Rule) Describe() string {
+	every := func(unit string) string {
+		if r.Interval == 1 {
+			return ""
+		}
+		return fmt.Sprintf(" (каждые %d %s)", r.Interval, unit)
+	}
+	switch r.Kind {
+	case RuleMonthly:
+		return fmt.Sprintf("ежемесячно, %d-го числа", r.Day) + every("мес.")
+	case RuleWeekly:
+		if r.Day >= 0 && r.Day < len(weekdays) {
+			return "еженедельно по " + weekdays[r.Day] + every("нед.")
+		}
+	case RuleDays:
+		if r.Interval == 1 {
+			return "ежедневно"
+		}
+		return fmt.Sprintf("каждые %d дн.", r.Interval)
+	case RuleLastBusinessDay:
+		return "в последний рабочий день месяца" + every("мес.")
+	}
+	return r.Kind
+}
+
+// Dates возвращает даты повторения начиная со start и не позже until,
+// но не больше limit дат (limit = 0 — без ограничения). Нумерация
+// повторений всегда идёт от start, поэтому limit — это общее число
+// повторений расписания, а не число дат после последнего запуска.
+func (r Rule) Dates(start, until time.Time, limit int) []time.Time {
+	if r.Validate() != nil {
+		return nil
+	}
+	start = day(start)
+	until = day(until)
+	if limit <= 0 || limit > maxDates {
+		limit = maxDates
+	}
+
+	var dates []time.Time
+	for k := 0; len(dates) < limit; k++ {
+		d := r.nth(start, k)
+		if d.After(until) {
+			break
+		}
+		// В первом месяце день повторения может быть раньше даты начала
+		if !d.Before(start) {
+			dates = append(dates, d)
+		}
+	}
+	return dates
+}
+
+// nth возвращает k-ю дату сетки правила, привязанной к start
+func (r Rule) nth(start time.Time, k int) time.Time {
+	switch r.Kind {
+	case RuleMonthly, RuleLastBusinessDay:
+		month := time.Date(start.Year(), start.Month()+time.Month(k*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+		last := month.AddDate(0, 1, -1)
+		if r.Kind == RuleMonthly {
+			return month.AddDate(0, 0, min(r.Day, last.Day())-1)
+		}
+		return lastBusinessDay(last)
+	case RuleWeekly:
+		first := start.AddDate(0, 0, (r.Day-int(start.Weekday())+7)%7)
+		return first.AddDate(0, 0, 7*r.Interval*k)
+	default:
+		return start.AddDate(0, 0, r.Interval*k)
+	}
+}
+
+// lastBusinessDay переносит последний день месяца с выходных на пятницу
+func lastBusinessDay(last time.Time) time.Time {
+	switch last.Weekday() {
+	case time.Saturday:
+		return last.AddDate(0, 0, -1)
+	case time.Sunday:
+		return last.AddDate(0, 0, -2)
+	}
+	return last
+}
+
+// day отбрасывает время и часовой пояс: расписание работает с датами
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
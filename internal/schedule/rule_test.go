@@ -0,0 +1,91 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func formatDates(dates []time.Time) string {
+	parts := make([]string, len(dates))
+	for i, d := range dates {
+		parts[i] = d.Format("2006-01-02")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestRuleDates(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		start string
+		until string
+		limit int
+		want  string
+	}{
+		{"monthly on 5th", Rule{RuleMonthly, 1, 5}, "2026-01-05", "2026-03-31", 0,
+			"2026-01-05 2026-02-05 2026-03-05"},
+		// 31-е в коротких месяцах — последний день месяца, дальше снова 31-е
+		{"monthly on 31st", Rule{RuleMonthly, 1, 31}, "2026-01-31", "2026-05-31", 0,
+			"2026-01-31 2026-02-28 2026-03-31 2026-04-30 2026-05-31"},
+		{"leap february", Rule{RuleMonthly, 1, 30}, "2028-01-30", "2028-03-30", 0,
+			"2028-01-30 2028-02-29 2028-03-30"},
+		// День повторения в первом месяце раньше даты начала — пропускается
+		{"monthly after start", Rule{RuleMonthly, 1, 1}, "2026-01-15", "2026-03-01", 0,
+			"2026-02-01 2026-03-01"},
+		{"quarterly", Rule{RuleMonthly, 3, 10}, "2026-01-10", "2026-12-31", 0,
+			"2026-01-10 2026-04-10 2026-07-10 2026-10-10"},
+		{"weekly on monday", Rule{RuleWeekly, 1, 1}, "2026-03-04", "2026-03-24", 0,
+			"2026-03-09 2026-03-16 2026-03-23"},
+		{"biweekly on friday", Rule{RuleWeekly, 2, 5}, "2026-03-06", "2026-04-10", 0,
+			"2026-03-06 2026-03-20 2026-04-03"},
+		{"every 10 days", Rule{RuleDays, 10, 0}, "2026-02-25", "2026-03-20", 0,
+			"2026-02-25 2026-03-07 2026-03-17"},
+		// Январь 2026 кончается субботой, май — воскресеньем
+		{"last business day", Rule{RuleLastBusinessDay, 1, 0}, "2026-01-01", "2026-05-31", 0,
+			"2026-01-30 2026-02-27 2026-03-31 2026-04-30 2026-05-29"},
+		{"limit", Rule{RuleMonthly, 1, 5}, "2026-01-05", "2026-12-31", 2,
+			"2026-01-05 2026-02-05"},
+		{"until before start", Rule{RuleDays, 1, 0}, "2026-03-10", "2026-03-09", 0, ""},
+		{"invalid day", Rule{RuleMonthly, 1, 32}, "2026-01-01", "2026-12-31", 0, ""},
+		{"invalid interval", Rule{RuleDays, 0, 0}, "2026-01-01", "2026-12-31", 0, ""},
+	}
+	for _, tt := range tests {
+		got := formatDates(tt.rule.Dates(date(tt.start), date(tt.until), tt.limit))
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	end := date("2026-04-30")
+	s := &Schedule{Rule: Rule{RuleMonthly, 1, 31}, StartDate: date("2026-01-31"), EndDate: &end}
+
+	if next, ok := s.Next(date("2026-02-10")); !ok || !next.Equal(date("2026-02-28")) {
+		t.Errorf("Next = %v %v, want 2026-02-28", next, ok)
+	}
+	// Дата повторения, равная today, уже наступила
+	if next, ok := s.Next(date("2026-03-31")); !ok || !next.Equal(date("2026-04-30")) {
+		t.Errorf("Next = %v %v, want 2026-04-30", next, ok)
+	}
+	if _, ok := s.Next(date("2026-04-30")); ok {
+		t.Error("schedule must end at its end date")
+	}
+
+	s = &Schedule{Rule: Rule{RuleDays, 1, 0}, StartDate: date("2026-03-01"), MaxOccurrences: 3}
+	if got := formatDates(s.Dates(date("2026-03-31"))); got != "2026-03-01 2026-03-02 2026-03-03" {
+		t.Errorf("Dates with MaxOccurrences = %q", got)
+	}
+	if _, ok := s.Next(date("2026-03-10")); ok {
+		t.Error("schedule must end after MaxOccurrences")
+	}
+}
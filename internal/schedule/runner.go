@@ -0,0 +1,197 @@
+package schedule
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Report — итог запуска: сколько транзакций и напоминаний создано
+type Report struct {
+	Created   int
+	Reminders int
+	Errors    []error
+}
+
+// Run создаёт повторения, наступившие к today, для расписаний пользователя
+// (userID = 0 — всех пользователей). Запуск идемпотентен: каждая дата
+// расписания записывается в scheduled_occurrences один раз (уникальный ключ
+// scheduled_id + occurrence_date), поэтому повторный или параллельный запуск
+// не создаёт дублей. Удалённая пользователем транзакция не создаётся заново.
+// Ошибка одного расписания не останавливает остальные и попадает в Report.Errors.
+func Run(db *sql.DB, userID int64, today time.Time) (*Report, error) {
+	schedules, err := Load(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	for _, s := range schedules {
+		if !s.Enabled {
+			continue
+		}
+		if err := materialize(db, s, today, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("расписание %d «%s»: %w", s.ID, s.Description, err))
+		}
+	}
+	return report, nil
+}
+
+// materialize создаёт недостающие повторения одного расписания
+func materialize(db *sql.DB, s *Schedule, today time.Time, report *Report) error {
+	done, err := occurrenceDates(db, s.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, date := range s.Dates(today) {
+		if done[date.Format("2006-01-02")] {
+			continue
+		}
+		if s.Mode == ModeAuto && !s.balanced() {
+			return ErrUnbalanced
+		}
+
+		created, err := addOccurrence(db, s, date)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !created:
+			// Дату уже обработал параллельный запуск
+		case s.Mode == ModeAuto:
+			report.Created++
+		default:
+			report.Reminders++
+		}
+	}
+	return nil
+}
+
+// occurrenceDates возвращает уже обработанные даты расписания
+func occurrenceDates(db *sql.DB, scheduledID int64) (map[string]bool, error) {
+	rows, err := db.Query("SELECT occurrence_date FROM scheduled_occurrences WHERE scheduled_id = ?", scheduledID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make(map[string]bool)
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates[date.Format("2006-01-02")] = true
+	}
+	return dates, rows.Err()
+}
+
+// addOccurrence записывает повторение и, в режиме ModeAuto, создаёт
+// транзакцию — в одной транзакции БД. false — дата уже записана.
+func addOccurrence(db *sql.DB, s *Schedule, date time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	status := StatusPending
+	if s.Mode == ModeAuto {
+		status = StatusCreated
+	}
+	result, err := tx.Exec(`
+		INSERT IGNORE INTO scheduled_occurrences (user_id, scheduled_id, occurrence_date, status)
+		VALUES (?, ?, ?, ?)
+	`, s.UserID, s.ID, date, status)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	occurrenceID, _ := result.LastInsertId()
+
+	if s.Mode == ModeAuto {
+		txID, err := insertTransaction(tx, s, date)
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec("UPDATE scheduled_occurrences SET tx_id = ? WHERE id = ?", txID, occurrenceID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// Post проводит напоминание: создаёт транзакцию по шаблону расписания
+// на дату повторения и возвращает её id
+func Post(db *sql.DB, userID, occurrenceID int64) (int64, error) {
+	var scheduledID int64
+	var date time.Time
+	var status string
+	err := db.QueryRow(`
+		SELECT scheduled_id, occurrence_date, status FROM scheduled_occurrences WHERE id = ? AND user_id = ?
+	`, occurrenceID, userID).Scan(&scheduledID, &date, &status)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status != StatusPending {
+		return 0, ErrNotPending
+	}
+
+	s, err := Get(db, userID, scheduledID)
+	if err != nil {
+		return 0, err
+	}
+	if !s.balanced() {
+		return 0, ErrUnbalanced
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Условие на status защищает от двойного проведения
+	result, err := tx.Exec("UPDATE scheduled_occurrences SET status = ? WHERE id = ? AND status = ?",
+		StatusCreated, occurrenceID, StatusPending)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, ErrNotPending
+	}
+	txID, err := insertTransaction(tx, s, date)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE scheduled_occurrences SET tx_id = ? WHERE id = ?", txID, occurrenceID); err != nil {
+		return 0, err
+	}
+	return txID, tx.Commit()
+}
+
+// Skip пропускает напоминание без создания транзакции
+func Skip(db *sql.DB, userID, occurrenceID int64) error {
+	result, err := db.Exec(`
+		UPDATE scheduled_occurrences SET status = ? WHERE id = ? AND user_id = ? AND status = ?
+	`, StatusSkipped, occurrenceID, userID, StatusPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM scheduled_occurrences WHERE id = ? AND user_id = ?",
+			occurrenceID, userID).Scan(&exists)
+		if exists == 0 {
+			return ErrNotFound
+		}
+		return ErrNotPending
+	}
+	return nil
+}
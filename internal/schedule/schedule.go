@@ -0,0 +1,303 @@
+package schedule
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/evbogdanov/finforme/internal/models"
+	"github.com/evbogdanov/finforme/internal/networth"
+	"github.com/evbogdanov/finforme/internal/tags"
+)
+
+// Режимы расписания
+const (
+	// ModeAuto — транзакция создаётся сама при наступлении даты
+	ModeAuto = "auto"
+	// ModeRemind — создаётся напоминание, транзакцию проводит пользователь
+	ModeRemind = "remind"
+)
+
+// Состояния повторения в scheduled_occurrences
+const (
+	StatusCreated = "created"
+	StatusPending = "pending"
+	StatusSkipped = "skipped"
+)
+
+var (
+	// ErrNotFound — расписание или повторение не найдено у пользователя
+	ErrNotFound = errors.New("не найдено")
+	// ErrNotPending — напоминание уже проведено или пропущено
+	ErrNotPending = errors.New("напоминание уже обработано")
+	// ErrUnbalanced — шаблон сплитов не сбалансирован (например, после
+	// удаления одного из счетов шаблона)
+	ErrUnbalanced = errors.New("шаблон транзакции не сбалансирован")
+)
+
+// Split — строка шаблона транзакции
+type Split struct {
+	AccountID     int64
+	ValueNum      int64
+	ValueDenom    int64
+	QuantityNum   int64
+	QuantityDenom int64
+	Memo          string
+	Action        string
+}
+
+// Schedule — запланированная транзакция: шаблон и правило повторения
+type Schedule struct {
+	ID             int64
+	UserID         int64
+	Description    string
+	Tags           string
+	CurrencyID     int64
+	Rule           Rule
+	StartDate      time.Time
+	EndDate        *time.Time // nil — без даты окончания
+	MaxOccurrences int        // 0 — без ограничения числа повторений
+	Mode           string
+	Enabled        bool
+	Splits         []Split
+}
+
+// Dates возвращает даты повторений, наступившие к today
+func (s *Schedule) Dates(today time.Time) []time.Time {
+	until := today
+	if s.EndDate != nil && s.EndDate.Before(until) {
+		until = *s.EndDate
+	}
+	return s.Rule.Dates(s.StartDate, until, s.MaxOccurrences)
+}
+
+// Next возвращает ближайшую дату повторения после today;
+// false — расписание закончилось
+func (s *Schedule) Next(today time.Time) (time.Time, bool) {
+	// Между соседними датами любого правила не больше 31*Interval дней
+	until := day(today).AddDate(0, 0, 31*s.Rule.Interval+7)
+	if s.EndDate != nil && s.EndDate.Before(until) {
+		until = *s.EndDate
+	}
+	for _, d := range s.Rule.Dates(s.StartDate, until, s.MaxOccurrences) {
+		if d.After(day(today)) {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// balanced проверяет, что шаблон можно провести как транзакцию
+func (s *Schedule) balanced() bool {
+	var sum models.Amount
+	for _, sp := range s.Splits {
+		sum = sum.Add(models.NewAmount(sp.ValueNum, sp.ValueDenom))
+	}
+	return len(s.Splits) >= 2 && sum.IsZero()
+}
+
+// Load читает расписания пользователя вместе с шаблонами сплитов;
+// userID = 0 — расписания всех пользователей (для cmd/schedule-runner)
+func Load(db *sql.DB, userID int64) ([]*Schedule, error) {
+	query := `
+		SELECT id, user_id, description, tags, currency_id, rule, rule_interval, rule_day,
+		       start_date, end_date, max_occurrences, mode, enabled
+		FROM scheduled_transactions`
+	var args []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	byID := make(map[int64]*Schedule)
+	for rows.Next() {
+		s := &Schedule{}
+		var tagList sql.NullString
+		var endDate sql.NullTime
+		var maxOccurrences sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Description, &tagList, &s.CurrencyID,
+			&s.Rule.Kind, &s.Rule.Interval, &s.Rule.Day, &s.StartDate, &endDate,
+			&maxOccurrences, &s.Mode, &s.Enabled); err != nil {
+			return nil, err
+		}
+		s.Tags = tagList.String
+		if endDate.Valid {
+			s.EndDate = &endDate.Time
+		}
+		s.MaxOccurrences = int(maxOccurrences.Int64)
+		schedules = append(schedules, s)
+		byID[s.ID] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT scheduled_id, account_id, value_num, value_denom, quantity_num, quantity_denom, memo, action
+		FROM scheduled_splits`
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+	}
+	splitRows, err := db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer splitRows.Close()
+	for splitRows.Next() {
+		var scheduledID int64
+		var sp Split
+		if err := splitRows.Scan(&scheduledID, &sp.AccountID, &sp.ValueNum, &sp.ValueDenom,
+			&sp.QuantityNum, &sp.QuantityDenom, &sp.Memo, &sp.Action); err != nil {
+			return nil, err
+		}
+		if s := byID[scheduledID]; s != nil {
+			s.Splits = append(s.Splits, sp)
+		}
+	}
+	return schedules, splitRows.Err()
+}
+
+// Get читает одно расписание пользователя
+func Get(db *sql.DB, userID, id int64) (*Schedule, error) {
+	schedules, err := Load(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range schedules {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Save создаёт расписание (s.ID = 0) или обновляет его вместе с шаблоном.
+// История повторений при обновлении сохраняется: уже созданные даты
+// повторно не создаются. Принадлежность счетов проверяет вызывающий.
+func Save(db *sql.DB, s *Schedule) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var maxOccurrences sql.NullInt64
+	if s.MaxOccurrences > 0 {
+		maxOccurrences = sql.NullInt64{Int64: int64(s.MaxOccurrences), Valid: true}
+	}
+
+	if s.ID == 0 {
+		result, err := tx.Exec(`
+			INSERT INTO scheduled_transactions (user_id, description, tags, currency_id, rule, rule_interval,
+			                                    rule_day, start_date, end_date, max_occurrences, mode, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, s.UserID, s.Description, s.Tags, s.CurrencyID, s.Rule.Kind, s.Rule.Interval, s.Rule.Day,
+			s.StartDate, s.EndDate, maxOccurrences, s.Mode, s.Enabled)
+		if err != nil {
+			return 0, err
+		}
+		s.ID, _ = result.LastInsertId()
+	} else {
+		result, err := tx.Exec(`
+			UPDATE scheduled_transactions
+			SET description = ?, tags = ?, currency_id = ?, rule = ?, rule_interval = ?, rule_day = ?,
+			    start_date = ?, end_date = ?, max_occurrences = ?, mode = ?, enabled = ?
+			WHERE id = ? AND user_id = ?
+		`, s.Description, s.Tags, s.CurrencyID, s.Rule.Kind, s.Rule.Interval, s.Rule.Day,
+			s.StartDate, s.EndDate, maxOccurrences, s.Mode, s.Enabled, s.ID, s.UserID)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			// UPDATE без изменений тоже даёт 0 — проверяем, что расписание есть
+			var exists int
+			tx.QueryRow("SELECT COUNT(*) FROM scheduled_transactions WHERE id = ? AND user_id = ?",
+				s.ID, s.UserID).Scan(&exists)
+			if exists == 0 {
+				return 0, ErrNotFound
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM scheduled_splits WHERE scheduled_id = ? AND user_id = ?",
+			s.ID, s.UserID); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, sp := range s.Splits {
+		_, err := tx.Exec(`
+			INSERT INTO scheduled_splits (user_id, scheduled_id, account_id, value_num, value_denom,
+			                              quantity_num, quantity_denom, memo, action)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, s.UserID, s.ID, sp.AccountID, sp.ValueNum, sp.ValueDenom, sp.QuantityNum, sp.QuantityDenom,
+			sp.Memo, sp.Action)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return s.ID, tx.Commit()
+}
+
+// Delete удаляет расписание с шаблоном и историей повторений.
+// Созданные по расписанию транзакции остаются в книге.
+func Delete(db *sql.DB, userID, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"scheduled_splits", "scheduled_occurrences"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE scheduled_id = ? AND user_id = ?", id, userID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec("DELETE FROM scheduled_transactions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// insertTransaction проводит шаблон расписания как транзакцию на дату date
+func insertTransaction(tx *sql.Tx, s *Schedule, date time.Time) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO transactions (user_id, currency_id, post_date, enter_date, description)
+		VALUES (?, ?, ?, ?, ?)
+	`, s.UserID, s.CurrencyID, date, time.Now(), s.Description)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	txID, _ := result.LastInsertId()
+	if err := tags.Set(tx, s.UserID, txID, tags.Parse(s.Tags)); err != nil {
+		return 0, fmt.Errorf("failed to tag transaction: %w", err)
+	}
+
+	for _, sp := range s.Splits {
+		_, err := tx.Exec(`
+			INSERT INTO splits (user_id, tx_id, account_id, value_num, value_denom,
+			                    quantity_num, quantity_denom, memo, action, reconcile_state)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, s.UserID, txID, sp.AccountID, sp.ValueNum, sp.ValueDenom, sp.QuantityNum, sp.QuantityDenom,
+			sp.Memo, sp.Action, models.ReconcileNew)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create split: %w", err)
+		}
+	}
+
+	// Снимки чистого капитала с даты проводки пересчитаются при показе
+	if err := networth.Invalidate(tx, s.UserID, date); err != nil {
+		return 0, fmt.Errorf("failed to reset net worth snapshots: %w", err)
+	}
+	return txID, nil
+}
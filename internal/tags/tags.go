@@ -0,0 +1,86 @@
+// Package tags хранит теги транзакций: справочник tags пользователя и связи
+// transaction_tags. В формах и выгрузках теги — строка через запятую, поэтому
+// запятой в имени тега быть не может.
+package tags
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxNameLength — максимальная длина имени тега в символах
+const MaxNameLength = 64
+
+// Column — SQL-выражение со списком тегов транзакции t через запятую,
+// по алфавиту; пустая строка, если тегов нет
+const Column = `COALESCE((SELECT GROUP_CONCAT(tg.name ORDER BY tg.name SEPARATOR ',')
+	FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tt.tx_id = t.id), '')`
+
+// Execer — *sql.DB или *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Parse разбирает строку тегов через запятую: пробелы по краям отбрасываются,
+// пустые и повторяющиеся теги пропускаются, порядок сохраняется
+func Parse(s string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// CheckName проверяет имя тега, заданное отдельно от списка (переименование)
+func CheckName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("Укажите имя тега")
+	case strings.Contains(name, ","):
+		return errors.New("Имя тега не может содержать запятую")
+	case len([]rune(name)) > MaxNameLength:
+		return fmt.Errorf("Имя тега длиннее %d символов", MaxNameLength)
+	}
+	return nil
+}
+
+// Ensure возвращает id тега пользователя, создавая тег при первом упоминании.
+// Имена сравниваются без учёта регистра (collation таблицы).
+func Ensure(db Execer, userID int64, name string) (int64, error) {
+	if err := CheckName(name); err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec("INSERT IGNORE INTO tags (user_id, name) VALUES (?, ?)", userID, name); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := db.QueryRow("SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&id)
+	return id, err
+}
+
+// Set заменяет теги транзакции txID списком names, недостающие теги создаются
+func Set(db Execer, userID, txID int64, names []string) error {
+	if _, err := db.Exec("DELETE FROM transaction_tags WHERE tx_id = ?", txID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		tagID, err := Ensure(db, userID, name)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec("INSERT IGNORE INTO transaction_tags (tx_id, tag_id) VALUES (?, ?)", txID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
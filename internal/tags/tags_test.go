@@ -0,0 +1,36 @@
+package tags
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"car", []string{"car"}},
+		{" еда , кафе,еда,Кафе ", []string{"еда", "кафе"}},
+		{"carsharing,car", []string{"carsharing", "car"}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %q, expected %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	if err := CheckName("отпуск 2026"); err != nil {
+		t.Errorf("valid name: %v", err)
+	}
+	for _, bad := range []string{"", "a,b", strings.Repeat("я", MaxNameLength+1)} {
+		if CheckName(bad) == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}